@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+)
+
+// CheckLoopbackBind returns an error unless addr, a host:port, is only
+// reachable from this machine. Proxies and DNS servers into private networks
+// don't authenticate their clients, so listening anywhere else would open the
+// network to everyone who can reach the address.
+func CheckLoopbackBind(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid bind address %q: %w", addr, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("bind address %s isn't a loopback address like 127.0.0.1 or [::1]; private networks are only reachable from this machine", addr)
+}
@@ -248,6 +248,54 @@ func (c *Client) Ping(ctx context.Context) (res PingResponse, err error) {
 	return
 }
 
+// TunnelStatus is the health of one of the agent's tunnels
+type TunnelStatus struct {
+	Org               string
+	Network           string
+	Endpoint          string
+	LastHandshake     time.Time
+	RxBytes           int64
+	TxBytes           int64
+	ActiveConnections int64
+	ProbeLatency      time.Duration
+	Error             string
+}
+
+type StatusResponse struct {
+	PingResponse
+	Tunnels      []TunnelStatus
+	SocksProxies []SocksProxy
+	DNSServers   []DNSServer
+}
+
+// Status reports the agent's tunnels, probing each of them, along with the
+// proxies and DNS servers it runs.
+func (c *Client) Status(ctx context.Context) (res StatusResponse, err error) {
+	err = c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "status"); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case isOK(data):
+			err = unmarshal(&res, data)
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+
+	return
+}
+
 const okPrefix = "ok "
 
 func isOK(data []byte) bool {
@@ -402,6 +450,184 @@ func (c *Client) LookupTxt(ctx context.Context, slug, host string) (records []st
 
 // WaitForTunnel waits for a tunnel to the given org slug to become available
 // in the next four minutes.
+// SocksProxy is a SOCKS5 and HTTP CONNECT proxy the agent runs into an
+// organization's private network
+type SocksProxy struct {
+	Org     string `json:"org"`
+	Network string `json:"network,omitempty"`
+	Addr    string `json:"addr"`
+}
+
+// StartSocks starts a proxy into the network of the organization listening
+// on bind, returning it with the address it's bound to.
+func (c *Client) StartSocks(ctx context.Context, slug, network, bind string) (proxy SocksProxy, err error) {
+	err = c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "socksStart", slug, bind, network); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case isOK(data):
+			err = unmarshal(&proxy, data)
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+
+	return
+}
+
+// StopSocks stops the proxy listening on addr
+func (c *Client) StopSocks(ctx context.Context, addr string) error {
+	return c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "socksStop", addr); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case string(data) == "ok":
+			return
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+}
+
+// SocksProxies lists the proxies the agent runs
+func (c *Client) SocksProxies(ctx context.Context) (proxies []SocksProxy, err error) {
+	err = c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "socksList"); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case isOK(data):
+			err = unmarshal(&proxies, data)
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+
+	return
+}
+
+// DNSServer is a DNS server the agent runs for an organization's private
+// network
+type DNSServer struct {
+	Org      string `json:"org"`
+	Network  string `json:"network,omitempty"`
+	Addr     string `json:"addr"`
+	Upstream string `json:"upstream,omitempty"`
+}
+
+// StartDNS starts a DNS server for the network of the organization listening
+// on bind, over UDP and TCP. Queries for other names than private ones are
+// forwarded to upstream, or answered with NXDOMAIN when it's empty.
+func (c *Client) StartDNS(ctx context.Context, slug, network, bind, upstream string) (server DNSServer, err error) {
+	err = c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "dnsStart", slug, bind, network, upstream); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case isOK(data):
+			err = unmarshal(&server, data)
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+
+	return
+}
+
+// StopDNS stops the DNS server listening on addr
+func (c *Client) StopDNS(ctx context.Context, addr string) error {
+	return c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "dnsStop", addr); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case string(data) == "ok":
+			return
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+}
+
+// DNSServers lists the DNS servers the agent runs
+func (c *Client) DNSServers(ctx context.Context) (servers []DNSServer, err error) {
+	err = c.do(ctx, func(conn net.Conn) (err error) {
+		if err = proto.Write(conn, "dnsList"); err != nil {
+			return
+		}
+
+		var data []byte
+		if data, err = proto.Read(conn); err != nil {
+			return
+		}
+
+		switch {
+		default:
+			err = errInvalidResponse(data)
+		case isOK(data):
+			err = unmarshal(&servers, data)
+		case isError(data):
+			err = extractError(data)
+		}
+
+		return
+	})
+
+	return
+}
+
 func (c *Client) WaitForTunnel(parent context.Context, slug, network string) (err error) {
 	ctx, cancel := context.WithTimeout(parent, 4*time.Minute)
 	defer cancel()
@@ -694,10 +920,16 @@ func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn ne
 		}
 	}()
 
+	verb := "connect"
+	switch network {
+	case "udp", "udp4", "udp6":
+		verb = "connectUdp"
+	}
+
 	c := make(chan error, 1)
 	go func() {
 		timeout := strconv.FormatInt(int64(d.timeout), 10)
-		if err := proto.Write(conn, "connect", d.slug, addr, timeout, d.network); err != nil {
+		if err := proto.Write(conn, verb, d.slug, addr, timeout, d.network); err != nil {
 			c <- err
 			return
 		}
@@ -723,9 +955,35 @@ func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn ne
 		err = ctx.Err()
 	case err = <-c:
 	}
+	if err == nil && verb == "connectUdp" {
+		conn = &datagramConn{Conn: conn}
+	}
 	return
 }
 
+// datagramConn carries UDP datagrams over a connection to the agent, each
+// prefixed with its length so their boundaries survive the stream.
+type datagramConn struct {
+	net.Conn
+}
+
+// Read reads a single datagram, discarding whatever doesn't fit in b.
+func (c *datagramConn) Read(b []byte) (int, error) {
+	data, err := proto.Read(c.Conn)
+	if err != nil {
+		return 0, err
+	}
+	return copy(b, data), nil
+}
+
+// Write sends b as a single datagram.
+func (c *datagramConn) Write(b []byte) (int, error) {
+	if err := proto.WriteDatagram(c.Conn, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
 // Pinger wraps a connection to the flyctl agent over which ICMP
 // requests and replies are written. There's a simple protocol
 // for encapsulating requests and responses; drive it with the Pinger
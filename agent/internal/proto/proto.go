@@ -3,7 +3,9 @@ package proto
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 )
 
 func Read(r io.Reader) (data []byte, err error) {
@@ -46,3 +48,19 @@ func Write(w io.Writer, verb string, args ...string) (err error) {
 
 	return
 }
+
+// WriteDatagram writes payload prefixed with its length, as Read expects, in a
+// single write so datagrams relayed over a stream connection stay whole.
+func WriteDatagram(w io.Writer, payload []byte) (err error) {
+	if len(payload) > math.MaxUint16 {
+		return fmt.Errorf("datagram too large (%d bytes)", len(payload))
+	}
+
+	b := make([]byte, 2+len(payload))
+	binary.LittleEndian.PutUint16(b, uint16(len(payload)))
+	copy(b[2:], payload)
+
+	_, err = w.Write(b)
+
+	return
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/agent"
+)
+
+// dnsQueryTimeout bounds how long a query is forwarded for before failing
+const dnsQueryTimeout = 10 * time.Second
+
+// dnsServer answers DNS queries on a local address, over both UDP and TCP.
+// AAAA and TXT queries for private names are forwarded to the organization's
+// DNS server through the tunnel. Other names get NXDOMAIN, or are forwarded
+// to the upstream server when there's one.
+type dnsServer struct {
+	info   agent.DNSServer
+	logger *log.Logger
+
+	query func(ctx context.Context, msg *dns.Msg) (*dns.Msg, error)
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+}
+
+// startDNS starts a DNS server for the private network of org listening on
+// bind. It runs until stopped or the agent shuts down.
+func (s *server) startDNS(org *fly.Organization, network, bind, upstream string) (agent.DNSServer, error) {
+	udp, tcp, err := listenDNS(bind)
+	if err != nil {
+		return agent.DNSServer{}, fmt.Errorf("failed binding dns server: %w", err)
+	}
+
+	d := &dnsServer{
+		info: agent.DNSServer{
+			Org:      org.Slug,
+			Network:  network,
+			Addr:     udp.LocalAddr().String(),
+			Upstream: upstream,
+		},
+		logger: s.Logger,
+		query: func(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+			tunnel, err := s.buildTunnel(ctx, org, false, network, s.GetClient(ctx))
+			if err != nil {
+				return nil, err
+			}
+			return tunnel.QueryDNS(ctx, msg)
+		},
+	}
+	d.udpConn, d.tcpListener = udp, tcp
+
+	s.mu.Lock()
+	s.dns[d.info.Addr] = d
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(s.runCtx)
+	go func() {
+		d.serve(ctx)
+		cancel()
+
+		s.mu.Lock()
+		if s.dns[d.info.Addr] == d {
+			delete(s.dns, d.info.Addr)
+		}
+		s.mu.Unlock()
+
+		s.printf("dns server %s stopped", d.info.Addr)
+	}()
+
+	s.printf("dns server %s started for %s", d.info.Addr, org.Slug)
+
+	return d.info, nil
+}
+
+// listenDNS binds UDP and TCP to the same address, which must be a loopback
+// address. When the port is 0, TCP listens on the port picked for UDP.
+func listenDNS(bind string) (net.PacketConn, net.Listener, error) {
+	if err := agent.CheckLoopbackBind(bind); err != nil {
+		return nil, nil, err
+	}
+
+	udp, err := net.ListenPacket("udp", bind)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host, _, err := net.SplitHostPort(bind)
+	if err != nil {
+		udp.Close()
+		return nil, nil, err
+	}
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+
+	tcp, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		udp.Close()
+		return nil, nil, err
+	}
+
+	return udp, tcp, nil
+}
+
+func (s *server) stopDNS(addr string) error {
+	s.mu.Lock()
+	d := s.dns[addr]
+	delete(s.dns, addr)
+	s.mu.Unlock()
+
+	if d == nil {
+		return fmt.Errorf("no dns server is listening on %s", addr)
+	}
+	d.shutdown()
+
+	return nil
+}
+
+func (s *server) listDNS() []agent.DNSServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	servers := make([]agent.DNSServer, 0, len(s.dns))
+	for _, d := range s.dns {
+		servers = append(servers, d.info)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Addr < servers[j].Addr
+	})
+	return servers
+}
+
+// serve runs until the servers are shut down or ctx is done
+func (d *dnsServer) serve(ctx context.Context) {
+	done := make(chan struct{}, 2)
+	servers := []*dns.Server{
+		{PacketConn: d.udpConn, Handler: d},
+		{Listener: d.tcpListener, Handler: d},
+	}
+	for _, srv := range servers {
+		srv := srv
+		go func() {
+			if err := srv.ActivateAndServe(); err != nil && !isClosed(err) {
+				d.logger.Printf("dns server %s: %v", d.info.Addr, err)
+			}
+			done <- struct{}{}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		d.shutdown()
+		<-done
+	case <-done:
+		d.shutdown()
+	}
+	<-done
+}
+
+// shutdown closes the listeners, which stops the servers whether or not
+// they've started yet
+func (d *dnsServer) shutdown() {
+	_ = d.udpConn.Close()
+	_ = d.tcpListener.Close()
+}
+
+func (d *dnsServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsQueryTimeout)
+	defer cancel()
+
+	res := d.answer(ctx, req)
+
+	// Replies over UDP must fit what the client accepts
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		res.Truncate(size)
+	}
+
+	if err := w.WriteMsg(res); err != nil {
+		d.logger.Printf("dns server %s: failed replying: %v", d.info.Addr, err)
+	}
+}
+
+func (d *dnsServer) answer(ctx context.Context, req *dns.Msg) *dns.Msg {
+	res := new(dns.Msg)
+
+	if req.Opcode != dns.OpcodeQuery || len(req.Question) != 1 {
+		return res.SetRcode(req, dns.RcodeNotImplemented)
+	}
+	q := req.Question[0]
+
+	if !isPrivateName(q.Name) {
+		if d.info.Upstream == "" {
+			return res.SetRcode(req, dns.RcodeNameError)
+		}
+
+		upstream, _, err := (&dns.Client{}).ExchangeContext(ctx, req, d.info.Upstream)
+		if err != nil {
+			d.logger.Printf("dns server %s: forwarding %s: %v", d.info.Addr, q.Name, err)
+			return res.SetRcode(req, dns.RcodeServerFailure)
+		}
+		return upstream
+	}
+
+	res.SetReply(req)
+	res.RecursionAvailable = true
+
+	switch q.Qtype {
+	case dns.TypeAAAA, dns.TypeTXT:
+	default:
+		// Private names only have AAAA and TXT records, so clients asking
+		// for anything else get no records rather than waiting on the tunnel
+		return res
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion(q.Name, q.Qtype)
+
+	tunneled, err := d.query(ctx, query)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			d.logger.Printf("dns server %s: querying %s: %v", d.info.Addr, q.Name, err)
+		}
+		return res.SetRcode(req, dns.RcodeServerFailure)
+	}
+
+	res.Rcode = tunneled.Rcode
+	res.Answer = tunneled.Answer
+	res.Ns = tunneled.Ns
+	return res
+}
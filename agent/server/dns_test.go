@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDNSServer runs a DNS server whose private network knows my-app.internal
+func testDNSServer(t *testing.T, upstream string) string {
+	udp, tcp, err := listenDNS("127.0.0.1:0")
+	require.NoError(t, err)
+
+	d := &dnsServer{
+		logger:      log.New(io.Discard, "", 0),
+		udpConn:     udp,
+		tcpListener: tcp,
+		query: func(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+			res := new(dns.Msg)
+			res.SetReply(msg)
+			q := msg.Question[0]
+			if q.Name != "my-app.internal." {
+				res.Rcode = dns.RcodeNameError
+				return res, nil
+			}
+
+			switch q.Qtype {
+			case dns.TypeAAAA:
+				rr, _ := dns.NewRR("my-app.internal. 5 IN AAAA fdaa::1")
+				res.Answer = append(res.Answer, rr)
+			case dns.TypeTXT:
+				// Enough records not to fit a plain UDP reply
+				for i := 0; i < 20; i++ {
+					rr, _ := dns.NewRR(`my-app.internal. 5 IN TXT "` + strings.Repeat("x", 50) + `"`)
+					res.Answer = append(res.Answer, rr)
+				}
+			}
+			return res, nil
+		},
+	}
+	d.info.Addr = udp.LocalAddr().String()
+	d.info.Upstream = upstream
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.serve(ctx)
+
+	return d.info.Addr
+}
+
+func exchange(t *testing.T, network, addr, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	res, _, err := (&dns.Client{Net: network}).Exchange(msg, addr)
+	require.NoError(t, err)
+	return res
+}
+
+func TestDNSServer(t *testing.T) {
+	addr := testDNSServer(t, "")
+
+	for _, network := range []string{"udp", "tcp"} {
+		res := exchange(t, network, addr, "my-app.internal.", dns.TypeAAAA)
+		assert.Equal(t, dns.RcodeSuccess, res.Rcode, network)
+		require.Len(t, res.Answer, 1, network)
+		assert.Equal(t, "fdaa::1", res.Answer[0].(*dns.AAAA).AAAA.String())
+	}
+
+	res := exchange(t, "udp", addr, "missing.internal.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+
+	// No A records on the private network
+	res = exchange(t, "udp", addr, "my-app.internal.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+	assert.Empty(t, res.Answer)
+
+	// Large replies are truncated over UDP, for the client to retry over TCP
+	res = exchange(t, "udp", addr, "my-app.internal.", dns.TypeTXT)
+	assert.True(t, res.Truncated)
+	res = exchange(t, "tcp", addr, "my-app.internal.", dns.TypeTXT)
+	assert.False(t, res.Truncated)
+	assert.Len(t, res.Answer, 20)
+
+	// Public names aren't resolved without an upstream
+	res = exchange(t, "udp", addr, "example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, res.Rcode)
+}
+
+func TestDNSServerUpstream(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	upstream := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		res := new(dns.Msg)
+		res.SetReply(req)
+		rr, _ := dns.NewRR("example.com. 60 IN A 192.0.2.1")
+		res.Answer = append(res.Answer, rr)
+		w.WriteMsg(res)
+	})}
+	go upstream.ActivateAndServe()
+	t.Cleanup(func() { conn.Close() })
+
+	addr := testDNSServer(t, conn.LocalAddr().String())
+
+	res := exchange(t, "udp", addr, "example.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, res.Rcode)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "192.0.2.1", res.Answer[0].(*dns.A).A.String())
+
+	// Private names still go through the tunnel
+	res = exchange(t, "udp", addr, "my-app.internal.", dns.TypeAAAA)
+	require.Len(t, res.Answer, 1)
+	assert.Equal(t, "fdaa::1", res.Answer[0].(*dns.AAAA).AAAA.String())
+}
+
+func TestListenDNSLoopbackOnly(t *testing.T) {
+	for _, bind := range []string{"0.0.0.0:5353", ":5353", "[::]:5353", "10.0.0.1:5353"} {
+		_, _, err := listenDNS(bind)
+		assert.ErrorContains(t, err, "isn't a loopback address", bind)
+	}
+}
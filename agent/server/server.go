@@ -31,6 +31,9 @@ type Options struct {
 	Background       bool
 	ConfigFile       string
 	ConfigWebsockets bool
+	// MetricsAddr, when set, is where status is served in the Prometheus
+	// text format
+	MetricsAddr string
 }
 
 func Run(ctx context.Context, opt Options) (err error) {
@@ -62,6 +65,9 @@ func Run(ctx context.Context, opt Options) (err error) {
 		runCtx:                ctx,
 		currentChange:         latestChangeAt,
 		tunnels:               make(map[tunnelKey]*wg.Tunnel),
+		socks:                 make(map[string]*socksProxy),
+		dns:                   make(map[string]*dnsServer),
+		conns:                 make(map[tunnelKey]int64),
 		tokens:                toks,
 		cancelTokenMonitoring: cancelMonitor,
 	}).serve(ctx, l)
@@ -124,8 +130,13 @@ type server struct {
 	mu                    sync.Mutex
 	currentChange         time.Time
 	tunnels               map[tunnelKey]*wg.Tunnel
+	socks                 map[string]*socksProxy
+	dns                   map[string]*dnsServer
 	tokens                *tokens.Tokens
 	cancelTokenMonitoring func()
+
+	connsMu sync.Mutex
+	conns   map[tunnelKey]int64
 }
 
 type terminateError struct{ error }
@@ -153,6 +164,14 @@ func (s *server) serve(parent context.Context, l net.Listener) (err error) {
 		return nil
 	})
 
+	if s.MetricsAddr != "" {
+		eg.Go(func() error {
+			s.serveMetrics(ctx)
+
+			return nil
+		})
+	}
+
 	eg.Go(func() (err error) {
 		s.printf("OK %d", os.Getpid())
 		defer s.print("QUIT")
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"os"
 	"regexp"
@@ -110,12 +111,16 @@ func (s *session) runCommand(ctx context.Context) {
 		handler = (*session).kill
 	case "ping":
 		handler = (*session).ping
+	case "status":
+		handler = (*session).status
 	case "establish":
 		handler = (*session).establish
 	case "reestablish":
 		handler = (*session).reestablish
 	case "connect":
 		handler = (*session).connect
+	case "connectUdp":
+		handler = (*session).connectUdp
 	case "probe":
 		handler = (*session).probe
 	case "instances":
@@ -128,6 +133,18 @@ func (s *session) runCommand(ctx context.Context) {
 		handler = (*session).ping6
 	case "set-token":
 		handler = (*session).setToken
+	case "socksStart":
+		handler = (*session).socksStart
+	case "socksStop":
+		handler = (*session).socksStop
+	case "socksList":
+		handler = (*session).socksList
+	case "dnsStart":
+		handler = (*session).dnsStart
+	case "dnsStop":
+		handler = (*session).dnsStop
+	case "dnsList":
+		handler = (*session).dnsList
 	default:
 		s.error(errUnsupportedCommand)
 		return
@@ -162,6 +179,16 @@ func (s *session) ping(_ context.Context, args ...string) {
 	})
 }
 
+var errMalformedStatus = errors.New("malformed status command")
+
+func (s *session) status(ctx context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedStatus) {
+		return
+	}
+
+	_ = s.marshal(s.srv.status(ctx))
+}
+
 var errMalformedEstablish = errors.New("malformed establish command")
 
 func (s *session) doEstablish(ctx context.Context, recycle bool, args ...string) {
@@ -363,23 +390,25 @@ var (
 	errDone             = errors.New("done")
 )
 
-func (s *session) connect(ctx context.Context, args ...string) {
+// dialTunnel dials addr over the tunnel named by the arguments shared by
+// connect and connectUdp, reporting any error to the client.
+func (s *session) dialTunnel(ctx context.Context, network string, args []string) net.Conn {
 	if !s.exactArgs(4, args, errMalformedConnect) {
-		return
+		return nil
 	}
 
 	timeout, err := strconv.ParseUint(args[2], 10, 32)
 	if err != nil {
 		s.error(err)
 
-		return
+		return nil
 	}
 
 	tunnel := s.srv.tunnelFor(args[0], args[3])
 	if tunnel == nil {
 		s.error(agent.ErrTunnelUnavailable)
 
-		return
+		return nil
 	}
 
 	var dialContext context.Context
@@ -391,10 +420,19 @@ func (s *session) connect(ctx context.Context, args ...string) {
 	}
 	defer cancel()
 
-	outconn, err := tunnel.DialContext(dialContext, "tcp", args[1])
+	outconn, err := tunnel.DialContext(dialContext, network, args[1])
 	if err != nil {
 		s.error(err)
 
+		return nil
+	}
+
+	return s.srv.trackConn(tunnelKey{orgSlug: args[0], networkName: args[3]}, outconn)
+}
+
+func (s *session) connect(ctx context.Context, args ...string) {
+	outconn := s.dialTunnel(ctx, "tcp", args)
+	if outconn == nil {
 		return
 	}
 	defer func() {
@@ -437,6 +475,62 @@ func (s *session) connect(ctx context.Context, args ...string) {
 	_ = eg.Wait()
 }
 
+// connectUdp is connect for UDP: datagrams from the client arrive over the
+// agent connection prefixed with their length and are relayed the same way.
+func (s *session) connectUdp(ctx context.Context, args ...string) {
+	outconn := s.dialTunnel(ctx, "udp", args)
+	if outconn == nil {
+		return
+	}
+	defer func() {
+		if err := outconn.Close(); err != nil && !isClosed(err) {
+			s.logger.Printf("failed closing outconn: %v", err)
+		}
+	}()
+
+	if !s.ok() {
+		return
+	}
+
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		_ = s.conn.Close()
+		_ = outconn.Close()
+
+		return errDone
+	})
+
+	eg.Go(func() error {
+		buf := make([]byte, math.MaxUint16)
+		for {
+			n, err := outconn.Read(buf)
+			if err != nil {
+				return err
+			}
+			if err := proto.WriteDatagram(s.conn, buf[:n]); err != nil {
+				return err
+			}
+		}
+	})
+
+	eg.Go(func() error {
+		for {
+			data, err := proto.Read(s.conn)
+			if err != nil {
+				return err
+			}
+			if _, err := outconn.Write(data); err != nil {
+				return err
+			}
+		}
+	})
+
+	_ = eg.Wait()
+}
+
 func (s *session) ping6(ctx context.Context, args ...string) {
 	// As with "dial", "ping6" handles an agent command and then
 	// repurposes the agent connection as a transport.
@@ -549,6 +643,122 @@ func (s *session) ping6(ctx context.Context, args ...string) {
 	}
 }
 
+var errMalformedSocksStart = errors.New("malformed socksStart command")
+
+// socksStart starts a SOCKS5 and HTTP CONNECT proxy into an organization's
+// private network, building its tunnel first so errors are reported early.
+func (s *session) socksStart(ctx context.Context, args ...string) {
+	if !s.exactArgs(3, args, errMalformedSocksStart) {
+		return
+	}
+
+	org, err := s.fetchOrg(ctx, args[0])
+	if err != nil {
+		s.error(err)
+
+		return
+	}
+
+	if _, err := s.srv.buildTunnel(ctx, org, false, args[2], s.getClient(ctx)); err != nil {
+		s.error(err)
+
+		return
+	}
+
+	info, err := s.srv.startSocks(org, args[2], args[1])
+	if err != nil {
+		s.error(err)
+
+		return
+	}
+
+	_ = s.marshal(info)
+}
+
+var errMalformedSocksStop = errors.New("malformed socksStop command")
+
+func (s *session) socksStop(_ context.Context, args ...string) {
+	if !s.exactArgs(1, args, errMalformedSocksStop) {
+		return
+	}
+
+	if err := s.srv.stopSocks(args[0]); err != nil {
+		s.error(err)
+
+		return
+	}
+
+	_ = s.ok()
+}
+
+var errMalformedSocksList = errors.New("malformed socksList command")
+
+func (s *session) socksList(_ context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedSocksList) {
+		return
+	}
+
+	_ = s.marshal(s.srv.listSocks())
+}
+
+var errMalformedDNSStart = errors.New("malformed dnsStart command")
+
+// dnsStart starts a DNS server for an organization's private network,
+// building its tunnel first so errors are reported early.
+func (s *session) dnsStart(ctx context.Context, args ...string) {
+	if !s.exactArgs(4, args, errMalformedDNSStart) {
+		return
+	}
+
+	org, err := s.fetchOrg(ctx, args[0])
+	if err != nil {
+		s.error(err)
+
+		return
+	}
+
+	if _, err := s.srv.buildTunnel(ctx, org, false, args[2], s.getClient(ctx)); err != nil {
+		s.error(err)
+
+		return
+	}
+
+	info, err := s.srv.startDNS(org, args[2], args[1], args[3])
+	if err != nil {
+		s.error(err)
+
+		return
+	}
+
+	_ = s.marshal(info)
+}
+
+var errMalformedDNSStop = errors.New("malformed dnsStop command")
+
+func (s *session) dnsStop(_ context.Context, args ...string) {
+	if !s.exactArgs(1, args, errMalformedDNSStop) {
+		return
+	}
+
+	if err := s.srv.stopDNS(args[0]); err != nil {
+		s.error(err)
+
+		return
+	}
+
+	_ = s.ok()
+}
+
+var errMalformedDNSList = errors.New("malformed dnsList command")
+
+func (s *session) dnsList(_ context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedDNSList) {
+		return
+	}
+
+	_ = s.marshal(s.srv.listDNS())
+}
+
 var errMalformedSetToken = errors.New("malformed set-token command")
 
 // setToken instructs the agent which tokens to use for API calls.
@@ -0,0 +1,417 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/wg"
+)
+
+// SOCKS5, as described in RFC 1928
+const (
+	socksVersion = 0x05
+
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+
+	socksConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksSucceeded          = 0x00
+	socksGeneralFailure     = 0x01
+	socksNotAllowed         = 0x02
+	socksHostUnreachable    = 0x04
+	socksConnectionRefused  = 0x05
+	socksCommandUnsupported = 0x07
+	socksAddrUnsupported    = 0x08
+)
+
+// socksHandshakeTimeout bounds how long a client takes to say where it
+// wants to connect
+const socksHandshakeTimeout = 30 * time.Second
+
+var errNotPrivate = errors.New("only .internal and .flycast names and private IPv6 addresses are reachable")
+
+// socksProxy accepts SOCKS5 and HTTP CONNECT proxy connections on a local
+// address and connects them to hosts on an organization's private network.
+type socksProxy struct {
+	info     agent.SocksProxy
+	listener net.Listener
+	logger   *log.Logger
+
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+	lookup func(ctx context.Context, host string) ([]net.IP, error)
+	cancel context.CancelFunc
+}
+
+// startSocks starts a proxy to the private network of org listening on bind,
+// which must be a loopback address. It runs until stopped or the agent shuts
+// down, building the tunnel again whenever it's been closed in the meantime.
+func (s *server) startSocks(org *fly.Organization, network, bind string) (agent.SocksProxy, error) {
+	if err := agent.CheckLoopbackBind(bind); err != nil {
+		return agent.SocksProxy{}, err
+	}
+
+	l, err := net.Listen("tcp", bind)
+	if err != nil {
+		return agent.SocksProxy{}, fmt.Errorf("failed binding proxy: %w", err)
+	}
+
+	tunnelNetwork := network
+	tunnel := func(ctx context.Context) (*wg.Tunnel, error) {
+		return s.buildTunnel(ctx, org, false, network, s.GetClient(ctx))
+	}
+
+	ctx, cancel := context.WithCancel(s.runCtx)
+	p := &socksProxy{
+		info:     agent.SocksProxy{Org: org.Slug, Network: network, Addr: l.Addr().String()},
+		listener: l,
+		logger:   s.Logger,
+		dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			t, err := tunnel(ctx)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := t.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return s.trackConn(tunnelKey{orgSlug: org.Slug, networkName: tunnelNetwork}, conn), nil
+		},
+		lookup: func(ctx context.Context, host string) ([]net.IP, error) {
+			t, err := tunnel(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return t.Resolver().LookupIP(ctx, "ip6", host)
+		},
+		cancel: cancel,
+	}
+
+	s.mu.Lock()
+	s.socks[p.info.Addr] = p
+	s.mu.Unlock()
+
+	go func() {
+		p.serve(ctx)
+
+		s.mu.Lock()
+		if s.socks[p.info.Addr] == p {
+			delete(s.socks, p.info.Addr)
+		}
+		s.mu.Unlock()
+
+		s.printf("proxy %s stopped", p.info.Addr)
+	}()
+
+	s.printf("proxy %s started for %s", p.info.Addr, org.Slug)
+
+	return p.info, nil
+}
+
+func (s *server) stopSocks(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.socks[addr]
+	if p == nil {
+		return fmt.Errorf("no proxy is listening on %s", addr)
+	}
+	delete(s.socks, addr)
+	p.cancel()
+
+	return nil
+}
+
+func (s *server) listSocks() []agent.SocksProxy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	proxies := make([]agent.SocksProxy, 0, len(s.socks))
+	for _, p := range s.socks {
+		proxies = append(proxies, p.info)
+	}
+	sort.Slice(proxies, func(i, j int) bool {
+		return proxies[i].Addr < proxies[j].Addr
+	})
+	return proxies
+}
+
+func (p *socksProxy) serve(ctx context.Context) {
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	go func() {
+		<-ctx.Done()
+		_ = p.listener.Close()
+	}()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if !isClosed(err) {
+				p.logger.Printf("proxy %s: failed accepting: %v", p.info.Addr, err)
+			}
+			return
+		}
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			defer conn.Close()
+
+			p.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle tells SOCKS5 clients, which start with the protocol version, from
+// HTTP ones and connects them where they ask.
+func (p *socksProxy) handle(ctx context.Context, conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	br := bufio.NewReader(conn)
+	first, err := br.Peek(1)
+	if err != nil {
+		return
+	}
+
+	var (
+		target net.Conn
+		addr   string
+	)
+	if first[0] == socksVersion {
+		target, addr, err = p.handshakeSOCKS(ctx, conn, br)
+	} else {
+		target, addr, err = p.handshakeHTTP(ctx, conn, br)
+	}
+	if err != nil {
+		p.logger.Printf("proxy %s: %v", p.info.Addr, err)
+		return
+	}
+	defer target.Close()
+
+	_ = conn.SetDeadline(time.Time{})
+	p.logger.Printf("proxy %s: connected %s to %s", p.info.Addr, conn.RemoteAddr(), addr)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// What the client sent along with the handshake is still buffered
+		_, _ = io.Copy(target, br)
+		if cw, ok := target.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, target)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+		<-done
+	case <-ctx.Done():
+	}
+}
+
+func (p *socksProxy) handshakeSOCKS(ctx context.Context, conn net.Conn, br *bufio.Reader) (net.Conn, string, error) {
+	// Greeting: version, number of auth methods, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, "", err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return nil, "", err
+	}
+	if bytes.IndexByte(methods, socksNoAuth) < 0 {
+		_, _ = conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return nil, "", errors.New("socks client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return nil, "", err
+	}
+
+	// Request: version, command, reserved, address type, address, port
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(br, request); err != nil {
+		return nil, "", err
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return nil, "", err
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length, err := br.ReadByte()
+		if err != nil {
+			return nil, "", err
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, "", err
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddrUnsupported)
+		return nil, "", fmt.Errorf("unsupported socks address type %d", request[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(br, portBytes); err != nil {
+		return nil, "", err
+	}
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(portBytes)))
+
+	if request[1] != socksConnect {
+		socksReply(conn, socksCommandUnsupported)
+		return nil, "", fmt.Errorf("unsupported socks command %d", request[1])
+	}
+
+	target, addr, err := p.connect(ctx, host, port)
+	if err != nil {
+		socksReply(conn, socksErrorCode(err))
+		return nil, "", err
+	}
+	if !socksReply(conn, socksSucceeded) {
+		target.Close()
+		return nil, "", errors.New("failed replying to socks client")
+	}
+	return target, addr, nil
+}
+
+// socksReply answers a SOCKS5 request. The bound address is left empty since
+// it's on the other side of the tunnel.
+func socksReply(conn net.Conn, code byte) bool {
+	_, err := conn.Write([]byte{socksVersion, code, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err == nil
+}
+
+func socksErrorCode(err error) byte {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, errNotPrivate):
+		return socksNotAllowed
+	case errors.Is(err, agent.ErrNoSuchHost), errors.As(err, &dnsErr):
+		return socksHostUnreachable
+	case errors.Is(err, agent.ErrTunnelUnavailable):
+		return socksGeneralFailure
+	default:
+		return socksConnectionRefused
+	}
+}
+
+func (p *socksProxy) handshakeHTTP(ctx context.Context, conn net.Conn, br *bufio.Reader) (net.Conn, string, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, "", err
+	}
+
+	reply := func(status int, msg string) {
+		fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+			status, http.StatusText(status), len(msg), msg)
+	}
+
+	if req.Method != http.MethodConnect {
+		reply(http.StatusMethodNotAllowed, "only CONNECT is supported\n")
+		return nil, "", fmt.Errorf("unsupported http method %s", req.Method)
+	}
+
+	host, port, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		reply(http.StatusBadRequest, err.Error()+"\n")
+		return nil, "", err
+	}
+
+	target, addr, err := p.connect(ctx, host, port)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errNotPrivate) {
+			status = http.StatusForbidden
+		}
+		reply(status, err.Error()+"\n")
+		return nil, "", err
+	}
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		target.Close()
+		return nil, "", err
+	}
+	return target, addr, nil
+}
+
+// connect resolves host and dials it through the tunnel. Only names on the
+// private network and private IPv6 addresses are accepted, as nothing else
+// is reachable through it.
+func (p *socksProxy) connect(ctx context.Context, host, port string) (net.Conn, string, error) {
+	addr, err := p.resolveTarget(ctx, host, port)
+	if err != nil {
+		return nil, "", fmt.Errorf("resolve %s: %w", host, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, socksHandshakeTimeout)
+	defer cancel()
+
+	conn, err := p.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("dial %s: %w", addr, err)
+	}
+	return conn, addr, nil
+}
+
+func (p *socksProxy) resolveTarget(ctx context.Context, host, port string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil || !ip.IsPrivate() {
+			return "", errNotPrivate
+		}
+		return net.JoinHostPort(ip.String(), port), nil
+	}
+
+	if !isPrivateName(host) {
+		return "", errNotPrivate
+	}
+
+	ips, err := p.lookup(ctx, strings.TrimSuffix(host, "."))
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", agent.ErrNoSuchHost
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// isPrivateName tells whether name is resolved by the private network's DNS
+func isPrivateName(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	return strings.HasSuffix(name, ".internal") || strings.HasSuffix(name, ".flycast")
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+
+	"github.com/superfly/flyctl/agent"
+)
+
+// testSocksProxy runs a proxy resolving my-app.internal to fdaa::1 and
+// dialing every address to a local echo server.
+func testSocksProxy(t *testing.T) (addr string, dialed chan string) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { echo.Close() })
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	dialed = make(chan string, 10)
+	p := &socksProxy{
+		info:     agent.SocksProxy{Org: "personal", Addr: l.Addr().String()},
+		listener: l,
+		logger:   log.New(io.Discard, "", 0),
+		dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed <- addr
+			return (&net.Dialer{}).DialContext(ctx, network, echo.Addr().String())
+		},
+		lookup: func(ctx context.Context, host string) ([]net.IP, error) {
+			if host == "my-app.internal" {
+				return []net.IP{net.ParseIP("fdaa::1")}, nil
+			}
+			return nil, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go p.serve(ctx)
+
+	return l.Addr().String(), dialed
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err := conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestSocksProxySOCKS5(t *testing.T) {
+	addr, dialed := testSocksProxy(t)
+
+	dialer, err := proxy.SOCKS5("tcp", addr, nil, proxy.Direct)
+	require.NoError(t, err)
+
+	conn, err := dialer.Dial("tcp", "my-app.internal:5432")
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "[fdaa::1]:5432", <-dialed)
+	assertEcho(t, conn)
+
+	conn, err = dialer.Dial("tcp", "[fdaa::2]:80")
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "[fdaa::2]:80", <-dialed)
+	assertEcho(t, conn)
+
+	// Nothing outside the private network is reachable
+	for _, target := range []string{"example.com:443", "1.1.1.1:53", "[2606:4700::1111]:53"} {
+		_, err = dialer.Dial("tcp", target)
+		assert.ErrorContains(t, err, "not allowed", target)
+	}
+
+	_, err = dialer.Dial("tcp", "missing.internal:80")
+	assert.ErrorContains(t, err, "host unreachable")
+}
+
+func TestSocksProxyHTTPConnect(t *testing.T) {
+	addr, dialed := testSocksProxy(t)
+
+	connect := func(target string) (net.Conn, *http.Response) {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		return conn, res
+	}
+
+	conn, res := connect("my-app.internal:8080")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "[fdaa::1]:8080", <-dialed)
+	assertEcho(t, conn)
+
+	_, res = connect("example.com:443")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET http://my-app.internal/ HTTP/1.1\r\nHost: my-app.internal\r\n\r\n")
+	res, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestStartSocksLoopbackOnly(t *testing.T) {
+	s := &server{}
+
+	for _, bind := range []string{"0.0.0.0:1080", ":1080", "[::]:1080", "192.168.1.10:1080", "example.com:1080", "127.0.0.1"} {
+		_, err := s.startSocks(nil, "", bind)
+		assert.Error(t, err, bind)
+	}
+
+	for _, bind := range []string{"127.0.0.1:1080", "127.0.0.2:1080", "[::1]:1080", "localhost:1080"} {
+		assert.NoError(t, agent.CheckLoopbackBind(bind), bind)
+	}
+}
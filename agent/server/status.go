@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/internal/buildinfo"
+	"github.com/superfly/flyctl/wg"
+)
+
+// statusProbeTimeout bounds how long each tunnel is probed for when
+// reporting status
+const statusProbeTimeout = 5 * time.Second
+
+// trackConn counts conn as one of the active connections of the tunnel
+// named by tk until it's closed
+func (s *server) trackConn(tk tunnelKey, conn net.Conn) net.Conn {
+	s.connsMu.Lock()
+	s.conns[tk]++
+	s.connsMu.Unlock()
+
+	return &trackedConn{
+		Conn: conn,
+		done: func() {
+			s.connsMu.Lock()
+			defer s.connsMu.Unlock()
+
+			if s.conns[tk]--; s.conns[tk] <= 0 {
+				delete(s.conns, tk)
+			}
+		},
+	}
+}
+
+func (s *server) activeConns(tk tunnelKey) int64 {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	return s.conns[tk]
+}
+
+type trackedConn struct {
+	net.Conn
+	once sync.Once
+	done func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.done)
+	return c.Conn.Close()
+}
+
+func (c *trackedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// status reports the state of every tunnel, probing them all at once, along
+// with the proxies and DNS servers the agent runs.
+func (s *server) status(ctx context.Context) agent.StatusResponse {
+	s.mu.Lock()
+	tunnels := make(map[tunnelKey]*wg.Tunnel, len(s.tunnels))
+	keys := make([]tunnelKey, 0, len(s.tunnels))
+	for tk, tunnel := range s.tunnels {
+		tunnels[tk] = tunnel
+		keys = append(keys, tk)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].orgSlug != keys[j].orgSlug {
+			return keys[i].orgSlug < keys[j].orgSlug
+		}
+		return keys[i].networkName < keys[j].networkName
+	})
+
+	statuses := make([]agent.TunnelStatus, len(keys))
+
+	var probes sync.WaitGroup
+	for i, tk := range keys {
+		i, tk := i, tk
+
+		probes.Add(1)
+		go func() {
+			defer probes.Done()
+
+			tunnel := tunnels[tk]
+			stats, err := tunnel.Stats()
+			status := agent.TunnelStatus{
+				Org:               tk.orgSlug,
+				Network:           tk.networkName,
+				Endpoint:          stats.Endpoint,
+				LastHandshake:     stats.LastHandshake,
+				RxBytes:           stats.RxBytes,
+				TxBytes:           stats.TxBytes,
+				ActiveConnections: s.activeConns(tk),
+			}
+			if err != nil {
+				status.Error = err.Error()
+				statuses[i] = status
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, statusProbeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			if _, err := tunnel.LookupAAAA(ctx, "_api.internal"); err != nil {
+				status.Error = fmt.Sprintf("probe failed: %v", err)
+			} else {
+				status.ProbeLatency = time.Since(start)
+			}
+			statuses[i] = status
+		}()
+	}
+	probes.Wait()
+
+	return agent.StatusResponse{
+		PingResponse: agent.PingResponse{
+			PID:        os.Getpid(),
+			Version:    buildinfo.Version().String(),
+			Background: s.Options.Background,
+		},
+		Tunnels:      statuses,
+		SocksProxies: s.listSocks(),
+		DNSServers:   s.listDNS(),
+	}
+}
+
+// serveMetrics serves the status in the Prometheus text format on
+// MetricsAddr, which must be a loopback address, until ctx is done. Failing
+// to bind only gets logged, since the agent is still of use without metrics.
+func (s *server) serveMetrics(ctx context.Context) {
+	if err := agent.CheckLoopbackBind(s.MetricsAddr); err != nil {
+		s.printf("not serving metrics: %v", err)
+
+		return
+	}
+
+	l, err := net.Listen("tcp", s.MetricsAddr)
+	if err != nil {
+		s.printf("failed binding metrics endpoint: %v", err)
+
+		return
+	}
+
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(s.handleMetrics),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	s.printf("serving metrics on http://%s/metrics", l.Addr())
+
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		s.printf("failed serving metrics: %v", err)
+	}
+}
+
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, s.status(r.Context()))
+}
+
+// writeMetrics writes status in the Prometheus text exposition format
+func writeMetrics(w io.Writer, status agent.StatusResponse) {
+	metric := func(name, kind, help string, values func(emit func(labels string, value float64))) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		values(func(labels string, value float64) {
+			fmt.Fprintf(w, "%s%s %g\n", name, labels, value)
+		})
+	}
+	perTunnel := func(value func(agent.TunnelStatus) (float64, bool)) func(func(string, float64)) {
+		return func(emit func(string, float64)) {
+			for _, t := range status.Tunnels {
+				if v, ok := value(t); ok {
+					emit(fmt.Sprintf(`{org="%s",network="%s"}`, escapeLabel(t.Org), escapeLabel(t.Network)), v)
+				}
+			}
+		}
+	}
+
+	metric("fly_agent_info", "gauge", "Version of the running agent.", func(emit func(string, float64)) {
+		emit(fmt.Sprintf(`{version="%s"}`, escapeLabel(status.Version)), 1)
+	})
+	metric("fly_agent_tunnels", "gauge", "Number of open tunnels.", func(emit func(string, float64)) {
+		emit("", float64(len(status.Tunnels)))
+	})
+	metric("fly_agent_tunnel_up", "gauge", "Whether the tunnel answered its last probe.", perTunnel(func(t agent.TunnelStatus) (float64, bool) {
+		if t.Error != "" {
+			return 0, true
+		}
+		return 1, true
+	}))
+	metric("fly_agent_tunnel_last_handshake_timestamp_seconds", "gauge", "Time of the last WireGuard handshake.", perTunnel(func(t agent.TunnelStatus) (float64, bool) {
+		return float64(t.LastHandshake.UnixNano()) / 1e9, !t.LastHandshake.IsZero()
+	}))
+	metric("fly_agent_tunnel_receive_bytes_total", "counter", "Bytes received through the tunnel.", perTunnel(func(t agent.TunnelStatus) (float64, bool) {
+		return float64(t.RxBytes), true
+	}))
+	metric("fly_agent_tunnel_transmit_bytes_total", "counter", "Bytes sent through the tunnel.", perTunnel(func(t agent.TunnelStatus) (float64, bool) {
+		return float64(t.TxBytes), true
+	}))
+	metric("fly_agent_tunnel_active_connections", "gauge", "Connections open through the tunnel.", perTunnel(func(t agent.TunnelStatus) (float64, bool) {
+		return float64(t.ActiveConnections), true
+	}))
+	metric("fly_agent_tunnel_probe_latency_seconds", "gauge", "Time the last probe of the tunnel took.", perTunnel(func(t agent.TunnelStatus) (float64, bool) {
+		return t.ProbeLatency.Seconds(), t.Error == ""
+	}))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/agent"
+)
+
+func TestTrackConn(t *testing.T) {
+	s := &server{conns: make(map[tunnelKey]int64)}
+	tk := tunnelKey{orgSlug: "personal", networkName: "default"}
+
+	a, b := net.Pipe()
+	defer b.Close()
+	c, d := net.Pipe()
+	defer d.Close()
+
+	tracked := s.trackConn(tk, a)
+	other := s.trackConn(tk, c)
+	assert.EqualValues(t, 2, s.activeConns(tk))
+
+	require.NoError(t, tracked.Close())
+	// Closing twice only counts once
+	_ = tracked.Close()
+	assert.EqualValues(t, 1, s.activeConns(tk))
+
+	require.NoError(t, other.Close())
+	assert.EqualValues(t, 0, s.activeConns(tk))
+	assert.Empty(t, s.conns)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var out strings.Builder
+	writeMetrics(&out, agent.StatusResponse{
+		PingResponse: agent.PingResponse{Version: "1.2.3"},
+		Tunnels: []agent.TunnelStatus{
+			{
+				Org:               "personal",
+				Network:           "default",
+				LastHandshake:     time.Unix(1700000000, 0),
+				RxBytes:           1024,
+				TxBytes:           2048,
+				ActiveConnections: 3,
+				ProbeLatency:      250 * time.Millisecond,
+			},
+			{
+				Org:     `we"ird`,
+				Network: "other",
+				Error:   "probe failed: timeout",
+			},
+		},
+	})
+
+	metrics := out.String()
+	for _, line := range []string{
+		`# TYPE fly_agent_info gauge`,
+		`fly_agent_info{version="1.2.3"} 1`,
+		`fly_agent_tunnels 2`,
+		`fly_agent_tunnel_up{org="personal",network="default"} 1`,
+		`fly_agent_tunnel_up{org="we\"ird",network="other"} 0`,
+		`fly_agent_tunnel_last_handshake_timestamp_seconds{org="personal",network="default"} 1.7e+09`,
+		`# TYPE fly_agent_tunnel_receive_bytes_total counter`,
+		`fly_agent_tunnel_receive_bytes_total{org="personal",network="default"} 1024`,
+		`fly_agent_tunnel_transmit_bytes_total{org="personal",network="default"} 2048`,
+		`fly_agent_tunnel_active_connections{org="personal",network="default"} 3`,
+		`fly_agent_tunnel_probe_latency_seconds{org="personal",network="default"} 0.25`,
+	} {
+		assert.Contains(t, metrics, line+"\n")
+	}
+
+	// Tunnels without a handshake or a successful probe don't report them
+	assert.NotContains(t, metrics, `fly_agent_tunnel_last_handshake_timestamp_seconds{org="we\"ird"`)
+	assert.NotContains(t, metrics, `fly_agent_tunnel_probe_latency_seconds{org="we\"ird"`)
+}
+
+func TestServeMetricsLoopbackOnly(t *testing.T) {
+	var logs strings.Builder
+	s := &server{Options: Options{Logger: log.New(&logs, "", 0), MetricsAddr: "0.0.0.0:0"}}
+
+	// Returns right away instead of serving until the context is done
+	s.serveMetrics(context.Background())
+	assert.Contains(t, logs.String(), "isn't a loopback address")
+}
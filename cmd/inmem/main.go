@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/inmem"
+)
+
+func main() {
+	var (
+		addr string
+		apps []string
+	)
+
+	rootCmd := &cobra.Command{
+		Use:   "inmem",
+		Short: "Local emulator of the Fly.io GraphQL and Machines APIs",
+		Long: `Runs an in-memory emulator of the Fly.io GraphQL and Machines APIs.
+
+Point flyctl at it with the environment variables it prints. State is lost when
+the emulator exits.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			server := inmem.NewServer()
+			for _, name := range apps {
+				server.CreateApp(&fly.App{Name: name, Organization: inmem.DefaultOrganization})
+			}
+			return serve(addr, server)
+		},
+	}
+	rootCmd.Flags().StringVar(&addr, "addr", "127.0.0.1:4280", "Address to listen on")
+	rootCmd.Flags().StringSliceVar(&apps, "app", nil, "Create an app with this name at startup. Can be repeated.")
+
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func serve(addr string, server *inmem.Server) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	baseURL := "http://" + l.Addr().String()
+	fmt.Printf("export FLY_API_BASE_URL=%s\n", baseURL)
+	fmt.Printf("export FLY_FLAPS_BASE_URL=%s\n", baseURL)
+	fmt.Printf("export FLY_API_TOKEN=inmem\n")
+
+	return http.Serve(l, server.Handler())
+}
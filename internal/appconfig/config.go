@@ -61,6 +61,7 @@ type Config struct {
 	Restart []Restart `toml:"restart,omitempty" json:"restart,omitempty"`
 
 	Compute []*Compute `toml:"vm,omitempty" json:"vm,omitempty"`
+	Scale   []*Scale   `toml:"scale,omitempty" json:"scale,omitempty"`
 
 	// Others, less important.
 	Statics []Static   `toml:"statics,omitempty" json:"statics,omitempty"`
@@ -90,6 +91,61 @@ type Deploy struct {
 	Strategy              string        `toml:"strategy,omitempty" json:"strategy,omitempty"`
 	MaxUnavailable        *float64      `toml:"max_unavailable,omitempty" json:"max_unavailable,omitempty"`
 	WaitTimeout           *fly.Duration `toml:"wait_timeout,omitempty" json:"wait_timeout,omitempty"`
+	Progressive           *Progressive  `toml:"progressive,omitempty" json:"progressive,omitempty"`
+	Hooks                 *DeployHooks  `toml:"hooks,omitempty" json:"hooks,omitempty"`
+}
+
+// Progressive tunes the "progressive" deployment strategy, which updates a growing
+// percentage of each process group and waits for the updated machines to stay
+// healthy before moving on to the next step.
+type Progressive struct {
+	Steps       []int         `toml:"steps,omitempty" json:"steps,omitempty"`
+	BakeTime    *fly.Duration `toml:"bake_time,omitempty" json:"bake_time,omitempty"`
+	MaxRestarts int           `toml:"max_restarts,omitempty" json:"max_restarts,omitempty"`
+}
+
+const (
+	DeployHookRunOnLocal   = "local"
+	DeployHookRunOnMachine = "machine"
+
+	DeployHookFailurePolicyAbort    = "abort"
+	DeployHookFailurePolicyContinue = "continue"
+)
+
+// DeployHooks are commands run, in order, at different stages of a deployment.
+type DeployHooks struct {
+	PreDeploy  []DeployHook `toml:"pre_deploy,omitempty" json:"pre_deploy,omitempty"`
+	PostDeploy []DeployHook `toml:"post_deploy,omitempty" json:"post_deploy,omitempty"`
+	OnFailure  []DeployHook `toml:"on_failure,omitempty" json:"on_failure,omitempty"`
+}
+
+// DeployHook is a single command run either on the machine running flyctl or
+// on an ephemeral machine using the image being deployed.
+type DeployHook struct {
+	Name          string        `toml:"name,omitempty" json:"name,omitempty"`
+	Command       string        `toml:"command,omitempty" json:"command,omitempty"`
+	RunOn         string        `toml:"run_on,omitempty" json:"run_on,omitempty"`
+	Timeout       *fly.Duration `toml:"timeout,omitempty" json:"timeout,omitempty"`
+	FailurePolicy string        `toml:"failure_policy,omitempty" json:"failure_policy,omitempty"`
+}
+
+// DisplayName is the hook name if it has one, otherwise its command
+func (h DeployHook) DisplayName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Command
+}
+
+// RunsLocally reports whether the hook runs on the machine running flyctl.
+// Hooks run on an ephemeral machine unless told otherwise.
+func (h DeployHook) RunsLocally() bool {
+	return h.RunOn == DeployHookRunOnLocal
+}
+
+// ContinueOnFailure reports whether the deployment carries on when the hook fails
+func (h DeployHook) ContinueOnFailure() bool {
+	return h.FailurePolicy == DeployHookFailurePolicyContinue
 }
 
 type File struct {
@@ -148,6 +204,7 @@ type Build struct {
 	Dockerfile        string            `toml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
 	Ignorefile        string            `toml:"ignorefile,omitempty" json:"ignorefile,omitempty"`
 	DockerBuildTarget string            `toml:"build-target,omitempty" json:"build-target,omitempty"`
+	Platforms         []string          `toml:"platforms,omitempty" json:"platforms,omitempty"`
 }
 
 type Experimental struct {
@@ -166,6 +223,15 @@ type Compute struct {
 	*fly.MachineGuest `toml:",inline" json:",inline"`
 	Processes         []string `json:"processes,omitempty" toml:"processes,omitempty"`
 }
+
+// Scale is how many machines a process group should have in each region.
+// `fly scale apply` converges the app's machines to it, sized as the
+// group's [[vm]] section says.
+type Scale struct {
+	Regions   map[string]int `json:"regions,omitempty" toml:"regions,omitempty"`
+	Processes []string       `json:"processes,omitempty" toml:"processes,omitempty"`
+}
+
 type Restart struct {
 	Policy     RestartPolicy `toml:"policy,omitempty" json:"policy,omitempty"`
 	MaxRetries int           `toml:"retries,omitempty" json:"retries,omitempty"`
@@ -240,6 +306,13 @@ func (c *Config) DockerBuildTarget() string {
 	return c.Build.DockerBuildTarget
 }
 
+func (c *Config) BuildPlatforms() []string {
+	if c == nil || c.Build == nil {
+		return nil
+	}
+	return c.Build.Platforms
+}
+
 func (c *Config) InternalPort() int {
 	if c.HTTPService != nil {
 		return c.HTTPService.InternalPort
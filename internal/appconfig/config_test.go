@@ -27,18 +27,21 @@ func TestConfigDockerGetters(t *testing.T) {
 			Dockerfile:        "some_dockerfile",
 			Ignorefile:        "some_ignore_file",
 			DockerBuildTarget: "some_build_target",
+			Platforms:         []string{"linux/arm64"},
 		},
 	}
 
 	assert.Equal(t, validCfg.Dockerfile(), "some_dockerfile")
 	assert.Equal(t, validCfg.Ignorefile(), "some_ignore_file")
 	assert.Equal(t, validCfg.DockerBuildTarget(), "some_build_target")
+	assert.Equal(t, validCfg.BuildPlatforms(), []string{"linux/arm64"})
 
 	var nilCfg *Config
 
 	assert.Equal(t, nilCfg.Dockerfile(), "")
 	assert.Equal(t, nilCfg.Ignorefile(), "")
 	assert.Equal(t, nilCfg.DockerBuildTarget(), "")
+	assert.Nil(t, nilCfg.BuildPlatforms())
 }
 
 func TestNilBuildStrategy(t *testing.T) {
@@ -160,6 +160,12 @@ func TestToDefinition(t *testing.T) {
 				"memory_mb": int64(4096),
 			},
 		},
+		"scale": []any{
+			map[string]any{
+				"regions":   map[string]any{"ams": int64(2), "iad": int64(1)},
+				"processes": []any{"app"},
+			},
+		},
 		"build": map[string]any{
 			"builder":      "dockerfile",
 			"image":        "foo/fighter",
@@ -167,6 +173,7 @@ func TestToDefinition(t *testing.T) {
 			"dockerfile":   "Dockerfile",
 			"ignorefile":   ".gitignore",
 			"build-target": "target",
+			"platforms":    []any{"linux/amd64", "linux/arm64"},
 			"buildpacks":   []any{"packme", "well"},
 			"settings": map[string]any{
 				"foo":   "bar",
@@ -250,6 +257,27 @@ func TestToDefinition(t *testing.T) {
 			"release_command": "release command",
 			"strategy":        "rolling-eyes",
 			"max_unavailable": 0.2,
+			"progressive": map[string]any{
+				"steps":        []any{int64(10), int64(50), int64(100)},
+				"bake_time":    "2m0s",
+				"max_restarts": int64(1),
+			},
+			"hooks": map[string]any{
+				"pre_deploy": []any{
+					map[string]any{
+						"name":    "migrate",
+						"command": "bin/migrate",
+						"timeout": "5m0s",
+					},
+				},
+				"post_deploy": []any{
+					map[string]any{
+						"command":        "make smoke-test",
+						"run_on":         "local",
+						"failure_policy": "continue",
+					},
+				},
+			},
 		},
 		"env": map[string]any{
 			"FOO": "BAR",
@@ -182,6 +182,15 @@ func (c *Config) Flatten(groupName string) (*Config, error) {
 		dst.Compute = append(dst.Compute, compute)
 	}
 
+	// [[scale]]
+	scale := dst.ScaleForGroup(groupName)
+
+	dst.Scale = nil
+	if scale != nil {
+		scale.Processes = []string{groupName}
+		dst.Scale = append(dst.Scale, scale)
+	}
+
 	return dst, nil
 }
 
@@ -208,6 +217,23 @@ func (c *Config) ComputeForGroup(groupName string) *Compute {
 	return compute
 }
 
+// ScaleForGroup finds the most specific [[scale]] section for this process
+// group, the same way ComputeForGroup does for [[vm]]. It returns nil if the
+// group's scale isn't set.
+func (c *Config) ScaleForGroup(groupName string) *Scale {
+	if groupName == "" {
+		groupName = c.DefaultProcessName()
+	}
+
+	return lo.MaxBy(
+		lo.Filter(c.Scale, func(x *Scale, _ int) bool {
+			return len(x.Processes) == 0 || c.flattenGroupsMatch(groupName, x.Processes)
+		}),
+		func(item *Scale, _ *Scale) bool {
+			return slices.Contains(item.Processes, groupName)
+		})
+}
+
 func (c *Config) InitCmd(groupName string) ([]string, error) {
 	if groupName == "" {
 		groupName = c.DefaultProcessName()
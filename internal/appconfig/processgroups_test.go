@@ -73,3 +73,24 @@ func TestProcessNames(t *testing.T) {
 		})
 	}
 }
+
+func TestScaleForGroup(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Processes = map[string]string{"web": "run web", "worker": "run worker"}
+	cfg.Scale = []*Scale{
+		{Regions: map[string]int{"iad": 1}},
+		{Regions: map[string]int{"iad": 2, "ams": 2}, Processes: []string{"web"}},
+	}
+
+	assert.Equal(t, map[string]int{"iad": 2, "ams": 2}, cfg.ScaleForGroup("web").Regions)
+	assert.Equal(t, map[string]int{"iad": 1}, cfg.ScaleForGroup("worker").Regions)
+
+	flat, err := cfg.Flatten("worker")
+	require.NoError(t, err)
+	require.Len(t, flat.Scale, 1)
+	assert.Equal(t, []string{"worker"}, flat.Scale[0].Processes)
+	assert.Equal(t, map[string]int{"iad": 1}, flat.Scale[0].Regions)
+
+	cfg.Scale = cfg.Scale[1:]
+	assert.Nil(t, cfg.ScaleForGroup("worker"))
+}
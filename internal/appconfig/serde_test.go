@@ -350,6 +350,12 @@ func TestLoadTOMLAppConfigReferenceFormat(t *testing.T) {
 				},
 			},
 		},
+		Scale: []*Scale{
+			{
+				Regions:   map[string]int{"ams": 2, "iad": 1},
+				Processes: []string{"app"},
+			},
+		},
 		Experimental: &Experimental{
 			Cmd:          []string{"cmd"},
 			Entrypoint:   []string{"entrypoint"},
@@ -374,6 +380,7 @@ func TestLoadTOMLAppConfigReferenceFormat(t *testing.T) {
 			Dockerfile:        "Dockerfile",
 			Ignorefile:        ".gitignore",
 			DockerBuildTarget: "target",
+			Platforms:         []string{"linux/amd64", "linux/arm64"},
 			Buildpacks:        []string{"packme", "well"},
 			Settings: map[string]any{
 				"foo":   "bar",
@@ -390,6 +397,23 @@ func TestLoadTOMLAppConfigReferenceFormat(t *testing.T) {
 			ReleaseCommand: "release command",
 			Strategy:       "rolling-eyes",
 			MaxUnavailable: fly.Pointer(0.2),
+			Progressive: &Progressive{
+				Steps:       []int{10, 50, 100},
+				BakeTime:    fly.MustParseDuration("2m"),
+				MaxRestarts: 1,
+			},
+			Hooks: &DeployHooks{
+				PreDeploy: []DeployHook{{
+					Name:    "migrate",
+					Command: "bin/migrate",
+					Timeout: fly.MustParseDuration("5m"),
+				}},
+				PostDeploy: []DeployHook{{
+					Command:       "make smoke-test",
+					RunOn:         "local",
+					FailurePolicy: "continue",
+				}},
+			},
 		},
 
 		Env: map[string]string{
@@ -18,7 +18,7 @@ import (
 
 var (
 	ValidationError          = errors.New("invalid app configuration")
-	MachinesDeployStrategies = []string{"canary", "rolling", "immediate", "bluegreen"}
+	MachinesDeployStrategies = []string{"canary", "rolling", "immediate", "bluegreen", "progressive"}
 )
 
 func (cfg *Config) Validate(ctx context.Context) (err error, extra_info string) {
@@ -36,6 +36,7 @@ func (cfg *Config) Validate(ctx context.Context) (err error, extra_info string)
 		cfg.validateConsoleCommand,
 		cfg.validateMounts,
 		cfg.validateRestartPolicy,
+		cfg.validateScaleSection,
 	}
 
 	extra_info = fmt.Sprintf("Validating %s\n", cfg.ConfigFilePath())
@@ -115,6 +116,62 @@ func (cfg *Config) validateDeploySection() (extraInfo string, err error) {
 		}
 	}
 
+	if p := cfg.Deploy.Progressive; p != nil {
+		last := 0
+		for _, step := range p.Steps {
+			if step <= last || step > 100 {
+				extraInfo += fmt.Sprintf(
+					"progressive deployment steps must be increasing percentages between 1 and 100, got %v\n", p.Steps,
+				)
+				err = ValidationError
+				break
+			}
+			last = step
+		}
+
+		if p.MaxRestarts < 0 {
+			extraInfo += "progressive deployment max_restarts can't be negative\n"
+			err = ValidationError
+		}
+	}
+
+	if h := cfg.Deploy.Hooks; h != nil {
+		stages := []struct {
+			name  string
+			hooks []DeployHook
+		}{
+			{"pre_deploy", h.PreDeploy},
+			{"post_deploy", h.PostDeploy},
+			{"on_failure", h.OnFailure},
+		}
+		for _, stage := range stages {
+			for idx, hook := range stage.hooks {
+				if hook.Command == "" {
+					extraInfo += fmt.Sprintf("deploy.hooks.%s[%d] must have a command\n", stage.name, idx)
+					err = ValidationError
+				}
+				if hook.RunOn != "" && hook.RunOn != DeployHookRunOnLocal && hook.RunOn != DeployHookRunOnMachine {
+					extraInfo += fmt.Sprintf(
+						"deploy.hooks.%s[%d] has an invalid run_on '%s', must be either '%s' or '%s'\n",
+						stage.name, idx, hook.RunOn, DeployHookRunOnLocal, DeployHookRunOnMachine,
+					)
+					err = ValidationError
+				}
+				if p := hook.FailurePolicy; p != "" && p != DeployHookFailurePolicyAbort && p != DeployHookFailurePolicyContinue {
+					extraInfo += fmt.Sprintf(
+						"deploy.hooks.%s[%d] has an invalid failure_policy '%s', must be either '%s' or '%s'\n",
+						stage.name, idx, p, DeployHookFailurePolicyAbort, DeployHookFailurePolicyContinue,
+					)
+					err = ValidationError
+				}
+				if hook.Timeout != nil && hook.Timeout.Duration <= 0 {
+					extraInfo += fmt.Sprintf("deploy.hooks.%s[%d] timeout must be positive\n", stage.name, idx)
+					err = ValidationError
+				}
+			}
+		}
+	}
+
 	return
 }
 
@@ -355,3 +412,47 @@ func (cfg *Config) validateRestartPolicy() (extraInfo string, err error) {
 
 	return
 }
+
+func (cfg *Config) validateScaleSection() (extraInfo string, err error) {
+	validGroupNames := cfg.ProcessNames()
+	seen := map[string]bool{}
+
+	for idx, scale := range cfg.Scale {
+		if scale == nil {
+			continue
+		}
+
+		groups := scale.Processes
+		if len(groups) == 0 {
+			groups = []string{""}
+		}
+		for _, processName := range groups {
+			if processName != "" && !slices.Contains(validGroupNames, processName) {
+				extraInfo += fmt.Sprintf("scale[%d] specifies '%s' as one of its processes, but no processes are defined with that name\n", idx, processName)
+				err = ValidationError
+			}
+			if seen[processName] {
+				name := processName
+				if name == "" {
+					name = "all processes"
+				}
+				extraInfo += fmt.Sprintf("scale[%d] sets the scale of %s again, each process group can only be in one [[scale]] section\n", idx, name)
+				err = ValidationError
+			}
+			seen[processName] = true
+		}
+
+		if len(scale.Regions) == 0 {
+			extraInfo += fmt.Sprintf("scale[%d] must set the count of at least one region\n", idx)
+			err = ValidationError
+		}
+		for region, count := range scale.Regions {
+			if count < 0 {
+				extraInfo += fmt.Sprintf("scale[%d] sets a negative count for region '%s'\n", idx, region)
+				err = ValidationError
+			}
+		}
+	}
+
+	return
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/cmdutil/preparers"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/logger"
@@ -42,6 +43,69 @@ func TestConfig_ValidateGroups(t *testing.T) {
 	require.NoErrorf(t, err, x)
 }
 
+func TestConfig_ValidateProgressive(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Deploy = &Deploy{
+		Strategy:    "progressive",
+		Progressive: &Progressive{Steps: []int{10, 50, 100}},
+	}
+	x, err := cfg.validateDeploySection()
+	require.NoError(t, err, x)
+
+	cfg.Deploy.Progressive.Steps = []int{50, 25, 100}
+	x, err = cfg.validateDeploySection()
+	require.Error(t, err)
+	require.Contains(t, x, "progressive deployment steps must be increasing percentages")
+
+	cfg.Deploy.Progressive.Steps = []int{10, 200}
+	_, err = cfg.validateDeploySection()
+	require.Error(t, err)
+}
+
+func TestConfig_ValidateDeployHooks(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Deploy = &Deploy{
+		Hooks: &DeployHooks{
+			PreDeploy: []DeployHook{
+				{Command: "bin/migrate"},
+				{Command: "make smoke-test", RunOn: "local", FailurePolicy: "continue", Timeout: fly.MustParseDuration("30s")},
+			},
+		},
+	}
+	x, err := cfg.validateDeploySection()
+	require.NoError(t, err, x)
+
+	cfg.Deploy.Hooks.PostDeploy = []DeployHook{{RunOn: "laptop", FailurePolicy: "ignore"}}
+	x, err = cfg.validateDeploySection()
+	require.Error(t, err)
+	require.Contains(t, x, "deploy.hooks.post_deploy[0] must have a command")
+	require.Contains(t, x, "invalid run_on 'laptop'")
+	require.Contains(t, x, "invalid failure_policy 'ignore'")
+}
+
+func TestConfig_ValidateScale(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Processes = map[string]string{"web": "run web", "worker": "run worker"}
+	cfg.Scale = []*Scale{
+		{Regions: map[string]int{"iad": 1}},
+		{Regions: map[string]int{"iad": 2, "ams": 0}, Processes: []string{"web"}},
+	}
+	x, err := cfg.validateScaleSection()
+	require.NoError(t, err, x)
+
+	cfg.Scale = append(cfg.Scale,
+		&Scale{Regions: map[string]int{"iad": -1}, Processes: []string{"web", "cron"}},
+		&Scale{},
+	)
+	x, err = cfg.validateScaleSection()
+	require.Error(t, err)
+	require.Contains(t, x, "scale[2] specifies 'cron' as one of its processes")
+	require.Contains(t, x, "scale[2] sets the scale of web again")
+	require.Contains(t, x, "scale[2] sets a negative count for region 'iad'")
+	require.Contains(t, x, "scale[3] sets the scale of all processes again")
+	require.Contains(t, x, "scale[3] must set the count of at least one region")
+}
+
 func TestConfig_ValidateMounts(t *testing.T) {
 	cfg, err := LoadConfig("./testdata/validate-mounts.toml")
 	require.NoError(t, err)
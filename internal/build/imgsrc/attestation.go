@@ -0,0 +1,190 @@
+package imgsrc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Predicate types of the attestations BuildKit attaches to images
+const (
+	SBOMPredicateType          = "https://spdx.dev/Document"
+	ProvenanceV02PredicateType = "https://slsa.dev/provenance/v0.2"
+	ProvenanceV1PredicateType  = "https://slsa.dev/provenance/v1"
+)
+
+// Annotations BuildKit sets on attestation manifests and their layers. See
+// https://docs.docker.com/build/attestations/attestation-storage/
+const (
+	referenceTypeAnnotation    = "vnd.docker.reference.type"
+	referenceDigestAnnotation  = "vnd.docker.reference.digest"
+	attestationManifestType    = "attestation-manifest"
+	predicateTypeAnnotation    = "in-toto.io/predicate-type"
+	maxAttestationStatementLen = 64 << 20
+)
+
+// Attestation is an attestation manifest attached to an image variant
+type Attestation struct {
+	Platform       string
+	Digest         string
+	PredicateTypes []string
+}
+
+// listAttestations returns the attestations in a manifest list, along with
+// the platform of the image each one is for.
+func listAttestations(index v1.ImageIndex, manifest *v1.IndexManifest) ([]Attestation, error) {
+	platformOf := map[string]string{}
+	for _, desc := range manifest.Manifests {
+		if platform := descriptorPlatform(desc); platform != "" {
+			platformOf[desc.Digest.String()] = platform
+		}
+	}
+
+	var attestations []Attestation
+	for _, desc := range manifest.Manifests {
+		if desc.Annotations[referenceTypeAnnotation] != attestationManifestType {
+			continue
+		}
+
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			return nil, err
+		}
+
+		attestation := Attestation{
+			Platform: platformOf[desc.Annotations[referenceDigestAnnotation]],
+			Digest:   desc.Digest.String(),
+		}
+		for _, layer := range m.Layers {
+			if t := layer.Annotations[predicateTypeAnnotation]; t != "" {
+				attestation.PredicateTypes = append(attestation.PredicateTypes, t)
+			}
+		}
+		attestations = append(attestations, attestation)
+	}
+
+	sort.Slice(attestations, func(i, j int) bool {
+		return attestations[i].Platform < attestations[j].Platform
+	})
+	return attestations, nil
+}
+
+// fetchAttestations lists the attestations pushed along with tag
+func fetchAttestations(ctx context.Context, tag string) ([]Attestation, error) {
+	index, manifest, err := fetchIndex(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return listAttestations(index, manifest)
+}
+
+// attestationsNote describes attestations for the build record
+func attestationsNote(attestations []Attestation) string {
+	notes := make([]string, 0, len(attestations))
+	for _, a := range attestations {
+		notes = append(notes, fmt.Sprintf("%s attestation %s (%s)", a.Platform, a.Digest, strings.Join(a.PredicateTypes, ", ")))
+	}
+	return strings.Join(notes, "; ")
+}
+
+// FetchAttestation returns the predicate, and its type, of the first
+// attestation of one of predicateTypes attached to the platform variant of
+// the image ref refers to. ref may include the digest of a variant, as
+// deployed images do, in which case the manifest list is read by tag.
+func FetchAttestation(ctx context.Context, ref, platform string, predicateTypes ...string) (json.RawMessage, string, error) {
+	tag, _, _ := strings.Cut(ref, "@")
+
+	index, manifest, err := fetchIndex(ctx, tag)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var variant string
+	for _, desc := range manifest.Manifests {
+		if descriptorPlatform(desc) == platform {
+			variant = desc.Digest.String()
+			break
+		}
+	}
+	if variant == "" {
+		return nil, "", fmt.Errorf("image %s has no %s variant", tag, platform)
+	}
+
+	for _, desc := range manifest.Manifests {
+		if desc.Annotations[referenceTypeAnnotation] != attestationManifestType || desc.Annotations[referenceDigestAnnotation] != variant {
+			continue
+		}
+
+		img, err := index.Image(desc.Digest)
+		if err != nil {
+			return nil, "", err
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			return nil, "", err
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			return nil, "", err
+		}
+
+		for i, layerDesc := range m.Layers {
+			predicateType := layerDesc.Annotations[predicateTypeAnnotation]
+			if !containsString(predicateTypes, predicateType) {
+				continue
+			}
+
+			predicate, err := readStatementPredicate(layers[i])
+			if err != nil {
+				return nil, "", fmt.Errorf("failed reading %s attestation: %w", predicateType, err)
+			}
+			return predicate, predicateType, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("image %s has no %s attestation for %s; deploy with --attest to attach one", tag, strings.Join(predicateTypes, " or "), platform)
+}
+
+// readStatementPredicate reads the predicate of the in-toto statement an
+// attestation layer holds
+func readStatementPredicate(layer v1.Layer) (json.RawMessage, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxAttestationStatementLen))
+	if err != nil {
+		return nil, err
+	}
+
+	var statement struct {
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, err
+	}
+	if len(statement.Predicate) == 0 {
+		return nil, fmt.Errorf("statement has no predicate")
+	}
+	return statement.Predicate, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package imgsrc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/fly-go/tokens"
+
+	"github.com/superfly/flyctl/internal/config"
+)
+
+func TestAttestations(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+
+	tag := strings.TrimPrefix(srv.URL, "http://") + "/app:deployment-1"
+	ref, err := name.ParseReference(tag)
+	require.NoError(t, err)
+
+	img, err := random.Image(100, 1)
+	require.NoError(t, err)
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+
+	// Attestations are stored the way BuildKit pushes them, as a manifest
+	// of in-toto statements next to the image they describe
+	attestation, err := mutate.Append(empty.Image,
+		mutate.Addendum{
+			Layer:       static.NewLayer([]byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://spdx.dev/Document","predicate":{"spdxVersion":"SPDX-2.3"}}`), "application/vnd.in-toto+json"),
+			Annotations: map[string]string{predicateTypeAnnotation: SBOMPredicateType},
+		},
+		mutate.Addendum{
+			Layer:       static.NewLayer([]byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"buildType":"https://mobyproject.org/buildkit@v1"}}`), "application/vnd.in-toto+json"),
+			Annotations: map[string]string{predicateTypeAnnotation: ProvenanceV02PredicateType},
+		},
+	)
+	require.NoError(t, err)
+	attestationDigest, err := attestation.Digest()
+	require.NoError(t, err)
+
+	index := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex),
+		mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		},
+		mutate.IndexAddendum{
+			Add: attestation,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"},
+				Annotations: map[string]string{
+					referenceTypeAnnotation:   attestationManifestType,
+					referenceDigestAnnotation: imgDigest.String(),
+				},
+			},
+		},
+	)
+	require.NoError(t, remote.WriteIndex(ref, index))
+
+	ctx := config.NewContext(context.Background(), &config.Config{Tokens: &tokens.Tokens{}})
+
+	attestations, err := fetchAttestations(ctx, tag)
+	require.NoError(t, err)
+	assert.Equal(t, []Attestation{{
+		Platform:       "linux/amd64",
+		Digest:         attestationDigest.String(),
+		PredicateTypes: []string{SBOMPredicateType, ProvenanceV02PredicateType},
+	}}, attestations)
+	assert.Contains(t, attestationsNote(attestations), attestationDigest.String())
+
+	// Deployed images are pinned to the digest of their variant
+	predicate, predicateType, err := FetchAttestation(ctx, tag+"@"+imgDigest.String(), MachinePlatform, SBOMPredicateType)
+	require.NoError(t, err)
+	assert.Equal(t, SBOMPredicateType, predicateType)
+	assert.JSONEq(t, `{"spdxVersion":"SPDX-2.3"}`, string(predicate))
+
+	_, predicateType, err = FetchAttestation(ctx, tag, MachinePlatform, ProvenanceV1PredicateType, ProvenanceV02PredicateType)
+	require.NoError(t, err)
+	assert.Equal(t, ProvenanceV02PredicateType, predicateType)
+
+	_, _, err = FetchAttestation(ctx, tag, "linux/arm64", SBOMPredicateType)
+	assert.ErrorContains(t, err, "no linux/arm64 variant")
+}
+
+func TestSolveOptAttest(t *testing.T) {
+	opts := ImageOptions{Tag: "registry.fly.io/app:deployment-1", WorkingDir: ".", Attest: true}
+
+	solveOpt := solveOptFromImageOptions(opts, "Dockerfile", nil)
+	assert.Equal(t, "", solveOpt.FrontendAttrs["attest:sbom"])
+	assert.Equal(t, "mode=max", solveOpt.FrontendAttrs["attest:provenance"])
+	assert.Equal(t, "image", solveOpt.Exports[0].Type)
+	assert.Equal(t, "true", solveOpt.Exports[0].Attrs["push"])
+}
@@ -0,0 +1,260 @@
+package imgsrc
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/flyutil"
+)
+
+// buildCacheFileName is the name of the file in the config directory which
+// maps build context hashes to the images built from them.
+const buildCacheFileName = "build-cache.json"
+
+// buildCacheEntriesPerApp bounds how many images are remembered for an app
+const buildCacheEntriesPerApp = 20
+
+type buildCacheEntry struct {
+	Key       string            `json:"key"`
+	Tag       string            `json:"tag"`
+	ID        string            `json:"id"`
+	Size      int64             `json:"size"`
+	Platforms map[string]string `json:"platforms,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// buildCache remembers, per app, the images pushed for each build context
+// hash so unchanged sources don't have to be built again.
+type buildCache struct {
+	path string
+	Apps map[string][]buildCacheEntry `json:"apps"`
+}
+
+func loadBuildCache(configDir string) (*buildCache, error) {
+	c := &buildCache{
+		path: filepath.Join(configDir, buildCacheFileName),
+		Apps: map[string][]buildCacheEntry{},
+	}
+
+	data, err := os.ReadFile(c.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		// A corrupt cache only costs a rebuild
+		return &buildCache{path: c.path, Apps: map[string][]buildCacheEntry{}}, nil
+	}
+	if c.Apps == nil {
+		c.Apps = map[string][]buildCacheEntry{}
+	}
+	return c, nil
+}
+
+func (c *buildCache) lookup(appName, key string) (buildCacheEntry, bool) {
+	for _, e := range c.Apps[appName] {
+		if e.Key == key {
+			return e, true
+		}
+	}
+	return buildCacheEntry{}, false
+}
+
+// remember records img as built from key, keeping the most recent entries
+func (c *buildCache) remember(appName, key string, img *DeploymentImage) {
+	entries := []buildCacheEntry{{
+		Key:       key,
+		Tag:       img.Tag,
+		ID:        img.ID,
+		Size:      img.Size,
+		Platforms: img.Platforms,
+		CreatedAt: time.Now(),
+	}}
+	for _, e := range c.Apps[appName] {
+		if e.Key != key && len(entries) < buildCacheEntriesPerApp {
+			entries = append(entries, e)
+		}
+	}
+	c.Apps[appName] = entries
+}
+
+func (c *buildCache) forget(appName, key string) {
+	entries := c.Apps[appName][:0]
+	for _, e := range c.Apps[appName] {
+		if e.Key != key {
+			entries = append(entries, e)
+		}
+	}
+	c.Apps[appName] = entries
+}
+
+// save writes the cache through a temporary file so concurrent deploys
+// never read a partial one
+func (c *buildCache) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), buildCacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// buildCacheDockerfile returns the Dockerfile a build with opts would use, or
+// an empty string if its result can't be cached. Only Dockerfile builds are,
+// since buildpacks, builtins and nixpacks pull in inputs from outside the
+// build context.
+func buildCacheDockerfile(opts ImageOptions) string {
+	if opts.Builder != "" || len(opts.Buildpacks) > 0 || opts.BuiltIn != "" {
+		return ""
+	}
+
+	if opts.DockerfilePath != "" {
+		if !helpers.FileExists(opts.DockerfilePath) {
+			return ""
+		}
+		return opts.DockerfilePath
+	}
+	return ResolveDockerfile(opts.WorkingDir)
+}
+
+// buildCacheKey hashes everything a Dockerfile build depends on: the files
+// of the build context, as archived for the builder, the Dockerfile, and the
+// options passed to the build, including --image-label, since it names the
+// image the build is pushed as. File modification times and ownership aren't
+// hashed, so fresh checkouts of the same sources hash the same.
+func buildCacheKey(dockerfile string, opts ImageOptions) (string, error) {
+	h := sha256.New()
+
+	r, err := makeBuildContext(dockerfile, opts, false)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close() // skipcq: GO-S2307
+
+	if err := hashArchive(h, r); err != nil {
+		return "", fmt.Errorf("error hashing build context: %w", err)
+	}
+
+	dockerfileData, err := os.ReadFile(dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("error reading Dockerfile: %w", err)
+	}
+	writeHashField(h, "dockerfile", string(dockerfileData))
+
+	writeHashMap(h, "build-arg", opts.BuildArgs)
+	writeHashMap(h, "extra-build-arg", opts.ExtraBuildArgs)
+	writeHashMap(h, "build-secret", opts.BuildSecrets)
+	writeHashMap(h, "label", opts.Label)
+	writeHashField(h, "target", opts.Target)
+	writeHashField(h, "image-label", opts.ImageLabel)
+	writeHashField(h, "platforms", strings.Join(buildPlatforms(opts), ","))
+	writeHashField(h, "attest", strconv.FormatBool(opts.Attest))
+	writeHashField(h, "overlaybd", strconv.FormatBool(opts.UseOverlaybd))
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashArchive(h hash.Hash, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+
+		writeHashField(h, "name", hdr.Name)
+		writeHashField(h, "type", string(hdr.Typeflag))
+		writeHashField(h, "mode", strconv.FormatInt(hdr.Mode&0o7777, 8))
+		writeHashField(h, "link", hdr.Linkname)
+		writeHashField(h, "size", strconv.FormatInt(hdr.Size, 10))
+		if _, err := io.Copy(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// writeHashField writes a length-prefixed field so that adjacent fields
+// can't run into each other
+func writeHashField(h hash.Hash, name, value string) {
+	fmt.Fprintf(h, "%s:%d:%s\n", name, len(value), value)
+}
+
+func writeHashMap(h hash.Hash, name string, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	writeHashField(h, name+"s", strconv.Itoa(len(keys)))
+	for _, k := range keys {
+		writeHashField(h, name, k)
+		writeHashField(h, name, m[k])
+	}
+}
+
+// cachedImage returns the image remembered for key when it's still in the
+// app's registry, forgetting it otherwise.
+func cachedImage(ctx context.Context, apiClient flyutil.Client, cache *buildCache, appName, key string) (*DeploymentImage, error) {
+	entry, ok := cache.lookup(appName, key)
+	if !ok {
+		return nil, nil
+	}
+
+	img, err := apiClient.ResolveImageForApp(ctx, appName, entry.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		cache.forget(appName, key)
+		return nil, nil
+	}
+
+	di := &DeploymentImage{
+		ID:        img.ID,
+		Tag:       img.Ref,
+		Size:      entry.Size,
+		Platforms: entry.Platforms,
+	}
+	if size, err := strconv.ParseInt(img.CompressedSize, 10, 64); err == nil {
+		di.Size = size
+	}
+	return di, nil
+}
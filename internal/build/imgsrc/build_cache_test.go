@@ -0,0 +1,109 @@
+package imgsrc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+
+	"github.com/superfly/flyctl/internal/mock"
+)
+
+func TestBuildCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("Dockerfile", "FROM alpine\nCOPY . /app\n")
+	write("main.go", "package main")
+	write(".dockerignore", "*.log\n")
+
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	opts := ImageOptions{WorkingDir: dir, BuildArgs: map[string]string{"A": "1"}}
+
+	key := func(opts ImageOptions) string {
+		k, err := buildCacheKey(dockerfile, opts)
+		require.NoError(t, err)
+		return k
+	}
+	base := key(opts)
+
+	// Modification times and ignored files don't matter
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "main.go"), later, later))
+	write("debug.log", "noise")
+	assert.Equal(t, base, key(opts))
+
+	// Build options do
+	assert.NotEqual(t, base, key(ImageOptions{WorkingDir: dir, BuildArgs: map[string]string{"A": "2"}}))
+	assert.NotEqual(t, base, key(ImageOptions{WorkingDir: dir, BuildArgs: opts.BuildArgs, Target: "prod"}))
+	assert.NotEqual(t, base, key(ImageOptions{WorkingDir: dir, BuildArgs: opts.BuildArgs, ImageLabel: "v2"}))
+
+	// And so do the sources
+	write("main.go", "package main // changed")
+	assert.NotEqual(t, base, key(opts))
+}
+
+func TestBuildCache(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := loadBuildCache(dir)
+	require.NoError(t, err)
+	_, ok := cache.lookup("app", "key")
+	assert.False(t, ok)
+
+	cache.remember("app", "key", &DeploymentImage{ID: "sha256:1", Tag: "registry.fly.io/app:deployment-1", Size: 10})
+	require.NoError(t, cache.save())
+
+	cache, err = loadBuildCache(dir)
+	require.NoError(t, err)
+	entry, ok := cache.lookup("app", "key")
+	require.True(t, ok)
+	assert.Equal(t, "registry.fly.io/app:deployment-1", entry.Tag)
+	_, ok = cache.lookup("other", "key")
+	assert.False(t, ok)
+
+	// Only the most recent entries are kept
+	for i := 0; i < buildCacheEntriesPerApp; i++ {
+		cache.remember("app", string(rune('a'+i)), &DeploymentImage{})
+	}
+	assert.Len(t, cache.Apps["app"], buildCacheEntriesPerApp)
+	_, ok = cache.lookup("app", "key")
+	assert.False(t, ok)
+}
+
+func TestCachedImage(t *testing.T) {
+	cache, err := loadBuildCache(t.TempDir())
+	require.NoError(t, err)
+	cache.remember("app", "key", &DeploymentImage{ID: "sha256:1", Tag: "registry.fly.io/app:deployment-1", Size: 10})
+
+	images := map[string]*fly.Image{
+		"registry.fly.io/app:deployment-1": {ID: "img_1", Ref: "registry.fly.io/app:deployment-1", CompressedSize: "42"},
+	}
+	client := &mock.Client{
+		ResolveImageForAppFunc: func(ctx context.Context, appName, imageRef string) (*fly.Image, error) {
+			return images[imageRef], nil
+		},
+	}
+
+	img, err := cachedImage(context.Background(), client, cache, "app", "key")
+	require.NoError(t, err)
+	assert.Equal(t, &DeploymentImage{ID: "img_1", Tag: "registry.fly.io/app:deployment-1", Size: 42}, img)
+
+	img, err = cachedImage(context.Background(), client, cache, "app", "other")
+	require.NoError(t, err)
+	assert.Nil(t, img)
+
+	// Images gone from the registry are forgotten
+	delete(images, "registry.fly.io/app:deployment-1")
+	img, err = cachedImage(context.Background(), client, cache, "app", "key")
+	require.NoError(t, err)
+	assert.Nil(t, img)
+	_, ok := cache.lookup("app", "key")
+	assert.False(t, ok)
+}
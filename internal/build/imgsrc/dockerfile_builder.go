@@ -171,6 +171,30 @@ func (*dockerfileBuilder) Run(ctx context.Context, dockerFactory *dockerClientFa
 
 	span.SetAttributes(attribute.Bool("buildkit_enabled", buildkitEnabled))
 
+	// Building for several platforms produces a manifest list, and
+	// attestations are attached to one, both of which BuildKit pushes to the
+	// registry as it builds
+	platforms := buildPlatforms(opts)
+	pushed := pushedByBuildKit(opts)
+	what := "attaching attestations"
+	if len(platforms) > 1 {
+		what = fmt.Sprintf("building for %s at once", strings.Join(platforms, ", "))
+	}
+	if pushed && !buildkitEnabled {
+		build.BuildFinish()
+		build.BuilderInitFinish()
+		err := fmt.Errorf("%s requires BuildKit", what)
+		tracing.RecordError(span, err, "buildkit push without buildkit")
+		return nil, "", err
+	}
+	if pushed && !opts.Publish {
+		build.BuildFinish()
+		build.BuilderInitFinish()
+		err := fmt.Errorf("%s pushes the image as it's built, so it requires --push", what)
+		tracing.RecordError(span, err, "buildkit push without push")
+		return nil, "", err
+	}
+
 	build.BuilderInitFinish()
 	defer func() {
 		// Don't untag images for remote builder, as people sometimes
@@ -269,6 +293,40 @@ func (*dockerfileBuilder) Run(ctx context.Context, dockerFactory *dockerClientFa
 	build.BuildFinish()
 	cmdfmt.PrintDone(streams.ErrOut, "Building image done")
 
+	if pushed {
+		digests, sizes, err := fetchPlatformVariants(ctx, opts.Tag)
+		if err != nil {
+			return nil, "", err
+		}
+
+		di := DeploymentImage{
+			ID:        imageID,
+			Tag:       opts.Tag,
+			Size:      sizes[MachinePlatform],
+			Platforms: digests,
+		}
+		if opts.UseOverlaybd {
+			terminal.Warn("lazy-loaded images can't be built with BuildKit pushing them, not using lazy-loading")
+		}
+
+		var note string
+		if opts.Attest {
+			attestations, err := fetchAttestations(ctx, opts.Tag)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(attestations) == 0 {
+				terminal.Warn("the builder didn't attach any attestations to the image")
+			}
+			note = attestationsNote(attestations)
+			di.Attestations = attestations
+		}
+
+		span.SetAttributes(di.ToSpanAttributes()...)
+
+		return &di, note, nil
+	}
+
 	if opts.Publish {
 		build.PushStart()
 		tb := render.NewTextBlock(ctx, "Pushing image to fly")
@@ -291,6 +349,9 @@ func (*dockerfileBuilder) Run(ctx context.Context, dockerFactory *dockerClientFa
 		Tag:  opts.Tag,
 		Size: img.Size,
 	}
+	if len(opts.Platforms) > 0 {
+		di.Platforms = map[string]string{platforms[0]: ""}
+	}
 
 	if opts.UseOverlaybd && dockerFactory.IsRemote() {
 		obdImage, err := buildOverlaybdImage(ctx, dockerFactory.appName, docker, opts)
@@ -402,7 +463,7 @@ func runClassicBuild(ctx context.Context, streams *iostreams.IOStreams, docker *
 		Tags:        []string{opts.Tag},
 		BuildArgs:   buildArgs,
 		AuthConfigs: authConfigs(config.Tokens(ctx).Docker()),
-		Platform:    "linux/amd64",
+		Platform:    buildPlatforms(opts)[0],
 		Dockerfile:  dockerfilePath,
 		Target:      opts.Target,
 		NoCache:     opts.NoCache,
@@ -434,15 +495,20 @@ func solveOptFromImageOptions(opts ImageOptions, dockerfilePath string, buildArg
 	attrs := map[string]string{
 		"filename": filepath.Base(dockerfilePath),
 		"target":   opts.Target,
-		// Fly.io only supports linux/amd64, but local Docker Engine could be running on ARM,
-		// including Apple Silicon.
-		"platform": "linux/amd64",
+		// Build for the machines' platform unless told otherwise, since local
+		// Docker Engine could be running on ARM, including Apple Silicon.
+		"platform": strings.Join(buildPlatforms(opts), ","),
 	}
 	attrs["target"] = opts.Target
 	if opts.NoCache {
 		attrs["no-cache"] = ""
 	}
 
+	if opts.Attest {
+		attrs["attest:sbom"] = ""
+		attrs["attest:provenance"] = "mode=max"
+	}
+
 	for k, v := range opts.Label {
 		attrs["label:"+k] = v
 	}
@@ -454,6 +520,22 @@ func solveOptFromImageOptions(opts ImageOptions, dockerfilePath string, buildArg
 		attrs["build-arg:"+k] = *v
 	}
 
+	// Docker Engine's worker only supports three exporters.
+	// "moby" exporter works best for flyctl, since we want to keep images in
+	// Docker Engine's image store. The others are exporting images to somewhere else.
+	// https://github.com/moby/moby/blob/v20.10.24/builder/builder-next/worker/worker.go#L221
+	exports := []client.ExportEntry{
+		{Type: "moby", Attrs: map[string]string{"name": opts.Tag}},
+	}
+	// Manifest lists and attestations can't be kept in the classic image
+	// store, so they're pushed by BuildKit, which needs the builder to use
+	// the containerd image store.
+	if pushedByBuildKit(opts) {
+		exports = []client.ExportEntry{
+			{Type: client.ExporterImage, Attrs: map[string]string{"name": opts.Tag, "push": "true"}},
+		}
+	}
+
 	return client.SolveOpt{
 		Frontend:      "dockerfile.v0",
 		FrontendAttrs: attrs,
@@ -461,13 +543,7 @@ func solveOptFromImageOptions(opts ImageOptions, dockerfilePath string, buildArg
 			"dockerfile": filepath.Dir(dockerfilePath),
 			"context":    opts.WorkingDir,
 		},
-		// Docker Engine's worker only supports three exporters.
-		// "moby" exporter works best for flyctl, since we want to keep images in
-		// Docker Engine's image store. The others are exporting images to somewhere else.
-		// https://github.com/moby/moby/blob/v20.10.24/builder/builder-next/worker/worker.go#L221
-		Exports: []client.ExportEntry{
-			{Type: "moby", Attrs: map[string]string{"name": opts.Tag}},
-		},
+		Exports: exports,
 	}
 }
 
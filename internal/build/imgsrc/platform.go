@@ -0,0 +1,189 @@
+package imgsrc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/superfly/flyctl/internal/config"
+)
+
+// MachinePlatform is the platform Fly Machines run images for, and the one
+// images are built for unless told otherwise.
+const MachinePlatform = "linux/amd64"
+
+// supportedPlatforms are the platforms images can be built for
+var supportedPlatforms = []string{"linux/amd64", "linux/arm64"}
+
+// NormalizePlatforms parses platform specifiers such as "linux/arm64/v8" or
+// "amd64", returning them in their canonical form without duplicates.
+func NormalizePlatforms(specifiers []string) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, specifier := range specifiers {
+		specifier = strings.TrimSpace(specifier)
+		if specifier == "" {
+			continue
+		}
+
+		p, err := platforms.Parse(specifier)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform %q: %w", specifier, err)
+		}
+		platform := platforms.Format(platforms.Normalize(p))
+
+		if !isSupportedPlatform(platform) {
+			return nil, fmt.Errorf("unsupported platform %q, expected one of %s", specifier, strings.Join(supportedPlatforms, ", "))
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			normalized = append(normalized, platform)
+		}
+	}
+	return normalized, nil
+}
+
+// CheckMachinePlatform returns an error if images built for platforms, as
+// returned by NormalizePlatforms, can't run on machines. No platforms means
+// MachinePlatform.
+func CheckMachinePlatform(platforms []string) error {
+	if len(platforms) == 0 {
+		return nil
+	}
+	for _, p := range platforms {
+		if p == MachinePlatform {
+			return nil
+		}
+	}
+	return fmt.Errorf("machines run %s images, but the build platforms are %s; add %s to them", MachinePlatform, strings.Join(platforms, ", "), MachinePlatform)
+}
+
+func isSupportedPlatform(platform string) bool {
+	for _, p := range supportedPlatforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPlatforms returns the platforms a build with opts targets
+func buildPlatforms(opts ImageOptions) []string {
+	if len(opts.Platforms) == 0 {
+		return []string{MachinePlatform}
+	}
+	return opts.Platforms
+}
+
+// pushedByBuildKit reports whether a build with opts is pushed by BuildKit as
+// it builds, rather than kept in Docker's image store and pushed after.
+// Manifest lists and attestations can't be kept in the classic image store.
+func pushedByBuildKit(opts ImageOptions) bool {
+	return len(buildPlatforms(opts)) > 1 || opts.Attest
+}
+
+// PlatformRef returns the reference of the image variant built for platform.
+// Multi-platform images are pinned to the digest of that variant, so
+// machines don't depend on the registry picking it.
+func (di DeploymentImage) PlatformRef(platform string) (string, error) {
+	if len(di.Platforms) == 0 {
+		return di.Tag, nil
+	}
+
+	digest, ok := di.Platforms[platform]
+	if !ok {
+		built := make([]string, 0, len(di.Platforms))
+		for p := range di.Platforms {
+			built = append(built, p)
+		}
+		sort.Strings(built)
+		return "", fmt.Errorf("image %s was built for %s, but machines run %s images; add %s to the build platforms", di.Tag, strings.Join(built, ", "), platform, platform)
+	}
+	if digest == "" {
+		return di.Tag, nil
+	}
+
+	// The tag is kept so the manifest list, and the attestations in it, can
+	// still be found from the machines
+	tag, _, _ := strings.Cut(di.Tag, "@")
+	return tag + "@" + digest, nil
+}
+
+// fetchIndex reads the manifest list ref points to
+func fetchIndex(ctx context.Context, ref string) (v1.ImageIndex, *v1.IndexManifest, error) {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index, err := remote.Index(parsed,
+		remote.WithContext(ctx),
+		remote.WithAuth(registryAuthenticator(ctx, parsed)),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed fetching manifest list for %s: %w", ref, err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading manifest list for %s: %w", ref, err)
+	}
+	return index, manifest, nil
+}
+
+// registryAuthenticator authenticates to the Fly registry with the user's
+// token, and anonymously anywhere else
+func registryAuthenticator(ctx context.Context, ref name.Reference) authn.Authenticator {
+	auth := registryAuth(config.Tokens(ctx).Docker())
+	if ref.Context().RegistryStr() != auth.ServerAddress {
+		return authn.Anonymous
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: auth.Username, Password: auth.Password})
+}
+
+// descriptorPlatform returns the platform of an image in a manifest list, or
+// an empty string for entries which aren't images, such as attestations.
+func descriptorPlatform(desc v1.Descriptor) string {
+	if desc.Platform == nil || desc.Platform.OS == "unknown" {
+		return ""
+	}
+
+	return platforms.Format(platforms.Normalize(platforms.Platform{
+		OS:           desc.Platform.OS,
+		Architecture: desc.Platform.Architecture,
+		Variant:      desc.Platform.Variant,
+	}))
+}
+
+// fetchPlatformVariants reads the manifest list pushed for tag, returning the
+// digest and size of the variant for each platform.
+func fetchPlatformVariants(ctx context.Context, tag string) (digests map[string]string, sizes map[string]int64, err error) {
+	index, manifest, err := fetchIndex(ctx, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digests, sizes = map[string]string{}, map[string]int64{}
+	for _, desc := range manifest.Manifests {
+		platform := descriptorPlatform(desc)
+		if platform == "" {
+			continue
+		}
+		digests[platform] = desc.Digest.String()
+
+		if img, err := index.Image(desc.Digest); err == nil {
+			if m, err := img.Manifest(); err == nil {
+				for _, layer := range m.Layers {
+					sizes[platform] += layer.Size
+				}
+			}
+		}
+	}
+	return digests, sizes, nil
+}
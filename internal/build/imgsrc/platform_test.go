@@ -0,0 +1,126 @@
+package imgsrc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/fly-go/tokens"
+
+	"github.com/superfly/flyctl/internal/config"
+)
+
+func TestNormalizePlatforms(t *testing.T) {
+	platforms, err := NormalizePlatforms([]string{"amd64", "linux/arm64/v8", " linux/amd64", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, platforms)
+
+	platforms, err = NormalizePlatforms(nil)
+	require.NoError(t, err)
+	assert.Empty(t, platforms)
+
+	_, err = NormalizePlatforms([]string{"windows/amd64"})
+	assert.ErrorContains(t, err, "unsupported platform")
+
+	_, err = NormalizePlatforms([]string{"linux/amd64/v2/extra"})
+	assert.ErrorContains(t, err, "invalid platform")
+}
+
+func TestCheckMachinePlatform(t *testing.T) {
+	assert.NoError(t, CheckMachinePlatform(nil))
+	assert.NoError(t, CheckMachinePlatform([]string{"linux/arm64", "linux/amd64"}))
+	assert.ErrorContains(t, CheckMachinePlatform([]string{"linux/arm64"}), "machines run linux/amd64 images, but the build platforms are linux/arm64")
+}
+
+func TestPlatformRef(t *testing.T) {
+	img := DeploymentImage{Tag: "registry.fly.io/app:deployment-1"}
+
+	ref, err := img.PlatformRef(MachinePlatform)
+	require.NoError(t, err)
+	assert.Equal(t, "registry.fly.io/app:deployment-1", ref)
+
+	img.Platforms = map[string]string{"linux/amd64": "sha256:aaa", "linux/arm64": "sha256:bbb"}
+	ref, err = img.PlatformRef("linux/arm64")
+	require.NoError(t, err)
+	assert.Equal(t, "registry.fly.io/app:deployment-1@sha256:bbb", ref)
+
+	// Single platform images are used as tagged
+	img.Platforms = map[string]string{"linux/arm64": ""}
+	ref, err = img.PlatformRef("linux/arm64")
+	require.NoError(t, err)
+	assert.Equal(t, "registry.fly.io/app:deployment-1", ref)
+
+	_, err = img.PlatformRef(MachinePlatform)
+	assert.ErrorContains(t, err, "was built for linux/arm64")
+}
+
+func TestSolveOptPlatforms(t *testing.T) {
+	opts := ImageOptions{Tag: "registry.fly.io/app:deployment-1", WorkingDir: "."}
+
+	solveOpt := solveOptFromImageOptions(opts, "Dockerfile", nil)
+	assert.Equal(t, "linux/amd64", solveOpt.FrontendAttrs["platform"])
+	assert.Equal(t, "moby", solveOpt.Exports[0].Type)
+
+	opts.Platforms = []string{"linux/arm64"}
+	solveOpt = solveOptFromImageOptions(opts, "Dockerfile", nil)
+	assert.Equal(t, "linux/arm64", solveOpt.FrontendAttrs["platform"])
+	assert.Equal(t, "moby", solveOpt.Exports[0].Type)
+
+	opts.Platforms = []string{"linux/amd64", "linux/arm64"}
+	solveOpt = solveOptFromImageOptions(opts, "Dockerfile", nil)
+	assert.Equal(t, "linux/amd64,linux/arm64", solveOpt.FrontendAttrs["platform"])
+	assert.Equal(t, "image", solveOpt.Exports[0].Type)
+	assert.Equal(t, map[string]string{"name": opts.Tag, "push": "true"}, solveOpt.Exports[0].Attrs)
+}
+
+func TestFetchPlatformVariants(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+
+	tag := strings.TrimPrefix(srv.URL, "http://") + "/app:deployment-1"
+	ref, err := name.ParseReference(tag)
+	require.NoError(t, err)
+
+	index := mutate.IndexMediaType(empty.Index, types.OCIImageIndex)
+	digests := map[string]string{}
+	for _, platform := range []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		// BuildKit lists attestations as well
+		{OS: "unknown", Architecture: "unknown"},
+	} {
+		platform := platform
+		img, err := random.Image(100, 2)
+		require.NoError(t, err)
+		digest, err := img.Digest()
+		require.NoError(t, err)
+		digests[platform.OS+"/"+platform.Architecture] = digest.String()
+
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &platform},
+		})
+	}
+	require.NoError(t, remote.WriteIndex(ref, index))
+
+	ctx := config.NewContext(context.Background(), &config.Config{Tokens: &tokens.Tokens{}})
+	variants, sizes, err := fetchPlatformVariants(ctx, tag)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"linux/amd64": digests["linux/amd64"],
+		"linux/arm64": digests["linux/arm64"],
+	}, variants)
+	assert.Positive(t, sizes["linux/amd64"])
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flyutil"
 	"github.com/superfly/flyctl/internal/sentry"
+	"github.com/superfly/flyctl/internal/state"
 	"github.com/superfly/flyctl/internal/tracing"
 	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/retry"
@@ -53,6 +54,16 @@ type ImageOptions struct {
 	BuildpacksDockerHost string
 	BuildpacksVolumes    []string
 	UseOverlaybd         bool
+	// Platforms the image is built for. More than one builds a manifest
+	// list, which is pushed straight to the registry. Defaults to
+	// MachinePlatform.
+	Platforms []string
+	// Attest attaches SBOM and provenance attestations to the image, which
+	// pushes it straight to the registry like manifest lists are
+	Attest bool
+	// ForceBuild builds the image even when one was already pushed for the
+	// same build context
+	ForceBuild bool
 }
 
 func (io ImageOptions) ToSpanAttributes() []attribute.KeyValue {
@@ -66,6 +77,9 @@ func (io ImageOptions) ToSpanAttributes() []attribute.KeyValue {
 		attribute.Bool("imageoptions.publish", io.Publish),
 		attribute.String("imageoptions.tag", io.Tag),
 		attribute.Bool("imageoptions.nocache", io.NoCache),
+		attribute.Bool("imageoptions.force_build", io.ForceBuild),
+		attribute.StringSlice("imageoptions.platforms", io.Platforms),
+		attribute.Bool("imageoptions.attest", io.Attest),
 		attribute.String("imageoptions.builtin", io.BuiltIn),
 		attribute.String("imageoptions.builder", io.BuiltIn),
 		attribute.String("imageoptions.buildpacks_docker_host", io.BuildpacksDockerHost),
@@ -126,6 +140,12 @@ type DeploymentImage struct {
 	Tag    string
 	Size   int64
 	Labels map[string]string
+	// Platforms maps the platforms the image was built for to the digests
+	// of their variants, or to an empty string when Tag is a single
+	// platform image. It's empty for images of unknown platforms.
+	Platforms map[string]string
+	// Attestations attached to the image, when built with them
+	Attestations []Attestation
 }
 
 func (di DeploymentImage) ToSpanAttributes() []attribute.KeyValue {
@@ -221,6 +241,14 @@ func (r *Resolver) BuildImage(ctx context.Context, streams *iostreams.IOStreams,
 
 	span.SetAttributes(attribute.String("tag", opts.Tag))
 
+	cache, cacheKey, cached := r.checkBuildCache(ctx, opts)
+	if cached != nil {
+		span.AddEvent("reusing image built from the same build context")
+		fmt.Fprintf(streams.ErrOut, "Build context unchanged, reusing image %s\n", cached.Tag)
+		span.SetAttributes(cached.ToSpanAttributes()...)
+		return cached, nil
+	}
+
 	strategies := []imageBuilder{}
 
 	if r.dockerFactory.mode.UseNixpacks() {
@@ -261,6 +289,12 @@ func (r *Resolver) BuildImage(ctx context.Context, streams *iostreams.IOStreams,
 			bld.BuildAndPushFinish()
 			bld.FinishStrategy(s, false /* success */, nil, note)
 			r.finishBuild(ctx, bld, false /* completed */, "", img)
+			if cache != nil {
+				cache.remember(opts.AppName, cacheKey, img)
+				if err := cache.save(); err != nil {
+					terminal.Debugf("failed saving build cache: %v\n", err)
+				}
+			}
 			return img, nil
 		}
 		bld.BuildAndPushFinish()
@@ -271,6 +305,48 @@ func (r *Resolver) BuildImage(ctx context.Context, streams *iostreams.IOStreams,
 	return nil, errors.New("app does not have a Dockerfile or buildpacks configured. See https://fly.io/docs/reference/configuration/#the-build-section")
 }
 
+// checkBuildCache hashes the build context when the image to build can be
+// reused by later deploys, returning the image pushed for the same hash
+// before if there's one. The cache is only returned when the image about to
+// be built should be remembered. Failing to use the cache isn't fatal, it
+// only means building.
+func (r *Resolver) checkBuildCache(ctx context.Context, opts ImageOptions) (cache *buildCache, key string, img *DeploymentImage) {
+	ctx, span := tracing.GetTracer().Start(ctx, "check_build_cache")
+	defer span.End()
+
+	// Only pushed images can be reused, and --no-cache asks for a fresh build
+	if !opts.Publish || opts.NoCache || r.dockerFactory.mode.UseNixpacks() {
+		return nil, "", nil
+	}
+
+	dockerfile := buildCacheDockerfile(opts)
+	if dockerfile == "" {
+		return nil, "", nil
+	}
+
+	cache, err := loadBuildCache(state.ConfigDirectory(ctx))
+	if err != nil {
+		terminal.Debugf("failed loading build cache: %v\n", err)
+		return nil, "", nil
+	}
+
+	if key, err = buildCacheKey(dockerfile, opts); err != nil {
+		terminal.Debugf("failed hashing build context: %v\n", err)
+		return nil, "", nil
+	}
+	span.SetAttributes(attribute.String("build_cache.key", key))
+
+	if opts.ForceBuild {
+		return cache, key, nil
+	}
+
+	if img, err = cachedImage(ctx, r.apiClient, cache, opts.AppName, key); err != nil {
+		terminal.Debugf("failed checking for cached image: %v\n", err)
+		return cache, key, nil
+	}
+	return cache, key, img
+}
+
 func (r *Resolver) createImageBuild(ctx context.Context, strategies []imageResolver, opts RefOptions) (*build, error) {
 	strategiesAvailable := make([]string, 0)
 	for _, r := range strategies {
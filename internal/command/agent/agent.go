@@ -29,9 +29,12 @@ func New() (cmd *cobra.Command) {
 	cmd.AddCommand(
 		newRun(),
 		newPing(),
+		newStatus(),
 		newStart(),
 		newStop(),
 		newRestart(),
+		newSocks(),
+		newDNS(),
 	)
 
 	if env.IsTruthy("DEV") {
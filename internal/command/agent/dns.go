@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/orgs"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newDNS() (cmd *cobra.Command) {
+	const (
+		short = "Manage DNS servers for private network names"
+		long  = `The agent can run a DNS server for the private network of an organization,
+answering queries for names ending in .internal and .flycast through the
+organization's DNS. Point a split-DNS resolver at it to use private names from
+any tool, e.g. on macOS with /etc/resolver/internal containing
+
+    nameserver 127.0.0.1
+    port 5353
+
+or with systemd-resolved using 'resolvectl dns' and 'resolvectl domain'.
+`
+		usage = "dns <command>"
+	)
+
+	cmd = command.New(usage, short, long, nil)
+
+	cmd.AddCommand(
+		newDNSStart(),
+		newDNSStop(),
+		newDNSList(),
+	)
+
+	return
+}
+
+func newDNSStart() (cmd *cobra.Command) {
+	const (
+		short = "Start a DNS server for the private network of an organization"
+		long  = short + `. It listens on UDP and TCP and runs in the agent until
+stopped or the agent exits. Queries for other names are answered with NXDOMAIN,
+or forwarded to the server given with --upstream.
+
+DNS servers don't authenticate their clients, so they only listen on loopback
+addresses such as 127.0.0.1 or [::1].
+`
+	)
+
+	cmd = command.New("start", short, long, runDNSStart,
+		command.RequireSession,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.Org(),
+		flag.String{
+			Name:        "bind",
+			Description: "The loopback address to listen on",
+			Default:     "127.0.0.1:5353",
+		},
+		flag.String{
+			Name:        "upstream",
+			Description: "Forward queries for other names to this DNS server, e.g. 1.1.1.1:53",
+		},
+		flag.JSONOutput(),
+	)
+
+	return
+}
+
+func runDNSStart(ctx context.Context) (err error) {
+	bind := flag.GetString(ctx, "bind")
+	if err = agent.CheckLoopbackBind(bind); err != nil {
+		return
+	}
+
+	org, err := orgs.OrgFromFlagOrSelect(ctx)
+	if err != nil {
+		return
+	}
+
+	var client *agent.Client
+	if client, err = establish(ctx); err != nil {
+		return
+	}
+
+	var server agent.DNSServer
+	if server, err = client.StartDNS(ctx, org.Slug, "", bind, flag.GetString(ctx, "upstream")); err != nil {
+		err = fmt.Errorf("failed starting dns server: %w", err)
+
+		return
+	}
+
+	if out := iostreams.FromContext(ctx).Out; config.FromContext(ctx).JSONOutput {
+		err = render.JSON(out, server)
+	} else {
+		fmt.Fprintf(out, "Resolving %s network names on %s\n", server.Org, server.Addr)
+	}
+
+	return
+}
+
+func newDNSStop() (cmd *cobra.Command) {
+	const (
+		short = "Stop a DNS server"
+		long  = short + ", given the address it listens on\n"
+		usage = "stop <address>"
+	)
+
+	cmd = command.New(usage, short, long, runDNSStop)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	return
+}
+
+func runDNSStop(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	if err = client.StopDNS(ctx, flag.FirstArg(ctx)); err != nil {
+		return
+	}
+
+	fmt.Fprintf(iostreams.FromContext(ctx).Out, "Stopped dns server on %s\n", flag.FirstArg(ctx))
+
+	return
+}
+
+func newDNSList() (cmd *cobra.Command) {
+	const (
+		short = "List the DNS servers the agent runs"
+		long  = short + "\n"
+	)
+
+	cmd = command.New("list", short, long, runDNSList)
+
+	cmd.Aliases = []string{"ls"}
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd, flag.JSONOutput())
+
+	return
+}
+
+func runDNSList(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	var servers []agent.DNSServer
+	if servers, err = client.DNSServers(ctx); err != nil {
+		return
+	}
+
+	out := iostreams.FromContext(ctx).Out
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(out, servers)
+	}
+
+	rows := make([][]string, 0, len(servers))
+	for _, s := range servers {
+		rows = append(rows, []string{s.Addr, s.Org, s.Upstream})
+	}
+
+	return render.Table(out, "", rows, "Address", "Organization", "Upstream")
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/env"
 	"github.com/superfly/flyctl/internal/filemu"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/state"
@@ -36,6 +37,13 @@ func newRun() (cmd *cobra.Command) {
 	cmd.Args = cobra.MaximumNArgs(1)
 	cmd.Aliases = []string{"daemon-start"}
 
+	flag.Add(cmd,
+		flag.String{
+			Name:        "metrics-addr",
+			Description: "Serve tunnel metrics in the Prometheus text format on this loopback address, e.g. 127.0.0.1:9091. Defaults to $FLY_AGENT_METRICS_ADDR",
+		},
+	)
+
 	return
 }
 
@@ -67,11 +75,21 @@ func run(ctx context.Context) error {
 		Background:       logPath != "",
 		ConfigFile:       state.ConfigFile(ctx),
 		ConfigWebsockets: viper.GetBool(flyctl.ConfigWireGuardWebsockets),
+		MetricsAddr:      metricsAddr(ctx),
 	}
 
 	return server.Run(ctx, opt)
 }
 
+// metricsAddr is taken from the environment when the flag isn't set, since
+// agents started in the background aren't passed flags
+func metricsAddr(ctx context.Context) string {
+	if addr := flag.GetString(ctx, "metrics-addr"); addr != "" {
+		return addr
+	}
+	return env.First("FLY_AGENT_METRICS_ADDR")
+}
+
 func setupLogger(path string) (logger *log.Logger, close func(), err error) {
 	var out io.Writer
 	if path != "" {
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/orgs"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newSocks() (cmd *cobra.Command) {
+	const (
+		short = "Manage SOCKS5 and HTTP CONNECT proxies into private networks"
+		long  = `The agent can run SOCKS5 and HTTP CONNECT proxies into the private network of
+an organization, so that browsers, database GUIs and tools such as
+'curl --socks5-hostname' reach any private app directly. Names ending in
+.internal and .flycast are resolved through the organization's DNS.
+`
+		usage = "socks <command>"
+	)
+
+	cmd = command.New(usage, short, long, nil)
+
+	cmd.AddCommand(
+		newSocksStart(),
+		newSocksStop(),
+		newSocksList(),
+	)
+
+	return
+}
+
+func newSocksStart() (cmd *cobra.Command) {
+	const (
+		short = "Start a proxy into the private network of an organization"
+		long  = short + `. It runs in the agent until stopped or the agent
+exits, and accepts both SOCKS5 and HTTP CONNECT clients on the same address.
+
+Proxies don't authenticate their clients, so they only listen on loopback
+addresses such as 127.0.0.1 or [::1].
+`
+	)
+
+	cmd = command.New("start", short, long, runSocksStart,
+		command.RequireSession,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.Org(),
+		flag.String{
+			Name:        "bind",
+			Description: "The loopback address to listen on",
+			Default:     "127.0.0.1:1080",
+		},
+		flag.JSONOutput(),
+	)
+
+	return
+}
+
+func runSocksStart(ctx context.Context) (err error) {
+	bind := flag.GetString(ctx, "bind")
+	if err = agent.CheckLoopbackBind(bind); err != nil {
+		return
+	}
+
+	org, err := orgs.OrgFromFlagOrSelect(ctx)
+	if err != nil {
+		return
+	}
+
+	var client *agent.Client
+	if client, err = establish(ctx); err != nil {
+		return
+	}
+
+	var proxy agent.SocksProxy
+	if proxy, err = client.StartSocks(ctx, org.Slug, "", bind); err != nil {
+		err = fmt.Errorf("failed starting proxy: %w", err)
+
+		return
+	}
+
+	if out := iostreams.FromContext(ctx).Out; config.FromContext(ctx).JSONOutput {
+		err = render.JSON(out, proxy)
+	} else {
+		fmt.Fprintf(out, "Proxying to the %s network on %s\n", proxy.Org, proxy.Addr)
+		fmt.Fprintf(out, "Try: curl --socks5-hostname %s http://<app>.internal:<port>/\n", proxy.Addr)
+	}
+
+	return
+}
+
+func newSocksStop() (cmd *cobra.Command) {
+	const (
+		short = "Stop a proxy"
+		long  = short + ", given the address it listens on\n"
+		usage = "stop <address>"
+	)
+
+	cmd = command.New(usage, short, long, runSocksStop)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	return
+}
+
+func runSocksStop(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	if err = client.StopSocks(ctx, flag.FirstArg(ctx)); err != nil {
+		return
+	}
+
+	fmt.Fprintf(iostreams.FromContext(ctx).Out, "Stopped proxy on %s\n", flag.FirstArg(ctx))
+
+	return
+}
+
+func newSocksList() (cmd *cobra.Command) {
+	const (
+		short = "List the proxies the agent runs"
+		long  = short + "\n"
+	)
+
+	cmd = command.New("list", short, long, runSocksList)
+
+	cmd.Aliases = []string{"ls"}
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd, flag.JSONOutput())
+
+	return
+}
+
+func runSocksList(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	var proxies []agent.SocksProxy
+	if proxies, err = client.SocksProxies(ctx); err != nil {
+		return
+	}
+
+	out := iostreams.FromContext(ctx).Out
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(out, proxies)
+	}
+
+	rows := make([][]string, 0, len(proxies))
+	for _, p := range proxies {
+		rows = append(rows, []string{p.Addr, p.Org})
+	}
+
+	return render.Table(out, "", rows, "Address", "Organization")
+}
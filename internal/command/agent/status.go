@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newStatus() (cmd *cobra.Command) {
+	const (
+		short = "Show the health of the Fly agent's tunnels"
+		long  = short + `. Each tunnel is probed by looking up _api.internal
+through it, and reported with its WireGuard endpoint, last handshake, bytes
+received and sent, and connections open through it.
+
+The agent also serves these as Prometheus metrics when run with
+--metrics-addr or $FLY_AGENT_METRICS_ADDR set.
+`
+	)
+
+	cmd = command.New("status", short, long, runStatus)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd, flag.JSONOutput())
+	return
+}
+
+func runStatus(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	var status agent.StatusResponse
+	if status, err = client.Status(ctx); err != nil {
+		err = fmt.Errorf("failed fetching agent status: %w", err)
+
+		return
+	}
+
+	out := iostreams.FromContext(ctx).Out
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(out, status)
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%-10s: %d\n", "PID", status.PID)
+	fmt.Fprintf(&buf, "%-10s: %s\n", "Version", status.Version)
+	fmt.Fprintf(&buf, "%-10s: %t\n", "Background", status.Background)
+	fmt.Fprintln(&buf)
+
+	if _, err = buf.WriteTo(out); err != nil {
+		return
+	}
+
+	rows := make([][]string, 0, len(status.Tunnels))
+	for _, t := range status.Tunnels {
+		handshake := "never"
+		if !t.LastHandshake.IsZero() {
+			handshake = humanize.Time(t.LastHandshake)
+		}
+		probe := t.ProbeLatency.Round(time.Millisecond).String()
+		if t.Error != "" {
+			probe = t.Error
+		}
+
+		rows = append(rows, []string{
+			t.Org,
+			t.Network,
+			t.Endpoint,
+			handshake,
+			humanize.Bytes(uint64(t.RxBytes)),
+			humanize.Bytes(uint64(t.TxBytes)),
+			fmt.Sprint(t.ActiveConnections),
+			probe,
+		})
+	}
+	if err = render.Table(out, "Tunnels", rows, "Organization", "Network", "Endpoint", "Last Handshake", "Received", "Sent", "Connections", "Probe"); err != nil {
+		return
+	}
+
+	if len(status.SocksProxies) > 0 {
+		rows = rows[:0]
+		for _, p := range status.SocksProxies {
+			rows = append(rows, []string{p.Addr, p.Org, p.Network})
+		}
+		if err = render.Table(out, "Proxies", rows, "Address", "Organization", "Network"); err != nil {
+			return
+		}
+	}
+
+	if len(status.DNSServers) > 0 {
+		rows = rows[:0]
+		for _, d := range status.DNSServers {
+			rows = append(rows, []string{d.Addr, d.Org, d.Upstream})
+		}
+		err = render.Table(out, "DNS Servers", rows, "Address", "Organization", "Upstream")
+	}
+
+	return
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/superfly/flyctl/internal/metrics"
 	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/internal/sentry"
+	"github.com/superfly/flyctl/internal/statuslogger"
 	"github.com/superfly/flyctl/internal/tracing"
 	"github.com/superfly/flyctl/iostreams"
 	"go.opentelemetry.io/otel/attribute"
@@ -48,7 +49,10 @@ var CommonFlags = flag.Set{
 	flag.BuildArg(),
 	flag.BuildSecret(),
 	flag.BuildTarget(),
+	flag.Platform(),
+	flag.Attest(),
 	flag.NoCache(),
+	flag.ForceBuild(),
 	flag.Nixpacks(),
 	flag.BuildOnly(),
 	flag.BpDockerHost(),
@@ -204,12 +208,32 @@ func New() *Command {
 			Description: "Do not run the release command during deployment.",
 			Default:     false,
 		},
+		flag.Bool{
+			Name:        "plan",
+			Description: "Show the changes the deployment would make to machines and volumes, without building or deploying anything",
+			Default:     false,
+		},
+		flag.JSONOutput(),
+		flag.Bool{
+			Name:        "auto-rollback",
+			Description: "Revert updated machines to their previous configuration if a rolling or immediate deployment fails. Same as setting 'auto_rollback' in the [experimental] section of fly.toml.",
+			Default:     false,
+		},
+		flag.ProgressOutput(),
 	)
 
 	return cmd
 }
 
 func (cmd *Command) run(ctx context.Context) (err error) {
+	jsonLines, err := flag.GetJSONLinesOutput(ctx)
+	if err != nil {
+		return err
+	}
+	if jsonLines {
+		ctx = statuslogger.NewJSONLinesContext(ctx)
+	}
+
 	io := iostreams.FromContext(ctx)
 	appName := appconfig.NameFromContext(ctx)
 
@@ -297,6 +321,10 @@ func DeployWithConfig(ctx context.Context, appConfig *appconfig.Config, forceYes
 		}
 	}
 
+	if flag.GetBool(ctx, "plan") {
+		return planDeployment(ctx, appConfig, appCompact)
+	}
+
 	httpFailover := flag.GetHTTPSFailover(ctx)
 	usingWireguard := flag.GetWireguard(ctx)
 	recreateBuilder := flag.GetRecreateBuilder(ctx)
@@ -385,31 +413,103 @@ func deployToMachines(
 		metrics.Status(ctx, "deploy_machines", err == nil)
 	}()
 
-	releaseCmdTimeout, err := parseDurationFlag(ctx, "release-command-timeout")
+	status.AppName = app.Name
+	status.OrgSlug = app.Organization.Slug
+	status.Image = img.Tag
+	status.PrimaryRegion = cfg.PrimaryRegion
+	status.Strategy = cfg.DeployStrategy()
+	if flag.GetString(ctx, "strategy") != "" {
+		status.Strategy = flag.GetString(ctx, "strategy")
+	}
+
+	status.FlyctlVersion = buildinfo.Info().Version.String()
+
+	// Machines run the variant of multi-platform images built for them
+	imageRef, err := img.PlatformRef(imgsrc.MachinePlatform)
 	if err != nil {
 		return err
 	}
 
-	waitTimeout, err := parseDurationFlag(ctx, "wait-timeout")
+	args, err := deploymentArgsFromFlags(ctx, cfg, app, imageRef)
 	if err != nil {
 		return err
 	}
 
-	leaseTimeout, err := parseDurationFlag(ctx, "lease-timeout")
+	md, err := NewMachineDeployment(ctx, args)
 	if err != nil {
+		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", app)
 		return err
 	}
 
-	files, err := command.FilesFromCommand(ctx)
+	err = md.DeployMachinesApp(ctx)
+	if err != nil {
+		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", app)
+	}
+	return err
+}
+
+// planDeployment prints what deploying the app config would change, without touching the
+// app's machines or building an image.
+func planDeployment(ctx context.Context, cfg *appconfig.Config, app *fly.AppCompact) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "plan_deployment")
+	defer span.End()
+	ctx = appconfig.WithConfig(ctx, cfg)
+
+	image, err := fetchImageRef(ctx, cfg)
 	if err != nil {
 		return err
 	}
+	if image == "" {
+		image = planPlaceholderImage
+	}
 
-	guest, err := flag.GetMachineGuest(ctx, nil)
+	args, err := deploymentArgsFromFlags(ctx, cfg, app, image)
+	if err != nil {
+		return err
+	}
+	args.DryRun = true
+
+	md, err := NewMachineDeployment(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	plan, err := md.PlanMachinesApp(ctx)
 	if err != nil {
 		return err
 	}
 
+	io := iostreams.FromContext(ctx)
+	return RenderPlan(io.Out, io.ColorScheme(), plan, config.FromContext(ctx).JSONOutput)
+}
+
+// deploymentArgsFromFlags builds the machine deployment arguments out of the command line flags
+func deploymentArgsFromFlags(ctx context.Context, cfg *appconfig.Config, app *fly.AppCompact, image string) (MachineDeploymentArgs, error) {
+	releaseCmdTimeout, err := parseDurationFlag(ctx, "release-command-timeout")
+	if err != nil {
+		return MachineDeploymentArgs{}, err
+	}
+
+	waitTimeout, err := parseDurationFlag(ctx, "wait-timeout")
+	if err != nil {
+		return MachineDeploymentArgs{}, err
+	}
+
+	leaseTimeout, err := parseDurationFlag(ctx, "lease-timeout")
+	if err != nil {
+		return MachineDeploymentArgs{}, err
+	}
+
+	files, err := command.FilesFromCommand(ctx)
+	if err != nil {
+		return MachineDeploymentArgs{}, err
+	}
+
+	guest, err := flag.GetMachineGuest(ctx, nil)
+	if err != nil {
+		return MachineDeploymentArgs{}, err
+	}
+
 	excludeRegions := make(map[string]bool)
 	for _, r := range flag.GetNonEmptyStringSlice(ctx, "exclude-regions") {
 		excludeRegions[r] = true
@@ -443,7 +543,7 @@ func deployToMachines(
 		maxUnavailable = fly.Pointer(flag.GetFloat64(ctx, "max-unavailable"))
 		// Validation to ensure that 0.0 is *purely* the "unspecified" value
 		if *maxUnavailable <= 0 {
-			return fmt.Errorf("the value for --max-unavailable must be > 0")
+			return MachineDeploymentArgs{}, fmt.Errorf("the value for --max-unavailable must be > 0")
 		}
 	}
 
@@ -453,20 +553,9 @@ func deployToMachines(
 		maxConcurrent = immediateMaxConcurrent
 	}
 
-	status.AppName = app.Name
-	status.OrgSlug = app.Organization.Slug
-	status.Image = img.Tag
-	status.PrimaryRegion = cfg.PrimaryRegion
-	status.Strategy = cfg.DeployStrategy()
-	if flag.GetString(ctx, "strategy") != "" {
-		status.Strategy = flag.GetString(ctx, "strategy")
-	}
-
-	status.FlyctlVersion = buildinfo.Info().Version.String()
-
-	md, err := NewMachineDeployment(ctx, MachineDeploymentArgs{
+	return MachineDeploymentArgs{
 		AppCompact:            app,
-		DeploymentImage:       img.Tag,
+		DeploymentImage:       image,
 		Strategy:              flag.GetString(ctx, "strategy"),
 		EnvFromFlags:          flag.GetStringArray(ctx, "env"),
 		PrimaryRegionFlag:     cfg.PrimaryRegion,
@@ -474,6 +563,7 @@ func deployToMachines(
 		SkipHealthChecks:      flag.GetDetach(ctx),
 		SkipDNSChecks:         flag.GetDetach(ctx) || !flag.GetBool(ctx, "dns-checks"),
 		SkipReleaseCommand:    flag.GetBool(ctx, "skip-release-command"),
+		AutoRollback:          flag.GetBool(ctx, "auto-rollback"),
 		WaitTimeout:           waitTimeout,
 		StopSignal:            flag.GetString(ctx, "signal"),
 		ReleaseCmdTimeout:     releaseCmdTimeout,
@@ -491,17 +581,7 @@ func deployToMachines(
 		MaxConcurrent:         maxConcurrent,
 		VolumeInitialSize:     flag.GetInt(ctx, "volume-initial-size"),
 		ProcessGroups:         processGroups,
-	})
-	if err != nil {
-		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", app)
-		return err
-	}
-
-	err = md.DeployMachinesApp(ctx)
-	if err != nil {
-		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", app)
-	}
-	return err
+	}, nil
 }
 
 // determineAppConfig fetches the app config from a local file, or in its absence, from the API
@@ -543,7 +623,7 @@ func determineAppConfig(ctx context.Context) (cfg *appconfig.Config, err error)
 		return nil, err
 	}
 
-	if cfg.Deploy != nil && cfg.Deploy.Strategy != "rolling" && cfg.Deploy.Strategy != "canary" && cfg.Deploy.MaxUnavailable != nil {
+	if cfg.Deploy != nil && cfg.Deploy.Strategy != "rolling" && cfg.Deploy.Strategy != "canary" && cfg.Deploy.Strategy != "progressive" && cfg.Deploy.MaxUnavailable != nil {
 		if !config.FromContext(ctx).JSONOutput {
 			fmt.Fprintf(io.Out, "Warning: max-unavailable set for non-rolling strategy '%s', ignoring\n", cfg.Deploy.Strategy)
 		}
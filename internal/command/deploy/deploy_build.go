@@ -110,6 +110,8 @@ func determineImage(ctx context.Context, appConfig *appconfig.Config, useWG, rec
 		Publish:              flag.GetBool(ctx, "push") || !flag.GetBuildOnly(ctx),
 		ImageLabel:           flag.GetString(ctx, "image-label"),
 		NoCache:              flag.GetBool(ctx, "no-cache"),
+		ForceBuild:           flag.GetBool(ctx, "force-build"),
+		Attest:               flag.GetBool(ctx, "attest"),
 		BuiltIn:              build.Builtin,
 		BuiltInSettings:      build.Settings,
 		Builder:              build.Builder,
@@ -174,6 +176,23 @@ func determineImage(ctx context.Context, appConfig *appconfig.Config, useWG, rec
 		opts.Target = target
 	}
 
+	platforms := flag.GetStringSlice(ctx, "platform")
+	if len(platforms) == 0 {
+		platforms = appConfig.BuildPlatforms()
+	}
+	if opts.Platforms, err = imgsrc.NormalizePlatforms(platforms); err != nil {
+		tracing.RecordError(span, err, "failed to parse build platforms")
+		return
+	}
+	// Images that are deployed have to run on machines, so fail before
+	// building one that can't
+	if !flag.GetBuildOnly(ctx) {
+		if err = imgsrc.CheckMachinePlatform(opts.Platforms); err != nil {
+			tracing.RecordError(span, err, "build platforms exclude the machine platform")
+			return
+		}
+	}
+
 	span.SetAttributes(opts.ToSpanAttributes()...)
 
 	// finally, build the image
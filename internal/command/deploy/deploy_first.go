@@ -15,6 +15,9 @@ func (md *machineDeployment) provisionFirstDeploy(ctx context.Context, allocPubl
 	if !md.isFirstDeploy || md.restartOnly {
 		return nil
 	}
+	if md.dryRun {
+		return md.provisionVolumesOnFirstDeploy(ctx)
+	}
 	if err := md.provisionIpsOnFirstDeploy(ctx, allocPublicIPs); err != nil {
 		fmt.Fprintf(md.io.ErrOut, "Failed to provision IP addresses. Use `fly ips` commands to remediate it. ERROR: %s", err)
 	}
@@ -131,6 +134,22 @@ func (md *machineDeployment) provisionVolumesOnFirstDeploy(ctx context.Context)
 				initialSize = DefaultVolumeInitialSizeGB
 			}
 
+			// Keep track of the volume as if it was created, so the plan can attach it to new machines
+			if md.dryRun {
+				md.plannedVolumes = append(md.plannedVolumes, VolumePlan{
+					Name:         m.Source,
+					Region:       groupConfig.PrimaryRegion,
+					SizeGB:       initialSize,
+					ProcessGroup: groupName,
+				})
+				md.volumes[m.Source] = append(md.volumes[m.Source], fly.Volume{
+					Name:   m.Source,
+					Region: groupConfig.PrimaryRegion,
+					SizeGb: initialSize,
+				})
+				continue
+			}
+
 			fmt.Fprintf(
 				md.io.Out,
 				"Creating a %d GB volume named '%s' for process group '%s'. "+
@@ -40,6 +40,7 @@ const (
 
 type MachineDeployment interface {
 	DeployMachinesApp(context.Context) error
+	PlanMachinesApp(context.Context) (*DeploymentPlan, error)
 }
 
 type MachineDeploymentArgs struct {
@@ -72,6 +73,10 @@ type MachineDeploymentArgs struct {
 	VolumeInitialSize     int
 	RestartPolicy         *fly.MachineRestartPolicy
 	RestartMaxRetries     int
+	AutoRollback          bool
+	// DryRun prepares the deployment without creating a release or any first deploy resources,
+	// only PlanMachinesApp can be called on it.
+	DryRun bool
 }
 
 type machineDeployment struct {
@@ -111,6 +116,12 @@ type machineDeployment struct {
 	processGroups         map[string]bool
 	maxConcurrent         int
 	volumeInitialSize     int
+	progressiveSteps      []int
+	bakeTime              time.Duration
+	maxRestarts           int
+	autoRollback          bool
+	dryRun                bool
+	plannedVolumes        []VolumePlan
 }
 
 func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (_ MachineDeployment, err error) {
@@ -206,6 +217,20 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (_ Ma
 		maxConcurrent = 1
 	}
 
+	progressiveSteps := DefaultProgressiveSteps
+	bakeTime := DefaultProgressiveBakeTime
+	var maxRestarts int
+	if appConfig.Deploy != nil && appConfig.Deploy.Progressive != nil {
+		progressive := appConfig.Deploy.Progressive
+		if len(progressive.Steps) > 0 {
+			progressiveSteps = progressive.Steps
+		}
+		if progressive.BakeTime != nil {
+			bakeTime = progressive.BakeTime.Duration
+		}
+		maxRestarts = progressive.MaxRestarts
+	}
+
 	md := &machineDeployment{
 		apiClient:             apiClient,
 		flapsClient:           flapsClient,
@@ -235,6 +260,11 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (_ Ma
 		maxConcurrent:         maxConcurrent,
 		volumeInitialSize:     args.VolumeInitialSize,
 		processGroups:         args.ProcessGroups,
+		progressiveSteps:      progressiveSteps,
+		bakeTime:              bakeTime,
+		maxRestarts:           maxRestarts,
+		autoRollback:          args.AutoRollback || (appConfig.Experimental != nil && appConfig.Experimental.AutoRollback),
+		dryRun:                args.DryRun,
 	}
 	if err := md.setStrategy(); err != nil {
 		tracing.RecordError(span, err, "failed to set strategy")
@@ -268,6 +298,10 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (_ Ma
 		tracing.RecordError(span, err, "failed to validate volume config")
 		return nil, err
 	}
+	if md.dryRun {
+		span.SetAttributes(md.ToSpanAttributes()...)
+		return md, nil
+	}
 	if err = md.createReleaseInBackend(ctx); err != nil {
 		tracing.RecordError(span, err, "failed to create release in backend")
 		return nil, err
@@ -533,10 +567,16 @@ func (md *machineDeployment) createReleaseInBackend(ctx context.Context) error {
 	ctx, span := tracing.GetTracer().Start(ctx, "create_backend_release")
 	defer span.End()
 
+	// The platform doesn't know about progressive deployments, record them as rolling ones.
+	strategy := md.strategy
+	if strategy == "progressive" {
+		strategy = "rolling"
+	}
+
 	resp, err := md.apiClient.CreateRelease(ctx, fly.CreateReleaseInput{
 		AppId:           md.app.Name,
 		PlatformVersion: "machines",
-		Strategy:        fly.DeploymentStrategy(strings.ToUpper(md.strategy)),
+		Strategy:        fly.DeploymentStrategy(strings.ToUpper(strategy)),
 		Definition:      md.appConfig,
 		Image:           md.img,
 	})
@@ -648,6 +688,8 @@ func (md *machineDeployment) ToSpanAttributes() []attribute.KeyValue {
 		attribute.Float64("deployment.release_cmd_timeout", md.releaseCmdTimeout.Seconds()),
 		attribute.Bool("deployment.increased_availability", md.increasedAvailability),
 		attribute.Bool("deployment.update_only", md.updateOnly),
+		attribute.Bool("deployment.auto_rollback", md.autoRollback),
+		attribute.Bool("deployment.dry_run", md.dryRun),
 		attribute.Int("deployment.max_concurrency", md.maxConcurrent),
 		attribute.Int("deployment.volume_initial_size", md.volumeInitialSize),
 	}
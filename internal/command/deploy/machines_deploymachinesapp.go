@@ -59,6 +59,11 @@ func (md *machineDeployment) DeployMachinesApp(ctx context.Context) error {
 		err = md.restartMachinesApp(ctx)
 	} else {
 		err = md.deployMachinesApp(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			if hookErr := md.runDeployHooks(onInterruptContext, deployHookStageOnFailure, err); hookErr != nil {
+				terminal.Warnf("%v\n", hookErr)
+			}
+		}
 	}
 
 	var status string
@@ -275,14 +280,20 @@ func (md *machineDeployment) deployCreateMachinesForGroups(ctx context.Context,
 }
 
 // deployMachinesApp executes the following flow:
+//   - Run pre_deploy hooks
 //   - Run release command
 //   - Remove spare machines from removed groups
 //   - Launch new machines on new groups
 //   - Update existing machines
+//   - Run post_deploy hooks
 func (md *machineDeployment) deployMachinesApp(ctx context.Context) error {
 	ctx, span := tracing.GetTracer().Start(ctx, "deploy_new_machines")
 	defer span.End()
 
+	if err := md.runDeployHooks(ctx, deployHookStagePreDeploy, nil); err != nil {
+		return fmt.Errorf("aborting deployment. %w", err)
+	}
+
 	if !md.skipReleaseCommand {
 		if err := md.runReleaseCommand(ctx); err != nil {
 			return fmt.Errorf("release command failed - aborting deployment. %w", err)
@@ -329,12 +340,19 @@ func (md *machineDeployment) deployMachinesApp(ctx context.Context) error {
 		machineUpdateEntries = append(machineUpdateEntries, &machineUpdateEntry{leasableMachine: lm, launchInput: li})
 	}
 
-	return md.updateExistingMachines(ctx, machineUpdateEntries)
+	if err := md.updateExistingMachines(ctx, machineUpdateEntries); err != nil {
+		return err
+	}
+
+	return md.runDeployHooks(ctx, deployHookStagePostDeploy, nil)
 }
 
 type machineUpdateEntry struct {
 	leasableMachine machine.LeasableMachine
 	launchInput     *fly.LaunchMachineInput
+	// previousConfig is the machine config before the deployment touched it,
+	// it is only set once updateMachine was called for the entry.
+	previousConfig *fly.MachineConfig
 }
 
 type machineUpdateEntries []*machineUpdateEntry
@@ -460,13 +478,24 @@ func (md *machineDeployment) updateExistingMachines(ctx context.Context, updateE
 	case "bluegreen":
 		// TODO(billy) do machine checks here
 		return md.updateUsingBlueGreenStrategy(ctx, updateEntries)
+	case "progressive":
+		// Progressive deployments roll back on their own
+		return md.updateUsingProgressiveStrategy(ctx, updateEntries)
 	case "immediate":
-		return md.updateUsingImmediateStrategy(ctx, updateEntries)
+		err = md.updateUsingImmediateStrategy(ctx, updateEntries)
 	case "canary", "rolling":
 		fallthrough
 	default:
-		return md.updateUsingRollingStrategy(ctx, updateEntries)
+		err = md.updateUsingRollingStrategy(ctx, updateEntries)
 	}
+
+	if err != nil && md.autoRollback {
+		fmt.Fprintf(md.io.ErrOut, "Deployment failed after error: %s\n", err)
+		if rollbackErr := md.rollbackMachines(context.WithoutCancel(ctx), updateEntries); rollbackErr != nil {
+			fmt.Fprintf(md.io.ErrOut, "Error in rollback: %s\n", rollbackErr)
+		}
+	}
+	return err
 }
 
 func (md *machineDeployment) updateUsingBlueGreenStrategy(ctx context.Context, updateEntries []*machineUpdateEntry) error {
@@ -709,12 +738,18 @@ func (md *machineDeployment) updateMachine(ctx context.Context, e *machineUpdate
 
 	fmtID := e.leasableMachine.FormattedMachineId()
 
+	// Remember how the machine looked before touching it in case it must be rolled back
+	if e.previousConfig == nil {
+		e.previousConfig = machine.CloneConfig(e.leasableMachine.Machine().Config)
+	}
+
 	replaceMachine := func() error {
 		statuslogger.Logf(ctx, "Replacing %s by new machine", md.colorize.Bold(fmtID))
 		if err := md.updateMachineByReplace(ctx, e); err != nil {
 			return err
 		}
 		statuslogger.Logf(ctx, "Created machine %s", md.colorize.Bold(fmtID))
+		statuslogger.LogEvent(ctx, statuslogger.MachineEvent(statuslogger.EventMachineCreated, e.leasableMachine.Machine()))
 		return nil
 	}
 
@@ -735,6 +770,7 @@ func (md *machineDeployment) updateMachine(ctx context.Context, e *machineUpdate
 			return err
 		}
 	}
+	statuslogger.LogEvent(ctx, statuslogger.MachineEvent(statuslogger.EventMachineUpdated, e.leasableMachine.Machine()))
 	return nil
 }
 
@@ -837,6 +873,7 @@ func (md *machineDeployment) spawnMachineInGroup(ctx context.Context, groupName
 
 	lm := machine.NewLeasableMachine(md.flapsClient, md.io, newMachineRaw)
 	statuslogger.Logf(ctx, "Machine %s was created", md.colorize.Bold(lm.FormattedMachineId()))
+	statuslogger.LogEvent(ctx, statuslogger.MachineEvent(statuslogger.EventMachineCreated, lm.Machine()))
 	defer lm.ReleaseLease(ctx)
 
 	// Don't wait for SkipLaunch machines, they are created but not started
@@ -0,0 +1,169 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/internal/inmem"
+	"github.com/superfly/flyctl/internal/logger"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+const (
+	oldImage       = "test-registry.fly.io/test-app:deployment-1"
+	faultTestImage = "test-registry.fly.io/test-app:deployment-2"
+)
+
+// newFaultTestDeployment sets up an app with machines running an older
+// release on the in-memory Machines API, and returns a deployment of a new
+// image to them. Faults injected into the server before calling
+// DeployMachinesApp affect the deployment.
+func newFaultTestDeployment(t *testing.T, strategy string, machines int, checks bool) (context.Context, *inmem.Server, *machineDeployment) {
+	t.Helper()
+
+	var out bytes.Buffer
+	ctx := iostreams.NewContext(context.Background(), &iostreams.IOStreams{Out: &out, ErrOut: &out})
+	ctx = logger.NewContext(ctx, logger.New(&out, logger.Info, true))
+
+	server := inmem.NewServer()
+	server.CreateApp(&fly.App{Name: "test-app", Organization: inmem.DefaultOrganization})
+	require.NoError(t, server.CreateImage(ctx, "test-app", faultTestImage, &fly.Image{ID: "IMAGE2", Ref: faultTestImage, CompressedSize: "1000"}))
+
+	cfg := appconfig.NewConfig()
+	cfg.AppName = "test-app"
+	cfg.PrimaryRegion = "ord"
+	if checks {
+		cfg.Checks = map[string]*appconfig.ToplevelCheck{
+			"alive": {Type: fly.Pointer("tcp"), Port: fly.Pointer(8080)},
+		}
+	}
+
+	flapsClient := server.FlapsClient("test-app")
+	for i := 0; i < machines; i++ {
+		_, err := flapsClient.Launch(ctx, fly.LaunchMachineInput{Region: "ord", Config: &fly.MachineConfig{
+			Image: oldImage,
+			Metadata: map[string]string{
+				fly.MachineConfigMetadataKeyFlyPlatformVersion: fly.MachineFlyPlatformVersion2,
+				fly.MachineConfigMetadataKeyFlyProcessGroup:    fly.MachineProcessGroupApp,
+			},
+		}})
+		require.NoError(t, err)
+	}
+
+	ctx = appconfig.WithConfig(ctx, cfg)
+	ctx = flyutil.NewContextWithClient(ctx, server.Client())
+	ctx = flapsutil.NewContextWithClient(ctx, flapsClient)
+
+	app, err := server.Client().GetAppCompact(ctx, "test-app")
+	require.NoError(t, err)
+
+	waitTimeout, leaseTimeout := 2*time.Second, 5*time.Second
+	md, err := NewMachineDeployment(ctx, MachineDeploymentArgs{
+		AppCompact:      app,
+		DeploymentImage: faultTestImage,
+		Strategy:        strategy,
+		SkipSmokeChecks: true,
+		SkipDNSChecks:   true,
+		WaitTimeout:     &waitTimeout,
+		LeaseTimeout:    &leaseTimeout,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Log(out.String())
+		}
+	})
+	return ctx, server, md.(*machineDeployment)
+}
+
+// machineImages returns the images of the machines of the app, by ID
+func machineImages(t *testing.T, ctx context.Context) map[string]string {
+	t.Helper()
+
+	machines, err := flapsutil.ClientFromContext(ctx).List(ctx, "")
+	require.NoError(t, err)
+	images := map[string]string{}
+	for _, m := range machines {
+		images[m.ID] = m.Config.Image
+	}
+	return images
+}
+
+func TestRollingDeployFaults(t *testing.T) {
+	const m1, m2, m3 = "00000000000001", "00000000000002", "00000000000003"
+
+	t.Run("server errors stop the rollout", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "rolling", 3, false)
+		server.InjectFault(inmem.Fault{Method: "UpdateMachine", Err: inmem.ServerError(http.StatusInternalServerError), Times: 1})
+
+		assert.ErrorContains(t, md.DeployMachinesApp(ctx), "Internal Server Error")
+		assert.Equal(t, map[string]string{m1: oldImage, m2: oldImage, m3: oldImage}, machineImages(t, ctx))
+	})
+
+	t.Run("lease conflicts abort before any update", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "rolling", 3, false)
+		server.InjectFault(inmem.Fault{Method: "AcquireLease", MachineID: m2, Err: inmem.ServerError(http.StatusConflict)})
+
+		assert.ErrorContains(t, md.DeployMachinesApp(ctx), "error acquiring leases")
+		assert.Equal(t, map[string]string{m1: oldImage, m2: oldImage, m3: oldImage}, machineImages(t, ctx))
+		// The leases that were acquired are given back
+		_, err := server.FindLease(ctx, "test-app", m1)
+		assert.Error(t, err)
+	})
+
+	t.Run("flapping checks are waited out", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "rolling", 3, true)
+		server.SetCheckSequence("test-app", m2, "alive", fly.Critical, fly.Passing)
+
+		require.NoError(t, md.DeployMachinesApp(ctx))
+		assert.Equal(t, map[string]string{m1: faultTestImage, m2: faultTestImage, m3: faultTestImage}, machineImages(t, ctx))
+	})
+
+	t.Run("failing checks stop the rollout", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "rolling", 3, true)
+		server.SetCheckSequence("test-app", m2, "alive", fly.Critical)
+
+		assert.ErrorContains(t, md.DeployMachinesApp(ctx), "waiting for health checks to pass for machine "+m2)
+		assert.Equal(t, map[string]string{m1: faultTestImage, m2: faultTestImage, m3: oldImage}, machineImages(t, ctx))
+	})
+
+	t.Run("stuck machines are rolled back", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "rolling", 3, false)
+		md.autoRollback = true
+		md.waitTimeout = 500 * time.Millisecond
+		server.HoldMachineState("test-app", m2, fly.MachineStateStopped)
+
+		assert.ErrorContains(t, md.DeployMachinesApp(ctx), "timeout reached waiting for machine's state to change")
+		assert.Equal(t, map[string]string{m1: oldImage, m2: oldImage, m3: oldImage}, machineImages(t, ctx))
+	})
+}
+
+func TestImmediateDeployFaults(t *testing.T) {
+	const m1, m2, m3 = "00000000000001", "00000000000002", "00000000000003"
+
+	t.Run("server errors only fail their machine", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "immediate", 3, false)
+		server.InjectFault(inmem.Fault{Method: "UpdateMachine", MachineID: m2, Err: inmem.ServerError(http.StatusServiceUnavailable)})
+
+		assert.ErrorContains(t, md.DeployMachinesApp(ctx), "Service Unavailable")
+		assert.Equal(t, map[string]string{m1: faultTestImage, m2: oldImage, m3: faultTestImage}, machineImages(t, ctx))
+	})
+
+	t.Run("stuck machines aren't waited for", func(t *testing.T) {
+		ctx, server, md := newFaultTestDeployment(t, "immediate", 3, true)
+		server.HoldMachineState("test-app", m2, fly.MachineStateStopped)
+		server.SetCheckSequence("test-app", m3, "alive", fly.Critical)
+
+		require.NoError(t, md.DeployMachinesApp(ctx))
+		assert.Equal(t, map[string]string{m1: faultTestImage, m2: faultTestImage, m3: faultTestImage}, machineImages(t, ctx))
+	})
+}
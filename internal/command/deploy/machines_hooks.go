@@ -0,0 +1,188 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	deployHookStagePreDeploy  = "pre_deploy"
+	deployHookStagePostDeploy = "post_deploy"
+	deployHookStageOnFailure  = "on_failure"
+)
+
+const (
+	defaultDeployHookTimeout = 5 * time.Minute
+	// localDeployHookWaitDelay is how long a local hook's output is still
+	// read after it's killed
+	localDeployHookWaitDelay = time.Second
+)
+
+func (md *machineDeployment) deployHooks(stage string) []appconfig.DeployHook {
+	if md.appConfig.Deploy == nil || md.appConfig.Deploy.Hooks == nil {
+		return nil
+	}
+	hooks := md.appConfig.Deploy.Hooks
+	switch stage {
+	case deployHookStagePreDeploy:
+		return hooks.PreDeploy
+	case deployHookStagePostDeploy:
+		return hooks.PostDeploy
+	case deployHookStageOnFailure:
+		return hooks.OnFailure
+	}
+	return nil
+}
+
+// runDeployHooks runs the hooks configured for a deployment stage in order.
+// It stops at the first failing hook unless its failure policy is "continue".
+// deployErr is only set for on_failure hooks and passed to them in FLY_DEPLOY_ERROR.
+func (md *machineDeployment) runDeployHooks(ctx context.Context, stage string, deployErr error) error {
+	hooks := md.deployHooks(stage)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.GetTracer().Start(ctx, "run_deploy_hooks", trace.WithAttributes(
+		attribute.String("stage", stage),
+		attribute.Int("hooks", len(hooks)),
+	))
+	defer span.End()
+
+	env := md.deployHookEnv(stage, deployErr)
+	for idx, hook := range hooks {
+		fmt.Fprintf(md.io.ErrOut, "Running %s %s hook %d/%d: %s\n",
+			md.colorize.Bold(md.app.Name), stage, idx+1, len(hooks), md.colorize.Bold(hook.DisplayName()),
+		)
+
+		hookErr := md.runDeployHook(ctx, hook, env)
+		if hookErr == nil {
+			continue
+		}
+
+		hookErr = fmt.Errorf("%s hook '%s' failed: %w", stage, hook.DisplayName(), hookErr)
+		if hook.ContinueOnFailure() {
+			fmt.Fprintf(md.io.ErrOut, "%s %v, continuing\n", md.colorize.WarningIcon(), hookErr)
+			continue
+		}
+		tracing.RecordError(span, hookErr, "deploy hook failed")
+		return hookErr
+	}
+	return nil
+}
+
+// deployHookEnv is the environment set for every hook of a stage, on top of the app env for
+// machine hooks and the flyctl environment for local hooks.
+func (md *machineDeployment) deployHookEnv(stage string, deployErr error) map[string]string {
+	env := map[string]string{
+		"FLY_APP_NAME":        md.app.Name,
+		"FLY_IMAGE_REF":       md.img,
+		"FLY_RELEASE_ID":      md.releaseId,
+		"FLY_RELEASE_VERSION": strconv.Itoa(md.releaseVersion),
+		"FLY_DEPLOY_HOOK":     stage,
+	}
+	if deployErr != nil {
+		env["FLY_DEPLOY_ERROR"] = deployErr.Error()
+	}
+	return env
+}
+
+func (md *machineDeployment) runDeployHook(ctx context.Context, hook appconfig.DeployHook, env map[string]string) error {
+	timeout := defaultDeployHookTimeout
+	if hook.Timeout != nil {
+		timeout = hook.Timeout.Duration
+	}
+
+	if hook.RunsLocally() {
+		return md.runLocalDeployHook(ctx, hook, env, timeout)
+	}
+	return md.runMachineDeployHook(ctx, hook, env, timeout)
+}
+
+func (md *machineDeployment) runLocalDeployHook(ctx context.Context, hook appconfig.DeployHook, env map[string]string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	shell := []string{"/bin/sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/C"}
+	}
+
+	cmd := exec.CommandContext(ctx, shell[0], append(shell[1:], hook.Command)...)
+	killHookOnCancel(cmd)
+	// Output is copied through pipes, which whatever the hook left running
+	// may hold open after it's killed
+	cmd.WaitDelay = localDeployHookWaitDelay
+	cmd.Stdout = md.io.Out
+	cmd.Stderr = md.io.ErrOut
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+// runMachineDeployHook runs the hook command on an ephemeral machine using the image being deployed.
+// Like `fly machine exec`, the command isn't run through a shell.
+func (md *machineDeployment) runMachineDeployHook(ctx context.Context, hook appconfig.DeployHook, env map[string]string, timeout time.Duration) error {
+	mConfig, err := md.appConfig.ToConsoleMachineConfig()
+	if err != nil {
+		return fmt.Errorf("failed to generate deploy hook machine configuration: %w", err)
+	}
+	mConfig.Image = md.img
+	mConfig.Guest = md.inferReleaseCommandGuest()
+	mConfig.Env = lo.Assign(mConfig.Env, env)
+	if hdid := md.appConfig.HostDedicationID; hdid != "" {
+		mConfig.Guest.HostDedicationID = hdid
+	}
+
+	m, cleanup, err := machine.LaunchEphemeral(ctx, &machine.EphemeralInput{
+		LaunchInput: fly.LaunchMachineInput{
+			Config: mConfig,
+			Region: md.appConfig.PrimaryRegion,
+		},
+		What: "to run the deploy hook",
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	out, err := md.flapsClient.Exec(ctx, m.ID, &fly.MachineExecRequest{
+		Cmd:     hook.Command,
+		Timeout: int(timeout.Seconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("could not exec command on machine %s: %w", m.ID, err)
+	}
+
+	if out.StdOut != "" {
+		fmt.Fprint(md.io.Out, out.StdOut)
+	}
+	if out.StdErr != "" {
+		fmt.Fprint(md.io.ErrOut, out.StdErr)
+	}
+	if out.ExitCode != 0 {
+		return fmt.Errorf("exited with code %d", out.ExitCode)
+	}
+	return nil
+}
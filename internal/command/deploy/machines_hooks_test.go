@@ -0,0 +1,66 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestRunDeployHooksLocal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("local hooks are run with cmd on windows")
+	}
+
+	ios, _, out, errOut := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	cfg := appconfig.NewConfig()
+	cfg.Deploy = &appconfig.Deploy{
+		Hooks: &appconfig.DeployHooks{
+			PreDeploy: []appconfig.DeployHook{
+				{Name: "flaky", Command: "exit 1", RunOn: "local", FailurePolicy: "continue"},
+				{Command: `echo "$FLY_APP_NAME v$FLY_RELEASE_VERSION $FLY_DEPLOY_HOOK"`, RunOn: "local"},
+			},
+			PostDeploy: []appconfig.DeployHook{
+				{Name: "smoke", Command: "exit 2", RunOn: "local"},
+				{Command: "echo unreachable", RunOn: "local"},
+			},
+			OnFailure: []appconfig.DeployHook{
+				{Command: `echo "$FLY_DEPLOY_ERROR"`, RunOn: "local"},
+				{Name: "slow", Command: "sleep 5; echo done", RunOn: "local", Timeout: fly.MustParseDuration("100ms")},
+			},
+		},
+	}
+	md := &machineDeployment{
+		app:            &fly.AppCompact{Name: "my-app"},
+		appConfig:      cfg,
+		io:             ios,
+		colorize:       ios.ColorScheme(),
+		releaseVersion: 3,
+	}
+
+	require.NoError(t, md.runDeployHooks(ctx, deployHookStagePreDeploy, nil))
+	assert.Contains(t, out.String(), "my-app v3 pre_deploy\n")
+	assert.Contains(t, errOut.String(), "pre_deploy hook 'flaky' failed")
+
+	out.Reset()
+	err := md.runDeployHooks(ctx, deployHookStagePostDeploy, nil)
+	require.ErrorContains(t, err, "post_deploy hook 'smoke' failed")
+	assert.NotContains(t, out.String(), "unreachable")
+
+	// Timeouts kill whatever the hook's shell started too
+	out.Reset()
+	start := time.Now()
+	err = md.runDeployHooks(ctx, deployHookStageOnFailure, errors.New("machines failed to start"))
+	require.ErrorContains(t, err, "timed out after 100ms")
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Contains(t, out.String(), "machines failed to start\n")
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package deploy
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killHookOnCancel runs a local hook in its own process group and kills the
+// whole group when the hook is canceled, so commands the shell started don't
+// outlive it.
+func killHookOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
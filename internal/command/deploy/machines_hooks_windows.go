@@ -0,0 +1,10 @@
+//go:build windows
+
+package deploy
+
+import "os/exec"
+
+// killHookOnCancel leaves canceling a local hook to exec.CommandContext,
+// which kills the shell; the WaitDelay of the hook stops waiting for
+// anything the shell started.
+func killHookOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,327 @@
+package deploy
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/internal/tracing"
+	"github.com/superfly/flyctl/iostreams"
+	"golang.org/x/exp/maps"
+)
+
+// planPlaceholderImage stands in for the image reference when planning a deployment
+// that would build the image from source.
+const planPlaceholderImage = "<image built from source>"
+
+const (
+	PlanActionCreate    = "create"
+	PlanActionUpdate    = "update"
+	PlanActionReplace   = "replace"
+	PlanActionDestroy   = "destroy"
+	PlanActionUnchanged = "unchanged"
+)
+
+// Metadata that changes on every deployment and would only add noise to a plan
+var planIgnoredPaths = []string{
+	"metadata." + fly.MachineConfigMetadataKeyFlyReleaseId,
+	"metadata." + fly.MachineConfigMetadataKeyFlyReleaseVersion,
+	"metadata." + fly.MachineConfigMetadataKeyFlyctlVersion,
+}
+
+// DeploymentPlan describes what a deployment would do to the app's machines and volumes
+// without actually doing it.
+type DeploymentPlan struct {
+	App      string        `json:"app"`
+	Image    string        `json:"image"`
+	Strategy string        `json:"strategy"`
+	Machines []MachinePlan `json:"machines"`
+	Volumes  []VolumePlan  `json:"volumes,omitempty"`
+}
+
+type MachinePlan struct {
+	Action       string         `json:"action"`
+	ID           string         `json:"id,omitempty"`
+	ProcessGroup string         `json:"process_group"`
+	Region       string         `json:"region"`
+	Standby      bool           `json:"standby,omitempty"`
+	Changes      []ConfigChange `json:"changes,omitempty"`
+}
+
+type VolumePlan struct {
+	Name         string `json:"name"`
+	Region       string `json:"region"`
+	SizeGB       int    `json:"size_gb"`
+	ProcessGroup string `json:"process_group"`
+}
+
+// ConfigChange is a single field that differs between two machine configs.
+// Path uses dots for objects and brackets for arrays, e.g. "services[0].internal_port".
+type ConfigChange struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// PlanMachinesApp computes the changes DeployMachinesApp would apply. It must be called on a
+// deployment created with DryRun set, so neither a release nor any first deploy resources exist.
+func (md *machineDeployment) PlanMachinesApp(ctx context.Context) (*DeploymentPlan, error) {
+	ctx, span := tracing.GetTracer().Start(ctx, "plan_machines")
+	defer span.End()
+
+	if !md.dryRun {
+		return nil, fmt.Errorf("BUG: deployment plans can only be computed for dry-run deployments")
+	}
+
+	plan := &DeploymentPlan{
+		App:      md.app.Name,
+		Image:    md.img,
+		Strategy: md.strategy,
+		Machines: []MachinePlan{},
+		Volumes:  md.plannedVolumes,
+	}
+
+	diff := md.resolveProcessGroupChanges()
+	toRemove := map[string]bool{}
+	for _, lm := range diff.machinesToRemove {
+		m := lm.Machine()
+		toRemove[m.ID] = true
+		plan.Machines = append(plan.Machines, MachinePlan{
+			Action:       PlanActionDestroy,
+			ID:           m.ID,
+			ProcessGroup: m.ProcessGroup(),
+			Region:       m.Region,
+		})
+	}
+
+	if !md.updateOnly {
+		groups := maps.Keys(diff.groupsNeedingMachines)
+		slices.Sort(groups)
+		for _, name := range groups {
+			creates, err := md.planCreateMachinesForGroup(name)
+			if err != nil {
+				tracing.RecordError(span, err, "failed to plan new machines")
+				return nil, err
+			}
+			plan.Machines = append(plan.Machines, creates...)
+		}
+	}
+
+	for _, lm := range md.machineSet.GetMachines() {
+		m := lm.Machine()
+		if toRemove[m.ID] {
+			continue
+		}
+
+		li, err := md.launchInputForUpdate(m)
+		if err != nil {
+			tracing.RecordError(span, err, "failed to compute machine update")
+			return nil, fmt.Errorf("failed to update machine configuration for %s: %w", lm.FormattedMachineId(), err)
+		}
+
+		changes, err := configChanges(m.Config, li.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		action := PlanActionUpdate
+		switch {
+		case li.RequiresReplacement:
+			action = PlanActionReplace
+		case len(changes) == 0:
+			action = PlanActionUnchanged
+		}
+
+		plan.Machines = append(plan.Machines, MachinePlan{
+			Action:       action,
+			ID:           m.ID,
+			ProcessGroup: m.ProcessGroup(),
+			Region:       m.Region,
+			Changes:      changes,
+		})
+	}
+
+	return plan, nil
+}
+
+// planCreateMachinesForGroup mirrors the machines deployCreateMachinesForGroups would launch
+func (md *machineDeployment) planCreateMachinesForGroup(name string) ([]MachinePlan, error) {
+	li, err := md.launchInputForLaunch(name, md.machineGuest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating machine configuration: %w", err)
+	}
+	created := MachinePlan{
+		Action:       PlanActionCreate,
+		ProcessGroup: li.Config.ProcessGroup(),
+		Region:       li.Region,
+	}
+	plans := []MachinePlan{created}
+
+	if !md.increasedAvailability {
+		return plans, nil
+	}
+
+	groupConfig, err := md.appConfig.Flatten(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(groupConfig.Mounts) > 0:
+	case len(groupConfig.AllServices()) > 0:
+		plans = append(plans, created)
+	default:
+		standby := created
+		standby.Standby = true
+		plans = append(plans, standby)
+	}
+	return plans, nil
+}
+
+// configChanges lists every field that differs between the JSON representation of both configs.
+func configChanges(original, updated *fly.MachineConfig) ([]ConfigChange, error) {
+	before, err := flattenConfig(original)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flattenConfig(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := lo.Uniq(append(maps.Keys(before), maps.Keys(after)...))
+	paths = lo.Reject(paths, func(p string, _ int) bool { return slices.Contains(planIgnoredPaths, p) })
+	slices.Sort(paths)
+
+	var changes []ConfigChange
+	for _, path := range paths {
+		o, n := before[path], after[path]
+		if string(o) == string(n) {
+			continue
+		}
+		changes = append(changes, ConfigChange{Path: path, Old: o, New: n})
+	}
+	return changes, nil
+}
+
+// flattenConfig maps every leaf of the config JSON to its path and raw JSON value
+func flattenConfig(config *fly.MachineConfig) (map[string]json.RawMessage, error) {
+	out := map[string]json.RawMessage{}
+	if config == nil {
+		return out, nil
+	}
+
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+
+	var walk func(path string, v any) error
+	walk = func(path string, v any) error {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				childPath := k
+				if path != "" {
+					childPath = path + "." + k
+				}
+				if err := walk(childPath, child); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for i, child := range v {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i), child); err != nil {
+					return err
+				}
+			}
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			out[path] = b
+		}
+		return nil
+	}
+	return out, walk("", tree)
+}
+
+func (p *DeploymentPlan) counts() map[string]int {
+	return lo.CountValuesBy(p.Machines, func(m MachinePlan) string { return m.Action })
+}
+
+// RenderPlan prints the plan as JSON or as a human readable list of changes
+func RenderPlan(w io.Writer, colorize *iostreams.ColorScheme, plan *DeploymentPlan, asJSON bool) error {
+	if asJSON {
+		return render.JSON(w, plan)
+	}
+
+	fmt.Fprintf(w, "Deployment plan for app '%s' using the %s strategy\n", colorize.Bold(plan.App), plan.Strategy)
+	fmt.Fprintf(w, "Image: %s\n\n", plan.Image)
+
+	machines := slices.Clone(plan.Machines)
+	order := []string{PlanActionDestroy, PlanActionCreate, PlanActionReplace, PlanActionUpdate, PlanActionUnchanged}
+	slices.SortStableFunc(machines, func(a, b MachinePlan) int {
+		return cmp.Compare(slices.Index(order, a.Action), slices.Index(order, b.Action))
+	})
+
+	for _, m := range machines {
+		var symbol string
+		switch m.Action {
+		case PlanActionCreate:
+			symbol = colorize.Green("+")
+		case PlanActionDestroy:
+			symbol = colorize.Red("-")
+		case PlanActionReplace:
+			symbol = colorize.Yellow("-/+")
+		case PlanActionUpdate:
+			symbol = colorize.Yellow("~")
+		default:
+			symbol = " "
+		}
+
+		id := m.ID
+		if id == "" {
+			id = "new machine"
+		}
+		standby := ""
+		if m.Standby {
+			standby = " (standby)"
+		}
+		fmt.Fprintf(w, "%3s %-9s %s [%s] in %s%s\n", symbol, m.Action, colorize.Bold(id), m.ProcessGroup, m.Region, standby)
+
+		for _, c := range m.Changes {
+			fmt.Fprintf(w, "        %s: %s => %s\n", c.Path, planValue(c.Old), planValue(c.New))
+		}
+	}
+
+	for _, v := range plan.Volumes {
+		fmt.Fprintf(w, "%3s %-9s volume '%s' (%d GB) in %s for group [%s]\n", colorize.Green("+"), PlanActionCreate, colorize.Bold(v.Name), v.SizeGB, v.Region, v.ProcessGroup)
+	}
+
+	counts := plan.counts()
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update in place, %d to replace, %d to destroy, %d unchanged.",
+		counts[PlanActionCreate], counts[PlanActionUpdate], counts[PlanActionReplace], counts[PlanActionDestroy], counts[PlanActionUnchanged])
+	if n := len(plan.Volumes); n > 0 {
+		fmt.Fprintf(w, " %d volumes to create.", n)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+func planValue(v json.RawMessage) string {
+	if len(v) == 0 {
+		return "<none>"
+	}
+	return string(v)
+}
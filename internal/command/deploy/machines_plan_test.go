@@ -0,0 +1,73 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestConfigChanges(t *testing.T) {
+	original := &fly.MachineConfig{
+		Image: "registry.fly.io/app:v1",
+		Env:   map[string]string{"FOO": "bar", "GONE": "yes"},
+		Metadata: map[string]string{
+			fly.MachineConfigMetadataKeyFlyReleaseVersion: "1",
+		},
+	}
+	updated := &fly.MachineConfig{
+		Image: "registry.fly.io/app:v2",
+		Env:   map[string]string{"FOO": "bar", "NEW": "1"},
+		Metadata: map[string]string{
+			fly.MachineConfigMetadataKeyFlyReleaseVersion: "2",
+		},
+	}
+
+	changes, err := configChanges(original, updated)
+	require.NoError(t, err)
+	assert.Equal(t, []ConfigChange{
+		{Path: "env.GONE", Old: json.RawMessage(`"yes"`)},
+		{Path: "env.NEW", New: json.RawMessage(`"1"`)},
+		{Path: "image", Old: json.RawMessage(`"registry.fly.io/app:v1"`), New: json.RawMessage(`"registry.fly.io/app:v2"`)},
+	}, changes)
+
+	changes, err = configChanges(original, original)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestRenderPlan(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	plan := &DeploymentPlan{
+		App:      "my-app",
+		Image:    planPlaceholderImage,
+		Strategy: "rolling",
+		Machines: []MachinePlan{
+			{Action: PlanActionUnchanged, ID: "m3", ProcessGroup: "app", Region: "ord"},
+			{Action: PlanActionUpdate, ID: "m1", ProcessGroup: "app", Region: "ord", Changes: []ConfigChange{
+				{Path: "image", Old: json.RawMessage(`"old"`), New: json.RawMessage(`"new"`)},
+			}},
+			{Action: PlanActionDestroy, ID: "m2", ProcessGroup: "worker", Region: "ams"},
+			{Action: PlanActionCreate, ProcessGroup: "web", Region: "ord"},
+		},
+		Volumes: []VolumePlan{{Name: "data", Region: "ord", SizeGB: 1, ProcessGroup: "web"}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, RenderPlan(&buf, ios.ColorScheme(), plan, false))
+	out := buf.String()
+	assert.Contains(t, out, `image: "old" => "new"`)
+	assert.Contains(t, out, "volume 'data' (1 GB) in ord for group [web]")
+	assert.Contains(t, out, "Plan: 1 to create, 1 to update in place, 0 to replace, 1 to destroy, 1 unchanged. 1 volumes to create.")
+	assert.Less(t, bytes.Index(buf.Bytes(), []byte("m2")), bytes.Index(buf.Bytes(), []byte("m1")))
+
+	buf.Reset()
+	require.NoError(t, RenderPlan(&buf, ios.ColorScheme(), plan, true))
+	var decoded DeploymentPlan
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, plan, &decoded)
+}
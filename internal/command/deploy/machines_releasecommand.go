@@ -93,6 +93,9 @@ func (md *machineDeployment) runReleaseCommand(ctx context.Context) (err error)
 			}
 			for _, l := range releaseCmdLogs {
 				fmt.Fprintf(md.io.ErrOut, "  %s\n", l.Message)
+				e := statuslogger.MachineEvent(statuslogger.EventReleaseCommandLog, releaseCmdMachine.Machine())
+				e.Message = l.Message
+				statuslogger.LogEvent(ctx, e)
 			}
 		}
 		if exitCode != 0 {
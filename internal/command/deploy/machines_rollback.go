@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/statuslogger"
+	"github.com/superfly/flyctl/internal/tracing"
+)
+
+// errReplacedMachine skips the rollback of machines replaced to attach other
+// volumes, since the previous config refers to volumes the new machine can't
+// mount
+var errReplacedMachine = errors.New("machine was replaced with other volumes and can't be reverted in place")
+
+type rollbackResult struct {
+	entry *machineUpdateEntry
+	err   error
+}
+
+// rollbackMachines updates the machines touched by the deployment back to the config
+// they had before it started and prints a per machine summary of the outcome.
+// Entries that never reached updateMachine are left alone.
+func (md *machineDeployment) rollbackMachines(ctx context.Context, entries []*machineUpdateEntry) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "rollback_machines")
+	defer span.End()
+
+	entries = lo.Filter(entries, func(e *machineUpdateEntry, _ int) bool {
+		return e.previousConfig != nil
+	})
+	if len(entries) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(md.io.ErrOut, "Rolling back %d machines to their previous configuration\n", len(entries))
+
+	results := make([]rollbackResult, 0, len(entries))
+	func() {
+		sl := statuslogger.Create(ctx, len(entries), true)
+		defer sl.Destroy(false)
+
+		for idx, e := range entries {
+			eCtx := statuslogger.NewContext(ctx, sl.Line(idx))
+			fmtID := e.leasableMachine.FormattedMachineId()
+
+			err := md.rollbackMachine(eCtx, e)
+			event := statuslogger.MachineEvent(statuslogger.EventRollback, e.leasableMachine.Machine())
+			switch {
+			case errors.Is(err, errReplacedMachine):
+				statuslogger.LogfStatus(eCtx, statuslogger.StatusSuccess, "Machine %s rollback %s: %s", md.colorize.Bold(fmtID), md.colorize.Yellow("skipped"), err)
+			case err != nil:
+				tracing.RecordError(span, err, "failed to rollback machine")
+				statuslogger.LogfStatus(eCtx, statuslogger.StatusFailure, "Machine %s rollback %s: %s", md.colorize.Bold(fmtID), md.colorize.Red("failed"), err)
+				event.Error = err.Error()
+			default:
+				statuslogger.LogfStatus(eCtx, statuslogger.StatusSuccess, "Machine %s rollback %s", md.colorize.Bold(fmtID), md.colorize.Green("succeeded"))
+			}
+			statuslogger.LogEvent(eCtx, event)
+			results = append(results, rollbackResult{entry: e, err: err})
+		}
+	}()
+
+	md.printRollbackSummary(results)
+
+	failed := lo.FilterMap(results, func(r rollbackResult, _ int) (string, bool) {
+		return r.entry.leasableMachine.Machine().ID, r.err != nil && !errors.Is(r.err, errReplacedMachine)
+	})
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to roll back machines: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (md *machineDeployment) rollbackMachine(ctx context.Context, e *machineUpdateEntry) error {
+	// Replaced machines are updated through the machine that replaced them,
+	// as long as it mounts the same volumes
+	lm := e.leasableMachine
+	if e.launchInput.RequiresReplacement && !sameMounts(e.previousConfig.Mounts, lm.Machine().Config.Mounts) {
+		return errReplacedMachine
+	}
+
+	statuslogger.Logf(ctx, "Rolling back %s", md.colorize.Bold(lm.FormattedMachineId()))
+
+	// Replaced machines release their lease once created
+	if !lm.HasLease() {
+		if err := lm.AcquireLease(ctx, md.leaseTimeout); err != nil {
+			return err
+		}
+		defer lm.ReleaseLease(ctx)
+	}
+
+	if err := lm.Update(ctx, fly.LaunchMachineInput{
+		Config:     e.previousConfig,
+		Region:     lm.Machine().Region,
+		SkipLaunch: e.launchInput.SkipLaunch,
+	}); err != nil {
+		return err
+	}
+
+	if e.launchInput.SkipLaunch || md.skipHealthChecks {
+		return nil
+	}
+	return lm.WaitForState(ctx, fly.MachineStateStarted, md.waitTimeout, false)
+}
+
+func (md *machineDeployment) printRollbackSummary(results []rollbackResult) {
+	fmt.Fprintf(md.io.ErrOut, "\nRollback summary:\n")
+	table := helpers.MakeSimpleTable(md.io.ErrOut, []string{"Machine", "Group", "Region", "Image", "Result"})
+	for _, r := range results {
+		m := r.entry.leasableMachine.Machine()
+		result := md.colorize.Green("rolled back")
+		if r.err != nil {
+			firstLine, _, _ := strings.Cut(r.err.Error(), "\n")
+			if errors.Is(r.err, errReplacedMachine) {
+				result = md.colorize.Yellow("skipped: " + firstLine)
+			} else {
+				result = md.colorize.Red("failed: " + firstLine)
+			}
+		}
+		table.Append([]string{m.ID, m.ProcessGroup(), m.Region, r.entry.previousConfig.Image, result})
+	}
+	table.Render()
+	fmt.Fprintf(md.io.ErrOut, "\n")
+}
+
+// sameMounts reports whether a and b mount the same volumes at the same paths
+func sameMounts(a, b []fly.MachineMount) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Volume != b[i].Volume || a[i].Path != b[i].Path {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+type rollbackLeasableMachine struct {
+	machine.LeasableMachine
+	machine *fly.Machine
+	updates []fly.LaunchMachineInput
+}
+
+func (m *rollbackLeasableMachine) Machine() *fly.Machine      { return m.machine }
+func (m *rollbackLeasableMachine) HasLease() bool             { return true }
+func (m *rollbackLeasableMachine) FormattedMachineId() string { return m.machine.ID }
+
+func (m *rollbackLeasableMachine) Update(_ context.Context, input fly.LaunchMachineInput) error {
+	m.updates = append(m.updates, input)
+	m.machine.Config = input.Config
+	return nil
+}
+
+func TestRollbackMachines(t *testing.T) {
+	ios, _, _, errOut := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+	md := &machineDeployment{io: ios, colorize: ios.ColorScheme(), skipHealthChecks: true}
+
+	newEntry := func(id string, previous *fly.MachineConfig) (*machineUpdateEntry, *rollbackLeasableMachine) {
+		lm := &rollbackLeasableMachine{machine: &fly.Machine{ID: id, Region: "ord", Config: &fly.MachineConfig{Image: "new"}}}
+		return &machineUpdateEntry{
+			leasableMachine: lm,
+			launchInput:     &fly.LaunchMachineInput{Config: lm.machine.Config},
+			previousConfig:  previous,
+		}, lm
+	}
+
+	updated, updatedLM := newEntry("updated", &fly.MachineConfig{Image: "old"})
+	untouched, untouchedLM := newEntry("untouched", nil)
+	replaced, replacedLM := newEntry("replaced", &fly.MachineConfig{Image: "old"})
+	replaced.launchInput.RequiresReplacement = true
+
+	err := md.rollbackMachines(ctx, []*machineUpdateEntry{updated, untouched, replaced})
+	require.NoError(t, err)
+
+	require.Len(t, updatedLM.updates, 1)
+	assert.Equal(t, "old", updatedLM.updates[0].Config.Image)
+	assert.Equal(t, "ord", updatedLM.updates[0].Region)
+	assert.Empty(t, untouchedLM.updates)
+	// The machine that replaced the other one mounts the same volumes
+	require.Len(t, replacedLM.updates, 1)
+	assert.Equal(t, "old", replacedLM.updates[0].Config.Image)
+
+	assert.Contains(t, errOut.String(), "Rollback summary")
+	assert.NotContains(t, errOut.String(), "untouched")
+}
+
+func TestRollbackMachinesReplacedVolume(t *testing.T) {
+	ios, _, _, errOut := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+	md := &machineDeployment{io: ios, colorize: ios.ColorScheme(), skipHealthChecks: true}
+
+	lm := &rollbackLeasableMachine{machine: &fly.Machine{ID: "replaced", Region: "ord", Config: &fly.MachineConfig{
+		Image:  "new",
+		Mounts: []fly.MachineMount{{Volume: "vol_new", Path: "/data"}},
+	}}}
+	replaced := &machineUpdateEntry{
+		leasableMachine: lm,
+		launchInput:     &fly.LaunchMachineInput{Config: lm.machine.Config, RequiresReplacement: true},
+		previousConfig: &fly.MachineConfig{
+			Image:  "old",
+			Mounts: []fly.MachineMount{{Volume: "vol_old", Path: "/data"}},
+		},
+	}
+
+	// Machines that can't be reverted are skipped without failing the rollback
+	require.NoError(t, md.rollbackMachines(ctx, []*machineUpdateEntry{replaced}))
+	assert.Empty(t, lm.updates)
+	assert.Contains(t, errOut.String(), "skipped: machine was replaced with other volumes")
+}
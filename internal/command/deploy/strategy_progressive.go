@@ -0,0 +1,213 @@
+package deploy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/statuslogger"
+	"github.com/superfly/flyctl/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	DefaultProgressiveSteps    = []int{10, 25, 50, 100}
+	DefaultProgressiveBakeTime = 1 * time.Minute
+)
+
+const progressiveMaxPollInterval = 10 * time.Second
+
+// progressiveStep is the set of machines, per process group, that get updated in a
+// single step of a progressive deployment.
+type progressiveStep struct {
+	percent int
+	groups  map[string][]*machineUpdateEntry
+}
+
+func (s progressiveStep) size() int {
+	return lo.SumBy(lo.Values(s.groups), func(entries []*machineUpdateEntry) int { return len(entries) })
+}
+
+// progressiveSteps splits the update entries of every process group in consecutive
+// batches, so after step N is applied, steps[N] percent of each group is updated.
+func progressiveSteps(updateEntries []*machineUpdateEntry, percents []int) []progressiveStep {
+	if len(percents) == 0 || percents[len(percents)-1] < 100 {
+		percents = append(slices.Clone(percents), 100)
+	}
+
+	entriesByGroup := lo.GroupBy(updateEntries, func(e *machineUpdateEntry) string {
+		return e.launchInput.Config.ProcessGroup()
+	})
+	for _, entries := range entriesByGroup {
+		slices.SortFunc(entries, func(a, b *machineUpdateEntry) int {
+			return cmp.Compare(a.leasableMachine.Machine().ID, b.leasableMachine.Machine().ID)
+		})
+	}
+
+	done := map[string]int{}
+	steps := make([]progressiveStep, 0, len(percents))
+	for _, percent := range percents {
+		step := progressiveStep{percent: percent, groups: map[string][]*machineUpdateEntry{}}
+		for group, entries := range entriesByGroup {
+			target := int(math.Ceil(float64(len(entries)) * float64(percent) / 100))
+			target = min(target, len(entries))
+			if target > done[group] {
+				step.groups[group] = entries[done[group]:target]
+				done[group] = target
+			}
+		}
+		if step.size() > 0 {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func (md *machineDeployment) updateUsingProgressiveStrategy(parentCtx context.Context, updateEntries []*machineUpdateEntry) (err error) {
+	parentCtx, span := tracing.GetTracer().Start(parentCtx, "progressive", trace.WithAttributes(
+		attribute.IntSlice("steps", md.progressiveSteps),
+		attribute.Float64("bake_time", md.bakeTime.Seconds()),
+		attribute.Int("max_restarts", md.maxRestarts),
+	))
+	defer span.End()
+
+	// Progressive deployments always roll back the machines they touched when a step fails.
+	var updated []*machineUpdateEntry
+	defer func() {
+		if err == nil || len(updated) == 0 {
+			return
+		}
+		tracing.RecordError(span, err, "progressive deployment failed")
+		fmt.Fprintf(md.io.ErrOut, "Progressive deployment failed: %s\n", err)
+		if rollbackErr := md.rollbackMachines(context.WithoutCancel(parentCtx), updated); rollbackErr != nil {
+			fmt.Fprintf(md.io.ErrOut, "Error in rollback: %s\n", rollbackErr)
+			err = rollbackErr
+		}
+	}()
+
+	steps := progressiveSteps(updateEntries, md.progressiveSteps)
+	for idx, step := range steps {
+		fmt.Fprintf(md.io.Out, "Step %d/%d: updating %s of the machines (%d)\n",
+			idx+1, len(steps), md.colorize.Bold(fmt.Sprintf("%d%%", step.percent)), step.size())
+
+		// Machines in a failed step may or may not have been updated, but only the ones
+		// that were will be rolled back.
+		stepStart := time.Now()
+		for _, entries := range step.groups {
+			updated = append(updated, entries...)
+		}
+		if err := md.updateProgressiveStep(parentCtx, step); err != nil {
+			return err
+		}
+
+		if idx == len(steps)-1 {
+			break
+		}
+
+		if err := md.bakeProgressiveStep(parentCtx, updated, stepStart); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (md *machineDeployment) updateProgressiveStep(ctx context.Context, step progressiveStep) error {
+	sl := statuslogger.Create(ctx, step.size(), true)
+	defer sl.Destroy(false)
+
+	groups := lo.Keys(step.groups)
+	slices.Sort(groups)
+
+	groupsPool := pool.New().
+		WithErrors().
+		WithMaxGoroutines(rollingStrategyMaxConcurrentGroups).
+		WithContext(ctx).
+		WithCancelOnError()
+
+	startIdx := 0
+	for _, group := range groups {
+		group := group
+		entries := step.groups[group]
+		groupStartIdx := startIdx
+		startIdx += len(entries)
+		groupsPool.Go(func(ctx context.Context) error {
+			return md.updateEntriesGroup(ctx, group, entries, sl, groupStartIdx)
+		})
+	}
+
+	return groupsPool.Wait()
+}
+
+// bakeProgressiveStep watches the updated machines for the configured bake time and
+// fails as soon as any of them has critical health checks or restarts more than allowed.
+func (md *machineDeployment) bakeProgressiveStep(ctx context.Context, updated []*machineUpdateEntry, since time.Time) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "progressive_bake", trace.WithAttributes(
+		attribute.Int("machines", len(updated)),
+	))
+	defer span.End()
+
+	if md.skipHealthChecks || md.bakeTime <= 0 {
+		return nil
+	}
+
+	fmt.Fprintf(md.io.Out, "Waiting %s to verify the updated machines stay healthy\n", md.bakeTime)
+
+	pollInterval := min(max(md.bakeTime/6, time.Second), progressiveMaxPollInterval)
+	deadline := time.Now().Add(md.bakeTime)
+	for {
+		for _, e := range updated {
+			if e.launchInput.SkipLaunch {
+				continue
+			}
+			if err := md.checkProgressiveGates(ctx, e.leasableMachine, since); err != nil {
+				tracing.RecordError(span, err, "promotion gate failed")
+				return err
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			break
+		}
+
+		select {
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	fmt.Fprintf(md.io.Out, "%s %d machines stayed healthy, promoting\n", md.colorize.SuccessIcon(), len(updated))
+	return nil
+}
+
+func (md *machineDeployment) checkProgressiveGates(ctx context.Context, lm machine.LeasableMachine, since time.Time) error {
+	m, err := md.flapsClient.Get(ctx, lm.Machine().ID)
+	if err != nil {
+		return fmt.Errorf("error getting machine %s from api: %w", lm.Machine().ID, err)
+	}
+
+	if checks := m.AllHealthChecks(); checks.Critical > 0 {
+		return fmt.Errorf("machine %s has %d critical health checks", lm.FormattedMachineId(), checks.Critical)
+	}
+
+	restarts := lo.CountBy(m.Events, func(e *fly.MachineEvent) bool {
+		return e.Type == "exit" &&
+			e.Request != nil && e.Request.ExitEvent != nil &&
+			e.Request.ExitEvent.Restarting &&
+			!e.Time().Before(since)
+	})
+	if restarts > md.maxRestarts {
+		return fmt.Errorf("machine %s restarted %d times, more than the %d allowed", lm.FormattedMachineId(), restarts, md.maxRestarts)
+	}
+
+	return nil
+}
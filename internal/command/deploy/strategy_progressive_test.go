@@ -0,0 +1,71 @@
+package deploy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+)
+
+type stubLeasableMachine struct {
+	machine.LeasableMachine
+	machine *fly.Machine
+}
+
+func (m *stubLeasableMachine) Machine() *fly.Machine {
+	return m.machine
+}
+
+func stubUpdateEntries(group string, count int) []*machineUpdateEntry {
+	return lo.Times(count, func(i int) *machineUpdateEntry {
+		config := &fly.MachineConfig{
+			Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: group},
+		}
+		return &machineUpdateEntry{
+			leasableMachine: &stubLeasableMachine{machine: &fly.Machine{ID: fmt.Sprintf("%s-%02d", group, i), Config: config}},
+			launchInput:     &fly.LaunchMachineInput{Config: config},
+		}
+	})
+}
+
+func stepMachineIDs(step progressiveStep, group string) []string {
+	return lo.Map(step.groups[group], func(e *machineUpdateEntry, _ int) string {
+		return e.leasableMachine.Machine().ID
+	})
+}
+
+func TestProgressiveSteps(t *testing.T) {
+	entries := append(stubUpdateEntries("web", 10), stubUpdateEntries("worker", 2)...)
+
+	steps := progressiveSteps(entries, []int{10, 25, 50})
+	require.Len(t, steps, 4)
+
+	assert.Equal(t, 10, steps[0].percent)
+	assert.Equal(t, []string{"web-00"}, stepMachineIDs(steps[0], "web"))
+	assert.Equal(t, []string{"worker-00"}, stepMachineIDs(steps[0], "worker"))
+
+	assert.Equal(t, 25, steps[1].percent)
+	assert.Equal(t, []string{"web-01", "web-02"}, stepMachineIDs(steps[1], "web"))
+	assert.Empty(t, stepMachineIDs(steps[1], "worker"))
+
+	assert.Equal(t, 50, steps[2].percent)
+	assert.Equal(t, []string{"web-03", "web-04"}, stepMachineIDs(steps[2], "web"))
+
+	// A final step updating every remaining machine is always added
+	assert.Equal(t, 100, steps[3].percent)
+	assert.Len(t, stepMachineIDs(steps[3], "web"), 5)
+	assert.Equal(t, []string{"worker-01"}, stepMachineIDs(steps[3], "worker"))
+
+	assert.Equal(t, len(entries), lo.SumBy(steps, progressiveStep.size))
+}
+
+func TestProgressiveStepsSkipsEmptySteps(t *testing.T) {
+	steps := progressiveSteps(stubUpdateEntries("app", 1), DefaultProgressiveSteps)
+	require.Len(t, steps, 1)
+	assert.Equal(t, 10, steps[0].percent)
+	assert.Equal(t, 1, steps[0].size())
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/build/imgsrc"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func attestationFlags() []flag.Flag {
+	return []flag.Flag{
+		flag.App(),
+		flag.AppConfig(),
+		flag.String{
+			Name:        "platform",
+			Description: "Platform of the image variant to read the attestation of",
+			Default:     imgsrc.MachinePlatform,
+		},
+	}
+}
+
+// attestationPlatform returns the --platform to read attestations of,
+// normalized like the platforms deploy builds for, so linux/arm64/v8 and
+// linux/arm64 find the same image variant.
+func attestationPlatform(ctx context.Context) (string, error) {
+	platforms, err := imgsrc.NormalizePlatforms([]string{flag.GetString(ctx, "platform")})
+	switch {
+	case err != nil:
+		return "", err
+	case len(platforms) == 0:
+		return imgsrc.MachinePlatform, nil
+	default:
+		return platforms[0], nil
+	}
+}
+
+// attestedImage returns the image reference passed as an argument, or else
+// the one most of the app's machines run.
+func attestedImage(ctx context.Context) (string, error) {
+	if ref := flag.FirstArg(ctx); ref != "" {
+		return ref, nil
+	}
+
+	var (
+		client  = flyutil.ClientFromContext(ctx)
+		appName = appconfig.NameFromContext(ctx)
+	)
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return "", fmt.Errorf("get app: %w", err)
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppCompact: app,
+		AppName:    app.Name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	machines, err := flapsClient.List(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get machines: %w", err)
+	}
+
+	counts := map[string]int{}
+	for _, machine := range machines {
+		counts[machine.FullImageRef()]++
+	}
+	if len(counts) == 0 {
+		return "", fmt.Errorf("app %s has no machines, pass the image to read attestations of", appName)
+	}
+
+	refs := make([]string, 0, len(counts))
+	for ref := range counts {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if counts[refs[i]] != counts[refs[j]] {
+			return counts[refs[i]] > counts[refs[j]]
+		}
+		return refs[i] < refs[j]
+	})
+	return refs[0], nil
+}
+
+func printJSON(ctx context.Context, data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	_, err := buf.WriteTo(iostreams.FromContext(ctx).Out)
+	return err
+}
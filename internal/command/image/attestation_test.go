@@ -0,0 +1,43 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/flyctl/internal/build/imgsrc"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func TestAttestationPlatform(t *testing.T) {
+	testcases := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "", want: imgsrc.MachinePlatform},
+		{in: "linux/amd64", want: "linux/amd64"},
+		{in: "amd64", want: "linux/amd64"},
+		{in: "linux/arm64/v8", want: "linux/arm64"},
+		{in: "windows/amd64", err: true},
+		{in: "linux/amd64,linux/arm64", err: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.in, func(t *testing.T) {
+			flags := pflag.NewFlagSet("sbom", pflag.ContinueOnError)
+			flags.String("platform", tc.in, "")
+			ctx := flag.NewContext(context.Background(), flags)
+
+			got, err := attestationPlatform(ctx)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package image
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/internal/build/imgsrc"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func newProvenance() *cobra.Command {
+	const (
+		short = "Show the build provenance of an image"
+		long  = short + ` as SLSA provenance JSON. Defaults to the image the
+app's machines run, which must have been deployed with --attest.
+`
+
+		usage = "provenance [image]"
+	)
+
+	cmd := command.New(usage, short, long, runProvenance,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.MaximumNArgs(1)
+
+	flag.Add(cmd, attestationFlags()...)
+
+	return cmd
+}
+
+func runProvenance(ctx context.Context) error {
+	platform, err := attestationPlatform(ctx)
+	if err != nil {
+		return err
+	}
+
+	ref, err := attestedImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	predicate, _, err := imgsrc.FetchAttestation(ctx, ref, platform,
+		imgsrc.ProvenanceV1PredicateType,
+		imgsrc.ProvenanceV02PredicateType,
+	)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(ctx, predicate)
+}
@@ -0,0 +1,202 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/internal/build/imgsrc"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func newSBOM() *cobra.Command {
+	const (
+		short = "Show the software bill of materials of an image"
+		long  = short + ` as SPDX or CycloneDX JSON. Defaults to the image the
+app's machines run, which must have been deployed with --attest.
+`
+
+		usage = "sbom [image]"
+	)
+
+	cmd := command.New(usage, short, long, runSBOM,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.MaximumNArgs(1)
+
+	flag.Add(cmd, attestationFlags()...)
+	flag.Add(cmd,
+		flag.String{
+			Name:        "format",
+			Description: "Format to print the SBOM in, spdx or cyclonedx",
+			Default:     "spdx",
+		},
+	)
+
+	return cmd
+}
+
+func runSBOM(ctx context.Context) error {
+	format := flag.GetString(ctx, "format")
+	if format != "spdx" && format != "cyclonedx" {
+		return fmt.Errorf("unsupported SBOM format %q, expected spdx or cyclonedx", format)
+	}
+
+	platform, err := attestationPlatform(ctx)
+	if err != nil {
+		return err
+	}
+
+	ref, err := attestedImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	predicate, _, err := imgsrc.FetchAttestation(ctx, ref, platform, imgsrc.SBOMPredicateType)
+	if err != nil {
+		return err
+	}
+
+	if format == "cyclonedx" {
+		if predicate, err = spdxToCycloneDX(predicate); err != nil {
+			return fmt.Errorf("failed converting SBOM to CycloneDX: %w", err)
+		}
+	}
+
+	return printJSON(ctx, predicate)
+}
+
+// spdxDocument is the subset of an SPDX 2.x document converted to CycloneDX
+type spdxDocument struct {
+	Name         string `json:"name"`
+	CreationInfo struct {
+		Created string `json:"created"`
+	} `json:"creationInfo"`
+	Packages []struct {
+		SPDXID                string `json:"SPDXID"`
+		Name                  string `json:"name"`
+		VersionInfo           string `json:"versionInfo"`
+		Supplier              string `json:"supplier"`
+		LicenseConcluded      string `json:"licenseConcluded"`
+		LicenseDeclared       string `json:"licenseDeclared"`
+		PrimaryPackagePurpose string `json:"primaryPackagePurpose"`
+		ExternalRefs          []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+}
+
+type cycloneDXLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cycloneDXComponent struct {
+	Type      string             `json:"type"`
+	BOMRef    string             `json:"bom-ref,omitempty"`
+	Name      string             `json:"name"`
+	Version   string             `json:"version,omitempty"`
+	Publisher string             `json:"publisher,omitempty"`
+	PURL      string             `json:"purl,omitempty"`
+	CPE       string             `json:"cpe,omitempty"`
+	Licenses  []cycloneDXLicense `json:"licenses,omitempty"`
+}
+
+type cycloneDXBOM struct {
+	BOMFormat   string `json:"bomFormat"`
+	SpecVersion string `json:"specVersion"`
+	Version     int    `json:"version"`
+	Metadata    struct {
+		Timestamp string              `json:"timestamp,omitempty"`
+		Component *cycloneDXComponent `json:"component,omitempty"`
+	} `json:"metadata"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+// spdxToCycloneDX converts the packages of an SPDX JSON document to the
+// components of a CycloneDX 1.5 BOM
+func spdxToCycloneDX(data []byte) ([]byte, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	bom := cycloneDXBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Components:  []cycloneDXComponent{},
+	}
+	bom.Metadata.Timestamp = doc.CreationInfo.Created
+	if doc.Name != "" {
+		bom.Metadata.Component = &cycloneDXComponent{Type: "container", Name: doc.Name}
+	}
+
+	for _, pkg := range doc.Packages {
+		component := cycloneDXComponent{
+			Type:      cycloneDXComponentType(pkg.PrimaryPackagePurpose),
+			BOMRef:    pkg.SPDXID,
+			Name:      pkg.Name,
+			Version:   spdxValue(pkg.VersionInfo),
+			Publisher: strings.TrimPrefix(strings.TrimPrefix(spdxValue(pkg.Supplier), "Organization: "), "Person: "),
+		}
+
+		for _, ref := range pkg.ExternalRefs {
+			switch {
+			case ref.ReferenceType == "purl" && component.PURL == "":
+				component.PURL = ref.ReferenceLocator
+			case strings.HasPrefix(ref.ReferenceType, "cpe") && component.CPE == "":
+				component.CPE = ref.ReferenceLocator
+			}
+		}
+
+		license := spdxValue(pkg.LicenseConcluded)
+		if license == "" {
+			license = spdxValue(pkg.LicenseDeclared)
+		}
+		if license != "" {
+			component.Licenses = []cycloneDXLicense{{Expression: license}}
+		}
+
+		bom.Components = append(bom.Components, component)
+	}
+
+	return json.Marshal(bom)
+}
+
+// spdxValue returns v unless it's one of SPDX's placeholders for unknown
+// values
+func spdxValue(v string) string {
+	switch v {
+	case "NOASSERTION", "NONE":
+		return ""
+	default:
+		return v
+	}
+}
+
+func cycloneDXComponentType(purpose string) string {
+	switch purpose {
+	case "APPLICATION":
+		return "application"
+	case "CONTAINER":
+		return "container"
+	case "OPERATING-SYSTEM":
+		return "operating-system"
+	case "FRAMEWORK":
+		return "framework"
+	case "FILE":
+		return "file"
+	case "FIRMWARE":
+		return "firmware"
+	case "DEVICE":
+		return "device"
+	default:
+		return "library"
+	}
+}
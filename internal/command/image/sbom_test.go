@@ -0,0 +1,70 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSPDXToCycloneDX(t *testing.T) {
+	spdx := `{
+		"spdxVersion": "SPDX-2.3",
+		"name": "sbom",
+		"creationInfo": {"created": "2024-01-01T00:00:00Z"},
+		"packages": [
+			{
+				"SPDXID": "SPDXRef-Package-musl",
+				"name": "musl",
+				"versionInfo": "1.2.4-r2",
+				"supplier": "Organization: Alpine",
+				"licenseConcluded": "NOASSERTION",
+				"licenseDeclared": "MIT",
+				"externalRefs": [
+					{"referenceCategory": "SECURITY", "referenceType": "cpe23Type", "referenceLocator": "cpe:2.3:a:musl:musl:1.2.4-r2:*:*:*:*:*:*:*"},
+					{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:apk/alpine/musl@1.2.4-r2"}
+				]
+			},
+			{
+				"SPDXID": "SPDXRef-OperatingSystem-alpine",
+				"name": "alpine",
+				"versionInfo": "3.19.0",
+				"primaryPackagePurpose": "OPERATING-SYSTEM"
+			}
+		]
+	}`
+
+	bom, err := spdxToCycloneDX([]byte(spdx))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"bomFormat": "CycloneDX",
+		"specVersion": "1.5",
+		"version": 1,
+		"metadata": {
+			"timestamp": "2024-01-01T00:00:00Z",
+			"component": {"type": "container", "name": "sbom"}
+		},
+		"components": [
+			{
+				"type": "library",
+				"bom-ref": "SPDXRef-Package-musl",
+				"name": "musl",
+				"version": "1.2.4-r2",
+				"publisher": "Alpine",
+				"purl": "pkg:apk/alpine/musl@1.2.4-r2",
+				"cpe": "cpe:2.3:a:musl:musl:1.2.4-r2:*:*:*:*:*:*:*",
+				"licenses": [{"expression": "MIT"}]
+			},
+			{
+				"type": "operating-system",
+				"bom-ref": "SPDXRef-OperatingSystem-alpine",
+				"name": "alpine",
+				"version": "3.19.0"
+			}
+		]
+	}`, string(bom))
+
+	_, err = spdxToCycloneDX([]byte("not json"))
+	assert.Error(t, err)
+}
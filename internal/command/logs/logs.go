@@ -2,13 +2,20 @@
 package logs
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"regexp"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/azazeal/pause"
 	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/superfly/flyctl/iostreams"
@@ -18,6 +25,7 @@ import (
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
 	"github.com/superfly/flyctl/internal/flyutil"
 	"github.com/superfly/flyctl/internal/logger"
 	"github.com/superfly/flyctl/internal/render"
@@ -31,6 +39,13 @@ the Fly platform.
 Logs can be filtered to a specific instance using the --instance/-i flag or
 to all instances running in a specific region using the --region/-r flag.
 
+Entries can be further filtered locally by level, message, process group and
+time window, and printed with a custom Go template using --format, e.g.
+--format '{{.Timestamp}} {{.Instance}} {{.Message}}'.
+
+Use --save to keep a copy of the received logs on disk and 'fly logs replay'
+to view them later.
+
 By default logs are continually streamed until the command is aborted.
 Use --no-tail to only fetch the logs in the buffer.
 `
@@ -59,10 +74,60 @@ Use --no-tail to only fetch the logs in the buffer.
 			Shorthand:   "n",
 			Description: "Do not continually stream logs",
 		},
+		flag.ProcessGroup("Only show logs of machines in the given process group"),
+		filterFlags,
+		formatFlag(),
+		flag.String{
+			Name:        "save",
+			Description: "Also append every received log entry as a JSON line to the given file, which can be viewed later with 'fly logs replay'",
+		},
+		flag.Int{
+			Name:        "save-max-size",
+			Description: "Size in megabytes after which the --save file is rotated",
+			Default:     100,
+		},
+		flag.Int{
+			Name:        "save-max-files",
+			Description: "Number of rotated --save files to keep",
+			Default:     5,
+		},
 	)
+
+	cmd.AddCommand(newReplay(), newShip())
 	return
 }
 
+// filterFlags are the local filters shared by live and replayed logs
+var filterFlags = flag.Set{
+	flag.String{
+		Name:        "level",
+		Description: "Only show logs at or above the given level (debug, info, warn, error)",
+	},
+	flag.String{
+		Name:        "grep",
+		Description: "Only show logs whose message matches the given regular expression",
+	},
+	flag.String{
+		Name:        "exclude",
+		Description: "Hide logs whose message matches the given regular expression",
+	},
+	flag.String{
+		Name:        "since",
+		Description: "Only show logs after the given time, either an RFC3339 timestamp or a duration ago like 15m",
+	},
+	flag.String{
+		Name:        "until",
+		Description: "Only show logs before the given time, either an RFC3339 timestamp or a duration ago like 15m",
+	},
+}
+
+func formatFlag() flag.String {
+	return flag.String{
+		Name:        "format",
+		Description: "Go template used to print each log entry, with the fields of logs.LogEntry, e.g. .Timestamp, .Meta.Region",
+	}
+}
+
 func run(ctx context.Context) error {
 	client := flyutil.ClientFromContext(ctx)
 
@@ -73,29 +138,48 @@ func run(ctx context.Context) error {
 		NoTail:     flag.GetBool(ctx, "no-tail"),
 	}
 
-	var eg *errgroup.Group
-	eg, ctx = errgroup.WithContext(ctx)
+	printOpts, err := newPrintOptions(ctx, opts.AppName)
+	if err != nil {
+		return err
+	}
 
-	var streams []<-chan logs.LogEntry
-	if opts.NoTail {
-		streams = []<-chan logs.LogEntry{
-			poll(ctx, eg, client, opts),
-		}
-	} else {
-		pollingCtx, cancelPolling := context.WithCancel(ctx)
-		streams = []<-chan logs.LogEntry{
-			poll(pollingCtx, eg, client, opts),
-			nats(ctx, eg, client, opts, cancelPolling),
+	if path := flag.GetString(ctx, "save"); path != "" {
+		maxSize := int64(flag.GetInt(ctx, "save-max-size")) * 1024 * 1024
+		file, err := logs.OpenRotatingFile(path, maxSize, flag.GetInt(ctx, "save-max-files"))
+		if err != nil {
+			return fmt.Errorf("failed to open %s to save logs: %w", path, err)
 		}
+		defer file.Close()
+		printOpts.save = logs.NewEntryWriter(file)
 	}
 
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	streams := logStreams(ctx, eg, client, opts)
+
 	eg.Go(func() error {
-		return printStreams(ctx, streams...)
+		return printStreams(ctx, printOpts, streams...)
 	})
 
 	return eg.Wait()
 }
 
+// logStreams starts polling for logs, and unless NoTail is set, switches to NATS as soon as it's available
+func logStreams(ctx context.Context, eg *errgroup.Group, client flyutil.Client, opts *logs.LogOptions) []<-chan logs.LogEntry {
+	if opts.NoTail {
+		return []<-chan logs.LogEntry{
+			poll(ctx, eg, client, opts),
+		}
+	}
+
+	pollingCtx, cancelPolling := context.WithCancel(ctx)
+	return []<-chan logs.LogEntry{
+		poll(pollingCtx, eg, client, opts),
+		nats(ctx, eg, client, opts, cancelPolling),
+	}
+}
+
 func poll(ctx context.Context, eg *errgroup.Group, client flyutil.Client, opts *logs.LogOptions) <-chan logs.LogEntry {
 	c := make(chan logs.LogEntry)
 
@@ -145,25 +229,189 @@ func nats(ctx context.Context, eg *errgroup.Group, client flyutil.Client, opts *
 	return c
 }
 
-func printStreams(ctx context.Context, streams ...<-chan logs.LogEntry) error {
+// printOptions control which log entries are printed, and how
+type printOptions struct {
+	json   bool
+	format *template.Template
+	filter *logs.Filter
+	// save, when set, receives every entry before it's filtered
+	save *logs.EntryWriter
+}
+
+func newPrintOptions(ctx context.Context, appName string) (*printOptions, error) {
+	filter, err := newFilter(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &printOptions{
+		json:   config.FromContext(ctx).JSONOutput,
+		filter: filter,
+	}
+
+	if format := flag.GetString(ctx, "format"); format != "" {
+		tmpl, err := template.New("format").Option("missingkey=error").Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --format template: %w", err)
+		}
+		opts.format = tmpl
+	}
+
+	return opts, nil
+}
+
+// newFilter builds the local filter set by filterFlags and --process-group
+func newFilter(ctx context.Context, appName string) (*logs.Filter, error) {
+	filter := &logs.Filter{}
+
+	if level := flag.GetString(ctx, "level"); level != "" {
+		if err := logs.ValidateLevel(level); err != nil {
+			return nil, err
+		}
+		filter.MinLevel = level
+	}
+
+	var err error
+	if filter.Grep, err = regexpFlag(ctx, "grep"); err != nil {
+		return nil, err
+	}
+	if filter.Exclude, err = regexpFlag(ctx, "exclude"); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if filter.Since, err = timeFlag(ctx, "since", now); err != nil {
+		return nil, err
+	}
+	if filter.Until, err = timeFlag(ctx, "until", now); err != nil {
+		return nil, err
+	}
+
+	if group := flag.GetProcessGroup(ctx); group != "" {
+		instances, err := newProcessGroupInstances(ctx, appName, group)
+		if err != nil {
+			return nil, err
+		}
+		filter.Instance = instances.contains
+	}
+
+	return filter, nil
+}
+
+func regexpFlag(ctx context.Context, name string) (*regexp.Regexp, error) {
+	expr := flag.GetString(ctx, name)
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s regular expression: %w", name, err)
+	}
+	return re, nil
+}
+
+func timeFlag(ctx context.Context, name string, now time.Time) (time.Time, error) {
+	value := flag.GetString(ctx, name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	ts, err := logs.ParseTime(value, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return ts, nil
+}
+
+// processGroupRefreshInterval is the least time between two listings of the
+// machines of a process group
+const processGroupRefreshInterval = 5 * time.Second
+
+// processGroupInstances tracks the IDs of the machines in a process group.
+// Machines are created and replaced while logs are followed, so the machines
+// are listed again when logs come from an instance that wasn't around before.
+type processGroupInstances struct {
+	ctx   context.Context
+	group string
+	list  func(ctx context.Context) ([]*fly.Machine, error)
+
+	mu        sync.Mutex
+	members   map[string]bool
+	others    map[string]bool
+	refreshed time.Time
+}
+
+func newProcessGroupInstances(ctx context.Context, appName, group string) (*processGroupInstances, error) {
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &processGroupInstances{
+		ctx:   ctx,
+		group: group,
+		list: func(ctx context.Context) ([]*fly.Machine, error) {
+			return flapsClient.List(ctx, "")
+		},
+	}
+	if err := p.refresh(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// contains reports whether instance is a machine of the process group
+func (p *processGroupInstances) contains(instance string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.members[instance] && !p.others[instance] && time.Since(p.refreshed) >= processGroupRefreshInterval {
+		// Keep what's known when listing fails, and try again later
+		_ = p.refresh()
+	}
+	return p.members[instance]
+}
+
+// refresh lists the machines of the app again. p.mu must be held, or p not
+// shared yet.
+func (p *processGroupInstances) refresh() error {
+	p.refreshed = time.Now()
+
+	machines, err := p.list(p.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	p.members, p.others = map[string]bool{}, map[string]bool{}
+	for _, m := range machines {
+		if m.ProcessGroup() == p.group {
+			p.members[m.ID] = true
+		} else {
+			p.others[m.ID] = true
+		}
+	}
+	return nil
+}
+
+func printStreams(ctx context.Context, opts *printOptions, streams ...<-chan logs.LogEntry) error {
 	var eg *errgroup.Group
 	eg, ctx = errgroup.WithContext(ctx)
 
 	out := iostreams.FromContext(ctx).Out
-	json := config.FromContext(ctx).JSONOutput
 
 	for _, stream := range streams {
 		stream := stream
 
 		eg.Go(func() error {
-			return printStream(ctx, out, stream, json)
+			return printStream(ctx, out, stream, opts)
 		})
 	}
 
 	return eg.Wait()
 }
 
-func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry, json bool) error {
+func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry, opts *printOptions) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -173,10 +421,23 @@ func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry,
 				return nil
 			}
 
+			if opts.save != nil {
+				if err := opts.save.Write(entry); err != nil {
+					return fmt.Errorf("failed to save log entry: %w", err)
+				}
+			}
+
+			if !opts.filter.Match(entry) {
+				continue
+			}
+
 			var err error
-			if json {
+			switch {
+			case opts.json:
 				err = render.JSON(w, entry)
-			} else {
+			case opts.format != nil:
+				err = printFormatted(w, opts.format, entry)
+			default:
 				err = render.LogEntry(w, entry,
 					render.HideAllocID(),
 					render.RemoveNewlines(),
@@ -190,3 +451,15 @@ func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry,
 		}
 	}
 }
+
+func printFormatted(w io.Writer, tmpl *template.Template, entry logs.LogEntry) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, entry); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,101 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/logs"
+)
+
+func TestPrintStreamFiltersAndFormats(t *testing.T) {
+	stream := make(chan logs.LogEntry, 3)
+	stream <- logs.LogEntry{Level: "info", Instance: "m1", Message: "booting", Timestamp: "2024-05-01T12:00:00Z"}
+	stream <- logs.LogEntry{Level: "error", Instance: "m1", Message: "crashed", Timestamp: "2024-05-01T12:00:01Z"}
+	stream <- logs.LogEntry{Level: "error", Instance: "m2", Message: "crashed too", Timestamp: "2024-05-01T12:00:02Z"}
+	close(stream)
+
+	opts := &printOptions{
+		format: template.Must(template.New("format").Parse("{{.Instance}} {{.Level}}: {{.Message}}")),
+		filter: &logs.Filter{
+			MinLevel: "warn",
+			Exclude:  regexp.MustCompile("too$"),
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printStream(context.Background(), &out, stream, opts))
+	assert.Equal(t, "m1 error: crashed\n", out.String())
+}
+
+func TestReplayFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, entries ...logs.LogEntry) string {
+		var buf bytes.Buffer
+		w := logs.NewEntryWriter(&buf)
+		for _, e := range entries {
+			require.NoError(t, w.Write(e))
+		}
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+		return path
+	}
+	older := write("app.log.1", logs.LogEntry{Message: "first", Timestamp: "2024-05-01T12:00:00Z"})
+	newer := write("app.log", logs.LogEntry{Message: "second", Timestamp: "2024-05-01T12:00:00.05Z"})
+
+	out := make(chan logs.LogEntry, 2)
+	start := time.Now()
+	require.NoError(t, replayFiles(context.Background(), []string{older, newer}, 1, out))
+	close(out)
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	var messages []string
+	for e := range out {
+		messages = append(messages, e.Message)
+	}
+	assert.Equal(t, []string{"first", "second"}, messages)
+}
+
+func TestProcessGroupInstances(t *testing.T) {
+	machine := func(id, group string) *fly.Machine {
+		return &fly.Machine{ID: id, Config: &fly.MachineConfig{Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: group}}}
+	}
+
+	var listed int
+	machines := []*fly.Machine{machine("m1", "worker")}
+	p := &processGroupInstances{
+		ctx:   context.Background(),
+		group: "web",
+		list: func(context.Context) ([]*fly.Machine, error) {
+			listed++
+			return machines, nil
+		},
+	}
+	// The group can be empty when logs start being followed
+	require.NoError(t, p.refresh())
+	assert.False(t, p.contains("m1"))
+
+	// Machines created since are found once they log, but listing them again
+	// is rate limited
+	machines = append(machines, machine("m2", "web"))
+	assert.False(t, p.contains("m2"))
+	assert.Equal(t, 1, listed)
+
+	p.refreshed = time.Now().Add(-processGroupRefreshInterval)
+	assert.True(t, p.contains("m2"))
+	assert.Equal(t, 2, listed)
+
+	// Instances known to be in other groups don't cause listings
+	p.refreshed = time.Now().Add(-processGroupRefreshInterval)
+	assert.False(t, p.contains("m1"))
+	assert.True(t, p.contains("m2"))
+	assert.Equal(t, 2, listed)
+}
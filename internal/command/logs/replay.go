@@ -0,0 +1,129 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/azazeal/pause"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/logs"
+
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func newReplay() *cobra.Command {
+	const (
+		long = `Print logs previously saved with 'fly logs --save'.
+
+Files are read in the order they're given, so rotated files should be listed
+from the oldest to the most recent. The same filters as 'fly logs' apply.
+Saved entries don't record process groups, so --process-group matches the
+machines currently in the group of the app given with --app, and entries of
+machines destroyed since are left out.
+`
+		short = "Replay saved app logs"
+		usage = "replay FILE..."
+	)
+
+	cmd := command.New(usage, short, long, runReplay,
+		command.LoadAppNameIfPresent,
+		requireSessionForProcessGroup,
+	)
+
+	cmd.Args = cobra.MinimumNArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.JSONOutput(),
+		flag.ProcessGroup("Only show logs of machines in the given process group of the app"),
+		filterFlags,
+		formatFlag(),
+		flag.Float64{
+			Name:        "speed",
+			Description: "Replay entries at the given multiple of their original pace, e.g. 1 for the original speed. By default entries are printed right away.",
+		},
+	)
+
+	return cmd
+}
+
+func runReplay(ctx context.Context) error {
+	speed := flag.GetFloat64(ctx, "speed")
+	if speed < 0 {
+		return fmt.Errorf("--speed can't be negative")
+	}
+
+	opts, err := newPrintOptions(ctx, appconfig.NameFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	entries := make(chan logs.LogEntry)
+	eg.Go(func() error {
+		defer close(entries)
+		return replayFiles(ctx, flag.Args(ctx), speed, entries)
+	})
+	eg.Go(func() error {
+		return printStream(ctx, iostreams.FromContext(ctx).Out, entries, opts)
+	})
+
+	return eg.Wait()
+}
+
+// requireSessionForProcessGroup is a Preparer which makes sure an app is
+// selected and a session exists when --process-group needs machines looked up
+func requireSessionForProcessGroup(ctx context.Context) (context.Context, error) {
+	if flag.GetProcessGroup(ctx) == "" {
+		return ctx, nil
+	}
+	if appconfig.NameFromContext(ctx) == "" {
+		return nil, command.ErrRequireAppName
+	}
+	return command.RequireSession(ctx)
+}
+
+// replayFiles sends the entries saved in paths to out. When speed is positive it waits
+// between entries as long as they were apart originally, divided by speed.
+func replayFiles(ctx context.Context, paths []string, speed float64, out chan<- logs.LogEntry) error {
+	var previous time.Time
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		err = logs.ReadEntries(f, func(entry logs.LogEntry) error {
+			if speed > 0 {
+				if ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+					if !previous.IsZero() && ts.After(previous) {
+						pause.For(ctx, time.Duration(float64(ts.Sub(previous))/speed))
+					}
+					previous = ts
+				}
+			}
+
+			select {
+			case out <- entry:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to replay %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/flyerr"
 	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/statuslogger"
 	"github.com/superfly/flyctl/internal/watch"
 )
 
@@ -61,6 +62,7 @@ func newUpdate() *cobra.Command {
 			Description: "Seconds to wait for individual machines to transition states and become healthy. (default 300)",
 			Default:     300,
 		},
+		flag.ProgressOutput(),
 	)
 
 	cmd.Args = cobra.RangeArgs(0, 1)
@@ -69,6 +71,17 @@ func newUpdate() *cobra.Command {
 }
 
 func runUpdate(ctx context.Context) (err error) {
+	jsonLines, err := flag.GetJSONLinesOutput(ctx)
+	if err != nil {
+		return err
+	}
+	if jsonLines {
+		ctx = statuslogger.NewJSONLinesContext(ctx)
+		var loggerCleanup func(bool)
+		ctx, loggerCleanup = statuslogger.SingleLine(ctx, true)
+		defer loggerCleanup(false)
+	}
+
 	var (
 		io       = iostreams.FromContext(ctx)
 		colorize = io.ColorScheme()
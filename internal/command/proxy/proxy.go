@@ -14,20 +14,39 @@ import (
 	"github.com/superfly/flyctl/internal/flag/flagnames"
 	"github.com/superfly/flyctl/internal/flyutil"
 	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/ip"
 	"github.com/superfly/flyctl/proxy"
 )
 
 func New() *cobra.Command {
 	var (
 		long = strings.Trim(`Proxies connections to a Fly Machine through a WireGuard tunnel. By default,
-connects to the first Machine address returned by an internal DNS query on the app.`, "\n")
+connects to the first Machine address returned by an internal DNS query on the app.
+
+Several ports can be proxied at once, each given as local[:remote] or
+local:host:remote to reach another host than remote_host, such as a Flycast
+address. Mappings can also be listed in the proxies section of a TOML or YAML
+file passed with --proxies-file:
+
+  [[proxies]]
+  name = "db"
+  local = 15432
+  remote = 5432
+  host = "my-db.flycast"
+
+UDP ports are forwarded with --udp, e.g. --udp 5353:5353, or protocol = "udp"
+in the proxies file. Each local client gets its own session, closed after
+--udp-idle-timeout without traffic.
+
+Hosts are resolved anew for every connection and the WireGuard tunnel is
+reestablished when connecting fails.`, "\n")
 		short = `Proxies connections to a Fly Machine.`
 	)
 
-	cmd := command.New("proxy <local:remote> [remote_host]", short, long, run,
+	cmd := command.New("proxy <local:remote>... [remote_host]", short, long, run,
 		command.RequireSession, command.LoadAppNameIfPresent)
 
-	cmd.Args = cobra.RangeArgs(1, 2)
+	cmd.Args = cobra.ArbitraryArgs
 
 	flag.Add(cmd,
 		flag.App(),
@@ -50,6 +69,23 @@ connects to the first Machine address returned by an internal DNS query on the a
 			Default:     "127.0.0.1",
 			Description: "Local address to bind to",
 		},
+		flag.String{
+			Name:        "proxies-file",
+			Description: "Path to a TOML or YAML file with a proxies section listing port mappings",
+		},
+		flag.StringArray{
+			Name:        "udp",
+			Description: "UDP port mapping, as local[:remote] or local:host:remote. Can be specified multiple times.",
+		},
+		flag.Duration{
+			Name:        "udp-idle-timeout",
+			Description: "Close UDP sessions without traffic for this long",
+			Default:     proxy.DefaultUDPIdleTimeout,
+		},
+		flag.Duration{
+			Name:        "stats-interval",
+			Description: "Print connection counts and bytes transferred per mapping at this interval. They're always printed on exit.",
+		},
 	)
 
 	return cmd
@@ -64,6 +100,28 @@ func run(ctx context.Context) (err error) {
 	args := flag.Args(ctx)
 	promptInstance := flag.GetBool(ctx, "select")
 
+	mappings, remoteHost, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, spec := range flag.GetStringArray(ctx, "udp") {
+		m, err := proxy.ParseUDPMapping(spec)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m)
+	}
+	if path := flag.GetString(ctx, "proxies-file"); path != "" {
+		fileMappings, err := proxy.LoadMappings(path)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, fileMappings...)
+	}
+	if len(mappings) == 0 {
+		return errors.New("at least one port mapping is required, as an argument or with --udp or --proxies-file")
+	}
+
 	if promptInstance && appName == "" {
 		return errors.New("--app required when --select flag provided")
 	}
@@ -113,23 +171,39 @@ func run(ctx context.Context) (err error) {
 		return err
 	}
 
-	ports := strings.Split(args[0], ":")
-
 	params := &proxy.ConnectParams{
 		BindAddr:         flag.GetBindAddr(ctx),
-		Ports:            ports,
+		Mappings:         mappings,
 		AppName:          appName,
 		OrganizationSlug: orgSlug,
 		Dialer:           dialer,
 		PromptInstance:   promptInstance,
 		Network:          *network,
+		StatsInterval:    flag.GetDuration(ctx, "stats-interval"),
+		UDPIdleTimeout:   flag.GetDuration(ctx, "udp-idle-timeout"),
 	}
 
-	if len(args) > 1 {
-		params.RemoteHost = args[1]
+	if remoteHost != "" {
+		params.RemoteHost = remoteHost
 	} else {
 		params.RemoteHost = fmt.Sprintf("%s.internal", appName)
 	}
 
-	return proxy.Connect(ctx, params)
+	return proxy.ConnectMappings(ctx, params)
+}
+
+// parseArgs parses port mappings from args. Following the mappings, the last
+// argument may name the remote host of every mapping that doesn't set its own.
+func parseArgs(args []string) (mappings []proxy.Mapping, remoteHost string, err error) {
+	for i, arg := range args {
+		m, err := proxy.ParseMapping(arg)
+		if i > 0 && i == len(args)-1 && (err != nil || ip.IsV6(arg)) {
+			return mappings, arg, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, "", nil
 }
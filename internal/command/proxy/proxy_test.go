@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/proxy"
+)
+
+func TestParseArgs(t *testing.T) {
+	mappings, host, err := parseArgs([]string{"5432", "6379:redis.flycast:6379", "my-db.internal"})
+	require.NoError(t, err)
+	assert.Equal(t, "my-db.internal", host)
+	assert.Equal(t, []proxy.Mapping{
+		{LocalPort: "5432", RemotePort: "5432"},
+		{LocalPort: "6379", RemoteHost: "redis.flycast", RemotePort: "6379"},
+	}, mappings)
+
+	mappings, host, err = parseArgs([]string{"8080:80", "fdaa:0:1:a7b::2"})
+	require.NoError(t, err)
+	assert.Equal(t, "fdaa:0:1:a7b::2", host)
+	assert.Len(t, mappings, 1)
+
+	mappings, host, err = parseArgs([]string{"8080:80", "9090"})
+	require.NoError(t, err)
+	assert.Empty(t, host)
+	assert.Len(t, mappings, 2)
+
+	_, _, err = parseArgs([]string{"my-db.internal"})
+	assert.Error(t, err)
+	_, _, err = parseArgs([]string{"invalid", "8080"})
+	assert.Error(t, err)
+}
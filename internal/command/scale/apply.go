@@ -0,0 +1,312 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newScaleApply() *cobra.Command {
+	const (
+		short = "Converge the app's machines to the [[scale]] sections of fly.toml"
+		long  = `Create, destroy and resize machines so each process group has as many
+machines in each region as its [[scale]] section says, sized as its [[vm]]
+section says. A group's machines in regions its [[scale]] section doesn't list
+are destroyed, and groups without a [[scale]] section are left alone.
+
+The changes are shown as a plan before they're made. Use --dry-run to only
+show the plan, and --yes to make the changes without asking, like in a CI
+pipeline that applies fly.toml on every push.`
+	)
+	cmd := command.New("apply", short, long, runScaleApply,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.NoArgs
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Yes(),
+		flag.Bool{Name: "dry-run", Description: "Show the plan without making any changes"},
+	)
+	return cmd
+}
+
+func runScaleApply(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	appName := appconfig.NameFromContext(ctx)
+
+	appConfig := appconfig.ConfigFromContext(ctx)
+	if appConfig == nil {
+		return fmt.Errorf("no fly.toml found, `fly scale apply` needs one with [[scale]] sections")
+	}
+	if err, extraInfo := appConfig.Validate(ctx); err != nil {
+		fmt.Fprintln(io.ErrOut, extraInfo)
+		return err
+	}
+	if len(appConfig.Scale) == 0 {
+		return fmt.Errorf("%s has no [[scale]] sections, add one for each process group to scale", appConfig.ConfigFilePath())
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return err
+	}
+	ctx = flapsutil.NewContextWithClient(ctx, flapsClient)
+
+	return applyScale(ctx, appName, appConfig, flag.GetBool(ctx, "dry-run"))
+}
+
+func applyScale(ctx context.Context, appName string, appConfig *appconfig.Config, dryRun bool) error {
+	io := iostreams.FromContext(ctx)
+	flapsClient := flapsutil.ClientFromContext(ctx)
+	apiClient := flyutil.ClientFromContext(ctx)
+	ctx = appconfig.WithConfig(ctx, appConfig)
+
+	machines, err := mach.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+	// Machines created with `fly machine run` aren't part of a process group
+	machines = lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		return m.IsFlyAppsPlatform()
+	})
+
+	var latestCompleteRelease fly.Release
+	switch releases, err := apiClient.GetAppReleasesMachines(ctx, appName, "complete", 1); {
+	case err != nil:
+		return err
+	case len(releases) == 0:
+		return fmt.Errorf("this app has no complete releases. Run `fly deploy` to create one and rerun this command")
+	default:
+		latestCompleteRelease = releases[0]
+	}
+
+	volumes, err := flapsClient.GetVolumes(ctx)
+	if err != nil {
+		return err
+	}
+
+	defaultGuest, err := flag.GetMachineGuest(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defaults := newDefaults(appConfig, latestCompleteRelease, machines, volumes, "", false, defaultGuest)
+
+	actions, resizes, err := computeApplyActions(machines, appConfig, defaults)
+	if err != nil {
+		return err
+	}
+
+	if len(actions) == 0 && len(resizes) == 0 {
+		fmt.Fprintf(io.Out, "App already matches its [[scale]] sections. No need for changes\n")
+		return nil
+	}
+
+	fmt.Fprintf(io.Out, "App '%s' is going to be scaled according to this plan:\n", appName)
+
+	printPlan(io.Out, actions)
+	for _, resize := range resizes {
+		fmt.Fprintf(io.Out, "  resize %s group:%s region:%s from '%s' to '%s'\n",
+			resize.Machine.ID, resize.GroupName, resize.Machine.Region, resize.Machine.Config.Guest.ToSize(), resize.Guest.ToSize())
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	if !flag.GetYes(ctx) {
+		switch confirmed, err := prompt.Confirmf(ctx, "Scale app %s?", appName); {
+		case err == nil:
+			if !confirmed {
+				return nil
+			}
+		case prompt.IsNonInteractive(err):
+			return prompt.NonInteractiveError("--yes flag must be specified when not running interactively")
+		default:
+			return err
+		}
+	}
+
+	// Only the machines to destroy or resize need a lease
+	var leased []*fly.Machine
+	for _, action := range actions {
+		if action.Delta < 0 {
+			leased = append(leased, action.Machines[:-action.Delta]...)
+		}
+	}
+	for _, resize := range resizes {
+		leased = append(leased, resize.Machine)
+	}
+	_, releaseFunc, err := mach.AcquireLeases(ctx, leased)
+	defer releaseFunc() // It's important to call the release func even in case of errors
+	if err != nil {
+		return err
+	}
+
+	updatePool := pool.New().
+		WithErrors().
+		WithMaxGoroutines(maxConcurrentActions).
+		WithContext(ctx)
+
+	fmt.Fprintf(io.Out, "Executing scale plan\n")
+	goPlan(ctx, updatePool, actions)
+	for _, resize := range resizes {
+		resize := resize
+		updatePool.Go(func(ctx context.Context) error {
+			m := resize.Machine
+			mConfig := helpers.Clone(m.Config)
+			mConfig.Guest = resize.Guest
+
+			input := &fly.LaunchMachineInput{
+				Name:   m.Name,
+				Region: m.Region,
+				Config: mConfig,
+			}
+			if err := mach.Update(ctx, m, input); err != nil {
+				return err
+			}
+			fmt.Fprintf(io.Out, "  Resized %s group:%s region:%s size:%s\n", m.ID, resize.GroupName, m.Region, resize.Guest.ToSize())
+			return nil
+		})
+	}
+
+	return updatePool.Wait()
+}
+
+// resizeItem is a machine whose guest has to change to match its group's
+// [[vm]] section
+type resizeItem struct {
+	GroupName string
+	Machine   *fly.Machine
+	Guest     *fly.MachineGuest
+}
+
+// computeApplyActions diffs the machines of each process group with a
+// [[scale]] section against the count it sets for each region. Unlike
+// computeActions, counts are per region rather than spread over them.
+func computeApplyActions(machines []*fly.Machine, appConfig *appconfig.Config, defaults *defaultValues) ([]*planItem, []*resizeItem, error) {
+	actions := make([]*planItem, 0)
+	resizes := make([]*resizeItem, 0)
+	machineGroups := lo.GroupBy(machines, func(m *fly.Machine) string {
+		return m.ProcessGroup()
+	})
+
+	groupNames := appConfig.ProcessNames()
+	slices.Sort(groupNames)
+
+	for _, groupName := range groupNames {
+		scale := appConfig.ScaleForGroup(groupName)
+		if scale == nil {
+			continue
+		}
+
+		// The guest [[vm]] sets for the group, if any
+		groupConfig, err := appConfig.ToMachineConfig(groupName, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		guest := groupConfig.Guest
+
+		groupMachines := machineGroups[groupName]
+		var mConfig *fly.MachineConfig
+		if len(groupMachines) > 0 {
+			mConfig = helpers.Clone(groupMachines[0].Config)
+			// Nullify standbys, no point on having more than one
+			mConfig.Standbys = nil
+		} else {
+			mConfig, err = defaults.ToMachineConfig(groupName)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if guest != nil {
+			mConfig.Guest = guest
+		}
+
+		perRegionMachines := lo.GroupBy(groupMachines, func(m *fly.Machine) string {
+			return m.Region
+		})
+
+		regions := lo.Union(lo.Keys(scale.Regions), lo.Keys(perRegionMachines))
+		slices.Sort(regions)
+
+		for _, region := range regions {
+			regionMachines := destroyOrder(perRegionMachines[region])
+			delta := scale.Regions[region] - len(regionMachines)
+
+			if delta != 0 {
+				actions = append(actions, &planItem{
+					GroupName:           groupName,
+					Region:              region,
+					Delta:               delta,
+					Machines:            regionMachines,
+					LaunchMachineInput:  &fly.LaunchMachineInput{Region: region, Config: mConfig},
+					Volumes:             defaults.PopAvailableVolumes(mConfig, region, delta),
+					CreateVolumeRequest: defaults.CreateVolumeRequest(mConfig, region, delta),
+				})
+			}
+
+			if guest == nil {
+				continue
+			}
+			// Machines about to be destroyed aren't worth resizing
+			for _, m := range regionMachines[lo.Clamp(-delta, 0, len(regionMachines)):] {
+				if !sameGuestSize(m.Config.Guest, guest) {
+					resizes = append(resizes, &resizeItem{
+						GroupName: groupName,
+						Machine:   m,
+						Guest:     guest,
+					})
+				}
+			}
+		}
+	}
+
+	return actions, resizes, nil
+}
+
+// destroyOrder sorts machines in the order they're destroyed when scaling
+// down: stopped machines first, then the most recently created ones.
+func destroyOrder(machines []*fly.Machine) []*fly.Machine {
+	machines = slices.Clone(machines)
+	sort.SliceStable(machines, func(i, j int) bool {
+		iStarted := machines[i].State == fly.MachineStateStarted
+		jStarted := machines[j].State == fly.MachineStateStarted
+		if iStarted != jStarted {
+			return jStarted
+		}
+		return machines[i].CreatedAt > machines[j].CreatedAt
+	})
+	return machines
+}
+
+func sameGuestSize(a, b *fly.MachineGuest) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.CPUKind == b.CPUKind &&
+		a.CPUs == b.CPUs &&
+		a.MemoryMB == b.MemoryMB &&
+		a.GPUKind == b.GPUKind &&
+		a.GPUs == b.GPUs
+}
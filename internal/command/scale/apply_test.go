@@ -0,0 +1,109 @@
+package scale
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/internal/inmem"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestApplyScale(t *testing.T) {
+	server := inmem.NewServer()
+	server.CreateApp(&fly.App{Name: "test-app", Organization: inmem.DefaultOrganization})
+	release, err := server.CreateRelease(context.Background(), "test-app", "", "nginx", "machines", "rolling")
+	require.NoError(t, err)
+	require.NoError(t, server.UpdateRelease(context.Background(), release.ID, "", "complete"))
+
+	flags := pflag.NewFlagSet("apply", pflag.ContinueOnError)
+	flags.Bool("yes", true, "")
+
+	io, _, out, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), io)
+	ctx = flag.NewContext(ctx, flags)
+	ctx = flyutil.NewContextWithClient(ctx, server.Client())
+	ctx = flapsutil.NewContextWithClient(ctx, server.FlapsClient("test-app"))
+
+	launch := func(region string) *fly.Machine {
+		guest := &fly.MachineGuest{}
+		require.NoError(t, guest.SetSize("shared-cpu-1x"))
+		m, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{Region: region, Config: &fly.MachineConfig{
+			Image:    "nginx",
+			Guest:    guest,
+			Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyPlatformVersion: fly.MachineFlyPlatformVersion2, fly.MachineConfigMetadataKeyFlyProcessGroup: "app"},
+		}})
+		require.NoError(t, err)
+		return m
+	}
+	kept, stopped := launch("iad"), launch("iad")
+	launch("lhr")
+	require.NoError(t, server.StopMachine(ctx, "test-app", stopped.ID, ""))
+
+	appConfig := appconfig.NewConfig()
+	appConfig.AppName = "test-app"
+	appConfig.Compute = []*appconfig.Compute{{Size: "shared-cpu-2x"}}
+	appConfig.Scale = []*appconfig.Scale{{Regions: map[string]int{"iad": 1, "ams": 1}}}
+
+	// Dry runs only show the plan
+	require.NoError(t, applyScale(ctx, "test-app", appConfig, true))
+	assert.Contains(t, out.String(), "  +1 machines for group 'app' on region 'ams' of size 'shared-cpu-2x'")
+	assert.Contains(t, out.String(), "  -1 machines for group 'app' on region 'iad' of size 'shared-cpu-1x'")
+	assert.Contains(t, out.String(), "  -1 machines for group 'app' on region 'lhr' of size 'shared-cpu-1x'")
+	assert.Contains(t, out.String(), "  resize "+kept.ID+" group:app region:iad from 'shared-cpu-1x' to 'shared-cpu-2x'")
+	assert.NotContains(t, out.String(), "Executing scale plan")
+
+	machines, err := server.ListMachines(ctx, "test-app", false)
+	require.NoError(t, err)
+	assert.Len(t, machines, 3)
+
+	// Stopped machines are destroyed first and the rest resized
+	out.Reset()
+	require.NoError(t, applyScale(ctx, "test-app", appConfig, false))
+	assert.Contains(t, out.String(), "Executing scale plan")
+
+	machines, err = server.ListMachines(ctx, "test-app", false)
+	require.NoError(t, err)
+	require.Len(t, machines, 2)
+	regions := map[string]string{}
+	for _, m := range machines {
+		regions[m.Region] = m.ID
+		assert.Equal(t, "shared-cpu-2x", m.Config.Guest.ToSize())
+	}
+	assert.Equal(t, kept.ID, regions["iad"])
+	assert.Contains(t, regions, "ams")
+
+	// Then there's nothing left to do
+	out.Reset()
+	require.NoError(t, applyScale(ctx, "test-app", appConfig, false))
+	assert.Contains(t, out.String(), "App already matches its [[scale]] sections")
+}
+
+func TestComputeApplyActions_groupsWithoutScale(t *testing.T) {
+	appConfig := appconfig.NewConfig()
+	appConfig.Processes = map[string]string{"web": "serve", "worker": "work"}
+	appConfig.Scale = []*appconfig.Scale{{Regions: map[string]int{"iad": 2}, Processes: []string{"worker"}}}
+
+	machines := []*fly.Machine{{
+		ID:     "web1",
+		Region: "iad",
+		State:  fly.MachineStateStarted,
+		Config: &fly.MachineConfig{Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: "web"}},
+	}}
+	defaults := newDefaults(appConfig, fly.Release{ImageRef: "nginx"}, machines, nil, "", false, nil)
+
+	actions, resizes, err := computeApplyActions(machines, appConfig, defaults)
+	require.NoError(t, err)
+	assert.Empty(t, resizes)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "worker", actions[0].GroupName)
+	assert.Equal(t, "iad", actions[0].Region)
+	assert.Equal(t, 2, actions[0].Delta)
+}
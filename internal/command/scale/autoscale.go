@@ -0,0 +1,443 @@
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newScaleAutoscale() *cobra.Command {
+	const (
+		short = "Scale a process group's machines with its load"
+		long  = `Watch the load of a process group and start, stop and add machines to keep
+the load on each started machine near a target, within a minimum and maximum
+number of started machines. Runs until interrupted.
+
+The load is the result of a Prometheus query against the organization's
+metrics, which must be a scalar or an instant vector whose values are added
+up. It defaults to the number of concurrent connections or requests to the
+group's machines, with the soft limit of the group's services as the target.
+
+Stopped machines are started before new ones are added, and the most recently
+created machines are stopped first. Machines are stopped rather than
+destroyed, so they're quick to bring back. Every decision is printed, and
+can be appended to a file of JSON lines with --audit-log.`
+	)
+	cmd := command.New("autoscale", short, long, runScaleAutoscale,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.NoArgs
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.ProcessGroup("The process group to scale"),
+		flag.Int{Name: "min", Description: "Minimum number of started machines", Default: 1},
+		flag.Int{Name: "max", Description: "Maximum number of started machines"},
+		flag.String{Name: "query", Description: "Prometheus query for the group's load. Defaults to the sum of the concurrency of the group's machines"},
+		flag.String{Name: "prometheus-url", Description: "Base URL of the Prometheus API to query. Defaults to the Fly.io one of the app's organization"},
+		flag.Float64{Name: "target", Description: "Load each started machine should take. Defaults to the soft limit of the group's services when the load is their concurrency"},
+		flag.Duration{Name: "interval", Description: "How often to check the load", Default: 30 * time.Second},
+		flag.Duration{Name: "scale-up-cooldown", Description: "How long after scaling to wait before starting or adding machines", Default: time.Minute},
+		flag.Duration{Name: "scale-down-cooldown", Description: "How long after scaling to wait before stopping machines", Default: 5 * time.Minute},
+		flag.Bool{Name: "dry-run", Description: "Print what would be done without scaling"},
+		flag.String{Name: "audit-log", Description: "Append every decision to this file as a JSON line"},
+		flag.Bool{Name: "once", Description: "Check the load and scale once, then exit"},
+	)
+	return cmd
+}
+
+func runScaleAutoscale(ctx context.Context) error {
+	appName := appconfig.NameFromContext(ctx)
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return err
+	}
+	ctx = flapsutil.NewContextWithClient(ctx, flapsClient)
+
+	appConfig, err := appconfig.FromRemoteApp(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	groupName := flag.GetProcessGroup(ctx)
+	if groupName == "" {
+		groupName = appConfig.DefaultProcessName()
+	}
+	if !slices.Contains(appConfig.ProcessNames(), groupName) {
+		return fmt.Errorf("unknown process group %q, valid names are %v", groupName, appConfig.ProcessNames())
+	}
+
+	policy := autoscalePolicy{
+		Min:               flag.GetInt(ctx, "min"),
+		Max:               flag.GetInt(ctx, "max"),
+		Target:            flag.GetFloat64(ctx, "target"),
+		ScaleUpCooldown:   flag.GetDuration(ctx, "scale-up-cooldown"),
+		ScaleDownCooldown: flag.GetDuration(ctx, "scale-down-cooldown"),
+	}
+	switch {
+	case policy.Max < 1:
+		return fmt.Errorf("--max must be set to at least 1")
+	case policy.Min < 0 || policy.Min > policy.Max:
+		return fmt.Errorf("--min must be between 0 and --max")
+	case flag.IsSpecified(ctx, "target") && policy.Target <= 0:
+		return fmt.Errorf("--target must be greater than 0")
+	}
+
+	interval := flag.GetDuration(ctx, "interval")
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be greater than 0")
+	}
+
+	app, err := flyutil.ClientFromContext(ctx).GetAppCompact(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	a := &autoscaler{
+		appName:   appName,
+		groupName: groupName,
+		appConfig: appConfig,
+		policy:    policy,
+		query:     flag.GetString(ctx, "query"),
+		prom:      newPromClient(ctx, app.Organization.Slug, flag.GetString(ctx, "prometheus-url"), interval),
+		dryRun:    flag.GetBool(ctx, "dry-run"),
+		out:       iostreams.FromContext(ctx).Out,
+	}
+
+	if path := flag.GetString(ctx, "audit-log"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed opening audit log: %w", err)
+		}
+		defer f.Close()
+		a.auditLog = f
+	}
+
+	if flag.GetBool(ctx, "once") {
+		return a.tick(ctx, time.Now()).err()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Errors are recorded with the decision, and the next check may
+		// well go better
+		a.tick(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// autoscalePolicy is how a group is scaled
+type autoscalePolicy struct {
+	Min, Max int
+	// Target is the load each started machine should take
+	Target float64
+
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+}
+
+// scaleDecision is what the autoscaler decided to do about a group, and
+// why. They're written to the audit log as is.
+type scaleDecision struct {
+	Time    time.Time `json:"time"`
+	App     string    `json:"app"`
+	Group   string    `json:"group"`
+	Load    float64   `json:"load"`
+	Target  float64   `json:"target"`
+	Started int       `json:"started"`
+	Stopped int       `json:"stopped"`
+	Desired int       `json:"desired"`
+
+	Start  int    `json:"start,omitempty"`
+	Stop   int    `json:"stop,omitempty"`
+	Launch int    `json:"launch,omitempty"`
+	Reason string `json:"reason"`
+	DryRun bool   `json:"dry_run,omitempty"`
+
+	// Machines are the IDs of the machines started, stopped or launched
+	Machines []string `json:"machines,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (d *scaleDecision) scales() bool {
+	return d.Start > 0 || d.Stop > 0 || d.Launch > 0
+}
+
+func (d *scaleDecision) err() error {
+	if d.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("%s", d.Error)
+}
+
+func (d *scaleDecision) String() string {
+	var actions []string
+	if d.Start > 0 {
+		actions = append(actions, fmt.Sprintf("start %d", d.Start))
+	}
+	if d.Launch > 0 {
+		actions = append(actions, fmt.Sprintf("add %d", d.Launch))
+	}
+	if d.Stop > 0 {
+		actions = append(actions, fmt.Sprintf("stop %d", d.Stop))
+	}
+	action := "no change"
+	if len(actions) > 0 {
+		action = strings.Join(actions, ", ")
+	}
+	if d.DryRun && d.scales() {
+		action += " (dry run)"
+	}
+
+	s := fmt.Sprintf("%s group:%s load:%g target:%g started:%d stopped:%d desired:%d: %s, %s",
+		d.Time.Format(time.RFC3339), d.Group, d.Load, d.Target, d.Started, d.Stopped, d.Desired, action, d.Reason)
+	if d.Error != "" {
+		s += ": " + d.Error
+	}
+	return s
+}
+
+// decide works out how to scale a group from its load and the number of
+// its machines that are started and stopped. lastScaled is when the group
+// was last scaled.
+func decide(policy autoscalePolicy, load float64, started, stopped int, lastScaled, now time.Time) scaleDecision {
+	d := scaleDecision{
+		Time:    now,
+		Load:    load,
+		Target:  policy.Target,
+		Started: started,
+		Stopped: stopped,
+	}
+
+	d.Desired = int(math.Ceil(load / policy.Target))
+	d.Desired = max(policy.Min, min(policy.Max, d.Desired))
+
+	switch {
+	case d.Desired == started:
+		d.Reason = "load is on target"
+	case d.Desired > started && now.Sub(lastScaled) < policy.ScaleUpCooldown:
+		d.Reason = fmt.Sprintf("cooling down until %s", lastScaled.Add(policy.ScaleUpCooldown).Format(time.RFC3339))
+	case d.Desired < started && now.Sub(lastScaled) < policy.ScaleDownCooldown:
+		d.Reason = fmt.Sprintf("cooling down until %s", lastScaled.Add(policy.ScaleDownCooldown).Format(time.RFC3339))
+	case d.Desired > started:
+		d.Start = min(d.Desired-started, stopped)
+		d.Launch = d.Desired - started - d.Start
+		d.Reason = "load is above target"
+	default:
+		d.Stop = started - d.Desired
+		d.Reason = "load is below target"
+	}
+	return d
+}
+
+type autoscaler struct {
+	appName   string
+	groupName string
+	appConfig *appconfig.Config
+	policy    autoscalePolicy
+	query     string
+	prom      *promClient
+	dryRun    bool
+
+	out      io.Writer
+	auditLog io.Writer
+
+	lastScaled time.Time
+}
+
+// tick checks the load of the group and scales it, recording what it did
+func (a *autoscaler) tick(ctx context.Context, now time.Time) *scaleDecision {
+	d := a.evaluate(ctx, now)
+
+	fmt.Fprintln(a.out, d.String())
+	if a.auditLog != nil {
+		line, _ := json.Marshal(d)
+		if _, err := a.auditLog.Write(append(line, '\n')); err != nil {
+			fmt.Fprintf(a.out, "failed writing audit log: %v\n", err)
+		}
+	}
+	return d
+}
+
+func (a *autoscaler) evaluate(ctx context.Context, now time.Time) *scaleDecision {
+	fail := func(err error) *scaleDecision {
+		return &scaleDecision{Time: now, App: a.appName, Group: a.groupName, Reason: "check failed", Error: err.Error()}
+	}
+
+	flapsClient := flapsutil.ClientFromContext(ctx)
+	machines, _, err := flapsClient.ListFlyAppsMachines(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	machines = lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		return m.ProcessGroup() == a.groupName && len(m.Config.Standbys) == 0
+	})
+	started := lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		return m.State == fly.MachineStateStarted
+	})
+	stopped := lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		return m.State == fly.MachineStateStopped || m.State == "suspended"
+	})
+
+	policy := a.policy
+	if policy.Target == 0 {
+		if policy.Target = concurrencySoftLimit(machines); policy.Target == 0 {
+			return fail(fmt.Errorf("group %s has no services with a concurrency soft limit, set --target", a.groupName))
+		}
+	}
+
+	var load float64
+	switch {
+	case a.query != "":
+		load, err = a.prom.query(ctx, a.query)
+	case len(started) > 0:
+		ids := lo.Map(started, func(m *fly.Machine, _ int) string { return m.ID })
+		load, err = a.prom.query(ctx, fmt.Sprintf(`sum(fly_app_concurrency{app=%q,instance=~%q})`, a.appName, strings.Join(ids, "|")))
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	d := decide(policy, load, len(started), len(stopped), a.lastScaled, now)
+	d.App, d.Group, d.DryRun = a.appName, a.groupName, a.dryRun
+	if !d.scales() {
+		return &d
+	}
+
+	// Dry runs cool down too, to show what would really happen
+	a.lastScaled = now
+	if a.dryRun {
+		return &d
+	}
+
+	d.Machines, err = a.scale(ctx, &d, machines, started, stopped)
+	if err != nil {
+		d.Error = err.Error()
+	}
+	return &d
+}
+
+// concurrencySoftLimit returns the lowest soft limit of the services of
+// machines, or 0 if there's none
+func concurrencySoftLimit(machines []*fly.Machine) float64 {
+	limit := 0
+	for _, m := range machines {
+		for _, service := range m.Config.Services {
+			if c := service.Concurrency; c != nil && c.SoftLimit > 0 && (limit == 0 || c.SoftLimit < limit) {
+				limit = c.SoftLimit
+			}
+		}
+	}
+	return float64(limit)
+}
+
+// scale carries out a decision, returning the IDs of the machines it acted
+// on
+func (a *autoscaler) scale(ctx context.Context, d *scaleDecision, machines, started, stopped []*fly.Machine) ([]string, error) {
+	flapsClient := flapsutil.ClientFromContext(ctx)
+	var ids []string
+
+	for _, m := range stopped[:d.Start] {
+		if _, err := flapsClient.Start(ctx, m.ID, ""); err != nil {
+			return ids, fmt.Errorf("failed starting machine %s: %w", m.ID, err)
+		}
+		ids = append(ids, m.ID)
+	}
+
+	if d.Stop > 0 {
+		// Stop the newest machines, leaving the ones that have been around
+		// the longest. Machines created in the same second are taken in
+		// reverse order of listing.
+		started = slices.Clone(started)
+		slices.Reverse(started)
+		sort.SliceStable(started, func(i, j int) bool {
+			return started[i].CreatedAt > started[j].CreatedAt
+		})
+		for _, m := range started[:d.Stop] {
+			if err := flapsClient.Stop(ctx, fly.StopMachineInput{ID: m.ID}, ""); err != nil {
+				return ids, fmt.Errorf("failed stopping machine %s: %w", m.ID, err)
+			}
+			ids = append(ids, m.ID)
+		}
+	}
+
+	if d.Launch > 0 {
+		launched, err := a.launch(ctx, machines, d.Launch)
+		ids = append(ids, launched...)
+		if err != nil {
+			return ids, err
+		}
+	}
+	return ids, nil
+}
+
+// launch adds n machines to the group, spread across the regions it's in
+// the way `fly scale count` does it
+func (a *autoscaler) launch(ctx context.Context, machines []*fly.Machine, n int) ([]string, error) {
+	if len(machines) == 0 {
+		return nil, fmt.Errorf("group %s has no machines to copy, run `fly scale count` to create one", a.groupName)
+	}
+
+	flapsClient := flapsutil.ClientFromContext(ctx)
+	apiClient := flyutil.ClientFromContext(ctx)
+
+	releases, err := apiClient.GetAppReleasesMachines(ctx, a.appName, "complete", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("this app has no complete releases")
+	}
+	volumes, err := flapsClient.GetVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := newDefaults(a.appConfig, releases[0], machines, volumes, "", false, nil)
+	regions := lo.Uniq(lo.Map(machines, func(m *fly.Machine, _ int) string { return m.Region }))
+	actions, err := computeActions(machines, map[string]int{a.groupName: len(machines) + n}, regions, -1, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = appconfig.WithConfig(ctx, a.appConfig)
+	var ids []string
+	for _, action := range actions {
+		for i := 0; i < action.Delta; i++ {
+			m, err := launchMachine(ctx, action, i)
+			if err != nil {
+				return ids, fmt.Errorf("failed adding a machine in %s: %w", action.Region, err)
+			}
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids, nil
+}
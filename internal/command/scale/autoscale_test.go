@@ -0,0 +1,212 @@
+package scale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/internal/inmem"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func Test_decide(t *testing.T) {
+	policy := autoscalePolicy{
+		Min:               1,
+		Max:               5,
+		Target:            10,
+		ScaleUpCooldown:   time.Minute,
+		ScaleDownCooldown: 5 * time.Minute,
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name       string
+		load       float64
+		started    int
+		stopped    int
+		lastScaled time.Time
+		want       scaleDecision
+	}{
+		{
+			name:    "On target",
+			load:    19,
+			started: 2,
+			want:    scaleDecision{Desired: 2},
+		},
+		{
+			name:    "Start stopped machines first",
+			load:    35,
+			started: 2,
+			stopped: 1,
+			want:    scaleDecision{Desired: 4, Start: 1, Launch: 1},
+		},
+		{
+			name:    "Scale up to max",
+			load:    1000,
+			started: 2,
+			want:    scaleDecision{Desired: 5, Launch: 3},
+		},
+		{
+			name:    "Scale down to min",
+			load:    0,
+			started: 3,
+			want:    scaleDecision{Desired: 1, Stop: 2},
+		},
+		{
+			name:       "Scale up cooldown",
+			load:       35,
+			started:    2,
+			lastScaled: now.Add(-30 * time.Second),
+			want:       scaleDecision{Desired: 4},
+		},
+		{
+			name:       "Scale down after scale up cooldown",
+			load:       5,
+			started:    2,
+			lastScaled: now.Add(-2 * time.Minute),
+			want:       scaleDecision{Desired: 1},
+		},
+		{
+			name:       "Scale down after scale down cooldown",
+			load:       5,
+			started:    2,
+			lastScaled: now.Add(-10 * time.Minute),
+			want:       scaleDecision{Desired: 1, Stop: 1},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := decide(policy, tc.load, tc.started, tc.stopped, tc.lastScaled, now)
+			assert.Equal(t, tc.want.Desired, d.Desired, "desired")
+			assert.Equal(t, tc.want.Start, d.Start, "start")
+			assert.Equal(t, tc.want.Stop, d.Stop, "stop")
+			assert.Equal(t, tc.want.Launch, d.Launch, "launch")
+		})
+	}
+}
+
+func TestAutoscalerTick(t *testing.T) {
+	var load float64
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"%g"]}]}}`, load)
+	}))
+	defer prom.Close()
+
+	server := inmem.NewServer()
+	server.CreateApp(&fly.App{Name: "test-app", Organization: inmem.DefaultOrganization})
+	release, err := server.CreateRelease(context.Background(), "test-app", "", "nginx", "machines", "rolling")
+	require.NoError(t, err)
+	require.NoError(t, server.UpdateRelease(context.Background(), release.ID, "", "complete"))
+
+	io, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), io)
+	ctx = flyutil.NewContextWithClient(ctx, server.Client())
+	ctx = flapsutil.NewContextWithClient(ctx, server.FlapsClient("test-app"))
+
+	launch := func() *fly.Machine {
+		m, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{Config: &fly.MachineConfig{
+			Image:    "nginx",
+			Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyPlatformVersion: fly.MachineFlyPlatformVersion2, fly.MachineConfigMetadataKeyFlyProcessGroup: "app"},
+			Services: []fly.MachineService{{
+				InternalPort: 8080,
+				Concurrency:  &fly.MachineServiceConcurrency{Type: "requests", SoftLimit: 10},
+			}},
+		}})
+		require.NoError(t, err)
+		return m
+	}
+	first, second := launch(), launch()
+	require.NoError(t, server.StopMachine(ctx, "test-app", second.ID, ""))
+
+	appConfig := appconfig.NewConfig()
+	appConfig.AppName = "test-app"
+
+	var auditLog bytes.Buffer
+	a := &autoscaler{
+		appName:   "test-app",
+		groupName: "app",
+		appConfig: appConfig,
+		policy:    autoscalePolicy{Min: 1, Max: 4, ScaleUpCooldown: time.Minute, ScaleDownCooldown: time.Minute},
+		prom:      newPromClient(ctx, "personal", prom.URL, time.Second),
+		out:       io.Out,
+		auditLog:  &auditLog,
+	}
+	now := time.Now()
+
+	// Starts the stopped machine, then adds one
+	load = 25
+	d := a.tick(ctx, now)
+	require.NoError(t, d.err())
+	assert.Equal(t, float64(10), d.Target)
+	assert.Equal(t, []string{second.ID}, d.Machines[:1])
+	require.Len(t, d.Machines, 2)
+
+	machines, err := server.ListMachines(ctx, "test-app", false)
+	require.NoError(t, err)
+	assert.Len(t, machines, 3)
+	for _, m := range machines {
+		assert.Equal(t, fly.MachineStateStarted, m.State)
+	}
+
+	// Cools down
+	load = 0
+	d = a.tick(ctx, now.Add(30*time.Second))
+	assert.False(t, d.scales())
+
+	// Stops the newest machines
+	d = a.tick(ctx, now.Add(2*time.Minute))
+	require.NoError(t, d.err())
+	assert.Equal(t, 2, d.Stop)
+	assert.NotContains(t, d.Machines, first.ID)
+
+	// Dry runs don't act
+	a.dryRun = true
+	load = 40
+	d = a.tick(ctx, now.Add(4*time.Minute))
+	assert.Equal(t, 2, d.Start)
+	assert.Equal(t, 1, d.Launch)
+	assert.Empty(t, d.Machines)
+	m, err := server.GetMachine(ctx, "test-app", second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateStopped, m.State)
+
+	decoder := json.NewDecoder(&auditLog)
+	var entries []scaleDecision
+	for decoder.More() {
+		var entry scaleDecision
+		require.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 4)
+	assert.True(t, entries[3].DryRun)
+}
+
+func TestPromClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer prom.Close()
+	defer close(done)
+
+	c := newPromClient(context.Background(), "personal", prom.URL, 100*time.Millisecond)
+	start := time.Now()
+	_, err := c.query(context.Background(), "sum(fly_app_concurrency)")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/samber/lo"
@@ -78,21 +79,7 @@ func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appco
 
 	fmt.Fprintf(io.Out, "App '%s' is going to be scaled according to this plan:\n", appName)
 
-	for _, action := range actions {
-		fmt.Fprintf(io.Out, "%+4d machines for group '%s' on region '%s' of size '%s'\n",
-			action.Delta, action.GroupName, action.Region, action.MachineSize())
-
-		volumesToReuse := len(action.Volumes)
-		volumesToCreate := action.VolumesDelta()
-		switch {
-		case volumesToReuse > 0 && volumesToCreate > 0:
-			fmt.Fprintf(io.Out, "%+4d volumes and %d unattached volumes assigned to group '%s' in region '%s'\n", volumesToCreate, volumesToReuse, action.GroupName, action.Region)
-		case volumesToReuse > 0:
-			fmt.Fprintf(io.Out, "% 4d unattached volumes to be assigned to group '%s' in region '%s'\n", volumesToReuse, action.GroupName, action.Region)
-		case volumesToCreate > 0:
-			fmt.Fprintf(io.Out, "%+4d volumes  for group '%s' in region '%s'\n", volumesToCreate, action.GroupName, action.Region)
-		}
-	}
+	printPlan(io.Out, actions)
 
 	if !flag.GetYes(ctx) {
 		switch confirmed, err := prompt.Confirmf(ctx, "Scale app %s?", appName); {
@@ -122,11 +109,42 @@ func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appco
 		WithContext(ctx)
 
 	fmt.Fprintf(io.Out, "Executing scale plan\n")
+	goPlan(ctx, updatePool, actions)
+
+	return updatePool.Wait()
+}
+
+// printPlan prints the machines and volumes each action adds or removes
+func printPlan(w io.Writer, actions []*planItem) {
+	for _, action := range actions {
+		fmt.Fprintf(w, "%+4d machines for group '%s' on region '%s' of size '%s'\n",
+			action.Delta, action.GroupName, action.Region, action.MachineSize())
+
+		volumesToReuse := len(action.Volumes)
+		volumesToCreate := action.VolumesDelta()
+		switch {
+		case volumesToReuse > 0 && volumesToCreate > 0:
+			fmt.Fprintf(w, "%+4d volumes and %d unattached volumes assigned to group '%s' in region '%s'\n", volumesToCreate, volumesToReuse, action.GroupName, action.Region)
+		case volumesToReuse > 0:
+			fmt.Fprintf(w, "% 4d unattached volumes to be assigned to group '%s' in region '%s'\n", volumesToReuse, action.GroupName, action.Region)
+		case volumesToCreate > 0:
+			fmt.Fprintf(w, "%+4d volumes  for group '%s' in region '%s'\n", volumesToCreate, action.GroupName, action.Region)
+		}
+	}
+}
+
+// goPlan queues launching and destroying the machines of each action on
+// updatePool. Machines are destroyed in the order of action.Machines, whose
+// leases must be held already.
+func goPlan(ctx context.Context, updatePool *pool.ContextPool, actions []*planItem) {
+	io := iostreams.FromContext(ctx)
+
 	for _, action := range actions {
 		action := action
 		switch {
 		case action.Delta > 0:
 			for i := 0; i < action.Delta; i++ {
+				i := i
 				updatePool.Go(func(ctx context.Context) error {
 					m, err := launchMachine(ctx, action, i)
 					if err != nil {
@@ -144,11 +162,10 @@ func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appco
 				})
 			}
 		case action.Delta < 0:
-			for i := 0; i > action.Delta; i-- {
+			for _, m := range action.Machines[:-action.Delta] {
+				m := m
 				updatePool.Go(func(ctx context.Context) error {
-					m := action.Machines[-i]
-					err := destroyMachine(ctx, m)
-					if err != nil {
+					if err := destroyMachine(ctx, m); err != nil {
 						return err
 					}
 					fmt.Fprintf(io.Out, "  Destroyed %s group:%s region:%s size:%s\n", m.ID, action.GroupName, action.Region, m.Config.Guest.ToSize())
@@ -157,8 +174,6 @@ func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appco
 			}
 		}
 	}
-
-	return updatePool.Wait()
 }
 
 func launchMachine(ctx context.Context, action *planItem, idx int) (*fly.Machine, error) {
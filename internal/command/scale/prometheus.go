@@ -0,0 +1,120 @@
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superfly/flyctl/internal/config"
+)
+
+// promClient runs queries against a Prometheus HTTP API, like the one
+// Fly.io serves for each organization.
+type promClient struct {
+	baseURL       string
+	authorization string
+	httpClient    *http.Client
+	// timeout bounds each query, so a stalled API can't hold up the checks
+	// after it. The autoscaler uses its --interval, so a query never runs
+	// into the next check.
+	timeout time.Duration
+}
+
+// newPromClient returns a client for the Fly.io Prometheus API of an org,
+// or for the API at baseURL if it's set. Queries time out after timeout.
+func newPromClient(ctx context.Context, orgSlug, baseURL string, timeout time.Duration) *promClient {
+	authorization := ""
+	if baseURL == "" {
+		baseURL = config.FromContext(ctx).APIBaseURL + "/prometheus/" + url.PathEscape(orgSlug)
+		authorization = config.Tokens(ctx).GraphQLHeader()
+	}
+
+	return &promClient{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		authorization: authorization,
+		httpClient:    http.DefaultClient,
+		timeout:       timeout,
+	}
+}
+
+type promResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// query runs an instant query, returning its value. The values of the
+// series of vector results are added up; an empty vector is 0.
+func (c *promClient) query(ctx context.Context, query string) (float64, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/query?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed querying prometheus: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body promResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed querying prometheus: unexpected %s response: %w", res.Status, err)
+	}
+	if body.Status != "success" {
+		return 0, fmt.Errorf("failed querying prometheus: %s", body.Error)
+	}
+
+	switch body.Data.ResultType {
+	case "scalar":
+		var sample [2]any
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return 0, fmt.Errorf("failed decoding prometheus result: %w", err)
+		}
+		return promValue(sample)
+	case "vector":
+		var series []struct {
+			Value [2]any `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result, &series); err != nil {
+			return 0, fmt.Errorf("failed decoding prometheus result: %w", err)
+		}
+		var total float64
+		for _, s := range series {
+			v, err := promValue(s.Value)
+			if err != nil {
+				return 0, err
+			}
+			total += v
+		}
+		return total, nil
+	default:
+		return 0, fmt.Errorf("prometheus query returned a %s, it must return a scalar or an instant vector", body.Data.ResultType)
+	}
+}
+
+// promValue returns the value of a [timestamp, "value"] sample
+func promValue(sample [2]any) (float64, error) {
+	s, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected prometheus sample value %v", sample[1])
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -17,6 +17,8 @@ func New() *cobra.Command {
 		newScaleMemory(),
 		newScaleShow(),
 		newScaleCount(),
+		newScaleAutoscale(),
+		newScaleApply(),
 	)
 	return cmd
 }
@@ -3,8 +3,10 @@ package ssh
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/docker/docker/pkg/ioutils"
@@ -98,8 +100,24 @@ func lookupAddress(ctx context.Context, cli *agent.Client, dialer agent.Dialer,
 
 func newConsole() *cobra.Command {
 	const (
-		long  = `Connect to a running instance of the current app.`
-		short = long
+		long = `Connect to a running instance of the current app.
+
+Ports can be forwarded over the connection as with OpenSSH: -L forwards a
+local port to a host and port reached from the machine, such as an admin UI
+bound to localhost there, and -R forwards a port on the machine to a host and
+port reached from here. Both take [bind_address:]port:host:hostport and can be
+given several times. With --no-shell, the forwards are held open until
+interrupted without starting a shell.
+
+With --all, the command given with --command runs on every machine of the app
+at once, optionally filtered by region, process group and machine state. Output
+lines are prefixed with the machine they come from, and a summary of the exit
+codes is printed at the end.
+
+With --record, the session is saved to a file in asciicast v2 format, with
+what was typed, the output, and its timing, for 'fly ssh replay' or any
+asciicast player to play back.`
+		short = `Connect to a running instance of the current app.`
 		usage = "console"
 	)
 
@@ -109,9 +127,64 @@ func newConsole() *cobra.Command {
 
 	stdArgsSSH(cmd)
 
+	flag.Add(cmd,
+		flag.StringArray{
+			Name:        "local-forward",
+			Shorthand:   "L",
+			Description: "Forward a local port to a host and port reached from the machine, as [bind_address:]port:host:hostport",
+		},
+		flag.StringArray{
+			Name:        "remote-forward",
+			Shorthand:   "R",
+			Description: "Forward a port on the machine to a host and port reached from here, as [bind_address:]port:host:hostport",
+		},
+		flag.Bool{
+			Name:        "no-shell",
+			Shorthand:   "N",
+			Description: "Only hold the port forwards open, without starting a shell",
+		},
+		flag.String{
+			Name:        "record",
+			Description: "Record the session to this file in asciicast v2 format",
+		},
+		fanOutFlags(),
+	)
+
 	return cmd
 }
 
+// forwardsFromFlags parses the -L and -R port forwards
+func forwardsFromFlags(ctx context.Context) ([]ssh.Forward, error) {
+	var forwards []ssh.Forward
+	for _, spec := range flag.GetStringArray(ctx, "local-forward") {
+		f, err := ssh.ParseForward(spec, false)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+	for _, spec := range flag.GetStringArray(ctx, "remote-forward") {
+		f, err := ssh.ParseForward(spec, true)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+
+	if flag.GetBool(ctx, "no-shell") {
+		if len(forwards) == 0 {
+			return nil, errors.New("--no-shell requires at least one -L or -R port forward")
+		}
+		for _, name := range []string{"command", "record"} {
+			if flag.IsSpecified(ctx, name) {
+				return nil, fmt.Errorf("--no-shell can't be used with --%s", name)
+			}
+		}
+	}
+
+	return forwards, nil
+}
+
 func captureError(ctx context.Context, err error, app *fly.AppCompact) {
 	// ignore cancelled errors
 	if errors.Is(err, context.Canceled) {
@@ -136,6 +209,18 @@ func runConsole(ctx context.Context) error {
 	client := flyutil.ClientFromContext(ctx)
 	appName := appconfig.NameFromContext(ctx)
 
+	forwards, err := forwardsFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	all := flag.GetBool(ctx, "all")
+	if all {
+		if err := validateFanOut(ctx); err != nil {
+			return err
+		}
+	}
+
 	if !quiet(ctx) {
 		terminal.Debugf("Retrieving app info for %s\n", appName)
 	}
@@ -155,6 +240,10 @@ func runConsole(ctx context.Context) error {
 		return err
 	}
 
+	if all {
+		return runConsoleAll(ctx, app, dialer)
+	}
+
 	addr, err := lookupAddress(ctx, agentclient, dialer, app, true)
 	if err != nil {
 		return err
@@ -185,7 +274,36 @@ func runConsole(ctx context.Context) error {
 		return err
 	}
 
-	if err := Console(ctx, sshc, cmd, allocPTY); err != nil {
+	if len(forwards) > 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		if err := startForwards(ctx, sshc, forwards); err != nil {
+			return err
+		}
+
+		if flag.GetBool(ctx, "no-shell") {
+			return holdForwards(ctx, sshc)
+		}
+	}
+
+	var recorder *ssh.Recorder
+	if path := flag.GetString(ctx, "record"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create recording: %w", err)
+		}
+		defer f.Close()
+
+		recorder = ssh.NewRecorder(f, fmt.Sprintf("%s (%s)", app.Name, addr))
+		defer func() {
+			if err := recorder.Err(); err != nil {
+				terminal.Warnf("Recording to %s failed: %v\n", path, err)
+			}
+		}()
+	}
+
+	if err := console(ctx, sshc, cmd, allocPTY, recorder); err != nil {
 		captureError(ctx, err, app)
 		return err
 	}
@@ -193,7 +311,48 @@ func runConsole(ctx context.Context) error {
 	return nil
 }
 
+func startForwards(ctx context.Context, sshc *ssh.Client, forwards []ssh.Forward) error {
+	io := iostreams.FromContext(ctx)
+
+	for _, f := range forwards {
+		addr, err := sshc.Forward(ctx, f)
+		if err != nil {
+			return err
+		}
+		if tcpAddr, ok := addr.(*net.TCPAddr); ok && f.ListenPort == "0" {
+			f.ListenPort = strconv.Itoa(tcpAddr.Port)
+		}
+		fmt.Fprintf(io.ErrOut, "Forwarding %s\n", f)
+	}
+	return nil
+}
+
+// holdForwards waits until interrupted or the SSH connection drops
+func holdForwards(ctx context.Context, sshc *ssh.Client) error {
+	fmt.Fprintln(iostreams.FromContext(ctx).ErrOut, "Press Ctrl+C to stop forwarding")
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- sshc.Client.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-closed:
+		if err != nil {
+			return fmt.Errorf("ssh connection closed: %w", err)
+		}
+		return errors.New("ssh connection closed")
+	}
+}
+
 func Console(ctx context.Context, sshClient *ssh.Client, cmd string, allocPTY bool) error {
+	return console(ctx, sshClient, cmd, allocPTY, nil)
+}
+
+// console is Console, recording the session with recorder when it's set
+func console(ctx context.Context, sshClient *ssh.Client, cmd string, allocPTY bool, recorder *ssh.Recorder) error {
 	currentStdin, currentStdout, currentStderr, err := setupConsole()
 	defer func() error {
 		if err := cleanupConsole(currentStdin, currentStdout, currentStderr); err != nil {
@@ -212,6 +371,7 @@ func Console(ctx context.Context, sshClient *ssh.Client, cmd string, allocPTY bo
 		Stderr:   ioutils.NewWriteCloserWrapper(colorable.NewColorableStderr(), func() error { return nil }),
 		AllocPTY: allocPTY,
 		TermEnv:  determineTermEnv(),
+		Recorder: recorder,
 	}
 
 	if err := sshClient.Shell(ctx, sessIO, cmd); err != nil {
@@ -0,0 +1,266 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/ssh"
+)
+
+func fanOutFlags() flag.Set {
+	return flag.Set{
+		flag.Bool{
+			Name:        "all",
+			Description: "Run the command given with --command on every machine of the app, filtered by --region, --process-group and --state",
+		},
+		flag.StringSlice{
+			Name:        "state",
+			Description: "With --all, only run the command on machines in these states",
+			Default:     []string{fly.MachineStateStarted},
+		},
+		flag.Int{
+			Name:        "concurrency",
+			Description: "With --all, the number of machines the command runs on at once",
+			Default:     10,
+		},
+		flag.JSONOutput(),
+	}
+}
+
+// fanOutResult is the outcome of running a command on one machine
+type fanOutResult struct {
+	MachineID string `json:"machine_id"`
+	Region    string `json:"region"`
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error,omitempty"`
+	Stdout    string `json:"stdout,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+}
+
+func (r fanOutResult) succeeded() bool {
+	return r.Error == "" && r.ExitCode == 0
+}
+
+func validateFanOut(ctx context.Context) error {
+	if flag.GetString(ctx, "command") == "" {
+		return errors.New("--all requires a command to run, given with --command")
+	}
+	for _, name := range []string{"select", "machine", "address", "pty", "local-forward", "remote-forward", "no-shell", "record"} {
+		if flag.IsSpecified(ctx, name) {
+			return fmt.Errorf("--%s can't be used with --all", name)
+		}
+	}
+	if flag.GetInt(ctx, "concurrency") < 1 {
+		return errors.New("--concurrency must be at least 1")
+	}
+	return nil
+}
+
+// runConsoleAll runs the command on every machine matching the filters,
+// printing their output as it comes, prefixed with the machine, and a summary.
+func runConsoleAll(ctx context.Context, app *fly.AppCompact, dialer agent.Dialer) error {
+	iostream := iostreams.FromContext(ctx)
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppCompact: app,
+		AppName:    app.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	machines, err := flapsClient.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+	machines = filterMachines(machines, flag.GetStringSlice(ctx, "state"), flag.GetRegion(ctx), flag.GetProcessGroup(ctx))
+	if len(machines) == 0 {
+		return fmt.Errorf("app %s has no machines matching the given filters", app.Name)
+	}
+
+	// A single certificate serves every connection
+	username := flag.GetString(ctx, "user")
+	cert, pk, err := singleUseSSHCertificate(ctx, app.Organization, []string{app.Name}, username)
+	if err != nil {
+		return fmt.Errorf("create ssh certificate: %w (if you haven't created a key for your org yet, try `flyctl ssh issue`)", err)
+	}
+	pemkey := string(ssh.MarshalED25519PrivateKey(pk, "single-use certificate"))
+
+	cmd := flag.GetString(ctx, "command")
+	run := func(ctx context.Context, machine *fly.Machine, stdout, stderr io.Writer) (int, error) {
+		client := &ssh.Client{
+			Addr:        net.JoinHostPort(machine.PrivateIP, "22"),
+			User:        username,
+			Dial:        dialer.DialContext,
+			Certificate: cert.Certificate,
+			PrivateKey:  pemkey,
+		}
+		defer client.Close()
+
+		return client.Run(ctx, cmd, stdout, stderr)
+	}
+
+	jsonOutput := config.FromContext(ctx).JSONOutput
+	results := fanOut(ctx, machines, flag.GetInt(ctx, "concurrency"), run, iostream.Out, iostream.ErrOut, jsonOutput)
+
+	if jsonOutput {
+		if err := render.JSON(iostream.Out, results); err != nil {
+			return err
+		}
+	} else {
+		renderFanOutResults(iostream.Out, results)
+	}
+
+	failed := lo.CountBy(results, func(r fanOutResult) bool { return !r.succeeded() })
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d machines", failed, len(results))
+	}
+	return nil
+}
+
+func filterMachines(machines []*fly.Machine, states []string, region, group string) []*fly.Machine {
+	return lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		switch {
+		case len(states) > 0 && !lo.Contains(states, m.State):
+			return false
+		case region != "" && m.Region != region:
+			return false
+		case group != "" && m.ProcessGroup() != group:
+			return false
+		default:
+			return true
+		}
+	})
+}
+
+type fanOutRunner func(ctx context.Context, machine *fly.Machine, stdout, stderr io.Writer) (int, error)
+
+// fanOut runs the command on up to concurrency machines at once. Output is
+// either written to out and errOut as it comes, every line prefixed with the
+// machine, or captured into the results.
+func fanOut(ctx context.Context, machines []*fly.Machine, concurrency int, run fanOutRunner, out, errOut io.Writer, capture bool) []fanOutResult {
+	results := make([]fanOutResult, len(machines))
+
+	var (
+		mu sync.Mutex
+		eg errgroup.Group
+	)
+	eg.SetLimit(concurrency)
+
+	for i, machine := range machines {
+		i, machine := i, machine
+
+		eg.Go(func() error {
+			result := fanOutResult{MachineID: machine.ID, Region: machine.Region}
+
+			var stdout, stderr io.Writer
+			var stdoutBuf, stderrBuf bytes.Buffer
+			if capture {
+				stdout, stderr = &stdoutBuf, &stderrBuf
+			} else {
+				prefix := fmt.Sprintf("[%s %s] ", machine.ID, machine.Region)
+				stdoutPrefixed := &prefixWriter{w: out, mu: &mu, prefix: prefix}
+				stderrPrefixed := &prefixWriter{w: errOut, mu: &mu, prefix: prefix}
+				defer stdoutPrefixed.Flush()
+				defer stderrPrefixed.Flush()
+				stdout, stderr = stdoutPrefixed, stderrPrefixed
+			}
+
+			code, err := run(ctx, machine, stdout, stderr)
+			result.ExitCode = code
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Stdout = stdoutBuf.String()
+			result.Stderr = stderrBuf.String()
+
+			results[i] = result
+			return nil
+		})
+	}
+
+	_ = eg.Wait()
+	return results
+}
+
+func renderFanOutResults(w io.Writer, results []fanOutResult) {
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		status := "ok"
+		if !r.succeeded() {
+			status = "failed"
+		}
+		exitCode := ""
+		if r.ExitCode >= 0 {
+			exitCode = strconv.Itoa(r.ExitCode)
+		}
+		rows = append(rows, []string{r.MachineID, r.Region, status, exitCode, r.Error})
+	}
+
+	succeeded := lo.CountBy(results, func(r fanOutResult) bool { return r.succeeded() })
+	title := fmt.Sprintf("%d of %d machines succeeded", succeeded, len(results))
+	render.Table(w, title, rows, "Machine", "Region", "Status", "Exit Code", "Error")
+}
+
+// prefixWriter writes whole lines to w, each prefixed with prefix. Writers
+// sharing w share mu so their lines don't interleave.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes the last line, if it didn't end with a newline
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := io.WriteString(p.w, p.prefix); err != nil {
+		return err
+	}
+	_, err := p.w.Write(line)
+	return err
+}
@@ -0,0 +1,121 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestFilterMachines(t *testing.T) {
+	machines := []*fly.Machine{
+		{ID: "m1", State: "started", Region: "ord", Config: &fly.MachineConfig{Metadata: map[string]string{"fly_process_group": "app"}}},
+		{ID: "m2", State: "stopped", Region: "ord", Config: &fly.MachineConfig{Metadata: map[string]string{"fly_process_group": "app"}}},
+		{ID: "m3", State: "started", Region: "ams", Config: &fly.MachineConfig{Metadata: map[string]string{"fly_process_group": "worker"}}},
+	}
+
+	ids := func(machines []*fly.Machine) (ids []string) {
+		for _, m := range machines {
+			ids = append(ids, m.ID)
+		}
+		return
+	}
+
+	assert.Equal(t, []string{"m1", "m3"}, ids(filterMachines(machines, []string{"started"}, "", "")))
+	assert.Equal(t, []string{"m1", "m2"}, ids(filterMachines(machines, nil, "ord", "")))
+	assert.Equal(t, []string{"m3"}, ids(filterMachines(machines, []string{"started", "stopped"}, "", "worker")))
+	assert.Empty(t, filterMachines(machines, []string{"destroyed"}, "", ""))
+}
+
+func TestFanOut(t *testing.T) {
+	machines := []*fly.Machine{
+		{ID: "m1", Region: "ord"},
+		{ID: "m2", Region: "ams"},
+		{ID: "m3", Region: "syd"},
+	}
+
+	var running, maxRunning atomic.Int32
+	run := func(ctx context.Context, machine *fly.Machine, stdout, stderr io.Writer) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			max := maxRunning.Load()
+			if n <= max || maxRunning.CompareAndSwap(max, n) {
+				break
+			}
+		}
+
+		switch machine.ID {
+		case "m1":
+			fmt.Fprint(stdout, "hello\nwor")
+			fmt.Fprint(stdout, "ld")
+			return 0, nil
+		case "m2":
+			fmt.Fprintln(stderr, "oops")
+			return 3, nil
+		default:
+			return -1, errors.New("connection refused")
+		}
+	}
+
+	var out, errOut bytes.Buffer
+	results := fanOut(context.Background(), machines, 2, run, &out, &errOut, false)
+
+	assert.LessOrEqual(t, maxRunning.Load(), int32(2))
+	assert.Equal(t, "[m1 ord] hello\n[m1 ord] world\n", out.String())
+	assert.Equal(t, "[m2 ams] oops\n", errOut.String())
+	assert.Equal(t, []fanOutResult{
+		{MachineID: "m1", Region: "ord", ExitCode: 0},
+		{MachineID: "m2", Region: "ams", ExitCode: 3},
+		{MachineID: "m3", Region: "syd", ExitCode: -1, Error: "connection refused"},
+	}, results)
+
+	// Captured output goes to the results instead
+	out.Reset()
+	errOut.Reset()
+	results = fanOut(context.Background(), machines[:2], 1, run, &out, &errOut, true)
+	assert.Empty(t, out.String())
+	assert.Equal(t, "hello\nworld", results[0].Stdout)
+	assert.Equal(t, "oops\n", results[1].Stderr)
+
+	var table bytes.Buffer
+	renderFanOutResults(&table, []fanOutResult{
+		{MachineID: "m1", Region: "ord"},
+		{MachineID: "m3", Region: "syd", ExitCode: -1, Error: "connection refused"},
+	})
+	assert.Contains(t, table.String(), "1 of 2 machines succeeded")
+	assert.True(t, strings.Contains(table.String(), "connection refused"))
+}
+
+func TestPrefixWriterConcurrent(t *testing.T) {
+	var (
+		out bytes.Buffer
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+	)
+	for _, prefix := range []string{"a ", "b "} {
+		w := &prefixWriter{w: &out, mu: &mu, prefix: prefix}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				fmt.Fprintf(w, "line %d\n", i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 200)
+	for _, line := range lines {
+		assert.Regexp(t, `^[ab] line \d+$`, line)
+	}
+}
@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/ssh"
+)
+
+func newReplay() *cobra.Command {
+	const (
+		long = `Play back a session recorded with 'fly ssh console --record' in the terminal.
+
+Any asciicast v2 recording can be played back. The terminal should be at least
+as large as the one recorded for the output to look as it did.`
+		short = "Play back a recorded SSH session"
+		usage = "replay FILE"
+	)
+
+	cmd := command.New(usage, short, long, runReplay)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.Float64{
+			Name:        "speed",
+			Description: "Play back at the given multiple of the original pace, or 0 to print the output right away",
+			Default:     1,
+		},
+		flag.Duration{
+			Name:        "idle-time-limit",
+			Description: "Shorten pauses longer than this, e.g. 2s, to skip over idle time",
+		},
+	)
+
+	return cmd
+}
+
+func runReplay(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	speed := flag.GetFloat64(ctx, "speed")
+	if speed < 0 {
+		return errors.New("--speed can't be negative")
+	}
+
+	path := flag.FirstArg(ctx)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := ssh.Replay(ctx, f, io.Out, speed, flag.GetDuration(ctx, "idle-time-limit")); err != nil {
+		return fmt.Errorf("failed to replay %s: %w", path, err)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/ssh"
 
 	"github.com/chzyer/readline"
 	"github.com/google/shlex"
@@ -37,6 +38,7 @@ func NewSFTP() *cobra.Command {
 		newFind(),
 		newSFTPShell(),
 		newGet(),
+		newSync(),
 	)
 
 	return cmd
@@ -87,22 +89,29 @@ func newGet() *cobra.Command {
 }
 
 func newSFTPConnection(ctx context.Context) (*sftp.Client, error) {
+	_, ftp, err := connectSFTP(ctx)
+	return ftp, err
+}
+
+// connectSFTP returns an SFTP client along with the SSH connection it runs
+// over, which can run commands on the same machine.
+func connectSFTP(ctx context.Context) (*ssh.Client, *sftp.Client, error) {
 	client := flyutil.ClientFromContext(ctx)
 	appName := appconfig.NameFromContext(ctx)
 
 	app, err := client.GetAppCompact(ctx, appName)
 	if err != nil {
-		return nil, fmt.Errorf("get app: %w", err)
+		return nil, nil, fmt.Errorf("get app: %w", err)
 	}
 
 	agentclient, dialer, err := BringUpAgent(ctx, client, app, "", quiet(ctx))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	addr, err := lookupAddress(ctx, agentclient, dialer, app, false)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	params := &ConnectParams{
@@ -117,13 +126,17 @@ func newSFTPConnection(ctx context.Context) (*sftp.Client, error) {
 	conn, err := Connect(params, addr)
 	if err != nil {
 		captureError(ctx, err, app)
-		return nil, err
+		return nil, nil, err
 	}
 
-	return sftp.NewClient(conn.Client,
+	ftp, err := sftp.NewClient(conn.Client,
 		sftp.UseConcurrentReads(true),
 		sftp.UseConcurrentWrites(true),
 	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, ftp, nil
 }
 
 func runLs(ctx context.Context) error {
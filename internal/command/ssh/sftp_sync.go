@@ -0,0 +1,703 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+// partialSuffix marks files still being transferred. An interrupted sync
+// leaves them behind, and the next one resumes from where they end if the
+// source file is unchanged.
+const partialSuffix = ".flypartial"
+
+// partialSourceSuffix marks the file next to a partial file that records the
+// size and modification time of the source file it was started from
+const partialSourceSuffix = partialSuffix + "-source"
+
+// hashBatchSize is how many files a single remote sha256sum is run on
+const hashBatchSize = 100
+
+func newSync() *cobra.Command {
+	const (
+		long = `The SFTP SYNC command mirrors a local directory to a remote VM, or with --pull
+a remote directory to the local machine. Files are compared by size and modification
+time, or with --checksum by SHA-256, and only the changed ones are transferred.
+Transfers that were interrupted are resumed by the next sync, unless the
+source file has changed since.`
+		short = "Mirror a directory to or from a remote VM"
+		usage = "sync <local-dir> <remote-dir>"
+	)
+
+	cmd := command.New(usage, short, long, runSync, command.RequireSession, command.RequireAppName)
+
+	cmd.Args = cobra.ExactArgs(2)
+
+	stdArgsSSH(cmd)
+
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "pull",
+			Description: "Copy from the remote directory to the local one, rather than the other way around",
+		},
+		flag.Bool{
+			Name:        "delete",
+			Description: "Delete files from the destination that don't exist in the source",
+		},
+		flag.StringArray{
+			Name:        "exclude",
+			Description: "Skip files and directories matching a glob. Patterns with a slash match the path relative to the synced directory, others the file name. Can be specified multiple times.",
+		},
+		flag.Bool{
+			Name:        "dry-run",
+			Description: "Print what would be transferred and deleted without changing anything",
+		},
+		flag.Bool{
+			Name:        "checksum",
+			Description: "Compare files by SHA-256, computed remotely over SSH, rather than by size and modification time",
+		},
+	)
+
+	return cmd
+}
+
+func runSync(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	args := flag.Args(ctx)
+
+	exclude := flag.GetStringArray(ctx, "exclude")
+	for _, pattern := range exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	sshc, ftp, err := connectSFTP(ctx)
+	if err != nil {
+		return err
+	}
+	defer sshc.Close()
+	defer ftp.Close()
+
+	s := &syncer{
+		src:      localSyncFS{},
+		srcRoot:  args[0],
+		dst:      &remoteSyncFS{ftp: ftp, run: sshc.Run},
+		dstRoot:  args[1],
+		exclude:  exclude,
+		delete:   flag.GetBool(ctx, "delete"),
+		dryRun:   flag.GetBool(ctx, "dry-run"),
+		checksum: flag.GetBool(ctx, "checksum"),
+		out:      io.Out,
+	}
+	if flag.GetBool(ctx, "pull") {
+		s.src, s.dst = s.dst, s.src
+		s.srcRoot, s.dstRoot = s.dstRoot, s.srcRoot
+	}
+
+	stats, err := s.sync(ctx)
+
+	verb := "transferred"
+	if s.dryRun {
+		verb = "to transfer"
+	}
+	fmt.Fprintf(io.Out, "%d files %s (%s), %d deleted, %d up to date\n",
+		stats.transferred, verb, humanize.Bytes(uint64(stats.bytes)), stats.deleted, stats.unchanged)
+
+	return err
+}
+
+// syncFile is a file or directory found walking one side of a sync
+type syncFile struct {
+	size  int64
+	mtime time.Time
+	mode  fs.FileMode
+	dir   bool
+}
+
+// syncFS is one side of a sync, the local machine or the remote VM
+type syncFS interface {
+	join(root, rel string) string
+	readDir(path string) ([]fs.FileInfo, error)
+	stat(path string) (fs.FileInfo, error)
+	open(path string) (io.ReadSeekCloser, error)
+	// create opens path for writing at offset, keeping what comes before
+	create(path string, offset int64) (io.WriteCloser, error)
+	rename(from, to string) error
+	remove(path string) error
+	mkdirAll(path string) error
+	chmod(path string, mode fs.FileMode) error
+	chtimes(path string, mtime time.Time) error
+	// sha256 returns the hex encoded SHA-256 of each of paths
+	sha256(ctx context.Context, paths []string) ([]string, error)
+}
+
+type syncStats struct {
+	transferred int
+	deleted     int
+	unchanged   int
+	bytes       int64
+}
+
+// syncer mirrors srcRoot on src to dstRoot on dst
+type syncer struct {
+	src, dst         syncFS
+	srcRoot, dstRoot string
+
+	exclude  []string
+	delete   bool
+	dryRun   bool
+	checksum bool
+
+	out io.Writer
+}
+
+func (s *syncer) sync(ctx context.Context) (stats syncStats, err error) {
+	info, err := s.src.stat(s.srcRoot)
+	if err != nil {
+		return stats, err
+	}
+	if !info.IsDir() {
+		return stats, fmt.Errorf("%s is not a directory", s.srcRoot)
+	}
+	srcFiles, err := s.walk(s.src, s.srcRoot)
+	if err != nil {
+		return stats, err
+	}
+
+	dstFiles := map[string]syncFile{}
+	switch info, err := s.dst.stat(s.dstRoot); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return stats, err
+	case !info.IsDir():
+		return stats, fmt.Errorf("%s is not a directory", s.dstRoot)
+	default:
+		if dstFiles, err = s.walk(s.dst, s.dstRoot); err != nil {
+			return stats, err
+		}
+	}
+
+	var errs []error
+	fail := func(rel string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", rel, err))
+	}
+
+	if !s.dryRun {
+		if err := s.dst.mkdirAll(s.dstRoot); err != nil {
+			return stats, err
+		}
+	}
+
+	var transfers, compare []string
+	for _, rel := range sortedPaths(srcFiles) {
+		f, existing := srcFiles[rel], dstFiles[rel]
+		_, exists := dstFiles[rel]
+
+		switch {
+		case exists && f.dir != existing.dir:
+			fail(rel, errors.New("is a file on one side and a directory on the other"))
+		case f.dir:
+			if !exists {
+				s.printf("mkdir %s/\n", rel)
+				if !s.dryRun {
+					if err := s.dst.mkdirAll(s.dst.join(s.dstRoot, rel)); err != nil {
+						fail(rel, err)
+					}
+				}
+			}
+		case !exists || f.size != existing.size:
+			transfers = append(transfers, rel)
+		case s.checksum:
+			compare = append(compare, rel)
+		case f.mtime.Unix() != existing.mtime.Unix():
+			transfers = append(transfers, rel)
+		default:
+			stats.unchanged++
+		}
+	}
+
+	if len(compare) > 0 {
+		changed, err := s.compareHashes(ctx, compare)
+		if err != nil {
+			return stats, err
+		}
+		transfers = append(transfers, changed...)
+		stats.unchanged += len(compare) - len(changed)
+		sort.Strings(transfers)
+	}
+
+	for _, rel := range transfers {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		n, err := s.transfer(rel, srcFiles[rel])
+		stats.bytes += n
+		if err != nil {
+			fail(rel, err)
+			continue
+		}
+		stats.transferred++
+	}
+
+	if s.delete {
+		// Reversed, so directories are emptied before being deleted
+		paths := sortedPaths(dstFiles)
+		for i := len(paths) - 1; i >= 0; i-- {
+			rel := paths[i]
+			if _, ok := srcFiles[rel]; ok {
+				continue
+			}
+			s.printf("delete %s\n", rel)
+			if !s.dryRun {
+				if err := s.dst.remove(s.dst.join(s.dstRoot, rel)); err != nil {
+					fail(rel, err)
+					continue
+				}
+			}
+			stats.deleted++
+		}
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// walk lists the files and directories under root, by slash separated path
+// relative to it. Excluded paths, partial transfers and anything other than
+// regular files and directories, such as symlinks, are left out.
+func (s *syncer) walk(fsys syncFS, root string) (map[string]syncFile, error) {
+	files := map[string]syncFile{}
+
+	var walkDir func(rel string) error
+	walkDir = func(rel string) error {
+		entries, err := fsys.readDir(fsys.join(root, rel))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			entryRel := path.Join(rel, entry.Name())
+			isDir := entry.IsDir()
+
+			switch {
+			case !isDir && !entry.Mode().IsRegular():
+				continue
+			case !isDir && strings.HasSuffix(entry.Name(), partialSuffix):
+				continue
+			case !isDir && strings.HasSuffix(entry.Name(), partialSourceSuffix):
+				continue
+			case s.excluded(entryRel):
+				continue
+			}
+
+			files[entryRel] = syncFile{
+				size:  entry.Size(),
+				mtime: entry.ModTime(),
+				mode:  entry.Mode(),
+				dir:   isDir,
+			}
+			if isDir {
+				if err := walkDir(entryRel); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	return files, walkDir("")
+}
+
+// excluded tells whether rel matches an exclude pattern. Patterns with a
+// slash match the whole relative path, others only the file name.
+func (s *syncer) excluded(rel string) bool {
+	for _, pattern := range s.exclude {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compareHashes returns the paths whose content differs on both sides
+func (s *syncer) compareHashes(ctx context.Context, rels []string) ([]string, error) {
+	hashes := func(fsys syncFS, root string) ([]string, error) {
+		paths := make([]string, len(rels))
+		for i, rel := range rels {
+			paths[i] = fsys.join(root, rel)
+		}
+		return fsys.sha256(ctx, paths)
+	}
+
+	srcHashes, err := hashes(s.src, s.srcRoot)
+	if err != nil {
+		return nil, fmt.Errorf("checksum source files: %w", err)
+	}
+	dstHashes, err := hashes(s.dst, s.dstRoot)
+	if err != nil {
+		return nil, fmt.Errorf("checksum destination files: %w", err)
+	}
+
+	var changed []string
+	for i, rel := range rels {
+		if srcHashes[i] != dstHashes[i] {
+			changed = append(changed, rel)
+		}
+	}
+	return changed, nil
+}
+
+// transfer copies the file at rel through a partial file which is renamed
+// into place once complete. A partial file left by an earlier transfer is
+// appended to if it was started from the same version of the source file and
+// isn't larger than it, and started over otherwise.
+func (s *syncer) transfer(rel string, f syncFile) (int64, error) {
+	srcPath := s.src.join(s.srcRoot, rel)
+	dstPath := s.dst.join(s.dstRoot, rel)
+	partialPath := dstPath + partialSuffix
+	sourcePath := dstPath + partialSourceSuffix
+	source := fmt.Sprintf("%d %d\n", f.size, f.mtime.Unix())
+
+	var offset int64
+	if info, err := s.dst.stat(partialPath); err == nil && info.Mode().IsRegular() && info.Size() <= f.size && s.readPartialSource(sourcePath) == source {
+		offset = info.Size()
+	}
+
+	if offset > 0 {
+		s.printf("resume %s at %s of %s\n", rel, humanize.Bytes(uint64(offset)), humanize.Bytes(uint64(f.size)))
+	} else {
+		s.printf("transfer %s (%s)\n", rel, humanize.Bytes(uint64(f.size)))
+	}
+	if s.dryRun {
+		return f.size - offset, nil
+	}
+
+	in, err := s.src.open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if offset == 0 {
+		if err := s.writePartialSource(sourcePath, source); err != nil {
+			return 0, err
+		}
+	}
+
+	out, err := s.dst.create(partialPath, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if err := s.dst.rename(partialPath, dstPath); err != nil {
+		return n, err
+	}
+	if err := s.dst.remove(sourcePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return n, err
+	}
+	if err := s.dst.chmod(dstPath, f.mode.Perm()); err != nil {
+		return n, err
+	}
+	return n, s.dst.chtimes(dstPath, f.mtime)
+}
+
+// readPartialSource returns what writePartialSource recorded at path, or ""
+// if there's nothing readable there
+func (s *syncer) readPartialSource(path string) string {
+	f, err := s.dst.open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, 64))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// writePartialSource records the version of the source file a partial file
+// is started from, before any of it is written
+func (s *syncer) writePartialSource(path, source string) error {
+	f, err := s.dst.create(path, 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, source)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *syncer) printf(format string, args ...any) {
+	if s.dryRun {
+		format = "(dry run) " + format
+	}
+	fmt.Fprintf(s.out, format, args...)
+}
+
+func sortedPaths(files map[string]syncFile) []string {
+	paths := make([]string, 0, len(files))
+	for rel := range files {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+type localSyncFS struct{}
+
+func (localSyncFS) join(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+func (localSyncFS) readDir(path string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localSyncFS) stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (localSyncFS) open(path string) (io.ReadSeekCloser, error) {
+	return os.Open(path)
+}
+
+func (localSyncFS) create(path string, offset int64) (io.WriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := seekTruncate(f, offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (localSyncFS) rename(from, to string) error {
+	return os.Rename(from, to)
+}
+
+func (localSyncFS) remove(path string) error {
+	return os.Remove(path)
+}
+
+func (localSyncFS) mkdirAll(path string) error {
+	return os.MkdirAll(path, 0o755)
+}
+
+func (localSyncFS) chmod(path string, mode fs.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (localSyncFS) chtimes(path string, mtime time.Time) error {
+	return os.Chtimes(path, mtime, mtime)
+}
+
+func (localSyncFS) sha256(ctx context.Context, paths []string) ([]string, error) {
+	hashes := make([]string, len(paths))
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hex.EncodeToString(h.Sum(nil))
+	}
+	return hashes, nil
+}
+
+// remoteSyncFS is a VM's filesystem over SFTP. Checksums are computed on the
+// VM by running sha256sum, so files don't need downloading to be compared.
+type remoteSyncFS struct {
+	ftp *sftp.Client
+	run func(ctx context.Context, cmd string, stdout, stderr io.Writer) (int, error)
+}
+
+func (*remoteSyncFS) join(root, rel string) string {
+	return path.Join(root, rel)
+}
+
+func (r *remoteSyncFS) readDir(path string) ([]fs.FileInfo, error) {
+	return r.ftp.ReadDir(path)
+}
+
+func (r *remoteSyncFS) stat(path string) (fs.FileInfo, error) {
+	return r.ftp.Stat(path)
+}
+
+func (r *remoteSyncFS) open(path string) (io.ReadSeekCloser, error) {
+	return r.ftp.Open(path)
+}
+
+func (r *remoteSyncFS) create(path string, offset int64) (io.WriteCloser, error) {
+	f, err := r.ftp.OpenFile(path, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := seekTruncate(f, offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *remoteSyncFS) rename(from, to string) error {
+	// Plain SFTP renames fail when the target exists
+	if err := r.ftp.PosixRename(from, to); err == nil {
+		return nil
+	}
+	if err := r.ftp.Remove(to); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return r.ftp.Rename(from, to)
+}
+
+func (r *remoteSyncFS) remove(path string) error {
+	return r.ftp.Remove(path)
+}
+
+func (r *remoteSyncFS) mkdirAll(path string) error {
+	return r.ftp.MkdirAll(path)
+}
+
+func (r *remoteSyncFS) chmod(path string, mode fs.FileMode) error {
+	return r.ftp.Chmod(path, mode)
+}
+
+func (r *remoteSyncFS) chtimes(path string, mtime time.Time) error {
+	return r.ftp.Chtimes(path, mtime, mtime)
+}
+
+func (r *remoteSyncFS) sha256(ctx context.Context, paths []string) ([]string, error) {
+	hashes := make([]string, 0, len(paths))
+
+	for start := 0; start < len(paths); start += hashBatchSize {
+		batch := paths[start:min(start+hashBatchSize, len(paths))]
+
+		quoted := make([]string, len(batch))
+		for i, path := range batch {
+			quoted[i] = shellQuote(path)
+		}
+
+		var stdout, stderr bytes.Buffer
+		code, err := r.run(ctx, "sha256sum -- "+strings.Join(quoted, " "), &stdout, &stderr)
+		if err != nil {
+			return nil, err
+		}
+		if code != 0 {
+			return nil, fmt.Errorf("sha256sum exited with code %d: %s", code, strings.TrimSpace(stderr.String()))
+		}
+
+		batchHashes, err := parseSHA256Sums(&stdout)
+		if err != nil {
+			return nil, err
+		}
+		if len(batchHashes) != len(batch) {
+			return nil, fmt.Errorf("sha256sum returned %d checksums for %d files", len(batchHashes), len(batch))
+		}
+		hashes = append(hashes, batchHashes...)
+	}
+
+	return hashes, nil
+}
+
+// parseSHA256Sums reads the checksums from sha256sum output, in order. Lines
+// for file names sha256sum had to escape start with a backslash.
+func parseSHA256Sums(r io.Reader) ([]string, error) {
+	var hashes []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), `\`)
+		if line == "" {
+			continue
+		}
+		hash, _, ok := strings.Cut(line, " ")
+		if !ok || len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("unexpected sha256sum output %q", scanner.Text())
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, scanner.Err()
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type truncateSeeker interface {
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// seekTruncate cuts f down to offset and positions writes there
+func seekTruncate(f truncateSeeker, offset int64) error {
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
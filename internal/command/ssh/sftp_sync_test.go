@@ -0,0 +1,269 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRemoteSyncFS serves the local filesystem over SFTP and runs commands
+// with the local shell, standing in for a VM.
+func testRemoteSyncFS(t *testing.T) *remoteSyncFS {
+	serverConn, clientConn := net.Pipe()
+
+	server, err := sftp.NewServer(serverConn)
+	require.NoError(t, err)
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return &remoteSyncFS{
+		ftp: client,
+		run: func(ctx context.Context, cmd string, stdout, stderr io.Writer) (int, error) {
+			c := exec.CommandContext(ctx, "sh", "-c", cmd)
+			c.Stdout, c.Stderr = stdout, stderr
+			if err := c.Run(); err != nil {
+				if exitErr, ok := err.(*exec.ExitError); ok {
+					return exitErr.ExitCode(), nil
+				}
+				return -1, err
+			}
+			return 0, nil
+		},
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string, mtime time.Time) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+}
+
+func readFiles(t *testing.T, root string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestSync(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "dst")
+
+	writeFiles(t, src, map[string]string{
+		"a.txt":          "a",
+		"dir/b.txt":      "bb",
+		"dir/skip.log":   "log",
+		"cache/c.txt":    "c",
+		"dir/sub/d.txt":  "ddd",
+		"dir/sub/e.json": "{}",
+	}, mtime)
+
+	var out bytes.Buffer
+	s := &syncer{
+		src:     localSyncFS{},
+		srcRoot: src,
+		dst:     testRemoteSyncFS(t),
+		dstRoot: dst,
+		exclude: []string{"*.log", "/cache"},
+		delete:  true,
+		out:     &out,
+	}
+
+	stats, err := s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.transferred)
+	assert.Equal(t, map[string]string{
+		"a.txt":          "a",
+		"dir/b.txt":      "bb",
+		"dir/sub/d.txt":  "ddd",
+		"dir/sub/e.json": "{}",
+	}, readFiles(t, dst))
+
+	info, err := os.Stat(filepath.Join(dst, "dir/sub/d.txt"))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(mtime))
+
+	// Nothing changed, nothing transferred
+	stats, err = s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{unchanged: 4}, stats)
+
+	// Changed and removed files are synced, excluded ones in the
+	// destination are kept
+	writeFiles(t, src, map[string]string{"a.txt": "A"}, mtime.Add(time.Minute))
+	require.NoError(t, os.Remove(filepath.Join(src, "dir/sub/e.json")))
+	writeFiles(t, dst, map[string]string{"keep.log": "kept", "stale.txt": "x"}, mtime)
+
+	out.Reset()
+	stats, err = s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{transferred: 1, deleted: 2, unchanged: 2, bytes: 1}, stats)
+	assert.Equal(t, map[string]string{
+		"a.txt":         "A",
+		"dir/b.txt":     "bb",
+		"dir/sub/d.txt": "ddd",
+		"keep.log":      "kept",
+	}, readFiles(t, dst))
+	assert.Equal(t, "transfer a.txt (1 B)\ndelete stale.txt\ndelete dir/sub/e.json\n", out.String())
+}
+
+func TestSyncPull(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	remote, local := t.TempDir(), t.TempDir()
+	writeFiles(t, remote, map[string]string{"x/y.txt": "remote"}, mtime)
+
+	s := &syncer{
+		src:     testRemoteSyncFS(t),
+		srcRoot: remote,
+		dst:     localSyncFS{},
+		dstRoot: local,
+		out:     io.Discard,
+	}
+	stats, err := s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.transferred)
+	assert.Equal(t, map[string]string{"x/y.txt": "remote"}, readFiles(t, local))
+}
+
+func TestSyncDryRun(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"new.txt": "new"}, time.Now())
+	writeFiles(t, dst, map[string]string{"old.txt": "old"}, time.Now())
+
+	var out bytes.Buffer
+	s := &syncer{
+		src:     localSyncFS{},
+		srcRoot: src,
+		dst:     localSyncFS{},
+		dstRoot: dst,
+		delete:  true,
+		dryRun:  true,
+		out:     &out,
+	}
+	stats, err := s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{transferred: 1, deleted: 1, bytes: 3}, stats)
+	assert.Equal(t, "(dry run) transfer new.txt (3 B)\n(dry run) delete old.txt\n", out.String())
+	assert.Equal(t, map[string]string{"old.txt": "old"}, readFiles(t, dst))
+}
+
+func TestSyncResume(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"big.bin": "0123456789"}, mtime)
+	// An earlier sync got halfway
+	writeFiles(t, dst, map[string]string{
+		"big.bin" + partialSuffix:       "01234",
+		"big.bin" + partialSourceSuffix: fmt.Sprintf("10 %d\n", mtime.Unix()),
+	}, mtime)
+
+	var out bytes.Buffer
+	s := &syncer{
+		src:     localSyncFS{},
+		srcRoot: src,
+		dst:     testRemoteSyncFS(t),
+		dstRoot: dst,
+		out:     &out,
+	}
+	stats, err := s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{transferred: 1, bytes: 5}, stats)
+	assert.Equal(t, "resume big.bin at 5 B of 10 B\n", out.String())
+	assert.Equal(t, map[string]string{"big.bin": "0123456789"}, readFiles(t, dst))
+}
+
+func TestSyncResumeChangedSource(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"big.bin": "0123456789", "new.bin": "abc"}, mtime)
+	// An earlier sync got halfway through a file that has changed since, and
+	// one left a partial file without a record of its source
+	writeFiles(t, dst, map[string]string{
+		"big.bin" + partialSuffix:       "abcde",
+		"big.bin" + partialSourceSuffix: fmt.Sprintf("10 %d\n", mtime.Add(-time.Minute).Unix()),
+		"new.bin" + partialSuffix:       "x",
+	}, mtime)
+
+	var out bytes.Buffer
+	s := &syncer{
+		src:     localSyncFS{},
+		srcRoot: src,
+		dst:     testRemoteSyncFS(t),
+		dstRoot: dst,
+		out:     &out,
+	}
+	stats, err := s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{transferred: 2, bytes: 13}, stats)
+	assert.Equal(t, "transfer big.bin (10 B)\ntransfer new.bin (3 B)\n", out.String())
+	assert.Equal(t, map[string]string{"big.bin": "0123456789", "new.bin": "abc"}, readFiles(t, dst))
+}
+
+func TestSyncChecksum(t *testing.T) {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum isn't available")
+	}
+
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"same.txt": "same", "it's.txt": "new"}, mtime)
+	// Same size and modification time, but different content
+	writeFiles(t, dst, map[string]string{"same.txt": "same", "it's.txt": "old"}, mtime)
+
+	s := &syncer{
+		src:     localSyncFS{},
+		srcRoot: src,
+		dst:     testRemoteSyncFS(t),
+		dstRoot: dst,
+		out:     io.Discard,
+	}
+	stats, err := s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{unchanged: 2}, stats)
+
+	s.checksum = true
+	stats, err = s.sync(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, syncStats{transferred: 1, unchanged: 1, bytes: 3}, stats)
+	assert.Equal(t, map[string]string{"same.txt": "same", "it's.txt": "new"}, readFiles(t, dst))
+}
+
+func TestParseSHA256Sums(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	hashes, err := parseSHA256Sums(strings.NewReader(hash + "  /a\n\\" + hash + "  /b\\nc\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{hash, hash}, hashes)
+
+	_, err = parseSHA256Sums(strings.NewReader("sha256sum: /a: No such file or directory\n"))
+	assert.Error(t, err)
+}
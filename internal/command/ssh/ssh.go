@@ -19,6 +19,7 @@ func New() *cobra.Command {
 		newIssue(),
 		newLog(),
 		NewSFTP(),
+		newReplay(),
 	)
 
 	return cmd
@@ -0,0 +1,207 @@
+package snapshots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newExport() *cobra.Command {
+	const (
+		short = "Export a volume snapshot to local disk or S3-compatible storage."
+		long  = `Export the files of a volume snapshot, or of a volume as it is now, as a
+zstd-compressed tar archive, for backups off the platform.
+
+The snapshot is restored to a temporary volume that an ephemeral machine
+compresses and streams over SSH. Volumes attached to a machine are forked
+first, so they can be exported while in use; unattached ones are mounted
+directly.
+
+--to is file://<path>, s3://<bucket>/<key> or a plain path. S3 credentials
+and the region come from the usual AWS environment variables and files, and
+--s3-endpoint points at another S3-compatible service, like Tigris.
+
+Scheduled snapshots are taken daily, so exporting the latest one from a cron
+job or a CI schedule keeps an off-platform copy of every day.`
+		usage = "export <snapshot id|volume id>"
+	)
+
+	cmd := command.New(usage, short, long, runExport, command.RequireSession)
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.String{
+			Name:        "to",
+			Description: "Where to write the archive: file://<path>, s3://<bucket>/<key> or a path",
+		},
+		s3EndpointFlag,
+		imageFlag,
+	)
+	return cmd
+}
+
+var (
+	s3EndpointFlag = flag.String{
+		Name:        "s3-endpoint",
+		Description: "URL of the S3-compatible API for s3:// locations. Defaults to AWS",
+	}
+	imageFlag = flag.String{
+		Name:        "image",
+		Description: "Image of the ephemeral machine the volume is mounted on, which must have tar, and zstd or apk to install it",
+		Default:     defaultTransferImage,
+	}
+)
+
+func runExport(ctx context.Context) error {
+	var (
+		io     = iostreams.FromContext(ctx)
+		client = flyutil.ClientFromContext(ctx)
+
+		id      = flag.FirstArg(ctx)
+		appName = appconfig.NameFromContext(ctx)
+	)
+
+	if flag.GetString(ctx, "to") == "" {
+		return errors.New("the --to flag is required")
+	}
+	to, err := parseArchiveLocation(flag.GetString(ctx, "to"))
+	if err != nil {
+		return err
+	}
+
+	isVolume := strings.HasPrefix(id, "vol_")
+	if appName == "" {
+		if !isVolume {
+			return errors.New("the app of the snapshot is required, pass it with --app")
+		}
+		n, err := client.GetAppNameFromVolume(ctx, id)
+		if err != nil {
+			return err
+		}
+		appName = *n
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return err
+	}
+	ctx = flapsutil.NewContextWithClient(ctx, flapsClient)
+
+	fmt.Fprintf(io.Out, "Exporting %s to %s\n", id, to)
+
+	vol, cleanup, err := exportSource(ctx, id, isVolume)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	w, err := to.create(ctx, s3Options{Endpoint: flag.GetString(ctx, "s3-endpoint")})
+	if err != nil {
+		return err
+	}
+
+	counter := &countingWriter{w: w}
+	if err := exportVolume(ctx, appName, vol, flag.GetString(ctx, "image"), counter); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Exported %s to %s (%s)\n", id, to, humanize.IBytes(uint64(counter.n)))
+	return nil
+}
+
+// exportSource returns an unattached volume with the contents of the
+// snapshot or volume id, and a function that cleans up after the export.
+func exportSource(ctx context.Context, id string, isVolume bool) (*fly.Volume, func(), error) {
+	flapsClient := flapsutil.ClientFromContext(ctx)
+
+	if !isVolume {
+		vol, err := findSnapshotVolume(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		return temporaryVolume(ctx, fly.CreateVolumeRequest{
+			Name:       vol.Name,
+			Region:     vol.Region,
+			SizeGb:     fly.Pointer(vol.SizeGb),
+			Encrypted:  fly.Pointer(vol.Encrypted),
+			SnapshotID: fly.Pointer(id),
+		})
+	}
+
+	vol, err := flapsClient.GetVolume(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get volume: %w", err)
+	}
+	if !vol.IsAttached() {
+		return vol, func() {}, nil
+	}
+	return temporaryVolume(ctx, fly.CreateVolumeRequest{
+		Name:           vol.Name,
+		Region:         vol.Region,
+		SourceVolumeID: fly.Pointer(vol.ID),
+	})
+}
+
+// findSnapshotVolume returns the volume a snapshot was taken of, from the
+// volumes of the app
+func findSnapshotVolume(ctx context.Context, snapshotID string) (*fly.Volume, error) {
+	flapsClient := flapsutil.ClientFromContext(ctx)
+
+	volumes, err := flapsClient.GetVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, vol := range volumes {
+		switch vol.State {
+		case "pending_destroy", "deleted":
+			continue
+		}
+		snapshots, err := flapsClient.GetVolumeSnapshots(ctx, vol.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed retrieving snapshots: %w", err)
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.ID == snapshotID {
+				return &vol, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("snapshot %s not found in the volumes of the app", snapshotID)
+}
+
+// exportVolume writes a zstd-compressed tar archive of the files on vol to w
+func exportVolume(ctx context.Context, appName string, vol *fly.Volume, image string, w io.Writer) error {
+	return runOnVolume(ctx, appName, vol, image, exportCommand(transferMountPath), nil, w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
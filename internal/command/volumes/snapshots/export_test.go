@@ -0,0 +1,62 @@
+package snapshots
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/inmem"
+)
+
+func TestExportSource(t *testing.T) {
+	server := inmem.NewServer()
+	server.CreateApp(&fly.App{Name: "test-app", Organization: inmem.DefaultOrganization})
+	ctx := flapsutil.NewContextWithClient(context.Background(), server.FlapsClient("test-app"))
+
+	createVolume := func() *fly.Volume {
+		vol, err := server.CreateVolume(ctx, "test-app", fly.CreateVolumeRequest{Name: "data", Region: "ams", SizeGb: fly.Pointer(3)})
+		require.NoError(t, err)
+		return vol
+	}
+	attached, unattached := createVolume(), createVolume()
+	_, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{Region: "ams", Config: &fly.MachineConfig{
+		Image:  "nginx",
+		Mounts: []fly.MachineMount{{Volume: attached.ID, Path: "/data"}},
+	}})
+	require.NoError(t, err)
+	snapshot, err := server.CreateVolumeSnapshot(ctx, "test-app", unattached.ID)
+	require.NoError(t, err)
+
+	// Unattached volumes are exported as they are
+	vol, cleanup, err := exportSource(ctx, unattached.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, unattached.ID, vol.ID)
+	cleanup()
+	_, err = server.GetVolume(ctx, "test-app", unattached.ID)
+	assert.NoError(t, err)
+
+	// Attached ones are forked
+	vol, cleanup, err = exportSource(ctx, attached.ID, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, attached.ID, vol.ID)
+	assert.Equal(t, "ams", vol.Region)
+	assert.Equal(t, 3, vol.SizeGb)
+	cleanup()
+	vol, err = server.GetVolume(ctx, "test-app", vol.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "pending_destroy", vol.State)
+
+	// Snapshots are restored next to the volume they were taken of
+	vol, cleanup, err = exportSource(ctx, snapshot.ID, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, unattached.ID, vol.ID)
+	assert.Equal(t, "ams", vol.Region)
+	assert.Equal(t, 3, vol.SizeGb)
+	cleanup()
+
+	_, _, err = exportSource(ctx, "vs_missing", false)
+	assert.ErrorContains(t, err, "snapshot vs_missing not found")
+}
@@ -0,0 +1,124 @@
+package snapshots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/deploy"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/terminal"
+)
+
+func newImport() *cobra.Command {
+	const (
+		short = "Create a volume from an exported archive."
+		long  = `Create a volume and restore the files of an archive made by
+'fly volumes snapshots export' into it, from local disk or S3-compatible
+storage.
+
+The archive is streamed as it is to an ephemeral machine the volume is mounted
+on, which decompresses it.
+
+--from takes the same locations as the --to of export. The volume is created
+in --region, or the primary region of the app, and destroyed again if the
+restore fails.`
+		usage = "import <volume name>"
+	)
+
+	cmd := command.New(usage, short, long, runImport,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Region(),
+		flag.String{
+			Name:        "from",
+			Description: "Where to read the archive from: file://<path>, s3://<bucket>/<key> or a path",
+		},
+		flag.Int{
+			Name:        "size",
+			Shorthand:   "s",
+			Default:     deploy.DefaultVolumeInitialSizeGB,
+			Description: "The size of volume in gigabytes",
+		},
+		s3EndpointFlag,
+		imageFlag,
+	)
+	return cmd
+}
+
+func runImport(ctx context.Context) error {
+	var (
+		io = iostreams.FromContext(ctx)
+
+		volumeName = flag.FirstArg(ctx)
+		appName    = appconfig.NameFromContext(ctx)
+	)
+
+	if flag.GetString(ctx, "from") == "" {
+		return errors.New("the --from flag is required")
+	}
+	from, err := parseArchiveLocation(flag.GetString(ctx, "from"))
+	if err != nil {
+		return err
+	}
+
+	region := flag.GetRegion(ctx)
+	if region == "" {
+		if cfg := appconfig.ConfigFromContext(ctx); cfg != nil {
+			region = cfg.PrimaryRegion
+		}
+	}
+	if region == "" {
+		return errors.New("the region of the volume is required, pass it with --region")
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return err
+	}
+	ctx = flapsutil.NewContextWithClient(ctx, flapsClient)
+
+	r, err := from.open(ctx, s3Options{Endpoint: flag.GetString(ctx, "s3-endpoint")})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	vol, err := flapsClient.CreateVolume(ctx, fly.CreateVolumeRequest{
+		Name:              volumeName,
+		Region:            region,
+		SizeGb:            fly.Pointer(flag.GetInt(ctx, "size")),
+		Encrypted:         fly.Pointer(true),
+		RequireUniqueZone: fly.Pointer(false),
+	})
+	if err != nil {
+		return fmt.Errorf("failed creating volume: %w", err)
+	}
+
+	fmt.Fprintf(io.Out, "Restoring %s to volume %s\n", from, vol.ID)
+
+	if err := runOnVolume(ctx, appName, vol, flag.GetString(ctx, "image"), importCommand(transferMountPath), r, nil); err != nil {
+		if _, err := flapsClient.DeleteVolume(context.WithoutCancel(ctx), vol.ID); err != nil {
+			terminal.Warnf("Failed to destroy volume %s: %v", vol.ID, err)
+		}
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Restored %s to volume %s (%s) in region %s\n", from, vol.ID, vol.Name, vol.Region)
+	return nil
+}
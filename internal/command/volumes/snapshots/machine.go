@@ -0,0 +1,133 @@
+package snapshots
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/command/ssh"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/flyutil"
+	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/terminal"
+)
+
+const (
+	// defaultTransferImage has tar, and installs zstd with apk. SSH is
+	// available on every machine.
+	defaultTransferImage = "alpine:3.19"
+	// transferMountPath is where volumes are mounted on transfer machines
+	transferMountPath = "/data"
+)
+
+// exportCommand writes a zstd-compressed tar archive of the files in dir to
+// its output. Archives are compressed on the machine, so only compressed data
+// crosses the tunnel.
+func exportCommand(dir string) string {
+	return zstdCommand("tar -C " + dir + " -cf - . | zstd -q -c")
+}
+
+// importCommand extracts an archive written by exportCommand from its input
+// into dir
+func importCommand(dir string) string {
+	return zstdCommand("zstd -q -d -c | tar -C " + dir + " -xf -")
+}
+
+// zstdCommand runs the pipeline script in sh, installing zstd first on images
+// that lack it, such as defaultTransferImage. The pipeline fails when any of
+// its commands does, in shells that support pipefail.
+func zstdCommand(script string) string {
+	return "sh -c '(set -o pipefail) 2>/dev/null && set -o pipefail; command -v zstd >/dev/null || apk add -q --no-cache zstd >&2 || exit 1; " + script + "'"
+}
+
+// runOnVolume launches an ephemeral machine with vol mounted at
+// transferMountPath and runs cmd on it over SSH, feeding it stdin and
+// writing its output to stdout. The machine is destroyed when cmd exits.
+func runOnVolume(ctx context.Context, appName string, vol *fly.Volume, image, cmd string, stdin io.Reader, stdout io.Writer) error {
+	client := flyutil.ClientFromContext(ctx)
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("get app: %w", err)
+	}
+
+	machine, cleanup, err := mach.LaunchEphemeral(ctx, &mach.EphemeralInput{
+		LaunchInput: fly.LaunchMachineInput{
+			Region: vol.Region,
+			Config: &fly.MachineConfig{
+				Image: image,
+				Init: fly.MachineInit{
+					Exec: []string{"sleep", "inf"},
+				},
+				Guest: helpers.Clone(fly.MachinePresets["shared-cpu-1x"]),
+				Mounts: []fly.MachineMount{{
+					Volume: vol.ID,
+					Path:   transferMountPath,
+				}},
+				DNS: &fly.DNSConfig{
+					SkipRegistration: true,
+				},
+				Restart: &fly.MachineRestart{
+					Policy: fly.MachineRestartPolicyNo,
+				},
+				AutoDestroy: true,
+			},
+		},
+		What: fmt.Sprintf("to transfer the contents of volume %s", vol.ID),
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	_, dialer, err := ssh.BringUpAgent(ctx, client, app, "", true)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := ssh.Connect(&ssh.ConnectParams{
+		Ctx:            ctx,
+		Org:            app.Organization,
+		Dialer:         dialer,
+		Username:       ssh.DefaultSshUsername,
+		DisableSpinner: true,
+		AppNames:       []string{app.Name},
+	}, machine.PrivateIP)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	var stderr bytes.Buffer
+	code, err := sshClient.Pipe(ctx, cmd, stdin, stdout, &stderr)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("transfer command exited with code %d: %s", code, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// temporaryVolume creates a volume to export from, returning a function that
+// destroys it again
+func temporaryVolume(ctx context.Context, req fly.CreateVolumeRequest) (*fly.Volume, func(), error) {
+	flapsClient := flapsutil.ClientFromContext(ctx)
+
+	req.RequireUniqueZone = fly.Pointer(false)
+	vol, err := flapsClient.CreateVolume(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vol, func() {
+		if _, err := flapsClient.DeleteVolume(context.WithoutCancel(ctx), vol.ID); err != nil {
+			terminal.Warnf("Failed to destroy temporary volume %s: %v", vol.ID, err)
+			terminal.Warn("You may need to destroy it manually (`fly volumes destroy`).")
+		}
+	}, nil
+}
@@ -0,0 +1,40 @@
+package snapshots
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferCommands(t *testing.T) {
+	for _, name := range []string{"sh", "tar", "zstd"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s isn't available", name)
+		}
+	}
+
+	ctx := context.Background()
+	src, dst := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file.txt"), []byte("data"), 0o644))
+
+	var archive bytes.Buffer
+	export := exec.CommandContext(ctx, "sh", "-c", exportCommand(src))
+	export.Stdout = &archive
+	require.NoError(t, export.Run())
+	// The archive is compressed where the volume is
+	assert.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, archive.Bytes()[:4])
+
+	restore := exec.CommandContext(ctx, "sh", "-c", importCommand(dst))
+	restore.Stdin = &archive
+	require.NoError(t, restore.Run())
+	data, err := os.ReadFile(filepath.Join(dst, "dir", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
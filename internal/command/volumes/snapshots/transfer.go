@@ -0,0 +1,260 @@
+package snapshots
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Archives are uploaded to S3 in parts of s3PartSize at first. S3 allows
+// up to s3MaxParts parts, so the size doubles every s3PartsPerSize parts, up
+// to s3MaxPartSize, which lets archives grow to ~3TiB while only a part at
+// a time is held in memory.
+const (
+	s3PartSize     = 16 * 1024 * 1024
+	s3MaxPartSize  = 512 * 1024 * 1024
+	s3PartsPerSize = 1000
+	s3MaxParts     = 10000
+)
+
+// archiveLocation is where an archive of a volume is exported to or
+// imported from: a local file, or an object in an S3-compatible bucket.
+type archiveLocation struct {
+	Path string
+
+	Bucket string
+	Key    string
+}
+
+// parseArchiveLocation parses file://<path>, s3://<bucket>/<key> or a plain
+// local path. file:// paths are taken as they are, so file://backup.tar.zst
+// is relative to the current directory.
+func parseArchiveLocation(s string) (*archiveLocation, error) {
+	switch {
+	case strings.HasPrefix(s, "s3://"):
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 URL %q: %w", s, err)
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" || strings.HasSuffix(key, "/") {
+			return nil, fmt.Errorf("invalid S3 URL %q, it must look like s3://<bucket>/<key>", s)
+		}
+		return &archiveLocation{Bucket: u.Host, Key: key}, nil
+	case strings.HasPrefix(s, "file://"):
+		s = strings.TrimPrefix(s, "file://")
+	case strings.Contains(s, "://"):
+		return nil, fmt.Errorf("unsupported location %q, use file:// or s3://", s)
+	}
+	if s == "" {
+		return nil, errors.New("the location of the archive is empty")
+	}
+	return &archiveLocation{Path: s}, nil
+}
+
+func (l *archiveLocation) String() string {
+	if l.Bucket != "" {
+		return "s3://" + l.Bucket + "/" + l.Key
+	}
+	return l.Path
+}
+
+// s3Options configures the S3 client used for s3:// locations. Credentials
+// and the region come from the usual AWS environment variables and files.
+type s3Options struct {
+	// Endpoint is the URL of an S3-compatible API, like Tigris or MinIO.
+	// Buckets are addressed in the path of its URLs.
+	Endpoint string
+}
+
+func (o s3Options) client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		// S3-compatible services tend not to care, but requests must be
+		// signed for a region
+		cfg.Region = "auto"
+	}
+
+	return s3.NewFromConfig(cfg, func(so *s3.Options) {
+		if o.Endpoint != "" {
+			so.BaseEndpoint = aws.String(o.Endpoint)
+			so.UsePathStyle = true
+		}
+	}), nil
+}
+
+// create returns a writer for a new archive at the location. The archive is
+// only complete once the writer is closed without error; abort discards it.
+func (l *archiveLocation) create(ctx context.Context, opts s3Options) (archiveWriter, error) {
+	if l.Bucket == "" {
+		if err := os.MkdirAll(filepath.Dir(l.Path), 0o755); err != nil {
+			return nil, err
+		}
+		// Write next to the destination and move it in place when done, so
+		// a failed export doesn't leave a truncated archive behind
+		f, err := os.CreateTemp(filepath.Dir(l.Path), "."+filepath.Base(l.Path)+".*")
+		if err != nil {
+			return nil, err
+		}
+		return &fileArchiveWriter{File: f, path: l.Path}, nil
+	}
+
+	client, err := opts.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(l.Bucket),
+		Key:         aws.String(l.Key),
+		ContentType: aws.String("application/zstd"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed starting upload to %s: %w", l, err)
+	}
+	return &s3ArchiveWriter{
+		ctx:      ctx,
+		client:   client,
+		bucket:   l.Bucket,
+		key:      l.Key,
+		uploadID: aws.ToString(upload.UploadId),
+	}, nil
+}
+
+// open returns a reader for an existing archive at the location
+func (l *archiveLocation) open(ctx context.Context, opts s3Options) (io.ReadCloser, error) {
+	if l.Bucket == "" {
+		return os.Open(l.Path)
+	}
+
+	client, err := opts.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(l.Bucket),
+		Key:    aws.String(l.Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed downloading %s: %w", l, err)
+	}
+	return obj.Body, nil
+}
+
+type archiveWriter interface {
+	io.WriteCloser
+	abort() error
+}
+
+type fileArchiveWriter struct {
+	*os.File
+	path string
+}
+
+func (w *fileArchiveWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	return os.Rename(w.File.Name(), w.path)
+}
+
+func (w *fileArchiveWriter) abort() error {
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
+
+// s3ArchiveWriter uploads what's written to it in parts, since archives are
+// streamed and their size isn't known upfront.
+type s3ArchiveWriter struct {
+	ctx      context.Context
+	client   *s3.Client
+	bucket   string
+	key      string
+	uploadID string
+
+	buf   bytes.Buffer
+	parts []s3types.CompletedPart
+}
+
+func (w *s3ArchiveWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	for size := w.partSize(); w.buf.Len() >= size; size = w.partSize() {
+		if err := w.uploadPart(w.buf.Next(size)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// partSize returns the size of the next part to upload
+func (w *s3ArchiveWriter) partSize() int {
+	return min(s3PartSize<<(len(w.parts)/s3PartsPerSize), s3MaxPartSize)
+}
+
+func (w *s3ArchiveWriter) uploadPart(data []byte) error {
+	number := int32(len(w.parts) + 1)
+	if number > s3MaxParts {
+		return fmt.Errorf("archive is too large to upload to s3://%s/%s, S3 allows up to %d parts", w.bucket, w.key, s3MaxParts)
+	}
+	res, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(w.bucket),
+		Key:        aws.String(w.key),
+		UploadId:   aws.String(w.uploadID),
+		PartNumber: aws.Int32(number),
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed uploading part %d of s3://%s/%s: %w", number, w.bucket, w.key, err)
+	}
+	w.parts = append(w.parts, s3types.CompletedPart{ETag: res.ETag, PartNumber: aws.Int32(number)})
+	return nil
+}
+
+func (w *s3ArchiveWriter) Close() error {
+	// The last part is the only one allowed to be small, and there's always
+	// at least one
+	if w.buf.Len() > 0 || len(w.parts) == 0 {
+		if err := w.uploadPart(w.buf.Bytes()); err != nil {
+			w.abort()
+			return err
+		}
+		w.buf.Reset()
+	}
+
+	_, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(w.bucket),
+		Key:             aws.String(w.key),
+		UploadId:        aws.String(w.uploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	if err != nil {
+		w.abort()
+		return fmt.Errorf("failed completing upload to s3://%s/%s: %w", w.bucket, w.key, err)
+	}
+	return nil
+}
+
+func (w *s3ArchiveWriter) abort() error {
+	// The context may be canceled already, which is often why the upload is
+	// aborted in the first place
+	_, err := w.client.AbortMultipartUpload(context.WithoutCancel(w.ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: aws.String(w.uploadID),
+	})
+	return err
+}
@@ -0,0 +1,199 @@
+package snapshots
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArchiveLocation(t *testing.T) {
+	testcases := []struct {
+		in   string
+		want *archiveLocation
+		err  bool
+	}{
+		{in: "backup.tar.zst", want: &archiveLocation{Path: "backup.tar.zst"}},
+		{in: "file://backup.tar.zst", want: &archiveLocation{Path: "backup.tar.zst"}},
+		{in: "file:///var/backups/data.tar.zst", want: &archiveLocation{Path: "/var/backups/data.tar.zst"}},
+		{in: "s3://bucket/backups/data.tar.zst", want: &archiveLocation{Bucket: "bucket", Key: "backups/data.tar.zst"}},
+		{in: "s3://bucket", err: true},
+		{in: "s3://bucket/backups/", err: true},
+		{in: "https://example.com/data.tar.zst", err: true},
+		{in: "file://", err: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := parseArchiveLocation(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestFileArchive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	loc := &archiveLocation{Path: filepath.Join(dir, "backups", "data.tar.zst")}
+
+	// Aborted archives leave nothing behind
+	w, err := loc.create(ctx, s3Options{})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, w.abort())
+	entries, err := os.ReadDir(filepath.Join(dir, "backups"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	w, err = loc.create(ctx, s3Options{})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("archive"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := loc.open(ctx, s3Options{})
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "archive", string(data))
+}
+
+// fakeS3 implements the multipart upload and download of objects, addressed
+// by path
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	parts   []int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		data, _ := io.ReadAll(r.Body)
+		f.uploads[query.Get("uploadId")][number] = data
+		f.parts = append(f.parts, len(data))
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := f.uploads[query.Get("uploadId")]
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var object []byte
+		for _, n := range numbers {
+			object = append(object, parts[n]...)
+		}
+		f.objects[r.URL.Path] = object
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.Write(object)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestS3Archive(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	fake := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	opts := s3Options{Endpoint: server.URL}
+	loc := &archiveLocation{Bucket: "backups", Key: "app/data.tar.zst"}
+
+	// Parts are full size but the last
+	archive := bytes.Repeat([]byte("0123456789abcdef"), s3PartSize/16+1)
+	w, err := loc.create(ctx, opts)
+	require.NoError(t, err)
+	for start := 0; start < len(archive); start += 1 << 20 {
+		_, err := w.Write(archive[start:min(start+1<<20, len(archive))])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, []int{s3PartSize, 16}, fake.parts)
+	assert.Empty(t, fake.uploads)
+
+	r, err := loc.open(ctx, opts)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, archive, data)
+
+	// Aborted uploads aren't completed
+	w, err = loc.create(ctx, opts)
+	require.NoError(t, err)
+	require.NoError(t, w.abort())
+	assert.Empty(t, fake.uploads)
+}
+
+func TestS3ArchivePartSize(t *testing.T) {
+	w := &s3ArchiveWriter{bucket: "backups", key: "app/data.tar.zst"}
+	sizes := map[int]int{}
+	var total int64
+	for len(w.parts) < s3MaxParts {
+		size := w.partSize()
+		sizes[size]++
+		total += int64(size)
+		w.parts = append(w.parts, s3types.CompletedPart{})
+	}
+
+	assert.Equal(t, map[int]int{
+		16 << 20:  1000,
+		32 << 20:  1000,
+		64 << 20:  1000,
+		128 << 20: 1000,
+		256 << 20: 1000,
+		512 << 20: 5000,
+	}, sizes)
+	assert.Greater(t, total, int64(2<<40))
+
+	// Archives that don't fit fail before anything else is uploaded
+	assert.ErrorContains(t, w.uploadPart([]byte("more")), "too large")
+}
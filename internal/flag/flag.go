@@ -3,6 +3,7 @@ package flag
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"time"
 
@@ -516,6 +517,13 @@ func NoCache() Bool {
 	}
 }
 
+func ForceBuild() Bool {
+	return Bool{
+		Name:        "force-build",
+		Description: "Build the image even if one was already built from an unchanged build context",
+	}
+}
+
 func BuildSecret() StringArray {
 	return StringArray{
 		Name:        "build-secret",
@@ -537,6 +545,20 @@ func BuildTarget() String {
 	}
 }
 
+func Platform() StringSlice {
+	return StringSlice{
+		Name:        "platform",
+		Description: "Platforms to build the image for, such as linux/amd64 or linux/arm64. Several build a multi-platform image, which must include linux/amd64 to be deployed",
+	}
+}
+
+func Attest() Bool {
+	return Bool{
+		Name:        "attest",
+		Description: "Attach SBOM and build provenance attestations to the image. Requires BuildKit",
+	}
+}
+
 func Nixpacks() Bool {
 	return Bool{
 		Name:        "nixpacks",
@@ -548,7 +570,7 @@ func Nixpacks() Bool {
 func Strategy() String {
 	return String{
 		Name:        "strategy",
-		Description: "The strategy for replacing running instances. Options are canary, rolling, bluegreen, or immediate. The default strategy is rolling.",
+		Description: "The strategy for replacing running instances. Options are canary, rolling, bluegreen, immediate, or progressive. The default strategy is rolling.",
 	}
 }
 
@@ -561,6 +583,27 @@ func JSONOutput() Bool {
 	}
 }
 
+// ProgressOutput selects how commands report the progress of machine changes
+func ProgressOutput() String {
+	return String{
+		Name:        "output",
+		Description: "Format of progress updates, either 'text' or 'jsonl' to print one JSON event per line to stdout",
+		Default:     "text",
+	}
+}
+
+// GetJSONLinesOutput reports whether progress updates should be printed as JSON lines
+func GetJSONLinesOutput(ctx context.Context) (bool, error) {
+	switch output := GetString(ctx, "output"); output {
+	case "", "text":
+		return false, nil
+	case "jsonl":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported output format '%s', must be either 'text' or 'jsonl'", output)
+	}
+}
+
 func ProcessGroup(desc string) String {
 	if desc == "" {
 		desc = "The target process group"
@@ -0,0 +1,68 @@
+package inmem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/superfly/fly-go/flaps"
+)
+
+// Error is an error returned by the emulated APIs, carrying the HTTP status
+// the real ones respond with.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(status int, format string, args ...any) *Error {
+	return &Error{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+func errNotFound(format string, args ...any) *Error {
+	return newError(http.StatusNotFound, format, args...)
+}
+
+func errBadRequest(format string, args ...any) *Error {
+	return newError(http.StatusBadRequest, format, args...)
+}
+
+func errConflict(format string, args ...any) *Error {
+	return newError(http.StatusConflict, format, args...)
+}
+
+func errPrecondition(format string, args ...any) *Error {
+	return newError(http.StatusPreconditionFailed, format, args...)
+}
+
+// errNotImplemented is returned by the parts of the APIs the emulator
+// doesn't cover
+func errNotImplemented(what string) *Error {
+	return newError(http.StatusNotImplemented, "inmem: %s is not implemented", what)
+}
+
+// errorStatus returns the HTTP status err should be served with
+func errorStatus(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// flapsError wraps err the way the Machines API client does, so callers
+// checking for statuses with errors.Is see the same errors in-process as
+// over HTTP.
+func flapsError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &flaps.FlapsError{
+		OriginalError:      err,
+		ResponseStatusCode: errorStatus(err),
+	}
+}
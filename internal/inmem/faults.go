@@ -0,0 +1,207 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// Fault makes calls to a method of the server fail or slow down, so tests
+// can see how callers cope with a misbehaving platform. Methods are named as
+// the Server methods that implement them, like "StartMachine" or
+// "AcquireLease", and cover the Machines API whether it's called in-process
+// or over HTTP.
+type Fault struct {
+	// Method is the name of the method calls to which are affected
+	Method string
+	// MachineID limits the fault to calls about one machine, if set
+	MachineID string
+
+	// Err is returned by the calls that fail. Faults without one only add
+	// latency; an *Error sets the HTTP status clients see.
+	Err error
+	// Rate is the share of calls that fail, between 0 and 1. Every call
+	// fails if it's 0.
+	Rate float64
+	// Times limits how many calls fail, if set
+	Times int
+
+	// Latency delays every affected call, failing or not
+	Latency time.Duration
+}
+
+type activeFault struct {
+	Fault
+	failed int
+}
+
+// heldState is the state a machine is kept in and the one it would be in
+// otherwise
+type heldState struct {
+	state    string
+	intended string
+}
+
+// ServerError returns an error for a fault that clients see as the HTTP
+// status given
+func ServerError(status int) error {
+	return newError(status, "inmem: injected fault: %s", http.StatusText(status))
+}
+
+// InjectFault adds a fault to the server, returning a function that
+// removes it again.
+func (s *Server) InjectFault(f Fault) (remove func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := &activeFault{Fault: f}
+	s.faults = append(s.faults, active)
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, other := range s.faults {
+			if other == active {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// ClearFaults removes all the faults added to the server
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// SetFaultSeed seeds the choice of which calls fail for faults with a rate.
+// Servers start with the same seed, so runs are repeatable anyway.
+func (s *Server) SetFaultSeed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faultRand = rand.New(rand.NewSource(seed))
+}
+
+// fault applies the faults for a call to method, returning the error the
+// call should fail with, if any. Like requests to the real API, calls fail
+// once ctx is done. s.mu must not be held.
+func (s *Server) fault(ctx context.Context, method, machineID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	var (
+		latency time.Duration
+		err     error
+	)
+	for _, f := range s.faults {
+		if f.Method != method || (f.MachineID != "" && f.MachineID != machineID) {
+			continue
+		}
+		latency += f.Latency
+		if err != nil || f.Err == nil || (f.Times > 0 && f.failed >= f.Times) {
+			continue
+		}
+		if f.Rate > 0 && s.faultRand.Float64() >= f.Rate {
+			continue
+		}
+		f.failed++
+		err = f.Err
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// HoldMachineState keeps a machine in state: it moves there right away and
+// other transitions don't happen, except destroying it, so waiting for it to
+// reach another state times out. Machine IDs are handed out in sequence,
+// from 00000000000001, and machines that don't exist yet are held from the
+// moment they're launched.
+func (s *Server) HoldMachineState(appName, machineID, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.held[machineID] = &heldState{state: state}
+
+	if machine, err := s.machine(appName, machineID); err == nil && machine.State != fly.MachineStateDestroyed {
+		s.transition(machine, "hold", machine.State, "flyd")
+	}
+}
+
+// ReleaseMachineState lets a machine held with HoldMachineState move on to
+// the state it would have been in
+func (s *Server) ReleaseMachineState(appName, machineID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := s.held[machineID]
+	delete(s.held, machineID)
+
+	if machine, err := s.machine(appName, machineID); err == nil && held != nil && held.intended != "" {
+		s.transition(machine, "release", held.intended, "flyd")
+	}
+}
+
+// SetCheckSequence makes a health check of a machine go through statuses,
+// moving to the next one each time the machine is read and staying on the
+// last. It overrides SetCheckStatus, and like HoldMachineState, can be used
+// on machines that don't exist yet.
+func (s *Server) SetCheckSequence(appName, machineID, name string, statuses ...fly.ConsulCheckStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(statuses) == 0 {
+		delete(s.checks[machineID], name)
+	} else {
+		if s.checks[machineID] == nil {
+			s.checks[machineID] = map[string]checkOverride{}
+		}
+		s.checks[machineID][name] = checkOverride{
+			status:   statuses[0],
+			output:   fmt.Sprintf("status set to %s", statuses[0]),
+			sequence: statuses[1:],
+		}
+	}
+
+	if machine, err := s.machine(appName, machineID); err == nil {
+		s.refreshChecks(machine)
+		s.notify()
+	}
+}
+
+// advanceChecks moves the checks of a machine going through a sequence of
+// statuses on to the next one. s.mu must be held.
+func (s *Server) advanceChecks(machine *fly.Machine) {
+	overrides := s.checks[machine.ID]
+	advanced := false
+	for name, o := range overrides {
+		if len(o.sequence) == 0 {
+			continue
+		}
+		o.status, o.sequence = o.sequence[0], o.sequence[1:]
+		o.output = fmt.Sprintf("status set to %s", o.status)
+		overrides[name] = o
+		advanced = true
+	}
+	if advanced {
+		s.refreshChecks(machine)
+	}
+}
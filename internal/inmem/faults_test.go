@@ -0,0 +1,130 @@
+package inmem
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+)
+
+func TestFaultTimes(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	client := server.FlapsClient("test-app")
+
+	machine, err := client.Launch(ctx, fly.LaunchMachineInput{Config: &fly.MachineConfig{Image: "nginx"}})
+	require.NoError(t, err)
+
+	server.InjectFault(Fault{Method: "StopMachine", Err: ServerError(http.StatusServiceUnavailable), Times: 2})
+	for i := 0; i < 2; i++ {
+		err = client.Stop(ctx, fly.StopMachineInput{ID: machine.ID}, "")
+		var flapsErr *flaps.FlapsError
+		require.ErrorAs(t, err, &flapsErr)
+		assert.Equal(t, http.StatusServiceUnavailable, flapsErr.ResponseStatusCode)
+	}
+	require.NoError(t, client.Stop(ctx, fly.StopMachineInput{ID: machine.ID}, ""))
+}
+
+func TestFaultMachineID(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	remove := server.InjectFault(Fault{Method: "GetMachine", MachineID: "00000000000002", Err: ServerError(http.StatusInternalServerError)})
+
+	for _, id := range []string{"00000000000001", "00000000000002"} {
+		_, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{Config: &fly.MachineConfig{Image: "nginx"}})
+		require.NoError(t, err, id)
+	}
+
+	_, err := server.GetMachine(ctx, "test-app", "00000000000001")
+	assert.NoError(t, err)
+	_, err = server.GetMachine(ctx, "test-app", "00000000000002")
+	assert.Equal(t, http.StatusInternalServerError, errorStatus(err))
+
+	remove()
+	_, err = server.GetMachine(ctx, "test-app", "00000000000002")
+	assert.NoError(t, err)
+}
+
+func TestFaultRate(t *testing.T) {
+	ctx := context.Background()
+
+	failures := func() []bool {
+		server := newTestServer(t)
+		server.SetFaultSeed(42)
+		server.InjectFault(Fault{Method: "ListMachines", Err: ServerError(http.StatusBadGateway), Rate: 0.5})
+
+		out := make([]bool, 20)
+		for i := range out {
+			_, err := server.ListMachines(ctx, "test-app", false)
+			out[i] = err != nil
+		}
+		return out
+	}
+
+	first := failures()
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+	assert.Equal(t, first, failures())
+}
+
+func TestFaultLatency(t *testing.T) {
+	server := newTestServer(t)
+	server.InjectFault(Fault{Method: "ListVolumes", Latency: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := server.ListVolumes(ctx, "test-app")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// Like API requests, calls fail once their context is done, faults or not
+	_, err = server.ListMachines(ctx, "test-app", false)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestHoldMachineState(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	server.HoldMachineState("test-app", "00000000000001", fly.MachineStateCreated)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{Config: &fly.MachineConfig{Image: "nginx"}})
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateCreated, machine.State)
+
+	err = server.WaitMachine(ctx, "test-app", machine.ID, fly.MachineStateStarted, 10*time.Millisecond)
+	assert.Equal(t, http.StatusRequestTimeout, errorStatus(err))
+
+	server.ReleaseMachineState("test-app", machine.ID)
+	require.NoError(t, server.WaitMachine(ctx, "test-app", machine.ID, fly.MachineStateStarted, time.Second))
+}
+
+func TestSetCheckSequence(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	server.SetCheckSequence("test-app", "00000000000001", "alive", fly.Critical, fly.Warning, fly.Passing)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{
+			Image:  "nginx",
+			Checks: map[string]fly.MachineCheck{"alive": {}},
+		},
+	})
+	require.NoError(t, err)
+
+	var statuses []fly.ConsulCheckStatus
+	for i := 0; i < 4; i++ {
+		machine, err = server.GetMachine(ctx, "test-app", machine.ID)
+		require.NoError(t, err)
+		statuses = append(statuses, machine.Checks[0].Status)
+	}
+	assert.Equal(t, []fly.ConsulCheckStatus{fly.Critical, fly.Warning, fly.Passing, fly.Passing}, statuses)
+}
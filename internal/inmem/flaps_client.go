@@ -2,8 +2,10 @@ package inmem
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	fly "github.com/superfly/fly-go"
@@ -12,6 +14,9 @@ import (
 
 var _ flapsutil.FlapsClient = (*FlapsClient)(nil)
 
+// FlapsClient is a Machines API client for one app that calls the server
+// in-process. Errors carry the status the API would respond with, so they
+// can be checked for with errors.Is and flaps.FlapsErrorNotFound and such.
 type FlapsClient struct {
 	server  *Server
 	appName string
@@ -25,112 +30,161 @@ func NewFlapsClient(server *Server, appName string) *FlapsClient {
 }
 
 func (m *FlapsClient) AcquireLease(ctx context.Context, machineID string, ttl *int) (*fly.MachineLease, error) {
-	panic("TODO")
+	lease, err := m.server.AcquireLease(ctx, m.appName, machineID, ttl)
+	return lease, flapsError(err)
 }
 
 func (m *FlapsClient) Cordon(ctx context.Context, machineID string, nonce string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.CordonMachine(ctx, m.appName, machineID, nonce, true))
 }
 
 func (m *FlapsClient) CreateApp(ctx context.Context, name string, org string) (err error) {
-	panic("TODO")
+	_, err = m.server.NewApp(ctx, org, name, "")
+	return flapsError(err)
 }
 
 func (m *FlapsClient) CreateVolume(ctx context.Context, req fly.CreateVolumeRequest) (*fly.Volume, error) {
-	panic("TODO")
+	vol, err := m.server.CreateVolume(ctx, m.appName, req)
+	return vol, flapsError(err)
 }
 
 func (m *FlapsClient) CreateVolumeSnapshot(ctx context.Context, volumeId string) error {
-	panic("TODO")
+	_, err := m.server.CreateVolumeSnapshot(ctx, m.appName, volumeId)
+	return flapsError(err)
 }
 
 func (m *FlapsClient) DeleteMetadata(ctx context.Context, machineID, key string) error {
-	panic("TODO")
+	return flapsError(m.server.DeleteMetadata(ctx, m.appName, machineID, key))
 }
 
 func (m *FlapsClient) DeleteVolume(ctx context.Context, volumeId string) (*fly.Volume, error) {
-	panic("TODO")
+	vol, err := m.server.DeleteVolume(ctx, m.appName, volumeId)
+	return vol, flapsError(err)
 }
 
 func (m *FlapsClient) Destroy(ctx context.Context, input fly.RemoveMachineInput, nonce string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.DestroyMachine(ctx, m.appName, input.ID, input.Kill, nonce))
 }
 
 func (m *FlapsClient) Exec(ctx context.Context, machineID string, in *fly.MachineExecRequest) (*fly.MachineExecResponse, error) {
-	panic("TODO")
+	out, err := m.server.ExecMachine(ctx, m.appName, machineID, in)
+	return out, flapsError(err)
 }
 
 func (m *FlapsClient) ExtendVolume(ctx context.Context, volumeId string, size_gb int) (*fly.Volume, bool, error) {
-	panic("TODO")
+	vol, needsRestart, err := m.server.ExtendVolume(ctx, m.appName, volumeId, size_gb)
+	return vol, needsRestart, flapsError(err)
 }
 
 func (m *FlapsClient) FindLease(ctx context.Context, machineID string) (*fly.MachineLease, error) {
-	panic("TODO")
+	lease, err := m.server.FindLease(ctx, m.appName, machineID)
+	return lease, flapsError(err)
 }
 
 func (m *FlapsClient) Get(ctx context.Context, machineID string) (*fly.Machine, error) {
-	return m.server.GetMachine(ctx, m.appName, machineID)
+	machine, err := m.server.GetMachine(ctx, m.appName, machineID)
+	return machine, flapsError(err)
 }
 
 func (m *FlapsClient) GetAllVolumes(ctx context.Context) ([]fly.Volume, error) {
-	panic("TODO")
+	volumes, err := m.server.ListVolumes(ctx, m.appName)
+	return volumes, flapsError(err)
 }
 
 func (m *FlapsClient) GetMany(ctx context.Context, machineIDs []string) ([]*fly.Machine, error) {
-	panic("TODO")
+	machines := make([]*fly.Machine, 0, len(machineIDs))
+	for _, id := range machineIDs {
+		machine, err := m.Get(ctx, id)
+		if err != nil {
+			return machines, err
+		}
+		machines = append(machines, machine)
+	}
+	return machines, nil
 }
 
 func (m *FlapsClient) GetMetadata(ctx context.Context, machineID string) (map[string]string, error) {
-	panic("TODO")
+	metadata, err := m.server.GetMetadata(ctx, m.appName, machineID)
+	return metadata, flapsError(err)
 }
 
 func (m *FlapsClient) GetProcesses(ctx context.Context, machineID string) (fly.MachinePsResponse, error) {
-	return nil, nil // TODO
+	processes, err := m.server.MachineProcesses(ctx, m.appName, machineID)
+	return processes, flapsError(err)
 }
 
 func (m *FlapsClient) GetVolume(ctx context.Context, volumeId string) (*fly.Volume, error) {
-	panic("TODO")
+	vol, err := m.server.GetVolume(ctx, m.appName, volumeId)
+	return vol, flapsError(err)
 }
 
 func (m *FlapsClient) GetVolumeSnapshots(ctx context.Context, volumeId string) ([]fly.VolumeSnapshot, error) {
-	panic("TODO")
+	snapshots, err := m.server.ListVolumeSnapshots(ctx, m.appName, volumeId)
+	return snapshots, flapsError(err)
 }
 
 func (m *FlapsClient) GetVolumes(ctx context.Context) ([]fly.Volume, error) {
-	panic("TODO")
+	volumes, err := m.GetAllVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(volumes, func(v fly.Volume) bool {
+		return v.State == volumeDestroyedState
+	}), nil
 }
 
 func (m *FlapsClient) Kill(ctx context.Context, machineID string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.SignalMachine(ctx, m.appName, machineID, 9))
 }
 
 func (m *FlapsClient) Launch(ctx context.Context, builder fly.LaunchMachineInput) (out *fly.Machine, err error) {
-	return m.server.Launch(ctx, m.appName, builder.Name, builder.Region, builder.Config)
+	machine, err := m.server.Launch(ctx, m.appName, builder)
+	return machine, flapsError(err)
 }
 
+// List lists the app's machines. state is the query string the API takes,
+// such as "include_deleted=true" or "state=started".
 func (m *FlapsClient) List(ctx context.Context, state string) ([]*fly.Machine, error) {
-	panic("TODO")
+	query, err := url.ParseQuery(strings.TrimPrefix(state, "?"))
+	if err != nil {
+		return nil, flapsError(errBadRequest("invalid query: %v", err))
+	}
+	return listMachines(ctx, m.server, m.appName, query)
 }
 
-func (m *FlapsClient) ListActive(ctx context.Context) ([]*fly.Machine, error) {
-	m.server.mu.Lock()
-	defer m.server.mu.Unlock()
+// listMachines lists an app's machines as filtered by query
+func listMachines(ctx context.Context, server *Server, appName string, query url.Values) ([]*fly.Machine, error) {
+	machines, err := server.ListMachines(ctx, appName, query.Get("include_deleted") == "true")
+	if err != nil {
+		return nil, flapsError(err)
+	}
+	if states := query["state"]; len(states) > 0 {
+		states = strings.Split(strings.Join(states, ","), ",")
+		machines = slices.DeleteFunc(machines, func(machine *fly.Machine) bool {
+			return !slices.Contains(states, machine.State)
+		})
+	}
+	return machines, nil
+}
 
-	var a []*fly.Machine
-	for _, machine := range m.server.machines[m.appName] {
-		if !machine.IsReleaseCommandMachine() && !machine.IsFlyAppsConsole() && machine.IsActive() {
-			a = append(a, machine)
-		}
+func (m *FlapsClient) ListActive(ctx context.Context) ([]*fly.Machine, error) {
+	machines, err := m.List(ctx, "")
+	if err != nil {
+		return nil, err
 	}
-	return a, nil
+	return slices.DeleteFunc(machines, func(machine *fly.Machine) bool {
+		return machine.IsReleaseCommandMachine() || machine.IsFlyAppsConsole() || !machine.IsActive()
+	}), nil
 }
 
 func (m *FlapsClient) ListFlyAppsMachines(ctx context.Context) (machines []*fly.Machine, releaseCmdMachine *fly.Machine, err error) {
-	m.server.mu.Lock()
-	defer m.server.mu.Unlock()
+	all, err := m.List(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
 
 	machines = make([]*fly.Machine, 0)
-	for _, machine := range m.server.machines[m.appName] {
+	for _, machine := range all {
 		if machine.IsFlyAppsPlatform() && machine.IsActive() && !machine.IsFlyAppsReleaseCommand() && !machine.IsFlyAppsConsole() {
 			machines = append(machines, machine)
 		} else if machine.IsFlyAppsReleaseCommand() {
@@ -140,64 +194,61 @@ func (m *FlapsClient) ListFlyAppsMachines(ctx context.Context) (machines []*fly.
 	return machines, releaseCmdMachine, nil
 }
 
+// NewRequest builds a request for the server's HTTP front end. It's only
+// useful with a client that sends requests to a running Handler.
 func (m *FlapsClient) NewRequest(ctx context.Context, method, path string, in interface{}, headers map[string][]string) (*http.Request, error) {
-	panic("TODO")
+	return nil, flapsError(errNotImplemented("raw Machines API requests"))
 }
 
 func (m *FlapsClient) RefreshLease(ctx context.Context, machineID string, ttl *int, nonce string) (*fly.MachineLease, error) {
-	panic("TODO")
+	lease, err := m.server.RefreshLease(ctx, m.appName, machineID, ttl, nonce)
+	return lease, flapsError(err)
 }
 
 func (m *FlapsClient) ReleaseLease(ctx context.Context, machineID, nonce string) error {
-	panic("TODO")
+	return flapsError(m.server.ReleaseLease(ctx, m.appName, machineID, nonce))
 }
 
 func (m *FlapsClient) Restart(ctx context.Context, in fly.RestartMachineInput, nonce string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.RestartMachine(ctx, m.appName, in.ID, nonce))
 }
 
 func (m *FlapsClient) SetMetadata(ctx context.Context, machineID, key, value string) error {
-	panic("TODO")
+	return flapsError(m.server.SetMetadata(ctx, m.appName, machineID, key, value))
 }
 
 func (m *FlapsClient) Start(ctx context.Context, machineID string, nonce string) (out *fly.MachineStartResponse, err error) {
-	panic("TODO")
+	out, err = m.server.StartMachine(ctx, m.appName, machineID, nonce)
+	return out, flapsError(err)
 }
 
 func (m *FlapsClient) Stop(ctx context.Context, in fly.StopMachineInput, nonce string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.StopMachine(ctx, m.appName, in.ID, nonce))
 }
 
 func (m *FlapsClient) Suspend(ctx context.Context, machineID, nonce string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.SuspendMachine(ctx, m.appName, machineID, nonce))
 }
 
 func (m *FlapsClient) Uncordon(ctx context.Context, machineID string, nonce string) (err error) {
-	panic("TODO")
+	return flapsError(m.server.CordonMachine(ctx, m.appName, machineID, nonce, false))
 }
 
 func (m *FlapsClient) Update(ctx context.Context, builder fly.LaunchMachineInput, nonce string) (out *fly.Machine, err error) {
-	panic("TODO")
+	out, err = m.server.UpdateMachine(ctx, m.appName, builder, nonce)
+	return out, flapsError(err)
 }
 
 func (m *FlapsClient) UpdateVolume(ctx context.Context, volumeId string, req fly.UpdateVolumeRequest) (*fly.Volume, error) {
-	panic("TODO")
+	vol, err := m.server.UpdateVolume(ctx, m.appName, volumeId, req)
+	return vol, flapsError(err)
 }
 
 func (m *FlapsClient) Wait(ctx context.Context, machine *fly.Machine, state string, timeout time.Duration) (err error) {
-	if state == "" {
-		state = "started"
-	}
-	mach, err := m.server.GetMachine(ctx, m.appName, machine.ID)
-	if err != nil {
-		return err
-	}
-	if mach.State != state {
-		return fmt.Errorf("machine did not reach state %q, current state is %q", state, mach.State)
-	}
-	return nil
+	return flapsError(m.server.WaitMachine(ctx, m.appName, machine.ID, state, timeout))
 }
 
 func (m *FlapsClient) WaitForApp(ctx context.Context, name string) error {
-	panic("TODO")
+	_, err := m.server.GetApp(ctx, name)
+	return flapsError(err)
 }
@@ -0,0 +1,327 @@
+package inmem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// The GraphQL API is emulated without a schema. Fields resolve to whatever
+// the object they're selected from holds under a matching name, compared
+// ignoring case and underscores, and objects are projected through the
+// selection set of the query. That covers the queries flyctl makes without
+// having to model every type of the real API.
+
+// resolver computes the value of a field from its arguments
+type resolver func(ctx context.Context, args map[string]any) (any, error)
+
+// object is a GraphQL object. Its values are plain Go values, which are
+// projected as their JSON encoding, other objects or resolvers.
+type object map[string]any
+
+// get returns the value of field name
+func (o object) get(name string) any {
+	if v, ok := o[name]; ok {
+		return v
+	}
+	want := normalizeFieldName(name)
+	for k, v := range o {
+		if normalizeFieldName(k) == want {
+			return v
+		}
+	}
+	return nil
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// GraphQLError is an error in a GraphQL response
+type GraphQLError struct {
+	Message    string   `json:"message"`
+	Path       []string `json:"path,omitempty"`
+	Extensions struct {
+		Code string `json:"code,omitempty"`
+	} `json:"extensions"`
+}
+
+// GraphQLResponse is the response to a GraphQL request
+type GraphQLResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// errorCode returns the code the API puts in the extensions of errors with
+// the status of err, which clients check for.
+func errorCode(err error) string {
+	switch errorStatus(err) {
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "UNAUTHORIZED"
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENTS"
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return "UNPROCESSABLE"
+	case http.StatusNotImplemented:
+		return "NOT_IMPLEMENTED"
+	default:
+		return "SERVER_ERROR"
+	}
+}
+
+// ExecuteGraphQL runs a GraphQL query or mutation against the server. vars
+// may hold any values that encode to JSON.
+func (s *Server) ExecuteGraphQL(ctx context.Context, query string, vars map[string]any, operationName string) *GraphQLResponse {
+	resp := &GraphQLResponse{}
+	fail := func(err error) *GraphQLResponse {
+		gqlErr := GraphQLError{Message: err.Error()}
+		gqlErr.Extensions.Code = errorCode(err)
+		resp.Errors = append(resp.Errors, gqlErr)
+		return resp
+	}
+
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return fail(errBadRequest("%s", err.Error()))
+	}
+
+	var op *ast.OperationDefinition
+	switch {
+	case operationName != "":
+		op = doc.Operations.ForName(operationName)
+	case len(doc.Operations) == 1:
+		op = doc.Operations[0]
+	}
+	if op == nil {
+		return fail(errBadRequest("operation %q not found", operationName))
+	}
+
+	// Variables go through JSON so that those set by in-process callers
+	// look the same as those sent over HTTP
+	vars, err = normalizeVariables(vars)
+	if err != nil {
+		return fail(errBadRequest("invalid variables: %v", err))
+	}
+	for _, def := range op.VariableDefinitions {
+		if _, ok := vars[def.Variable]; !ok && def.DefaultValue != nil {
+			if vars[def.Variable], err = def.DefaultValue.Value(nil); err != nil {
+				return fail(errBadRequest("invalid default for $%s: %v", def.Variable, err))
+			}
+		}
+	}
+
+	var root object
+	switch op.Operation {
+	case ast.Query:
+		root = s.queryRoot()
+	case ast.Mutation:
+		root = s.mutationRoot()
+	default:
+		return fail(errNotImplemented(string(op.Operation) + "s"))
+	}
+
+	e := &executor{ctx: ctx, doc: doc, vars: vars}
+	for _, field := range e.fields(op.SelectionSet) {
+		if root.get(field.Name) == nil && field.Name != "__typename" {
+			return fail(errNotImplemented("the " + field.Name + " field"))
+		}
+	}
+
+	resp.Data = e.object(root, op.SelectionSet, nil)
+	resp.Errors = e.errors
+	return resp
+}
+
+func normalizeVariables(vars map[string]any) (map[string]any, error) {
+	if len(vars) == 0 {
+		return map[string]any{}, nil
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	return out, json.Unmarshal(data, &out)
+}
+
+type executor struct {
+	ctx    context.Context
+	doc    *ast.QueryDocument
+	vars   map[string]any
+	errors []GraphQLError
+}
+
+// fields flattens a selection set into the fields it selects, expanding
+// fragments. Type conditions aren't checked, since values of any type only
+// have the fields they have.
+func (e *executor) fields(set ast.SelectionSet) []*ast.Field {
+	var fields []*ast.Field
+	for _, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, selection)
+		case *ast.InlineFragment:
+			fields = append(fields, e.fields(selection.SelectionSet)...)
+		case *ast.FragmentSpread:
+			if fragment := e.doc.Fragments.ForName(selection.Name); fragment != nil {
+				fields = append(fields, e.fields(fragment.SelectionSet)...)
+			}
+		}
+	}
+	return fields
+}
+
+func (e *executor) object(obj object, set ast.SelectionSet, path []string) map[string]any {
+	out := make(map[string]any)
+	for _, field := range e.fields(set) {
+		key := field.Alias
+		if key == "" {
+			key = field.Name
+		}
+		fieldPath := append(path[:len(path):len(path)], key)
+
+		v := obj.get(field.Name)
+		if r, ok := v.(resolver); ok {
+			args, err := e.arguments(field)
+			if err == nil {
+				v, err = r(e.ctx, args)
+			}
+			if err != nil {
+				gqlErr := GraphQLError{Message: err.Error(), Path: fieldPath}
+				gqlErr.Extensions.Code = errorCode(err)
+				e.errors = append(e.errors, gqlErr)
+				out[key] = nil
+				continue
+			}
+		}
+
+		if existing, ok := out[key].(map[string]any); ok {
+			// The same field selected twice, by fragments for instance,
+			// has its selections merged
+			if more, ok := e.value(v, field.SelectionSet, fieldPath).(map[string]any); ok {
+				for k, v := range more {
+					existing[k] = v
+				}
+			}
+			continue
+		}
+		out[key] = e.value(v, field.SelectionSet, fieldPath)
+	}
+	return out
+}
+
+func (e *executor) value(v any, set ast.SelectionSet, path []string) any {
+	if len(set) == 0 {
+		return v
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case object:
+		return e.object(v, set, path)
+	case []object:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = e.object(item, set, path)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = e.value(item, set, path)
+		}
+		return out
+	case map[string]any:
+		return e.object(object(v), set, path)
+	}
+
+	switch v := toJSON(v).(type) {
+	case map[string]any:
+		return e.object(object(v), set, path)
+	case []any:
+		return e.value(v, set, path)
+	default:
+		return v
+	}
+}
+
+func (e *executor) arguments(field *ast.Field) (map[string]any, error) {
+	args := make(map[string]any, len(field.Arguments))
+	for _, arg := range field.Arguments {
+		v, err := arg.Value.Value(e.vars)
+		if err != nil {
+			return nil, errBadRequest("invalid argument %s: %v", arg.Name, err)
+		}
+		args[arg.Name] = v
+	}
+	return args, nil
+}
+
+// toJSON returns v as the generic values its JSON encoding decodes to
+func toJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// decodeArg decodes the argument name into out, which is left alone if the
+// argument is missing
+func decodeArg(args map[string]any, name string, out any) error {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errBadRequest("invalid argument %s: %v", name, err)
+	}
+	return nil
+}
+
+// stringArg returns the argument name if it's a string
+func stringArg(args map[string]any, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+// intArg returns the argument name if it's a number, which it is as an
+// int64 if given in the query and as a float64 if given as a variable
+func intArg(args map[string]any, name string) (int, bool) {
+	switch v := args[name].(type) {
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// graphQLErrors joins the errors of a response into one error
+func graphQLErrors(errs []GraphQLError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return errors.New(strings.Join(messages, ", "))
+}
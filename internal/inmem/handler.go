@@ -0,0 +1,312 @@
+package inmem
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+)
+
+// Handler serves the GraphQL API at /graphql and the Machines API under
+// /v1, so that flyctl can be pointed at a running server with
+// FLY_API_BASE_URL and FLY_FLAPS_BASE_URL. Tokens aren't checked.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", s.serveGraphQL)
+	mux.HandleFunc("/v1/apps", s.serveApps)
+	mux.HandleFunc("/v1/apps/", s.serveApps)
+	return mux
+}
+
+// handlerTransport sends requests straight to a handler, without a network
+// in between
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), map[string]string{"error": err.Error()})
+}
+
+// readJSON decodes the body of r into v. Empty bodies leave v alone.
+func readJSON(r *http.Request, v any) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errBadRequest("reading body: %v", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errBadRequest("invalid body: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, newError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	var req struct {
+		Query         string         `json:"query"`
+		Variables     map[string]any `json:"variables"`
+		OperationName string         `json:"operationName"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// GraphQL errors are reported in the body of successful responses
+	writeJSON(w, http.StatusOK, s.ExecuteGraphQL(r.Context(), req.Query, req.Variables, req.OperationName))
+}
+
+// serveApps routes requests for the Machines API
+func (s *Server) serveApps(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/apps"), "/"), "/")
+	if parts[0] == "" {
+		parts = nil
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req struct {
+			AppName string `json:"app_name"`
+			OrgSlug string `json:"org_slug"`
+			Network string `json:"network"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if _, err := s.NewApp(r.Context(), req.OrgSlug, req.AppName, req.Network); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		app, err := s.GetApp(r.Context(), parts[0])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"name":         app.Name,
+			"organization": map[string]string{"name": app.Organization.Name, "slug": app.Organization.Slug},
+			"status":       app.Status,
+		})
+	case len(parts) >= 2 && parts[1] == "machines":
+		s.serveMachines(w, r, parts[0], parts[2:])
+	case len(parts) >= 2 && parts[1] == "volumes":
+		s.serveVolumes(w, r, parts[0], parts[2:])
+	default:
+		writeError(w, errNotFound("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) serveMachines(w http.ResponseWriter, r *http.Request, appName string, parts []string) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	nonce := r.Header.Get(flaps.NonceHeader)
+
+	reply := func(v any, err error) {
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+	ok := map[string]bool{"ok": true}
+
+	route := r.Method
+	if len(parts) > 0 {
+		route += " :id"
+	}
+	if len(parts) > 1 {
+		route += " " + strings.Join(parts[1:], "/")
+	}
+
+	var machineID string
+	if len(parts) > 0 {
+		machineID = parts[0]
+	}
+
+	switch route {
+	case "GET":
+		reply(listMachines(ctx, s, appName, query))
+	case "POST":
+		var input fly.LaunchMachineInput
+		if err := readJSON(r, &input); err != nil {
+			writeError(w, err)
+			return
+		}
+		reply(s.Launch(ctx, appName, input))
+	case "GET :id":
+		reply(s.GetMachine(ctx, appName, machineID))
+	case "POST :id":
+		var input fly.LaunchMachineInput
+		if err := readJSON(r, &input); err != nil {
+			writeError(w, err)
+			return
+		}
+		input.ID = machineID
+		reply(s.UpdateMachine(ctx, appName, input, nonce))
+	case "DELETE :id":
+		reply(ok, s.DestroyMachine(ctx, appName, machineID, query.Get("kill") == "true", nonce))
+	case "POST :id start":
+		reply(s.StartMachine(ctx, appName, machineID, nonce))
+	case "POST :id stop":
+		reply(ok, s.StopMachine(ctx, appName, machineID, nonce))
+	case "POST :id restart":
+		reply(ok, s.RestartMachine(ctx, appName, machineID, nonce))
+	case "POST :id suspend":
+		reply(ok, s.SuspendMachine(ctx, appName, machineID, nonce))
+	case "POST :id cordon":
+		reply(ok, s.CordonMachine(ctx, appName, machineID, nonce, true))
+	case "POST :id uncordon":
+		reply(ok, s.CordonMachine(ctx, appName, machineID, nonce, false))
+	case "POST :id signal":
+		var req struct {
+			Signal int `json:"signal"`
+		}
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		reply(ok, s.SignalMachine(ctx, appName, machineID, req.Signal))
+	case "GET :id wait":
+		timeout := 60 * time.Second
+		if seconds, err := strconv.Atoi(query.Get("timeout")); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds) * time.Second
+		}
+		reply(ok, s.WaitMachine(ctx, appName, machineID, query.Get("state"), timeout))
+	case "GET :id lease":
+		reply(s.FindLease(ctx, appName, machineID))
+	case "POST :id lease":
+		var ttl *int
+		if seconds, err := strconv.Atoi(query.Get("ttl")); err == nil {
+			ttl = &seconds
+		}
+		if nonce != "" {
+			reply(s.RefreshLease(ctx, appName, machineID, ttl, nonce))
+		} else {
+			reply(s.AcquireLease(ctx, appName, machineID, ttl))
+		}
+	case "DELETE :id lease":
+		reply(ok, s.ReleaseLease(ctx, appName, machineID, nonce))
+	case "GET :id metadata":
+		reply(s.GetMetadata(ctx, appName, machineID))
+	case "POST :id exec":
+		var req fly.MachineExecRequest
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		reply(s.ExecMachine(ctx, appName, machineID, &req))
+	case "GET :id ps":
+		reply(s.MachineProcesses(ctx, appName, machineID))
+	default:
+		if len(parts) == 3 && parts[1] == "metadata" {
+			switch r.Method {
+			case http.MethodPost:
+				var req struct {
+					Value string `json:"value"`
+				}
+				if err := readJSON(r, &req); err != nil {
+					writeError(w, err)
+					return
+				}
+				reply(ok, s.SetMetadata(ctx, appName, machineID, parts[2], req.Value))
+				return
+			case http.MethodDelete:
+				reply(ok, s.DeleteMetadata(ctx, appName, machineID, parts[2]))
+				return
+			}
+		}
+		writeError(w, errNotFound("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) serveVolumes(w http.ResponseWriter, r *http.Request, appName string, parts []string) {
+	ctx := r.Context()
+
+	reply := func(v any, err error) {
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+
+	route := r.Method
+	if len(parts) > 0 {
+		route += " :id"
+	}
+	if len(parts) > 1 {
+		route += " " + strings.Join(parts[1:], "/")
+	}
+
+	var volumeID string
+	if len(parts) > 0 {
+		volumeID = parts[0]
+	}
+
+	switch route {
+	case "GET":
+		reply(s.ListVolumes(ctx, appName))
+	case "POST":
+		var req fly.CreateVolumeRequest
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		reply(s.CreateVolume(ctx, appName, req))
+	case "GET :id":
+		reply(s.GetVolume(ctx, appName, volumeID))
+	case "PUT :id":
+		var req fly.UpdateVolumeRequest
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		reply(s.UpdateVolume(ctx, appName, volumeID, req))
+	case "DELETE :id":
+		reply(s.DeleteVolume(ctx, appName, volumeID))
+	case "PUT :id extend":
+		var req flaps.ExtendVolumeRequest
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		vol, needsRestart, err := s.ExtendVolume(ctx, appName, volumeID, req.SizeGB)
+		reply(flaps.ExtendVolumeResponse{Volume: vol, NeedsRestart: needsRestart}, err)
+	case "GET :id snapshots":
+		reply(s.ListVolumeSnapshots(ctx, appName, volumeID))
+	case "POST :id snapshots":
+		reply(s.CreateVolumeSnapshot(ctx, appName, volumeID))
+	default:
+		writeError(w, errNotFound("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
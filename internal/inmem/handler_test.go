@@ -0,0 +1,58 @@
+package inmem
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/fly-go/tokens"
+	"github.com/superfly/graphql"
+)
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+	t.Setenv("FLY_FLAPS_BASE_URL", httpServer.URL)
+
+	flapsClient, err := flaps.NewWithOptions(ctx, flaps.NewClientOpts{
+		AppName:    "test-app",
+		AppCompact: &fly.AppCompact{Name: "test-app"},
+		Tokens:     tokens.Parse("test"),
+	})
+	require.NoError(t, err)
+
+	machine, err := flapsClient.Launch(ctx, fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{Image: "nginx"},
+	})
+	require.NoError(t, err)
+
+	lease, err := flapsClient.AcquireLease(ctx, machine.ID, nil)
+	require.NoError(t, err)
+	_, err = flapsClient.AcquireLease(ctx, machine.ID, nil)
+	var flapsErr *flaps.FlapsError
+	require.ErrorAs(t, err, &flapsErr)
+	assert.Equal(t, 409, flapsErr.ResponseStatusCode)
+
+	require.NoError(t, flapsClient.Kill(ctx, machine.ID))
+	require.NoError(t, flapsClient.Wait(ctx, machine, fly.MachineStateStopped, 0))
+	require.NoError(t, flapsClient.ReleaseLease(ctx, machine.ID, lease.Data.Nonce))
+
+	apiClient := fly.NewClientFromOptions(fly.ClientOptions{
+		BaseURL: httpServer.URL,
+		Tokens:  tokens.Parse("test"),
+		Logger:  nopLogger{},
+	})
+	app, err := apiClient.GetAppCompact(ctx, "test-app")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOrganization.Slug, app.Organization.Slug)
+
+	_, err = apiClient.GetAppCompact(ctx, "missing")
+	assert.True(t, graphql.IsNotFoundError(err))
+}
@@ -0,0 +1,877 @@
+package inmem
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/helpers"
+)
+
+// autoDestroyAfter is how long machines with auto_destroy set run before
+// their process exits, as release command machines do.
+var autoDestroyAfter = 100 * time.Millisecond
+
+// defaultLeaseTTL is the lease TTL when none is requested, in seconds
+const defaultLeaseTTL = 30
+
+type checkOverride struct {
+	status   fly.ConsulCheckStatus
+	output   string
+	sequence []fly.ConsulCheckStatus // statuses to go through next
+}
+
+// machine returns the machine with id stored for an app. s.mu must be held.
+func (s *Server) machine(appName, machineID string) (*fly.Machine, error) {
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+	for _, machine := range s.machines[appName] {
+		if machine.ID == machineID {
+			return machine, nil
+		}
+	}
+	return nil, errNotFound("machine not found: %q", machineID)
+}
+
+// checkLease fails if a lease other than the one nonce refers to is held on
+// a machine. s.mu must be held.
+func (s *Server) checkLease(machineID, nonce string) error {
+	lease := s.leases[machineID]
+	if lease == nil || time.Now().Unix() >= lease.ExpiresAt {
+		return nil
+	}
+	if lease.Nonce != nonce {
+		return errPrecondition("machine ID %s lease currently held by %s, expires at %s", machineID, lease.Owner, time.Unix(lease.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// transition moves a machine to state, recording an event of eventType.
+// s.mu must be held.
+func (s *Server) transition(machine *fly.Machine, eventType, state, source string) {
+	if held := s.held[machine.ID]; held != nil && state != fly.MachineStateDestroyed {
+		held.intended, state = state, held.state
+	}
+	machine.State = state
+	machine.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	machine.Events = append([]*fly.MachineEvent{{
+		Type:      eventType,
+		Status:    state,
+		Source:    source,
+		Timestamp: time.Now().UnixMilli(),
+	}}, machine.Events...)
+	s.refreshChecks(machine)
+	s.notify()
+}
+
+// refreshChecks sets the statuses of a machine's health checks: passing
+// while it's started unless a test said otherwise, and critical if not.
+// s.mu must be held.
+func (s *Server) refreshChecks(machine *fly.Machine) {
+	names := checkNames(machine.Config)
+	if len(names) == 0 {
+		machine.Checks = nil
+		return
+	}
+
+	now := time.Now()
+	machine.Checks = make([]*fly.MachineCheckStatus, 0, len(names))
+	for _, name := range names {
+		status := fly.ConsulCheckStatus(fly.Critical)
+		output := "machine is not running"
+		if machine.State == fly.MachineStateStarted {
+			status, output = fly.Passing, "OK"
+		}
+		if o, ok := s.checks[machine.ID][name]; ok && machine.State == fly.MachineStateStarted {
+			status, output = o.status, o.output
+		}
+		machine.Checks = append(machine.Checks, &fly.MachineCheckStatus{
+			Name:      name,
+			Status:    status,
+			Output:    output,
+			UpdatedAt: &now,
+		})
+	}
+}
+
+// checkNames returns the names of the health checks config defines, named
+// the way the platform names them
+func checkNames(config *fly.MachineConfig) []string {
+	if config == nil {
+		return nil
+	}
+
+	var names []string
+	for name := range config.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, service := range config.Services {
+		for i, check := range service.Checks {
+			checkType := "tcp"
+			if check.Type != nil {
+				checkType = *check.Type
+			}
+			names = append(names, fmt.Sprintf("servicecheck-%02d-%s-%d", i, checkType, service.InternalPort))
+		}
+	}
+	return names
+}
+
+// newInstance gives a machine a new version, as launching or updating it
+// does. s.mu must be held.
+func (s *Server) newInstance(machine *fly.Machine) {
+	s.instanceSeq++
+	machine.InstanceID = fmt.Sprintf("01HZ%022X", s.instanceSeq)
+	machine.Version = machine.InstanceID
+	if machine.Config != nil {
+		machine.ImageRef = imageRef(machine.Config.Image)
+	}
+}
+
+// imageRef splits an image reference the way the Machines API reports it
+func imageRef(image string) fly.MachineImageRef {
+	var ref fly.MachineImageRef
+
+	image, ref.Digest, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, ref.Tag = image[:i], image[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	if registry, repository, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		ref.Registry, ref.Repository = registry, repository
+	} else {
+		ref.Registry, ref.Repository = "docker-hub-mirror.fly.io", image
+		if !ok {
+			ref.Repository = "library/" + image
+		}
+	}
+
+	if ref.Digest == "" {
+		sum := sha256.Sum256([]byte(image + ":" + ref.Tag))
+		ref.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return ref
+}
+
+// attachVolumes attaches the volumes mounted by a machine's config, failing
+// if any is in use by another machine. s.mu must be held.
+func (s *Server) attachVolumes(appName string, machine *fly.Machine) error {
+	if machine.Config == nil {
+		return nil
+	}
+
+	for _, mount := range machine.Config.Mounts {
+		vol := s.volume(appName, mount.Volume)
+		if vol == nil || vol.State == volumeDestroyedState {
+			return errNotFound("volume not found: %q", mount.Volume)
+		}
+		if vol.AttachedMachine != nil && *vol.AttachedMachine != machine.ID {
+			return errPrecondition("volume %s is already attached to machine %s", vol.ID, *vol.AttachedMachine)
+		}
+		if vol.Region != machine.Region {
+			return errBadRequest("volume %s is in region %s, not %s", vol.ID, vol.Region, machine.Region)
+		}
+	}
+
+	s.detachVolumes(appName, machine.ID)
+	for _, mount := range machine.Config.Mounts {
+		vol := s.volume(appName, mount.Volume)
+		id := machine.ID
+		vol.AttachedMachine = &id
+		vol.State = "attached"
+	}
+	return nil
+}
+
+// detachVolumes detaches every volume attached to a machine. s.mu must be
+// held.
+func (s *Server) detachVolumes(appName, machineID string) {
+	for _, vol := range s.volumes[appName] {
+		if vol.AttachedMachine != nil && *vol.AttachedMachine == machineID {
+			vol.AttachedMachine = nil
+			vol.State = "created"
+		}
+	}
+}
+
+// Launch creates a machine and, unless told to skip it, starts it
+func (s *Server) Launch(ctx context.Context, appName string, input fly.LaunchMachineInput) (*fly.Machine, error) {
+	if err := s.fault(ctx, "Launch", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+	if input.Config == nil || input.Config.Image == "" {
+		return nil, errBadRequest("image is required")
+	}
+	if input.Region == "" {
+		input.Region = "iad"
+	}
+
+	s.machineSeq++
+	id := s.machineSeq
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	machine := &fly.Machine{
+		ID:        fmt.Sprintf("%014x", id),
+		Name:      input.Name,
+		Region:    input.Region,
+		PrivateIP: fmt.Sprintf("fdaa:0:1:a7b:%x::%x", id/0x10000, id%0x10000),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Config:    helpers.Clone(input.Config),
+	}
+	if machine.Name == "" {
+		machine.Name = fmt.Sprintf("machine-%d", id)
+	}
+	s.newInstance(machine)
+
+	if err := s.attachVolumes(appName, machine); err != nil {
+		return nil, err
+	}
+
+	s.machines[appName] = append(s.machines[appName], machine)
+	s.transition(machine, "launch", fly.MachineStateCreated, "user")
+
+	if input.SkipLaunch {
+		s.transition(machine, "stop", fly.MachineStateStopped, "flyd")
+	} else {
+		s.start(appName, machine)
+	}
+
+	if input.LeaseTTL > 0 {
+		machine.LeaseNonce = s.grantLease(machine, input.LeaseTTL).Nonce
+	}
+
+	out := helpers.Clone(machine)
+	machine.LeaseNonce = ""
+	return out, nil
+}
+
+// start starts a machine. s.mu must be held.
+func (s *Server) start(appName string, machine *fly.Machine) {
+	s.transition(machine, "start", fly.MachineStateStarted, "user")
+
+	if machine.Config != nil && machine.Config.AutoDestroy {
+		id, instance := machine.ID, machine.InstanceID
+		time.AfterFunc(autoDestroyAfter, func() {
+			s.exit(appName, id, instance, 0)
+		})
+	}
+}
+
+// exit emulates the process of a machine exiting with code, which
+// destroys machines with auto_destroy set and stops others.
+func (s *Server) exit(appName, machineID, instanceID string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil || machine.InstanceID != instanceID || machine.State != fly.MachineStateStarted {
+		return
+	}
+
+	machine.Events = append([]*fly.MachineEvent{{
+		Type:      "exit",
+		Status:    fly.MachineStateStopped,
+		Source:    "flyd",
+		Timestamp: time.Now().UnixMilli(),
+		Request: &fly.MachineRequest{
+			ExitEvent: &fly.MachineExitEvent{ExitCode: code, ExitedAt: time.Now()},
+		},
+	}}, machine.Events...)
+
+	if machine.Config.AutoDestroy {
+		s.destroy(appName, machine)
+	} else {
+		s.transition(machine, "exit", fly.MachineStateStopped, "flyd")
+	}
+}
+
+// destroy destroys a machine. s.mu must be held.
+func (s *Server) destroy(appName string, machine *fly.Machine) {
+	s.detachVolumes(appName, machine.ID)
+	delete(s.leases, machine.ID)
+	delete(s.cordoned, machine.ID)
+	s.transition(machine, "destroy", fly.MachineStateDestroyed, "user")
+}
+
+func (s *Server) GetMachine(ctx context.Context, appName, machineID string) (*fly.Machine, error) {
+	if err := s.fault(ctx, "GetMachine", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return nil, err
+	}
+	out := helpers.Clone(machine)
+	s.advanceChecks(machine)
+	return out, nil
+}
+
+// ListMachines returns an app's machines, including destroyed ones only if
+// asked to.
+func (s *Server) ListMachines(ctx context.Context, appName string, includeDestroyed bool) ([]*fly.Machine, error) {
+	if err := s.fault(ctx, "ListMachines", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+
+	machines := make([]*fly.Machine, 0, len(s.machines[appName]))
+	for _, machine := range s.machines[appName] {
+		if includeDestroyed || machine.State != fly.MachineStateDestroyed {
+			machines = append(machines, helpers.Clone(machine))
+			s.advanceChecks(machine)
+		}
+	}
+	return machines, nil
+}
+
+// UpdateMachine replaces a machine's config, restarting it if it's running
+func (s *Server) UpdateMachine(ctx context.Context, appName string, input fly.LaunchMachineInput, nonce string) (*fly.Machine, error) {
+	if err := s.fault(ctx, "UpdateMachine", input.ID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLease(machine.ID, nonce); err != nil {
+		return nil, err
+	}
+	if !machine.IsActive() {
+		return nil, errPrecondition("machine %s is %s", machine.ID, machine.State)
+	}
+	if input.Config == nil || input.Config.Image == "" {
+		return nil, errBadRequest("image is required")
+	}
+	if input.Region != "" && input.Region != machine.Region {
+		return nil, errBadRequest("machines can't change regions")
+	}
+
+	previous := machine.Config
+	machine.Config = helpers.Clone(input.Config)
+	if err := s.attachVolumes(appName, machine); err != nil {
+		machine.Config = previous
+		return nil, err
+	}
+	if input.Name != "" {
+		machine.Name = input.Name
+	}
+
+	wasStarted := machine.State == fly.MachineStateStarted
+	s.newInstance(machine)
+	s.transition(machine, "update", "replacing", "user")
+	if wasStarted && !input.SkipLaunch {
+		s.start(appName, machine)
+	} else {
+		s.transition(machine, "stop", fly.MachineStateStopped, "flyd")
+	}
+
+	return helpers.Clone(machine), nil
+}
+
+func (s *Server) StartMachine(ctx context.Context, appName, machineID, nonce string) (*fly.MachineStartResponse, error) {
+	if err := s.fault(ctx, "StartMachine", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLease(machineID, nonce); err != nil {
+		return nil, err
+	}
+
+	previous := machine.State
+	switch previous {
+	case fly.MachineStateCreated, fly.MachineStateStopped, "suspended":
+	default:
+		return nil, errPrecondition("unable to start machine from current state: '%s'", previous)
+	}
+	s.start(appName, machine)
+
+	return &fly.MachineStartResponse{Status: "success", PreviousState: previous}, nil
+}
+
+func (s *Server) StopMachine(ctx context.Context, appName, machineID, nonce string) error {
+	if err := s.fault(ctx, "StopMachine", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLease(machineID, nonce); err != nil {
+		return err
+	}
+
+	switch machine.State {
+	case fly.MachineStateStarted:
+		s.transition(machine, "stop", fly.MachineStateStopped, "user")
+	case fly.MachineStateStopped, fly.MachineStateCreated, "suspended":
+	default:
+		return errPrecondition("unable to stop machine from current state: '%s'", machine.State)
+	}
+	return nil
+}
+
+func (s *Server) RestartMachine(ctx context.Context, appName, machineID, nonce string) error {
+	if err := s.fault(ctx, "RestartMachine", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLease(machineID, nonce); err != nil {
+		return err
+	}
+	if machine.State != fly.MachineStateStarted {
+		return errPrecondition("unable to restart machine from current state: '%s'", machine.State)
+	}
+
+	s.transition(machine, "stop", fly.MachineStateStopped, "user")
+	s.transition(machine, "restart", fly.MachineStateStarted, "user")
+	return nil
+}
+
+func (s *Server) SuspendMachine(ctx context.Context, appName, machineID, nonce string) error {
+	if err := s.fault(ctx, "SuspendMachine", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLease(machineID, nonce); err != nil {
+		return err
+	}
+	if machine.State != fly.MachineStateStarted {
+		return errPrecondition("unable to suspend machine from current state: '%s'", machine.State)
+	}
+
+	s.transition(machine, "suspend", "suspended", "user")
+	return nil
+}
+
+// SignalMachine sends a signal to a machine's process. SIGKILL stops it,
+// other signals are taken to be handled by the process.
+func (s *Server) SignalMachine(ctx context.Context, appName, machineID string, signal int) error {
+	if err := s.fault(ctx, "SignalMachine", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if machine.State != fly.MachineStateStarted {
+		return errPrecondition("machine %s is not running", machineID)
+	}
+	if signal == 9 {
+		s.transition(machine, "exit", fly.MachineStateStopped, "flyd")
+	}
+	return nil
+}
+
+// DestroyMachine destroys a machine, which must be stopped unless kill is
+// set.
+func (s *Server) DestroyMachine(ctx context.Context, appName, machineID string, kill bool, nonce string) error {
+	if err := s.fault(ctx, "DestroyMachine", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLease(machineID, nonce); err != nil {
+		return err
+	}
+
+	switch {
+	case machine.State == fly.MachineStateDestroyed:
+		return errNotFound("machine not found: %q", machineID)
+	case machine.State == fly.MachineStateStarted && !kill:
+		return errPrecondition("unable to destroy machine, not currently stopped")
+	}
+
+	s.destroy(appName, machine)
+	return nil
+}
+
+func (s *Server) CordonMachine(ctx context.Context, appName, machineID, nonce string, cordon bool) error {
+	if err := s.fault(ctx, "CordonMachine", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLease(machineID, nonce); err != nil {
+		return err
+	}
+
+	if cordon {
+		s.cordoned[machineID] = true
+	} else {
+		delete(s.cordoned, machineID)
+	}
+	machine.Events = append([]*fly.MachineEvent{{
+		Type:      map[bool]string{true: "cordon", false: "uncordon"}[cordon],
+		Status:    machine.State,
+		Source:    "user",
+		Timestamp: time.Now().UnixMilli(),
+	}}, machine.Events...)
+	return nil
+}
+
+// IsCordoned reports whether a machine is cordoned off from receiving
+// traffic
+func (s *Server) IsCordoned(appName, machineID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cordoned[machineID]
+}
+
+// WaitMachine waits for a machine to reach state, failing after timeout.
+// Waiting on a destroyed machine for any other state fails as not found.
+func (s *Server) WaitMachine(ctx context.Context, appName, machineID, state string, timeout time.Duration) error {
+	if err := s.fault(ctx, "WaitMachine", machineID); err != nil {
+		return err
+	}
+
+	if state == "" {
+		state = fly.MachineStateStarted
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		s.mu.Lock()
+		machine, err := s.machine(appName, machineID)
+		var current string
+		if err == nil {
+			current = machine.State
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		switch {
+		case err != nil:
+			return err
+		case current == state:
+			return nil
+		case current == fly.MachineStateDestroyed:
+			return errNotFound("machine %s was destroyed", machineID)
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return newError(http.StatusRequestTimeout, "deadline_exceeded: machine %s is %s, not %s", machineID, current, state)
+		}
+	}
+}
+
+// grantLease gives out a new lease on a machine. s.mu must be held.
+func (s *Server) grantLease(machine *fly.Machine, ttl int) *fly.MachineLeaseData {
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+
+	lease := &fly.MachineLeaseData{
+		Nonce:     hex.EncodeToString(nonce),
+		ExpiresAt: time.Now().Add(time.Duration(ttl) * time.Second).Unix(),
+		Owner:     DefaultUser.Email,
+		Version:   machine.InstanceID,
+	}
+	s.leases[machine.ID] = lease
+	return lease
+}
+
+func leaseResponse(lease *fly.MachineLeaseData) *fly.MachineLease {
+	other := *lease
+	return &fly.MachineLease{Status: "success", Data: &other}
+}
+
+func (s *Server) AcquireLease(ctx context.Context, appName, machineID string, ttl *int) (*fly.MachineLease, error) {
+	if err := s.fault(ctx, "AcquireLease", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return nil, err
+	}
+	if lease := s.leases[machineID]; lease != nil && time.Now().Unix() < lease.ExpiresAt {
+		return nil, errConflict("lease currently held by %s, expires at %s", lease.Owner, time.Unix(lease.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+
+	seconds := defaultLeaseTTL
+	if ttl != nil && *ttl > 0 {
+		seconds = *ttl
+	}
+	return leaseResponse(s.grantLease(machine, seconds)), nil
+}
+
+func (s *Server) FindLease(ctx context.Context, appName, machineID string) (*fly.MachineLease, error) {
+	if err := s.fault(ctx, "FindLease", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.machine(appName, machineID); err != nil {
+		return nil, err
+	}
+	lease := s.leases[machineID]
+	if lease == nil || time.Now().Unix() >= lease.ExpiresAt {
+		return nil, errNotFound("lease not found")
+	}
+	return leaseResponse(lease), nil
+}
+
+func (s *Server) RefreshLease(ctx context.Context, appName, machineID string, ttl *int, nonce string) (*fly.MachineLease, error) {
+	if err := s.fault(ctx, "RefreshLease", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.machine(appName, machineID); err != nil {
+		return nil, err
+	}
+	lease := s.leases[machineID]
+	if lease == nil || lease.Nonce != nonce {
+		return nil, errConflict("lease not found or nonce mismatch")
+	}
+
+	seconds := defaultLeaseTTL
+	if ttl != nil && *ttl > 0 {
+		seconds = *ttl
+	}
+	lease.ExpiresAt = time.Now().Add(time.Duration(seconds) * time.Second).Unix()
+	return leaseResponse(lease), nil
+}
+
+func (s *Server) ReleaseLease(ctx context.Context, appName, machineID, nonce string) error {
+	if err := s.fault(ctx, "ReleaseLease", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.machine(appName, machineID); err != nil {
+		return err
+	}
+	lease := s.leases[machineID]
+	if lease == nil {
+		return errNotFound("lease not found")
+	}
+	if lease.Nonce != nonce {
+		return errPrecondition("lease nonce mismatch")
+	}
+	delete(s.leases, machineID)
+	return nil
+}
+
+func (s *Server) GetMetadata(ctx context.Context, appName, machineID string) (map[string]string, error) {
+	if err := s.fault(ctx, "GetMetadata", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{}
+	for k, v := range machine.Config.Metadata {
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+func (s *Server) SetMetadata(ctx context.Context, appName, machineID, key, value string) error {
+	if err := s.fault(ctx, "SetMetadata", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if machine.Config.Metadata == nil {
+		machine.Config.Metadata = map[string]string{}
+	}
+	machine.Config.Metadata[key] = value
+	return nil
+}
+
+func (s *Server) DeleteMetadata(ctx context.Context, appName, machineID, key string) error {
+	if err := s.fault(ctx, "DeleteMetadata", machineID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if _, ok := machine.Config.Metadata[key]; !ok {
+		return errNotFound("metadata key not found: %q", key)
+	}
+	delete(machine.Config.Metadata, key)
+	return nil
+}
+
+// ExecMachine runs a command on a machine. Nothing really runs, so commands
+// succeed without output.
+func (s *Server) ExecMachine(ctx context.Context, appName, machineID string, in *fly.MachineExecRequest) (*fly.MachineExecResponse, error) {
+	if err := s.fault(ctx, "ExecMachine", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return nil, err
+	}
+	if machine.State != fly.MachineStateStarted {
+		return nil, errPrecondition("machine %s is not running", machineID)
+	}
+	if in == nil || in.Cmd == "" {
+		return nil, errBadRequest("cmd is required")
+	}
+	return &fly.MachineExecResponse{}, nil
+}
+
+// MachineProcesses lists the processes of a machine, which is only the one
+// its config runs while it's started
+func (s *Server) MachineProcesses(ctx context.Context, appName, machineID string) (fly.MachinePsResponse, error) {
+	if err := s.fault(ctx, "MachineProcesses", machineID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return nil, err
+	}
+	if machine.State != fly.MachineStateStarted {
+		return fly.MachinePsResponse{}, nil
+	}
+
+	command := machine.Config.Image
+	if init := machine.Config.Init; len(init.Cmd) > 0 {
+		command = strings.Join(init.Cmd, " ")
+	}
+	return fly.MachinePsResponse{{Pid: 1, Command: command, Directory: "/"}}, nil
+}
+
+// SetCheckStatus overrides the status of a health check of a running
+// machine, so tests can see how unhealthy machines are handled.
+func (s *Server) SetCheckStatus(appName, machineID, name string, status fly.ConsulCheckStatus, output string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	machine, err := s.machine(appName, machineID)
+	if err != nil {
+		return err
+	}
+	if s.checks[machineID] == nil {
+		s.checks[machineID] = map[string]checkOverride{}
+	}
+	s.checks[machineID][name] = checkOverride{status: status, output: output}
+	s.refreshChecks(machine)
+	s.notify()
+	return nil
+}
+
+// ExitMachine emulates the process of a started machine exiting with code
+func (s *Server) ExitMachine(appName, machineID string, code int) error {
+	machine, err := s.GetMachine(context.Background(), appName, machineID)
+	if err != nil {
+		return err
+	}
+	s.exit(appName, machineID, machine.InstanceID, code)
+	return nil
+}
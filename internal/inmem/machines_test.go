@@ -0,0 +1,120 @@
+package inmem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	server := NewServer()
+	server.CreateApp(&fly.App{Name: "test-app", Organization: DefaultOrganization})
+	return server
+}
+
+func TestMachineLifecycle(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{Image: "nginx"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateStarted, machine.State)
+	assert.Equal(t, "iad", machine.Region)
+	assert.Equal(t, "library/nginx", machine.ImageRef.Repository)
+
+	require.NoError(t, server.StopMachine(ctx, "test-app", machine.ID, ""))
+	require.NoError(t, server.WaitMachine(ctx, "test-app", machine.ID, fly.MachineStateStopped, time.Second))
+
+	_, err = server.StartMachine(ctx, "test-app", machine.ID, "")
+	require.NoError(t, err)
+
+	updated, err := server.UpdateMachine(ctx, "test-app", fly.LaunchMachineInput{
+		ID:     machine.ID,
+		Config: &fly.MachineConfig{Image: "nginx:1.25"},
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateStarted, updated.State)
+	assert.NotEqual(t, machine.InstanceID, updated.InstanceID)
+	assert.Equal(t, "1.25", updated.ImageRef.Tag)
+
+	require.NoError(t, server.DestroyMachine(ctx, "test-app", machine.ID, true, ""))
+	err = server.WaitMachine(ctx, "test-app", machine.ID, fly.MachineStateStarted, time.Second)
+	assert.Equal(t, 404, errorStatus(err))
+
+	machines, err := server.ListMachines(ctx, "test-app", false)
+	require.NoError(t, err)
+	assert.Empty(t, machines)
+	machines, err = server.ListMachines(ctx, "test-app", true)
+	require.NoError(t, err)
+	assert.Len(t, machines, 1)
+}
+
+func TestMachineAutoDestroy(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{Image: "nginx", AutoDestroy: true},
+	})
+	require.NoError(t, err)
+	require.NoError(t, server.WaitMachine(ctx, "test-app", machine.ID, fly.MachineStateDestroyed, time.Second))
+
+	machine, err = server.GetMachine(ctx, "test-app", machine.ID)
+	require.NoError(t, err)
+	exit := machine.Events[1]
+	assert.Equal(t, "exit", exit.Type)
+	assert.Equal(t, 0, exit.Request.ExitEvent.ExitCode)
+}
+
+func TestMachineLeases(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{Image: "nginx"},
+	})
+	require.NoError(t, err)
+
+	lease, err := server.AcquireLease(ctx, "test-app", machine.ID, nil)
+	require.NoError(t, err)
+	nonce := lease.Data.Nonce
+
+	_, err = server.AcquireLease(ctx, "test-app", machine.ID, nil)
+	assert.Equal(t, 409, errorStatus(err))
+	err = server.StopMachine(ctx, "test-app", machine.ID, "wrong")
+	assert.Equal(t, 412, errorStatus(err))
+	require.NoError(t, server.StopMachine(ctx, "test-app", machine.ID, nonce))
+
+	require.NoError(t, server.ReleaseLease(ctx, "test-app", machine.ID, nonce))
+	_, err = server.FindLease(ctx, "test-app", machine.ID)
+	assert.Equal(t, 404, errorStatus(err))
+}
+
+func TestMachineChecks(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{
+			Image:  "nginx",
+			Checks: map[string]fly.MachineCheck{"alive": {}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, machine.Checks, 1)
+	assert.Equal(t, fly.Passing, machine.Checks[0].Status)
+
+	require.NoError(t, server.SetCheckStatus("test-app", machine.ID, "alive", fly.Critical, "connection refused"))
+	machine, err = server.GetMachine(ctx, "test-app", machine.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fly.Critical, machine.Checks[0].Status)
+	assert.Equal(t, "connection refused", machine.Checks[0].Output)
+}
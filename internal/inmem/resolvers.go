@@ -0,0 +1,514 @@
+package inmem
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// Regions are the regions the emulated platform offers
+var Regions = []fly.Region{
+	{Code: "ams", Name: "Amsterdam, Netherlands", Latitude: 52.374342, Longitude: 4.895439, GatewayAvailable: true},
+	{Code: "cdg", Name: "Paris, France", Latitude: 48.860875, Longitude: 2.353477, GatewayAvailable: true},
+	{Code: "dfw", Name: "Dallas, Texas (US)", Latitude: 32.778287, Longitude: -96.7984, GatewayAvailable: true},
+	{Code: "ewr", Name: "Secaucus, NJ (US)", Latitude: 40.789543, Longitude: -74.056868, GatewayAvailable: true},
+	{Code: "fra", Name: "Frankfurt, Germany", Latitude: 50.1167, Longitude: 8.6833, GatewayAvailable: true},
+	{Code: "iad", Name: "Ashburn, Virginia (US)", Latitude: 39.02214, Longitude: -77.462556, GatewayAvailable: true},
+	{Code: "lax", Name: "Los Angeles, California (US)", Latitude: 33.9416, Longitude: -118.4085, GatewayAvailable: true},
+	{Code: "lhr", Name: "London, United Kingdom", Latitude: 51.516434, Longitude: -0.125656, GatewayAvailable: true},
+	{Code: "nrt", Name: "Tokyo, Japan", Latitude: 35.621793, Longitude: 139.418715, GatewayAvailable: true},
+	{Code: "ord", Name: "Chicago, Illinois (US)", Latitude: 41.891544, Longitude: -87.630386, GatewayAvailable: true},
+	{Code: "sea", Name: "Seattle, Washington (US)", Latitude: 47.6097, Longitude: -122.3331, GatewayAvailable: true},
+	{Code: "sin", Name: "Singapore, Singapore", Latitude: 1.3, Longitude: 103.8, GatewayAvailable: true},
+	{Code: "sjc", Name: "San Jose, California (US)", Latitude: 37.351601, Longitude: -121.896927, GatewayAvailable: true},
+	{Code: "syd", Name: "Sydney, Australia", Latitude: -33.866667, Longitude: 151.2, GatewayAvailable: true},
+	{Code: "yyz", Name: "Toronto, Canada", Latitude: 43.644444, Longitude: -79.383333, GatewayAvailable: true},
+}
+
+// NearestRegion is the region requests to the emulated platform come from
+const NearestRegion = "iad"
+
+func regionByCode(code string) *fly.Region {
+	for _, region := range Regions {
+		if region.Code == code {
+			return &region
+		}
+	}
+	return nil
+}
+
+func (s *Server) queryRoot() object {
+	return object{
+		"viewer":      resolver(s.resolveViewer),
+		"currentUser": resolver(s.resolveViewer),
+		"app": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return s.resolveApp(ctx, stringArg(args, "name"))
+		}),
+		"apps": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var nodes []object
+			for _, app := range s.ListApps(ctx, stringArg(args, "organizationId")) {
+				nodes = append(nodes, s.appObject(app))
+			}
+			return connection(nodes), nil
+		}),
+		"appNameAvailable": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			_, err := s.GetApp(ctx, stringArg(args, "name"))
+			return err != nil, nil
+		}),
+		"canPerformBluegreenDeployment": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			_, err := s.GetApp(ctx, stringArg(args, "name"))
+			return err == nil, err
+		}),
+		"organizations": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var nodes []object
+			for _, org := range s.ListOrganizations(ctx) {
+				nodes = append(nodes, s.orgObject(org))
+			}
+			return connection(nodes), nil
+		}),
+		"organization": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			id := stringArg(args, "slug")
+			if id == "" {
+				id = stringArg(args, "id")
+			}
+			s.mu.Lock()
+			org := s.orgByID(id)
+			s.mu.Unlock()
+			if org == nil {
+				return nil, errNotFound("Could not find Organization %q", id)
+			}
+			return s.orgObject(*org), nil
+		}),
+		"platform": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return object{"requestRegion": NearestRegion, "regions": Regions}, nil
+		}),
+		"nearestRegion": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return regionByCode(NearestRegion), nil
+		}),
+		"machine": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return s.resolveMachine(ctx, stringArg(args, "machineId"))
+		}),
+		"latestImageTag": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return "latest", nil
+		}),
+		"latestImageDetails": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return imageVersion(stringArg(args, "image")), nil
+		}),
+		"node": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			return s.resolveNode(ctx, stringArg(args, "id"))
+		}),
+	}
+}
+
+func (s *Server) mutationRoot() object {
+	return object{
+		"createApp": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.CreateAppInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			var network string
+			if input.Network != nil {
+				network = *input.Network
+			}
+			app, err := s.NewApp(ctx, input.OrganizationID, input.Name, network)
+			if err != nil {
+				return nil, err
+			}
+			return object{"app": s.appObject(*app)}, nil
+		}),
+		"deleteApp": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			app, err := s.DeleteApp(ctx, stringArg(args, "appId"))
+			if err != nil {
+				return nil, err
+			}
+			return object{"organization": s.orgObject(app.Organization)}, nil
+		}),
+		"moveApp": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input struct{ AppID, OrganizationID string }
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			app, err := s.MoveApp(ctx, input.AppID, input.OrganizationID)
+			if err != nil {
+				return nil, err
+			}
+			return object{"app": s.appObject(*app)}, nil
+		}),
+		"createBuild": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.CreateBuildInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			return s.CreateBuild(ctx, input.AppName)
+		}),
+		"finishBuild": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.FinishBuildInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			return s.FinishBuild(ctx, input.BuildId, input.Status)
+		}),
+		"createRelease": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.CreateReleaseInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			release, err := s.CreateReleaseWithDefinition(ctx, input.AppId, input.ClientMutationId, input.Image, input.PlatformVersion, string(input.Strategy), input.Definition)
+			if err != nil {
+				return nil, err
+			}
+			return object{"release": releaseObject(release)}, nil
+		}),
+		"updateRelease": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.UpdateReleaseInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			if err := s.UpdateRelease(ctx, input.ReleaseId, input.ClientMutationId, input.Status); err != nil {
+				return nil, err
+			}
+			return object{"release": object{"id": input.ReleaseId}}, nil
+		}),
+		"setSecrets": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.SetSecretsInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			secrets := make(map[string]string, len(input.Secrets))
+			for _, secret := range input.Secrets {
+				secrets[secret.Key] = secret.Value
+			}
+			release, err := s.SetSecrets(ctx, input.AppID, secrets)
+			if err != nil {
+				return nil, err
+			}
+			return s.secretsPayload(ctx, input.AppID, release)
+		}),
+		"unsetSecrets": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.UnsetSecretsInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			release, err := s.UnsetSecrets(ctx, input.AppID, input.Keys)
+			if err != nil {
+				return nil, err
+			}
+			return s.secretsPayload(ctx, input.AppID, release)
+		}),
+		"allocateIpAddress": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.AllocateIPAddressInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			ip, err := s.AllocateIPAddress(ctx, input.AppID, input.Type, input.Region)
+			if err != nil {
+				return nil, err
+			}
+			app, err := s.GetApp(ctx, input.AppID)
+			if err != nil {
+				return nil, err
+			}
+			return object{"ipAddress": ip, "app": s.appObject(*app)}, nil
+		}),
+		"releaseIpAddress": resolver(func(ctx context.Context, args map[string]any) (any, error) {
+			var input fly.ReleaseIPAddressInput
+			if err := decodeArg(args, "input", &input); err != nil {
+				return nil, err
+			}
+			var appName, address string
+			if input.AppID != nil {
+				appName = *input.AppID
+			}
+			switch {
+			case input.IP != nil:
+				address = *input.IP
+			case input.IPAddressID != nil:
+				address = *input.IPAddressID
+			}
+			if err := s.ReleaseIPAddress(ctx, appName, address); err != nil {
+				return nil, err
+			}
+			return object{"clientMutationId": nil}, nil
+		}),
+	}
+}
+
+func (s *Server) resolveViewer(ctx context.Context, args map[string]any) (any, error) {
+	return object{
+		"__typename":      "User",
+		"id":              DefaultUser.ID,
+		"name":            DefaultUser.Name,
+		"email":           DefaultUser.Email,
+		"enablePaidHobby": DefaultUser.EnablePaidHobby,
+	}, nil
+}
+
+func (s *Server) resolveApp(ctx context.Context, name string) (any, error) {
+	app, err := s.GetApp(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.appObject(*app), nil
+}
+
+// resolveMachine finds a machine by id in any app
+func (s *Server) resolveMachine(ctx context.Context, machineID string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for appName, machines := range s.machines {
+		for _, machine := range machines {
+			if machine.ID == machineID {
+				return s.machineObject(*s.apps[appName], machine), nil
+			}
+		}
+	}
+	return nil, errNotFound("Could not find Machine %q", machineID)
+}
+
+// resolveNode finds an app or volume by its id
+func (s *Server) resolveNode(ctx context.Context, id string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if app := s.appByID(id); app != nil {
+		return s.appObject(*app), nil
+	}
+	for appName, volumes := range s.volumes {
+		for _, vol := range volumes {
+			if vol.ID == id {
+				return s.volumeObject(*s.apps[appName], vol), nil
+			}
+		}
+	}
+	return nil, errNotFound("Could not find node %q", id)
+}
+
+func (s *Server) secretsPayload(ctx context.Context, appName string, release *fly.Release) (any, error) {
+	app, err := s.GetApp(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+	return object{"release": release, "app": s.appObject(*app)}, nil
+}
+
+// connection returns nodes as a single page of a connection
+func connection[T any](nodes []T) object {
+	if nodes == nil {
+		nodes = []T{}
+	}
+	return object{
+		"nodes":      nodes,
+		"totalCount": len(nodes),
+		"pageInfo":   object{"hasNextPage": false, "endCursor": ""},
+	}
+}
+
+// appObject returns app as a GraphQL object, with the fields the API
+// resolves from other state filled in lazily.
+func (s *Server) appObject(app fly.App) object {
+	obj := object(toJSON(app).(map[string]any))
+	obj["__typename"] = "App"
+	obj["organization"] = s.orgObject(app.Organization)
+	obj["role"] = nil
+	obj["regions"] = []fly.Region{}
+	obj["limitedAccessTokens"] = connection([]object(nil))
+	obj["addOns"] = connection([]object(nil))
+
+	currentRelease := resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		releases, err := s.ListReleases(ctx, app.Name)
+		if err != nil || len(releases) == 0 {
+			return nil, err
+		}
+		return releaseObject(&releases[0]), nil
+	})
+	obj["currentRelease"] = currentRelease
+	obj["currentReleaseUnprocessed"] = currentRelease
+
+	releases := resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		releases, err := s.ListReleases(ctx, app.Name)
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := intArg(args, "first"); ok && first < len(releases) {
+			releases = releases[:first]
+		}
+		nodes := make([]object, len(releases))
+		for i := range releases {
+			nodes[i] = releaseObject(&releases[i])
+		}
+		return connection(nodes), nil
+	})
+	obj["releases"] = releases
+	obj["releasesUnprocessed"] = releases
+
+	obj["config"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		releases, err := s.ListReleases(ctx, app.Name)
+		if err != nil || len(releases) == 0 {
+			return object{"definition": nil}, err
+		}
+		return object{"definition": releases[0].Definition}, nil
+	})
+
+	obj["imageDetails"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		releases, err := s.ListReleases(ctx, app.Name)
+		if err != nil || len(releases) == 0 {
+			return fly.ImageVersion{}, err
+		}
+		return imageVersion(releases[0].Image), nil
+	})
+
+	obj["image"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		ref := stringArg(args, "ref")
+		image, err := s.GetImage(ctx, app.Name, ref)
+		if err != nil {
+			return nil, err
+		}
+		if image == nil {
+			// There's no registry to look in, so images that weren't added
+			// with CreateImage resolve as if they had been pushed
+			parsed := imageRef(ref)
+			image = &fly.Image{
+				ID:     parsed.Digest,
+				Digest: parsed.Digest,
+				Ref:    parsed.Registry + "/" + parsed.Repository + ":" + parsed.Tag,
+			}
+		}
+		size := image.CompressedSize
+		if size == "" {
+			size = "0"
+		}
+		return object{
+			"id":                 image.ID,
+			"digest":             image.Digest,
+			"ref":                image.Ref,
+			"compressedSize":     size,
+			"compressedSizeFull": size,
+		}, nil
+	})
+
+	obj["secrets"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		return s.ListSecrets(ctx, app.Name)
+	})
+
+	obj["ipAddresses"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		ips, err := s.ListIPAddresses(ctx, app.Name)
+		if err != nil {
+			return nil, err
+		}
+		var nodes []fly.IPAddress
+		for _, ip := range ips {
+			if ip.Type != "shared_v4" {
+				nodes = append(nodes, ip)
+			}
+		}
+		return connection(nodes), nil
+	})
+	obj["sharedIpAddress"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		ips, err := s.ListIPAddresses(ctx, app.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			if ip.Type == "shared_v4" {
+				return ip.Address, nil
+			}
+		}
+		return "", nil
+	})
+
+	obj["machines"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		machines, err := s.ListMachines(ctx, app.Name, false)
+		if err != nil {
+			return nil, err
+		}
+		nodes := make([]object, len(machines))
+		for i, machine := range machines {
+			nodes[i] = s.machineObject(app, machine)
+		}
+		return connection(nodes), nil
+	})
+
+	return obj
+}
+
+func (s *Server) orgObject(org fly.Organization) object {
+	obj := object(toJSON(org).(map[string]any))
+	obj["__typename"] = "Organization"
+	obj["viewerRole"] = "admin"
+	obj["internalNumericId"] = org.ID
+	obj["addOnSsoLink"] = nil
+	obj["provisionsBetaExtensions"] = false
+	obj["members"] = object{"edges": []object{{"node": DefaultUser, "role": "admin"}}}
+	obj["apps"] = resolver(func(ctx context.Context, args map[string]any) (any, error) {
+		var nodes []object
+		for _, app := range s.ListApps(ctx, org.ID) {
+			nodes = append(nodes, s.appObject(app))
+		}
+		return connection(nodes), nil
+	})
+	return obj
+}
+
+func releaseObject(release *Release) object {
+	obj := object(toJSON(release.API()).(map[string]any))
+	obj["__typename"] = "Release"
+	obj["configDefinition"] = release.Definition
+	obj["imageRef"] = release.Image
+	return obj
+}
+
+// machineObject returns a machine as the GraphQL API presents it. It
+// doesn't call into the server, so s.mu may be held.
+func (s *Server) machineObject(app fly.App, machine *fly.Machine) object {
+	obj := object(toJSON(machine).(map[string]any))
+	obj["__typename"] = "Machine"
+	obj["app"] = object{
+		"id":           app.ID,
+		"name":         app.Name,
+		"organization": toJSON(app.Organization),
+	}
+	obj["ips"] = connection([]object{{
+		"family":   "v6",
+		"kind":     "privatenet",
+		"ip":       machine.PrivateIP,
+		"maskSize": 48,
+	}})
+	obj["host"] = object{"id": "inmem"}
+	return obj
+}
+
+// volumeObject returns a volume as the GraphQL API presents it. s.mu must be
+// held.
+func (s *Server) volumeObject(app fly.App, vol *fly.Volume) object {
+	obj := object(toJSON(vol).(map[string]any))
+	obj["__typename"] = "Volume"
+	obj["app"] = object{"id": app.ID, "name": app.Name}
+
+	snapshots := make([]object, 0, len(s.snapshots[vol.ID]))
+	for _, snapshot := range s.snapshots[vol.ID] {
+		o := object(toJSON(snapshot).(map[string]any))
+		// The GraphQL API has sizes as strings
+		o["size"] = strconv.Itoa(snapshot.Size)
+		snapshots = append(snapshots, o)
+	}
+	obj["snapshots"] = connection(snapshots)
+	return obj
+}
+
+// imageVersion splits an image reference into its parts
+func imageVersion(image string) fly.ImageVersion {
+	ref := imageRef(image)
+	if !strings.Contains(image, "@") {
+		ref.Digest = ""
+	}
+	return fly.ImageVersion{
+		Registry:   ref.Registry,
+		Repository: ref.Repository,
+		Tag:        ref.Tag,
+		Digest:     ref.Digest,
+	}
+}
@@ -2,7 +2,12 @@ package inmem
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,29 +15,78 @@ import (
 	"github.com/superfly/flyctl/helpers"
 )
 
+// DefaultOrganization is the personal organization of DefaultUser, which
+// every server starts with.
+var DefaultOrganization = fly.Organization{
+	ID:      "ORG1",
+	Name:    DefaultUser.Name,
+	Slug:    "personal",
+	RawSlug: "personal",
+	Type:    "PERSONAL",
+}
+
+// Server holds the state of the emulated platform. Clients and the HTTP
+// front end are views onto it, so changes made through one are seen by all.
 type Server struct {
 	mu sync.Mutex
 
-	apps   map[string]*fly.App     // apps by app name
-	images map[imageKey]*fly.Image // images by app name & image ref
+	// changed is closed, and replaced, whenever a machine changes so that
+	// waiters can check on it again
+	changed chan struct{}
+
+	orgs map[string]*fly.Organization // orgs by slug
+
+	apps    map[string]*fly.App              // apps by app name
+	images  map[imageKey]*fly.Image          // images by app name & image ref
+	secrets map[string]map[string]fly.Secret // secrets by app name & secret name
+
+	ipSeq int                        // ip address id generation
+	ips   map[string][]fly.IPAddress // ip addresses by app name
+
+	machineSeq  int                                 // machine id generation
+	instanceSeq int                                 // machine version generation
+	machines    map[string][]*fly.Machine           // machines by app name
+	leases      map[string]*fly.MachineLeaseData    // leases by machine id
+	cordoned    map[string]bool                     // cordoned machines by id
+	checks      map[string]map[string]checkOverride // check statuses set by tests, by machine id & check name
+	held        map[string]*heldState               // states machines are held in by tests, by machine id
 
-	machineSeq int                       // machine id generation
-	machines   map[string][]*fly.Machine // machines by app name
+	volumeSeq int                      // volume id generation
+	volumes   map[string][]*fly.Volume // volumes by app name
+
+	snapshotSeq int                             // snapshot id generation
+	snapshots   map[string][]fly.VolumeSnapshot // snapshots by volume id
 
 	buildSeq int               // build id generation
 	builds   map[string]*Build // builds by id
 
 	releaseSeq int                 // release id generation
 	releases   map[string]*Release // releases by id
+
+	faults    []*activeFault // faults injected by tests
+	faultRand *rand.Rand     // decides which calls fail for faults with a rate
 }
 
 func NewServer() *Server {
+	org := DefaultOrganization
+
 	return &Server{
-		apps:     make(map[string]*fly.App),
-		machines: make(map[string][]*fly.Machine),
-		images:   make(map[imageKey]*fly.Image),
-		builds:   make(map[string]*Build),
-		releases: make(map[string]*Release),
+		changed:   make(chan struct{}),
+		orgs:      map[string]*fly.Organization{org.Slug: &org},
+		apps:      make(map[string]*fly.App),
+		images:    make(map[imageKey]*fly.Image),
+		secrets:   make(map[string]map[string]fly.Secret),
+		ips:       make(map[string][]fly.IPAddress),
+		machines:  make(map[string][]*fly.Machine),
+		leases:    make(map[string]*fly.MachineLeaseData),
+		cordoned:  make(map[string]bool),
+		checks:    make(map[string]map[string]checkOverride),
+		held:      make(map[string]*heldState),
+		volumes:   make(map[string][]*fly.Volume),
+		snapshots: make(map[string][]fly.VolumeSnapshot),
+		builds:    make(map[string]*Build),
+		releases:  make(map[string]*Release),
+		faultRand: rand.New(rand.NewSource(1)),
 	}
 }
 
@@ -44,21 +98,236 @@ func (s *Server) FlapsClient(appName string) *FlapsClient {
 	return NewFlapsClient(s, appName)
 }
 
+// notify wakes up everything waiting on machine changes. s.mu must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// CreateOrganization adds org to the server, replacing any organization with
+// the same slug.
+func (s *Server) CreateOrganization(org *fly.Organization) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	other := *org
+	if other.RawSlug == "" {
+		other.RawSlug = other.Slug
+	}
+	if other.Type == "" {
+		other.Type = "SHARED"
+	}
+	s.orgs[org.Slug] = &other
+}
+
+func (s *Server) GetOrganization(ctx context.Context, slug string) (*fly.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org := s.orgs[slug]
+	if org == nil {
+		return nil, errNotFound("Could not find Organization %q", slug)
+	}
+	other := *org
+	return &other, nil
+}
+
+func (s *Server) ListOrganizations(ctx context.Context) []fly.Organization {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orgs := make([]fly.Organization, 0, len(s.orgs))
+	for _, org := range s.orgs {
+		orgs = append(orgs, *org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Slug < orgs[j].Slug })
+	return orgs
+}
+
+// orgByID returns the organization with id, or slug. s.mu must be held.
+func (s *Server) orgByID(id string) *fly.Organization {
+	for _, org := range s.orgs {
+		if org.ID == id || org.Slug == id {
+			return org
+		}
+	}
+	return nil
+}
+
+// CreateApp adds app to the server, along with its organization if that's
+// not there yet. It panics if an app with the same name exists, since it's
+// meant for setting up tests.
 func (s *Server) CreateApp(app *fly.App) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.apps[app.Name]; ok {
 		panic(fmt.Sprintf("app name already exists: %q", app.Name))
 	}
+	s.addApp(app)
+}
+
+// addApp fills in app's defaults and stores it. s.mu must be held.
+func (s *Server) addApp(app *fly.App) {
+	if app.ID == "" {
+		app.ID = app.Name
+	}
+	if app.Hostname == "" {
+		app.Hostname = app.Name + ".fly.dev"
+	}
+	if app.AppURL == "" {
+		app.AppURL = "https://" + app.Hostname
+	}
+	if app.PlatformVersion == "" {
+		app.PlatformVersion = "machines"
+	}
+	if app.Status == "" {
+		app.Status = "pending"
+	}
+	if app.Network == "" {
+		app.Network = "default"
+	}
+
+	if org := s.orgs[app.Organization.Slug]; org != nil {
+		app.Organization = *org
+	} else {
+		if app.Organization.ID == "" {
+			app.Organization.ID = app.Organization.Slug
+		}
+		org := app.Organization
+		s.orgs[org.Slug] = &org
+	}
+
 	s.apps[app.Name] = app
 }
 
+// NewApp creates an app in the organization with orgID, which may be its
+// slug, as the API does.
+func (s *Server) NewApp(ctx context.Context, orgID, name, network string) (*fly.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" {
+		return nil, errBadRequest("Name can't be blank")
+	}
+	if _, ok := s.apps[name]; ok {
+		return nil, errConflict("Name has already been taken")
+	}
+	org := s.orgByID(orgID)
+	if org == nil {
+		return nil, errNotFound("Could not find Organization %q", orgID)
+	}
+
+	app := &fly.App{
+		Name:         name,
+		Network:      network,
+		Organization: *org,
+	}
+	s.addApp(app)
+
+	other := *app
+	return &other, nil
+}
+
+func (s *Server) GetApp(ctx context.Context, appName string) (*fly.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.apps[appName]
+	if app == nil {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+	other := *app
+	return &other, nil
+}
+
+// ListApps returns the apps of the organization with orgID, or all apps if
+// it's empty.
+func (s *Server) ListApps(ctx context.Context, orgID string) []fly.App {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var apps []fly.App
+	for _, app := range s.apps {
+		if orgID == "" || app.Organization.ID == orgID || app.Organization.Slug == orgID {
+			apps = append(apps, *app)
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+	return apps
+}
+
+// DeleteApp removes an app along with its machines and volumes
+func (s *Server) DeleteApp(ctx context.Context, appName string) (*fly.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.apps[appName]
+	if app == nil {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+
+	for _, machine := range s.machines[appName] {
+		delete(s.leases, machine.ID)
+		delete(s.cordoned, machine.ID)
+		delete(s.checks, machine.ID)
+	}
+	for _, vol := range s.volumes[appName] {
+		delete(s.snapshots, vol.ID)
+	}
+	delete(s.apps, appName)
+	delete(s.machines, appName)
+	delete(s.volumes, appName)
+	delete(s.secrets, appName)
+	delete(s.ips, appName)
+	for key := range s.images {
+		if key.appName == appName {
+			delete(s.images, key)
+		}
+	}
+	s.notify()
+
+	return app, nil
+}
+
+// MoveApp moves an app to the organization with orgID
+func (s *Server) MoveApp(ctx context.Context, appName, orgID string) (*fly.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.apps[appName]
+	if app == nil {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+	org := s.orgByID(orgID)
+	if org == nil {
+		return nil, errNotFound("Could not find Organization %q", orgID)
+	}
+	app.Organization = *org
+
+	other := *app
+	return &other, nil
+}
+
+// appByID returns the app with id, which may also be its name. s.mu must be
+// held.
+func (s *Server) appByID(id string) *fly.App {
+	if app := s.apps[id]; app != nil {
+		return app
+	}
+	for _, app := range s.apps {
+		if app.ID == id {
+			return app
+		}
+	}
+	return nil
+}
+
 func (s *Server) CreateBuild(ctx context.Context, appName string) (*Build, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.apps[appName]; ok {
-		return nil, fmt.Errorf("app not found: %q", appName)
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("Could not find App %q", appName)
 	}
 
 	s.buildSeq++
@@ -79,22 +348,34 @@ func (s *Server) FinishBuild(ctx context.Context, id, status string) (*Build, er
 	defer s.mu.Unlock()
 
 	build, ok := s.builds[id]
-	if ok {
-		return nil, fmt.Errorf("build not found: %q", id)
+	if !ok {
+		return nil, errNotFound("build not found: %q", id)
 	}
 	build.Status = status
 	build.WallClockTimeMs = time.Since(build.CreatedAt).Milliseconds()
 
-	return build, nil
+	other := *build
+	return &other, nil
 }
 
 func (s *Server) CreateRelease(ctx context.Context, appID, clientMutationID, image, platformVersion, strategy string) (*Release, error) {
+	return s.CreateReleaseWithDefinition(ctx, appID, clientMutationID, image, platformVersion, strategy, nil)
+}
+
+// CreateReleaseWithDefinition creates a release recording the app config it
+// was deployed with, which flyctl reads back as the app's current config.
+func (s *Server) CreateReleaseWithDefinition(ctx context.Context, appID, clientMutationID, image, platformVersion, strategy string, definition any) (*Release, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	app := s.appByID(appID)
+	if app == nil {
+		return nil, errNotFound("Could not find App %q", appID)
+	}
+
 	var n int
 	for _, r := range s.releases {
-		if r.AppID == appID {
+		if r.AppID == app.ID {
 			n++
 		}
 	}
@@ -103,17 +384,24 @@ func (s *Server) CreateRelease(ctx context.Context, appID, clientMutationID, ima
 
 	release := &Release{
 		ID:               fmt.Sprintf("RELEASE%d", s.releaseSeq),
-		AppID:            appID,
+		AppID:            app.ID,
 		ClientMutationID: clientMutationID,
+		Definition:       definition,
 		Image:            image,
 		PlatformVersion:  platformVersion,
 		Status:           "pending",
 		Strategy:         strategy,
 		Version:          n + 1,
+		CreatedAt:        time.Now(),
 	}
 	s.releases[release.ID] = release
 
-	return release, nil
+	app.Version = release.Version
+	app.Deployed = true
+	app.Status = "deployed"
+
+	other := *release
+	return &other, nil
 }
 
 func (s *Server) UpdateRelease(ctx context.Context, id, clientMutationID, status string) error {
@@ -122,7 +410,7 @@ func (s *Server) UpdateRelease(ctx context.Context, id, clientMutationID, status
 
 	release := s.releases[id]
 	if release == nil {
-		return fmt.Errorf("release not found: %q", id)
+		return errNotFound("release not found: %q", id)
 	}
 
 	release.Status = status
@@ -130,12 +418,32 @@ func (s *Server) UpdateRelease(ctx context.Context, id, clientMutationID, status
 	return nil
 }
 
+// ListReleases returns an app's releases, most recent first
+func (s *Server) ListReleases(ctx context.Context, appName string) ([]Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app := s.apps[appName]
+	if app == nil {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+
+	var releases []Release
+	for _, r := range s.releases {
+		if r.AppID == app.ID {
+			releases = append(releases, *r)
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Version > releases[j].Version })
+	return releases, nil
+}
+
 func (s *Server) CreateImage(ctx context.Context, appName, imageRef string, image *fly.Image) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if _, ok := s.apps[appName]; !ok {
-		return fmt.Errorf("app not found: %q", appName)
+		return errNotFound("Could not find App %q", appName)
 	}
 
 	other := *image
@@ -143,35 +451,139 @@ func (s *Server) CreateImage(ctx context.Context, appName, imageRef string, imag
 	return nil
 }
 
-func (s *Server) Launch(ctx context.Context, appName, name, region string, config *fly.MachineConfig) (*fly.Machine, error) {
+func (s *Server) GetImage(ctx context.Context, appName, imageRef string) (*fly.Image, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.machineSeq++
-	id := s.machineSeq
+	image := s.images[imageKey{appName, imageRef}]
+	if image == nil {
+		return nil, nil
+	}
+	other := *image
+	return &other, nil
+}
 
-	machine := &fly.Machine{
-		ID:     fmt.Sprintf("%014x", id),
-		Name:   name,
-		Region: region,
-		State:  "started",
-		Config: helpers.Clone(config),
+// SetSecrets sets an app's secrets, returning the release the change makes
+func (s *Server) SetSecrets(ctx context.Context, appName string, secrets map[string]string) (*fly.Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+
+	if s.secrets[appName] == nil {
+		s.secrets[appName] = make(map[string]fly.Secret)
+	}
+	for name, value := range secrets {
+		digest := sha256.Sum256([]byte(value))
+		s.secrets[appName][name] = fly.Secret{
+			Name:      name,
+			Digest:    hex.EncodeToString(digest[:8]),
+			CreatedAt: time.Now(),
+		}
 	}
-	s.machines[appName] = append(s.machines[appName], machine)
 
-	return machine, nil
+	return &fly.Release{Version: s.apps[appName].Version, Status: "complete"}, nil
 }
 
-func (s *Server) GetMachine(ctx context.Context, appName, machineID string) (*fly.Machine, error) {
+func (s *Server) UnsetSecrets(ctx context.Context, appName string, keys []string) (*fly.Release, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, machine := range s.machines[appName] {
-		if machine.ID == machineID {
-			return helpers.Clone(machine), nil
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+
+	for _, key := range keys {
+		if _, ok := s.secrets[appName][key]; !ok {
+			return nil, errNotFound("could not find secret %q", key)
 		}
 	}
-	return nil, fmt.Errorf("machine not found: %q", machineID)
+	for _, key := range keys {
+		delete(s.secrets[appName], key)
+	}
+
+	return &fly.Release{Version: s.apps[appName].Version, Status: "complete"}, nil
+}
+
+func (s *Server) ListSecrets(ctx context.Context, appName string) ([]fly.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+
+	secrets := make([]fly.Secret, 0, len(s.secrets[appName]))
+	for _, secret := range s.secrets[appName] {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// AllocateIPAddress allocates an address of addrType, which is one of v4,
+// shared_v4, v6 or private_v6, to an app.
+func (s *Server) AllocateIPAddress(ctx context.Context, appName, addrType, region string) (*fly.IPAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+
+	s.ipSeq++
+
+	ip := fly.IPAddress{
+		ID:        fmt.Sprintf("ip_%d", s.ipSeq),
+		Type:      addrType,
+		Region:    region,
+		CreatedAt: time.Now(),
+	}
+	switch strings.ToLower(addrType) {
+	case "v4":
+		ip.Address = fmt.Sprintf("137.66.%d.%d", s.ipSeq/256, s.ipSeq%256)
+	case "shared_v4":
+		ip.Address = "66.241.124.1"
+	case "v6":
+		ip.Address = fmt.Sprintf("2a09:8280:1::%x", s.ipSeq)
+	case "private_v6":
+		ip.Address = fmt.Sprintf("fdaa:0:1:0:1::%x", s.ipSeq)
+	default:
+		return nil, errBadRequest("invalid ip address type %q", addrType)
+	}
+	ip.Type = strings.ToLower(addrType)
+	if ip.Region == "" {
+		ip.Region = "global"
+	}
+
+	s.ips[appName] = append(s.ips[appName], ip)
+	return &ip, nil
+}
+
+func (s *Server) ReleaseIPAddress(ctx context.Context, appName, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ips := s.ips[appName]
+	for i, ip := range ips {
+		if ip.Address == address || ip.ID == address {
+			s.ips[appName] = append(ips[:i:i], ips[i+1:]...)
+			return nil
+		}
+	}
+	return errNotFound("Could not find IP address %q", address)
+}
+
+func (s *Server) ListIPAddresses(ctx context.Context, appName string) ([]fly.IPAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("Could not find App %q", appName)
+	}
+	return helpers.Clone(s.ips[appName]), nil
 }
 
 type Build struct {
@@ -192,6 +604,22 @@ type Release struct {
 	Status           string
 	Strategy         string
 	Version          int
+	CreatedAt        time.Time
+}
+
+// API returns the release as the API presents it
+func (r *Release) API() fly.Release {
+	return fly.Release{
+		ID:                 r.ID,
+		Version:            r.Version,
+		Stable:             r.Status == "complete",
+		InProgress:         r.Status == "pending" || r.Status == "running",
+		Status:             r.Status,
+		DeploymentStrategy: r.Strategy,
+		User:               DefaultUser,
+		CreatedAt:          r.CreatedAt,
+		ImageRef:           r.Image,
+	}
 }
 
 type imageKey struct {
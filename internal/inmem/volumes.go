@@ -0,0 +1,286 @@
+package inmem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/helpers"
+)
+
+// volumeDestroyedState is the state of deleted volumes, which the API keeps
+// listing for a while
+const volumeDestroyedState = "pending_destroy"
+
+// defaultSnapshotRetention is how many days snapshots are kept for unless a
+// volume says otherwise
+const defaultSnapshotRetention = 5
+
+// volume returns the volume with id of an app, or nil. s.mu must be held.
+func (s *Server) volume(appName, volumeID string) *fly.Volume {
+	for _, vol := range s.volumes[appName] {
+		if vol.ID == volumeID {
+			return vol
+		}
+	}
+	return nil
+}
+
+// activeVolume returns the volume with id of an app, failing if it doesn't
+// exist or was deleted. s.mu must be held.
+func (s *Server) activeVolume(appName, volumeID string) (*fly.Volume, error) {
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+	vol := s.volume(appName, volumeID)
+	if vol == nil || vol.State == volumeDestroyedState {
+		return nil, errNotFound("volume not found: %q", volumeID)
+	}
+	return vol, nil
+}
+
+// ListVolumes returns an app's volumes, including deleted ones
+func (s *Server) ListVolumes(ctx context.Context, appName string) ([]fly.Volume, error) {
+	if err := s.fault(ctx, "ListVolumes", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+
+	volumes := make([]fly.Volume, 0, len(s.volumes[appName]))
+	for _, vol := range s.volumes[appName] {
+		volumes = append(volumes, *helpers.Clone(vol))
+	}
+	return volumes, nil
+}
+
+func (s *Server) GetVolume(ctx context.Context, appName, volumeID string) (*fly.Volume, error) {
+	if err := s.fault(ctx, "GetVolume", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+	vol := s.volume(appName, volumeID)
+	if vol == nil {
+		return nil, errNotFound("volume not found: %q", volumeID)
+	}
+	return helpers.Clone(vol), nil
+}
+
+// CreateVolume creates a volume, which may be restored from a snapshot or
+// forked from another volume of the app.
+func (s *Server) CreateVolume(ctx context.Context, appName string, req fly.CreateVolumeRequest) (*fly.Volume, error) {
+	if err := s.fault(ctx, "CreateVolume", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[appName]; !ok {
+		return nil, errNotFound("app not found: %q", appName)
+	}
+	if req.Name == "" {
+		return nil, errBadRequest("name is required")
+	}
+	if req.Region == "" {
+		return nil, errBadRequest("region is required")
+	}
+
+	size := 1
+	if req.SizeGb != nil {
+		size = *req.SizeGb
+	}
+
+	switch {
+	case req.SnapshotID != nil:
+		snapshot := s.snapshot(*req.SnapshotID)
+		if snapshot == nil {
+			return nil, errNotFound("snapshot not found: %q", *req.SnapshotID)
+		}
+		if req.SizeGb == nil {
+			size = (snapshot.Size + 1<<30 - 1) >> 30
+		}
+	case req.SourceVolumeID != nil:
+		source, err := s.activeVolume(appName, *req.SourceVolumeID)
+		if err != nil {
+			return nil, err
+		}
+		if req.SizeGb == nil {
+			size = source.SizeGb
+		}
+		if source.Region != req.Region {
+			return nil, errBadRequest("volumes can only be forked within a region")
+		}
+	}
+	if size < 1 {
+		return nil, errBadRequest("size_gb must be at least 1")
+	}
+
+	s.volumeSeq++
+
+	vol := &fly.Volume{
+		ID:                fmt.Sprintf("vol_%016x", s.volumeSeq),
+		Name:              req.Name,
+		State:             "created",
+		SizeGb:            size,
+		Region:            req.Region,
+		Zone:              fmt.Sprintf("%x", sha256.Sum256([]byte(req.Region)))[:4],
+		Encrypted:         req.Encrypted == nil || *req.Encrypted,
+		CreatedAt:         time.Now().UTC(),
+		SnapshotRetention: defaultSnapshotRetention,
+		AutoBackupEnabled: true,
+	}
+	if req.SnapshotRetention != nil {
+		vol.SnapshotRetention = *req.SnapshotRetention
+	}
+	if req.AutoBackupEnabled != nil {
+		vol.AutoBackupEnabled = *req.AutoBackupEnabled
+	}
+
+	s.volumes[appName] = append(s.volumes[appName], vol)
+	return helpers.Clone(vol), nil
+}
+
+func (s *Server) UpdateVolume(ctx context.Context, appName, volumeID string, req fly.UpdateVolumeRequest) (*fly.Volume, error) {
+	if err := s.fault(ctx, "UpdateVolume", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vol, err := s.activeVolume(appName, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if req.SnapshotRetention != nil {
+		vol.SnapshotRetention = *req.SnapshotRetention
+	}
+	if req.AutoBackupEnabled != nil {
+		vol.AutoBackupEnabled = *req.AutoBackupEnabled
+	}
+	return helpers.Clone(vol), nil
+}
+
+// ExtendVolume grows a volume to sizeGB, reporting whether the machine it's
+// attached to needs a restart to see the new size, as stopped ones don't.
+func (s *Server) ExtendVolume(ctx context.Context, appName, volumeID string, sizeGB int) (*fly.Volume, bool, error) {
+	if err := s.fault(ctx, "ExtendVolume", ""); err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vol, err := s.activeVolume(appName, volumeID)
+	if err != nil {
+		return nil, false, err
+	}
+	if sizeGB <= vol.SizeGb {
+		return nil, false, errBadRequest("size_gb must be greater than the current size of %dGB", vol.SizeGb)
+	}
+	vol.SizeGb = sizeGB
+
+	needsRestart := false
+	if vol.AttachedMachine != nil {
+		if machine, err := s.machine(appName, *vol.AttachedMachine); err == nil {
+			needsRestart = machine.State == fly.MachineStateStarted
+		}
+	}
+	return helpers.Clone(vol), needsRestart, nil
+}
+
+// DeleteVolume deletes a volume, which mustn't be attached to a machine
+func (s *Server) DeleteVolume(ctx context.Context, appName, volumeID string) (*fly.Volume, error) {
+	if err := s.fault(ctx, "DeleteVolume", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vol, err := s.activeVolume(appName, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if vol.AttachedMachine != nil {
+		return nil, errPrecondition("volume %s is attached to machine %s", vol.ID, *vol.AttachedMachine)
+	}
+	vol.State = volumeDestroyedState
+	return helpers.Clone(vol), nil
+}
+
+// snapshot returns the snapshot with id of any volume, or nil. s.mu must be
+// held.
+func (s *Server) snapshot(id string) *fly.VolumeSnapshot {
+	for _, snapshots := range s.snapshots {
+		for i := range snapshots {
+			if snapshots[i].ID == id {
+				return &snapshots[i]
+			}
+		}
+	}
+	return nil
+}
+
+// CreateVolumeSnapshot takes a snapshot of a volume, which completes
+// straight away
+func (s *Server) CreateVolumeSnapshot(ctx context.Context, appName, volumeID string) (*fly.VolumeSnapshot, error) {
+	if err := s.fault(ctx, "CreateVolumeSnapshot", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vol, err := s.activeVolume(appName, volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.snapshotSeq++
+
+	id := fmt.Sprintf("vs_%016x", s.snapshotSeq)
+	digest := sha256.Sum256([]byte(id))
+	retention := vol.SnapshotRetention
+	snapshot := fly.VolumeSnapshot{
+		ID:            id,
+		Size:          vol.SizeGb << 30,
+		Digest:        hex.EncodeToString(digest[:]),
+		CreatedAt:     time.Now().UTC(),
+		Status:        "created",
+		RetentionDays: &retention,
+	}
+	s.snapshots[vol.ID] = append(s.snapshots[vol.ID], snapshot)
+	return &snapshot, nil
+}
+
+func (s *Server) ListVolumeSnapshots(ctx context.Context, appName, volumeID string) ([]fly.VolumeSnapshot, error) {
+	if err := s.fault(ctx, "ListVolumeSnapshots", ""); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.activeVolume(appName, volumeID); err != nil {
+		return nil, err
+	}
+	snapshots := make([]fly.VolumeSnapshot, len(s.snapshots[volumeID]))
+	copy(snapshots, s.snapshots[volumeID])
+	return snapshots, nil
+}
@@ -0,0 +1,57 @@
+package inmem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestVolumes(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	vol, err := server.CreateVolume(ctx, "test-app", fly.CreateVolumeRequest{Name: "data", Region: "ord"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, vol.SizeGb)
+	assert.True(t, vol.Encrypted)
+
+	machine, err := server.Launch(ctx, "test-app", fly.LaunchMachineInput{
+		Region: "ord",
+		Config: &fly.MachineConfig{
+			Image:  "nginx",
+			Mounts: []fly.MachineMount{{Volume: vol.ID, Path: "/data"}},
+		},
+	})
+	require.NoError(t, err)
+
+	vol, err = server.GetVolume(ctx, "test-app", vol.ID)
+	require.NoError(t, err)
+	require.NotNil(t, vol.AttachedMachine)
+	assert.Equal(t, machine.ID, *vol.AttachedMachine)
+
+	vol, needsRestart, err := server.ExtendVolume(ctx, "test-app", vol.ID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, vol.SizeGb)
+	assert.True(t, needsRestart)
+
+	_, err = server.DeleteVolume(ctx, "test-app", vol.ID)
+	assert.Equal(t, 412, errorStatus(err))
+
+	snapshot, err := server.CreateVolumeSnapshot(ctx, "test-app", vol.ID)
+	require.NoError(t, err)
+	restored, err := server.CreateVolume(ctx, "test-app", fly.CreateVolumeRequest{
+		Name:       "data",
+		Region:     "ord",
+		SnapshotID: &snapshot.ID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, restored.SizeGb)
+
+	require.NoError(t, server.DestroyMachine(ctx, "test-app", machine.ID, true, ""))
+	vol, err = server.DeleteVolume(ctx, "test-app", vol.ID)
+	require.NoError(t, err)
+	assert.Equal(t, volumeDestroyedState, vol.State)
+}
@@ -128,10 +128,16 @@ func (lm *leasableMachine) FormattedMachineId() string {
 
 func (lm *leasableMachine) logStatusWaiting(ctx context.Context, desired string) {
 	statuslogger.Logf(ctx, "Waiting for %s to have state: %s", lm.colorize.Bold(lm.FormattedMachineId()), lm.colorize.Yellow(desired))
+	e := statuslogger.MachineEvent(statuslogger.EventMachineWaiting, lm.Machine())
+	e.State = desired
+	statuslogger.LogEvent(ctx, e)
 }
 
 func (lm *leasableMachine) logStatusFinished(ctx context.Context, current string) {
 	statuslogger.Logf(ctx, "Machine %s has state: %s", lm.colorize.Bold(lm.FormattedMachineId()), lm.colorize.Green(current))
+	e := statuslogger.MachineEvent(statuslogger.EventMachineState, lm.Machine())
+	e.State = current
+	statuslogger.LogEvent(ctx, e)
 }
 
 func (lm *leasableMachine) logHealthCheckStatus(ctx context.Context, status *fly.HealthCheckStatus) {
@@ -320,7 +326,11 @@ func (lm *leasableMachine) WaitForHealthchecksToPass(ctx context.Context, timeou
 		case errors.Is(waitCtx.Err(), context.Canceled):
 			return err
 		case errors.Is(waitCtx.Err(), context.DeadlineExceeded):
-			return fmt.Errorf("timeout reached waiting for health checks to pass for machine %s: %w", lm.Machine().ID, err)
+			err = fmt.Errorf("timeout reached waiting for health checks to pass for machine %s: %w", lm.Machine().ID, err)
+			e := statuslogger.MachineEvent(statuslogger.EventHealthChecksFailed, lm.Machine())
+			e.Error = err.Error()
+			statuslogger.LogEvent(ctx, e)
+			return err
 		case err != nil:
 			return fmt.Errorf("error getting machine %s from api: %w", lm.Machine().ID, err)
 		case !updateMachine.AllHealthChecks().AllPassing():
@@ -335,6 +345,7 @@ func (lm *leasableMachine) WaitForHealthchecksToPass(ctx context.Context, timeou
 			continue
 		}
 		lm.logHealthCheckStatus(ctx, updateMachine.AllHealthChecks())
+		statuslogger.LogEvent(ctx, statuslogger.MachineEvent(statuslogger.EventHealthChecksPassed, updateMachine))
 		return nil
 	}
 }
@@ -0,0 +1,74 @@
+package machine
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/inmem"
+	"github.com/superfly/flyctl/internal/statuslogger"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newTestLeasableMachine(t *testing.T, server *inmem.Server, config *fly.MachineConfig) (context.Context, *leasableMachine) {
+	t.Helper()
+
+	io, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), io)
+	ctx, done := statuslogger.SingleLine(ctx, false)
+	t.Cleanup(func() { done(false) })
+
+	server.CreateApp(&fly.App{Name: "test-app", Organization: inmem.DefaultOrganization})
+	flapsClient := server.FlapsClient("test-app")
+
+	machine, err := flapsClient.Launch(ctx, fly.LaunchMachineInput{Config: config})
+	require.NoError(t, err)
+
+	return ctx, NewLeasableMachine(flapsClient, io, machine).(*leasableMachine)
+}
+
+func TestLeasableMachineWaitForState(t *testing.T) {
+	server := inmem.NewServer()
+	server.HoldMachineState("test-app", "00000000000001", fly.MachineStateCreated)
+	ctx, lm := newTestLeasableMachine(t, server, &fly.MachineConfig{Image: "nginx"})
+
+	err := lm.WaitForState(ctx, fly.MachineStateStarted, 100*time.Millisecond, false)
+	assert.ErrorAs(t, err, &WaitTimeoutErr{})
+
+	// Waits that fail are retried
+	server.ReleaseMachineState("test-app", lm.Machine().ID)
+	server.InjectFault(inmem.Fault{Method: "WaitMachine", Err: inmem.ServerError(http.StatusInternalServerError), Times: 1})
+	assert.NoError(t, lm.WaitForState(ctx, fly.MachineStateStarted, 5*time.Second, false))
+}
+
+func TestLeasableMachineWaitForHealthchecksToPass(t *testing.T) {
+	server := inmem.NewServer()
+	server.SetCheckSequence("test-app", "00000000000001", "alive", fly.Critical, fly.Passing)
+	ctx, lm := newTestLeasableMachine(t, server, &fly.MachineConfig{
+		Image:  "nginx",
+		Checks: map[string]fly.MachineCheck{"alive": {}},
+	})
+
+	assert.NoError(t, lm.WaitForHealthchecksToPass(ctx, 5*time.Second))
+
+	server.SetCheckSequence("test-app", lm.Machine().ID, "alive", fly.Critical)
+	assert.ErrorContains(t, lm.WaitForHealthchecksToPass(ctx, 100*time.Millisecond), "timeout reached")
+}
+
+func TestLeasableMachineAcquireLease(t *testing.T) {
+	server := inmem.NewServer()
+	ctx, lm := newTestLeasableMachine(t, server, &fly.MachineConfig{Image: "nginx"})
+
+	server.InjectFault(inmem.Fault{Method: "AcquireLease", Err: inmem.ServerError(http.StatusConflict)})
+	assert.Error(t, lm.AcquireLease(ctx, time.Minute))
+	assert.False(t, lm.HasLease())
+
+	server.ClearFaults()
+	require.NoError(t, lm.AcquireLease(ctx, time.Minute))
+	assert.True(t, lm.HasLease())
+	assert.NoError(t, lm.ReleaseLease(ctx))
+}
@@ -6,8 +6,10 @@ import (
 	"slices"
 	"time"
 
+	"github.com/samber/lo"
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/statuslogger"
 	"github.com/superfly/flyctl/internal/watch"
 	"github.com/superfly/flyctl/iostreams"
 	"golang.org/x/exp/maps"
@@ -84,6 +86,7 @@ func Update(ctx context.Context, m *fly.Machine, input *fly.LaunchMachineInput)
 	if err != nil {
 		return fmt.Errorf("could not update machine %s: %w", m.ID, err)
 	}
+	statuslogger.LogEvent(ctx, statuslogger.MachineEvent(statuslogger.EventMachineUpdated, updatedMachine))
 
 	waitForAction := "start"
 	if input.SkipLaunch || m.Config.Schedule != "" {
@@ -95,15 +98,25 @@ func Update(ctx context.Context, m *fly.Machine, input *fly.LaunchMachineInput)
 		waitTimeout = time.Duration(input.Timeout) * time.Second
 	}
 
+	waitEvent := statuslogger.MachineEvent(statuslogger.EventMachineWaiting, updatedMachine)
+	waitEvent.State = lo.Ternary(waitForAction == "stop", fly.MachineStateStopped, fly.MachineStateStarted)
+	statuslogger.LogEvent(ctx, waitEvent)
 	if err := WaitForStartOrStop(ctx, updatedMachine, waitForAction, waitTimeout); err != nil {
 		return err
 	}
+	stateEvent := waitEvent
+	stateEvent.Type = statuslogger.EventMachineState
+	statuslogger.LogEvent(ctx, stateEvent)
 
 	if !input.SkipLaunch {
 		if !input.SkipHealthChecks {
 			if err := watch.MachinesChecks(ctx, []*fly.Machine{updatedMachine}); err != nil {
+				failedEvent := statuslogger.MachineEvent(statuslogger.EventHealthChecksFailed, updatedMachine)
+				failedEvent.Error = err.Error()
+				statuslogger.LogEvent(ctx, failedEvent)
 				return fmt.Errorf("failed to wait for health checks to pass: %w", err)
 			}
+			statuslogger.LogEvent(ctx, statuslogger.MachineEvent(statuslogger.EventHealthChecksPassed, updatedMachine))
 		}
 	}
 
@@ -11,7 +11,20 @@ func Create(ctx context.Context, numLines int, showStatusChar bool) StatusLogger
 
 	logNumbers := numLines > 1
 	io := iostreams.FromContext(ctx)
-	if io.IsInteractive() {
+	if w := jsonLinesFromContext(ctx); w != nil {
+		sl := &jsonLinesLogger{
+			w:     w,
+			lines: make([]*jsonLinesLine, numLines),
+		}
+		for i := 0; i < numLines; i++ {
+			sl.lines[i] = &jsonLinesLine{
+				logger:  sl,
+				lineNum: i,
+				status:  StatusNone,
+			}
+		}
+		return sl
+	} else if io.IsInteractive() {
 
 		sl := &interactiveLogger{
 			lines:      make([]*interactiveLine, numLines),
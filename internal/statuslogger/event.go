@@ -0,0 +1,71 @@
+package statuslogger
+
+import (
+	"context"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+)
+
+type EventType string
+
+const (
+	EventLog                EventType = "log"
+	EventFailed             EventType = "failed"
+	EventMachineCreated     EventType = "machine_created"
+	EventMachineUpdated     EventType = "machine_updated"
+	EventMachineWaiting     EventType = "machine_waiting"
+	EventMachineState       EventType = "machine_state"
+	EventHealthChecksPassed EventType = "health_checks_passed"
+	EventHealthChecksFailed EventType = "health_checks_failed"
+	EventReleaseCommandLog  EventType = "release_command_log"
+	EventRollback           EventType = "rollback"
+)
+
+// Event is a structured progress update. Only the JSON lines logger reports events,
+// the other loggers already show the same progress through regular log lines.
+type Event struct {
+	Type         EventType `json:"type"`
+	Time         time.Time `json:"time"`
+	Line         int       `json:"line"`
+	Status       string    `json:"status,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	MachineID    string    `json:"machine_id,omitempty"`
+	ProcessGroup string    `json:"process_group,omitempty"`
+	Region       string    `json:"region,omitempty"`
+	State        string    `json:"state,omitempty"`
+}
+
+// MachineEvent returns an event of the given type describing m.
+func MachineEvent(typ EventType, m *fly.Machine) Event {
+	e := Event{Type: typ}
+	if m != nil {
+		e.MachineID = m.ID
+		e.ProcessGroup = m.ProcessGroup()
+		e.Region = m.Region
+		e.State = m.State
+	}
+	return e
+}
+
+// LogEvent reports e to the StatusLine ctx carries, if any.
+// Unlike the other shorthands it never panics, since events are only extra detail.
+func LogEvent(ctx context.Context, e Event) {
+	if line := FromContextOptional(ctx); line != nil {
+		line.event(e)
+	}
+}
+
+func (s Status) String() string {
+	switch s {
+	case StatusRunning:
+		return "running"
+	case StatusSuccess:
+		return "success"
+	case StatusFailure:
+		return "failure"
+	default:
+		return ""
+	}
+}
@@ -63,3 +63,6 @@ func (line *interactiveLine) setStatus(s Status) {
 	line.logger.lockedDraw()
 	line.updateTimestamp()
 }
+
+// event is a no-op for interactive loggers, the same progress is logged as text.
+func (line *interactiveLine) event(_ Event) {}
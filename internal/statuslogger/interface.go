@@ -23,4 +23,6 @@ type StatusLine interface {
 	// Private because it won't redraw on non-interactive loggers.
 	// For outside use, use LogStatus or LogfStatus.
 	setStatus(s Status)
+	// Private because events are reported through LogEvent, which tolerates missing lines.
+	event(e Event)
 }
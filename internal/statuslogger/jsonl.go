@@ -0,0 +1,121 @@
+package statuslogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superfly/flyctl/iostreams"
+)
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+type jsonLinesKey struct{}
+
+// jsonLinesWriter serializes events coming from every logger sharing a context
+type jsonLinesWriter struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+func (w *jsonLinesWriter) write(e Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_ = w.enc.Encode(e)
+}
+
+// NewJSONLinesContext derives a Context in which loggers write one JSON event per line
+// to the current standard output. The standard output of the IOStreams in ctx is
+// redirected to its error output so other messages don't end up in the event stream.
+func NewJSONLinesContext(ctx context.Context) context.Context {
+	io := iostreams.FromContext(ctx)
+	w := newJSONLinesWriter(io.Out)
+	io.Out = io.ErrOut
+	return context.WithValue(ctx, jsonLinesKey{}, w)
+}
+
+// IsJSONLines reports whether loggers created from ctx emit JSON events
+func IsJSONLines(ctx context.Context) bool {
+	return jsonLinesFromContext(ctx) != nil
+}
+
+func jsonLinesFromContext(ctx context.Context) *jsonLinesWriter {
+	w, _ := ctx.Value(jsonLinesKey{}).(*jsonLinesWriter)
+	return w
+}
+
+func newJSONLinesWriter(w io.Writer) *jsonLinesWriter {
+	return &jsonLinesWriter{enc: json.NewEncoder(w)}
+}
+
+type jsonLinesLogger struct {
+	w     *jsonLinesWriter
+	lines []*jsonLinesLine
+}
+
+func (jl *jsonLinesLogger) Line(i int) StatusLine {
+	return jl.lines[i]
+}
+
+// Destroy is a no-op for JSON lines loggers.
+func (jl *jsonLinesLogger) Destroy(_ bool) {}
+
+func (jl *jsonLinesLogger) Pause() ResumeFn { return func() {} }
+
+type jsonLinesLine struct {
+	logger  *jsonLinesLogger
+	lineNum int
+
+	lock   sync.Mutex
+	status Status
+}
+
+func (line *jsonLinesLine) Log(s string) {
+	line.event(Event{Type: EventLog, Message: s})
+}
+
+func (line *jsonLinesLine) Logf(format string, args ...interface{}) {
+	line.Log(fmt.Sprintf(format, args...))
+}
+
+func (line *jsonLinesLine) LogStatus(s Status, str string) {
+	line.setStatus(s)
+	line.Log(str)
+}
+
+func (line *jsonLinesLine) LogfStatus(s Status, format string, args ...interface{}) {
+	line.LogStatus(s, fmt.Sprintf(format, args...))
+}
+
+func (line *jsonLinesLine) Failed(e error) {
+	line.setStatus(StatusFailure)
+	line.event(Event{Type: EventFailed, Error: e.Error()})
+}
+
+func (line *jsonLinesLine) setStatus(s Status) {
+	line.lock.Lock()
+	defer line.lock.Unlock()
+	line.status = s
+}
+
+func (line *jsonLinesLine) event(e Event) {
+	line.lock.Lock()
+	status := line.status
+	line.lock.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Status == "" {
+		e.Status = status.String()
+	}
+	e.Line = line.lineNum
+	e.Message = strings.TrimSpace(ansiEscape.ReplaceAllString(e.Message, ""))
+	e.Error = ansiEscape.ReplaceAllString(e.Error, "")
+	line.logger.w.write(e)
+}
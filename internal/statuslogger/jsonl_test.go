@@ -0,0 +1,73 @@
+package statuslogger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestJSONLinesLogger(t *testing.T) {
+	ios, _, out, errOut := iostreams.Test()
+	ctx := NewJSONLinesContext(iostreams.NewContext(context.Background(), ios))
+	require.True(t, IsJSONLines(ctx))
+
+	// Everything else is moved out of the event stream
+	fmt.Fprintln(ios.Out, "not an event")
+	assert.Equal(t, "not an event\n", errOut.String())
+
+	sl := Create(ctx, 2, true)
+	defer sl.Destroy(false)
+
+	m := &fly.Machine{
+		ID:     "m1",
+		Region: "ord",
+		Config: &fly.MachineConfig{Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: "web"}},
+	}
+
+	first := NewContext(ctx, sl.Line(0))
+	LogfStatus(first, StatusRunning, "Updating \x1b[1m%s\x1b[0m", m.ID)
+	LogEvent(first, MachineEvent(EventMachineUpdated, m))
+
+	second := NewContext(ctx, sl.Line(1))
+	Failed(second, errors.New("boom"))
+
+	var events []Event
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 3)
+
+	assert.Equal(t, EventLog, events[0].Type)
+	assert.Equal(t, "Updating m1", events[0].Message)
+	assert.Equal(t, "running", events[0].Status)
+	assert.False(t, events[0].Time.IsZero())
+
+	assert.Equal(t, EventMachineUpdated, events[1].Type)
+	assert.Equal(t, "m1", events[1].MachineID)
+	assert.Equal(t, "web", events[1].ProcessGroup)
+	assert.Equal(t, "ord", events[1].Region)
+
+	assert.Equal(t, EventFailed, events[2].Type)
+	assert.Equal(t, 1, events[2].Line)
+	assert.Equal(t, "failure", events[2].Status)
+	assert.Equal(t, "boom", events[2].Error)
+}
+
+func TestLogEventWithoutLine(t *testing.T) {
+	ios, _, out, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	LogEvent(ctx, Event{Type: EventLog})
+	assert.Empty(t, out.String())
+}
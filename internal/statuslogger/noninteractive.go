@@ -61,4 +61,7 @@ func (line *noninteractiveLine) setStatus(s Status) {
 	line.status = s
 }
 
+// event is a no-op for non-interactive loggers, the same progress is logged as text.
+func (line *noninteractiveLine) event(_ Event) {}
+
 func (nl *noninteractiveLogger) Pause() ResumeFn { return func() {} }
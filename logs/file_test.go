@@ -0,0 +1,57 @@
+package logs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryWriterRoundTrip(t *testing.T) {
+	entries := []LogEntry{
+		{Level: "info", Instance: "m1", Message: "one", Region: "ord", Timestamp: "2024-05-01T12:00:00Z"},
+		{Level: "error", Instance: "m2", Message: "two\nlines", Region: "ams", Timestamp: "2024-05-01T12:00:01Z"},
+	}
+
+	var buf bytes.Buffer
+	w := NewEntryWriter(&buf)
+	for _, e := range entries {
+		require.NoError(t, w.Write(e))
+	}
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	var read []LogEntry
+	require.NoError(t, ReadEntries(&buf, func(e LogEntry) error {
+		read = append(read, e)
+		return nil
+	}))
+	assert.Equal(t, entries, read)
+
+	err := ReadEntries(bytes.NewBufferString("{}\nnot json\n"), func(LogEntry) error { return nil })
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	read := func(p string) string {
+		b, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "dddddd\n", read(path))
+	assert.Equal(t, "cccccc\n", read(path+".1"))
+	assert.Equal(t, "bbbbbb\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+}
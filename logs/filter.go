@@ -0,0 +1,105 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// levelSeverity orders the log levels emitted by apps and the platform.
+// Unknown levels are treated as info.
+var levelSeverity = map[string]int{
+	"trace":    0,
+	"debug":    1,
+	"info":     2,
+	"notice":   2,
+	"warn":     3,
+	"warning":  3,
+	"error":    4,
+	"fatal":    5,
+	"critical": 5,
+	"panic":    5,
+}
+
+func severity(level string) int {
+	if s, ok := levelSeverity[strings.ToLower(level)]; ok {
+		return s
+	}
+	return levelSeverity["info"]
+}
+
+// Filter selects log entries on the client side, once they were received from
+// any of the log streams. Zero values disable the corresponding check.
+type Filter struct {
+	// MinLevel drops entries less severe than the given level
+	MinLevel string
+	// Grep keeps only entries whose message matches
+	Grep *regexp.Regexp
+	// Exclude drops entries whose message matches
+	Exclude *regexp.Regexp
+	// Since and Until bound the entry timestamps
+	Since time.Time
+	Until time.Time
+	// Instance, when not nil, keeps only the entries of instances it returns
+	// true for
+	Instance func(instance string) bool
+}
+
+// ValidateLevel returns an error for levels a Filter can't compare entries against
+func ValidateLevel(level string) error {
+	if _, ok := levelSeverity[strings.ToLower(level)]; !ok {
+		return fmt.Errorf("unknown log level '%s'", level)
+	}
+	return nil
+}
+
+// Match reports whether the entry passes every check of the filter.
+func (f *Filter) Match(entry LogEntry) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.MinLevel != "" && severity(entry.Level) < severity(f.MinLevel) {
+		return false
+	}
+
+	if f.Grep != nil && !f.Grep.MatchString(entry.Message) {
+		return false
+	}
+
+	if f.Exclude != nil && f.Exclude.MatchString(entry.Message) {
+		return false
+	}
+
+	if f.Instance != nil && !f.Instance(entry.Instance) {
+		return false
+	}
+
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !f.Since.IsZero() && ts.Before(f.Since) {
+			return false
+		}
+		if !f.Until.IsZero() && ts.After(f.Until) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseTime parses either an RFC3339 timestamp or a duration relative to now,
+// such as "15m", which is subtracted from now.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', use either a duration like 15m or an RFC3339 timestamp like 2006-01-02T15:04:05Z", value)
+}
@@ -0,0 +1,56 @@
+package logs
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMatch(t *testing.T) {
+	entry := LogEntry{
+		Level:     "warn",
+		Instance:  "m1",
+		Message:   "GET /health 200",
+		Timestamp: "2024-05-01T12:00:00Z",
+	}
+
+	var nilFilter *Filter
+	assert.True(t, nilFilter.Match(entry))
+	assert.True(t, (&Filter{}).Match(entry))
+
+	assert.True(t, (&Filter{MinLevel: "info"}).Match(entry))
+	assert.True(t, (&Filter{MinLevel: "warning"}).Match(entry))
+	assert.False(t, (&Filter{MinLevel: "error"}).Match(entry))
+
+	assert.True(t, (&Filter{Grep: regexp.MustCompile(`/health`)}).Match(entry))
+	assert.False(t, (&Filter{Grep: regexp.MustCompile(`^POST`)}).Match(entry))
+	assert.False(t, (&Filter{Exclude: regexp.MustCompile(`/health`)}).Match(entry))
+
+	isM1 := func(instance string) bool { return instance == "m1" }
+	isM2 := func(instance string) bool { return instance == "m2" }
+	assert.True(t, (&Filter{Instance: isM1}).Match(entry))
+	assert.False(t, (&Filter{Instance: isM2}).Match(entry))
+
+	noon := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, (&Filter{Since: noon.Add(-time.Minute), Until: noon.Add(time.Minute)}).Match(entry))
+	assert.False(t, (&Filter{Since: noon.Add(time.Minute)}).Match(entry))
+	assert.False(t, (&Filter{Until: noon.Add(-time.Minute)}).Match(entry))
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	ts, err := ParseTime("15m", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-15*time.Minute), ts)
+
+	ts, err = ParseTime("2024-05-01T10:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-2*time.Hour), ts)
+
+	_, err = ParseTime("yesterday", now)
+	assert.Error(t, err)
+}
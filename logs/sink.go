@@ -0,0 +1,214 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	jbackoff "github.com/jpillora/backoff"
+)
+
+// Sink receives batches of log entries shipped out of a log stream.
+type Sink interface {
+	Send(ctx context.Context, entries []LogEntry) error
+	Close() error
+}
+
+// SinkOptions are settings shared by every kind of sink
+type SinkOptions struct {
+	// AppName identifies the app the shipped entries come from
+	AppName string
+	// Timeout bounds each attempt at sending a batch over the network
+	Timeout time.Duration
+}
+
+// NewSink returns the sink described by to:
+//
+//	file:///path/to/app.log?max_size=100&max_files=5  rotating JSON lines file, sizes in megabytes
+//	syslog+tcp://host:port, syslog+udp://host:port     RFC5424 syslog
+//	http://host/path, https://host/path                 JSON array of entries POSTed per batch
+//	loki+http://host:port, loki+https://host            Loki push API
+func NewSink(to string, opts SinkOptions) (Sink, error) {
+	u, err := url.Parse(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink url %q: %w", to, err)
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	switch u.Scheme {
+	case "file":
+		return newFileSink(u)
+	case "syslog", "syslog+udp":
+		return newSyslogSink("udp", u, opts)
+	case "syslog+tcp":
+		return newSyslogSink("tcp", u, opts)
+	case "http", "https":
+		return newHTTPSink(u, opts), nil
+	case "loki+http", "loki+https":
+		return newLokiSink(u, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported sink %q, use one of file, syslog+tcp, syslog+udp, http, https, loki+http or loki+https", u.Scheme)
+	}
+}
+
+type fileSink struct {
+	file   *RotatingFile
+	writer *EntryWriter
+}
+
+func newFileSink(u *url.URL) (Sink, error) {
+	path := u.Path
+	if path == "" {
+		// file://relative/path puts the first element in the host
+		path = u.Host + u.Opaque
+	} else if u.Host != "" {
+		path = u.Host + path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("file sink requires a path")
+	}
+
+	maxSizeMB, err := queryInt(u, "max_size", 100)
+	if err != nil {
+		return nil, err
+	}
+	maxFiles, err := queryInt(u, "max_files", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := OpenRotatingFile(path, int64(maxSizeMB)*1024*1024, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file, writer: NewEntryWriter(file)}, nil
+}
+
+func queryInt(u *url.URL, name string, def int) (int, error) {
+	raw := u.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q for %s sink: %w", name, raw, u.Scheme, err)
+	}
+	return n, nil
+}
+
+func (s *fileSink) Send(_ context.Context, entries []LogEntry) error {
+	for _, entry := range entries {
+		if err := s.writer.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+// Shipper batches entries and sends them to a sink, retrying failed batches.
+// It stops reading entries while a batch is being sent, so a slow sink pushes
+// back on the log stream instead of buffering without bounds.
+type Shipper struct {
+	Sink Sink
+	// BatchSize is the maximum number of entries sent at once
+	BatchSize int
+	// FlushInterval is the longest time an entry waits for its batch to fill up
+	FlushInterval time.Duration
+	// Attempts is how many times a batch is sent before it's dropped
+	Attempts uint
+	Backoff  *jbackoff.Backoff
+	// OnDrop is called with the last error when a batch is dropped
+	OnDrop func(err error, dropped int)
+}
+
+// Run ships entries until in is closed or ctx is done, then flushes the pending batch.
+func (s *Shipper) Run(ctx context.Context, in <-chan LogEntry) error {
+	batchSize := s.BatchSize
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	flushInterval := s.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	batch := make([]LogEntry, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		s.send(ctx, batch)
+		batch = make([]LogEntry, 0, batchSize)
+	}
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Give the pending entries a last chance to make it out
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushInterval)
+			defer cancel()
+			flush(flushCtx)
+			return ctx.Err()
+		case entry, ok := <-in:
+			if !ok {
+				flush(ctx)
+				return nil
+			}
+			batch = append(batch, entry)
+			if len(batch) >= batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+func (s *Shipper) send(ctx context.Context, batch []LogEntry) {
+	attempts := s.Attempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	b := s.Backoff
+	if b == nil {
+		b = &jbackoff.Backoff{Min: 500 * time.Millisecond, Max: 10 * time.Second, Factor: 2, Jitter: true}
+	}
+	b.Reset()
+
+	// Unlike retry.RetryBackoff, waiting between attempts stops with ctx, and
+	// there's no wait after the last one
+	var err error
+	for attempt := uint(1); ; attempt++ {
+		err = s.Sink.Send(ctx, batch)
+		if err == nil || attempt >= attempts || !sleepContext(ctx, b.Duration()) {
+			break
+		}
+	}
+	if err != nil && s.OnDrop != nil {
+		s.OnDrop(err, len(batch))
+	}
+}
+
+// sleepContext waits for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,133 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpSink POSTs every batch as a JSON array of entries
+type httpSink struct {
+	url    *url.URL
+	client *http.Client
+}
+
+func newHTTPSink(u *url.URL, opts SinkOptions) Sink {
+	return &httpSink{url: u, client: &http.Client{Timeout: opts.Timeout}}
+}
+
+func (s *httpSink) Send(ctx context.Context, entries []LogEntry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.client, s.url, body)
+}
+
+func (s *httpSink) Close() error { return nil }
+
+// lokiSink pushes batches to the Loki push API, with one stream per set of labels
+type lokiSink struct {
+	url     *url.URL
+	client  *http.Client
+	appName string
+}
+
+const lokiPushPath = "/loki/api/v1/push"
+
+func newLokiSink(u *url.URL, opts SinkOptions) Sink {
+	target := *u
+	target.Scheme = strings.TrimPrefix(u.Scheme, "loki+")
+	if target.Path == "" || target.Path == "/" {
+		target.Path = lokiPushPath
+	}
+	return &lokiSink{url: &target, client: &http.Client{Timeout: opts.Timeout}, appName: opts.AppName}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+func (s *lokiSink) push(entries []LogEntry) lokiPush {
+	streams := map[string]*lokiStream{}
+	var keys []string
+	for _, entry := range entries {
+		labels := map[string]string{"app": s.appName, "region": entry.Region, "instance": entry.Instance, "level": entry.Level}
+		for k, v := range labels {
+			if v == "" {
+				delete(labels, k)
+			}
+		}
+		key := fmt.Sprintf("%s|%s|%s|%s", s.appName, entry.Region, entry.Instance, entry.Level)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			ts = time.Now()
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), entry.Message})
+	}
+
+	sort.Strings(keys)
+	push := lokiPush{Streams: make([]*lokiStream, 0, len(keys))}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, streams[key])
+	}
+	return push
+}
+
+func (s *lokiSink) Send(ctx context.Context, entries []LogEntry) error {
+	body, err := json.Marshal(s.push(entries))
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.client, s.url, body)
+}
+
+func (s *lokiSink) Close() error { return nil }
+
+// postJSON sends body to u, using the URL credentials for basic auth if present
+func postJSON(ctx context.Context, client *http.Client, u *url.URL, body []byte) error {
+	target := *u
+	target.User = nil
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s responded with %s: %s", target.Host, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
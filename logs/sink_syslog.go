@@ -0,0 +1,145 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacilityUser is the facility of user-level messages
+const syslogFacilityUser = 1
+
+// syslogSeverity maps log levels to RFC5424 severities
+func syslogSeverity(level string) int {
+	switch strings.ToLower(level) {
+	case "fatal", "panic":
+		return 2
+	case "critical", "error":
+		return 3
+	case "warn", "warning":
+		return 4
+	case "notice":
+		return 5
+	case "debug", "trace":
+		return 7
+	default:
+		return 6
+	}
+}
+
+// syslogSink sends entries as RFC5424 messages. Over TCP, messages are framed
+// with octet counting as described in RFC6587.
+type syslogSink struct {
+	network string
+	addr    string
+	opts    SinkOptions
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink(network string, u *url.URL, opts SinkOptions) (Sink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("syslog sink requires a host")
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "514")
+	}
+	return &syslogSink{network: network, addr: addr, opts: opts}, nil
+}
+
+func (s *syslogSink) Send(ctx context.Context, entries []LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: s.opts.Timeout}
+		conn, err := dialer.DialContext(ctx, s.network, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		msg := formatSyslog(s.opts.AppName, entry)
+		if s.network == "tcp" {
+			fmt.Fprintf(&buf, "%d %s", len(msg), msg)
+			continue
+		}
+		// Every UDP datagram carries a single message
+		if err := s.write([]byte(msg)); err != nil {
+			return err
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return s.write(buf.Bytes())
+}
+
+// write sends b on the current connection, dropping it on failure so the next
+// attempt reconnects.
+func (s *syslogSink) write(b []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.opts.Timeout))
+	if _, err := s.conn.Write(b); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// formatSyslog renders an entry as an RFC5424 message, using the instance as the
+// hostname and the event provider, such as app or runner, as the message ID.
+func formatSyslog(appName string, entry LogEntry) string {
+	pri := syslogFacilityUser*8 + syslogSeverity(entry.Level)
+
+	timestamp := "-"
+	if ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+		timestamp = ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+
+	field := func(value string, maxLen int) string {
+		value = strings.Map(func(r rune) rune {
+			if r < 33 || r > 126 {
+				return -1
+			}
+			return r
+		}, value)
+		if value == "" {
+			return "-"
+		}
+		if len(value) > maxLen {
+			value = value[:maxLen]
+		}
+		return value
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s - %s",
+		pri,
+		timestamp,
+		field(entry.Instance, 255),
+		field(appName, 48),
+		field(entry.Meta.Event.Provider, 32),
+		strings.TrimRight(entry.Message, "\n"),
+	)
+}
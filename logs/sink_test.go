@@ -0,0 +1,215 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jbackoff "github.com/jpillora/backoff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sinkEntries = []LogEntry{
+	{Level: "info", Instance: "m1", Region: "ord", Message: "hello", Timestamp: "2024-05-01T12:00:00Z"},
+	{Level: "error", Instance: "m1", Region: "ord", Message: "oops\n", Timestamp: "2024-05-01T12:00:01.5Z"},
+	{Level: "info", Instance: "m2", Region: "ams", Message: "hi", Timestamp: "2024-05-01T12:00:02Z"},
+}
+
+func TestNewSink(t *testing.T) {
+	for _, to := range []string{"ftp://example.com", "syslog+tcp://", "file://"} {
+		_, err := NewSink(to, SinkOptions{})
+		assert.Error(t, err, to)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	sink, err := NewSink("file://"+path+"?max_files=1", SinkOptions{})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.Background(), sinkEntries))
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var read []LogEntry
+	require.NoError(t, ReadEntries(f, func(e LogEntry) error {
+		read = append(read, e)
+		return nil
+	}))
+	assert.Equal(t, sinkEntries, read)
+}
+
+func TestFormatSyslog(t *testing.T) {
+	entry := sinkEntries[1]
+	entry.Meta.Event.Provider = "app"
+	assert.Equal(t, "<11>1 2024-05-01T12:00:01.500000Z m1 my-app - app - oops", formatSyslog("my-app", entry))
+	assert.Equal(t, "<14>1 - - - - - - ", formatSyslog("", LogEntry{}))
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 256)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _ := io.ReadAtLeast(conn, buf, 1)
+		received <- string(buf[:n])
+	}()
+
+	sink, err := NewSink("syslog+tcp://"+ln.Addr().String(), SinkOptions{AppName: "my-app"})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.Background(), sinkEntries[:1]))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "55 <14>1 2024-05-01T12:00:00.000000Z m1 my-app - - - hello", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+	}
+}
+
+func TestLokiSink(t *testing.T) {
+	var push lokiPush
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "secret", password)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&push))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink("loki+http://user:secret@"+server.Listener.Addr().String(), SinkOptions{AppName: "my-app"})
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.Background(), sinkEntries))
+
+	require.Len(t, push.Streams, 3)
+	assert.Equal(t, map[string]string{"app": "my-app", "region": "ams", "instance": "m2", "level": "info"}, push.Streams[0].Stream)
+	assert.Equal(t, map[string]string{"app": "my-app", "region": "ord", "instance": "m1", "level": "error"}, push.Streams[1].Stream)
+	assert.Equal(t, [][2]string{{"1714564801500000000", "oops\n"}}, push.Streams[1].Values)
+}
+
+func TestHTTPSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entries []LogEntry
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&entries))
+		assert.Len(t, entries, 3)
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL+"/ingest", SinkOptions{})
+	require.NoError(t, err)
+	err = sink.Send(context.Background(), sinkEntries)
+	assert.ErrorContains(t, err, "429 Too Many Requests: slow down")
+}
+
+type recordingSink struct {
+	mu       sync.Mutex
+	batches  [][]LogEntry
+	failures int
+}
+
+func (s *recordingSink) Send(_ context.Context, entries []LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, entries)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestShipper(t *testing.T) {
+	sink := &recordingSink{failures: 1}
+	var dropped int
+	shipper := &Shipper{
+		Sink:          sink,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		Attempts:      2,
+		Backoff:       &jbackoff.Backoff{Min: time.Millisecond, Max: time.Millisecond},
+		OnDrop:        func(_ error, n int) { dropped += n },
+	}
+
+	in := make(chan LogEntry)
+	go func() {
+		for _, e := range sinkEntries {
+			in <- e
+		}
+		close(in)
+	}()
+	require.NoError(t, shipper.Run(context.Background(), in))
+
+	assert.Zero(t, dropped)
+	require.Len(t, sink.batches, 2)
+	assert.Equal(t, sinkEntries[:2], sink.batches[0])
+	assert.Equal(t, sinkEntries[2:], sink.batches[1])
+
+	// Batches are dropped once every attempt failed
+	sink = &recordingSink{failures: 2}
+	shipper.Sink = sink
+	in = make(chan LogEntry, 1)
+	in <- sinkEntries[0]
+	close(in)
+	require.NoError(t, shipper.Run(context.Background(), in))
+	assert.Equal(t, 1, dropped)
+	assert.Empty(t, sink.batches)
+}
+
+func TestShipperCancelBackoff(t *testing.T) {
+	sink := &recordingSink{failures: 10}
+	var dropped int
+	shipper := &Shipper{
+		Sink:          sink,
+		BatchSize:     1,
+		FlushInterval: 50 * time.Millisecond,
+		Attempts:      5,
+		Backoff:       &jbackoff.Backoff{Min: time.Minute, Max: time.Minute},
+		OnDrop:        func(_ error, n int) { dropped += n },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan LogEntry, 1)
+	in <- sinkEntries[0]
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// Cancelling interrupts the wait between attempts, and the final flush
+	// doesn't wait after its last attempt either
+	start := time.Now()
+	assert.ErrorIs(t, shipper.Run(ctx, in), context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 1, dropped)
+
+	shipper.Attempts = 1
+	in <- sinkEntries[1]
+	close(in)
+	start = time.Now()
+	require.NoError(t, shipper.Run(context.Background(), in))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 2, dropped)
+}
@@ -3,12 +3,19 @@ package proxy
 import (
 	"context"
 	"fmt"
+	stdio "io"
 	"net"
 	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/superfly/flyctl/agent"
 	"github.com/superfly/flyctl/internal/flyutil"
 	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/ip"
 )
@@ -23,6 +30,18 @@ type ConnectParams struct {
 	PromptInstance   bool
 	DisableSpinner   bool
 	Network          string
+
+	// Mappings, StatsInterval and UDPIdleTimeout are only used by ConnectMappings
+	Mappings       []Mapping
+	StatsInterval  time.Duration
+	UDPIdleTimeout time.Duration
+}
+
+// mappingServer is implemented by Server and UDPServer
+type mappingServer interface {
+	ProxyServer(ctx context.Context) error
+	stats() *Stats
+	close() error
 }
 
 // Binds to a local port and runs a proxy to a remote address over Wireguard.
@@ -95,39 +114,198 @@ func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 		remoteAddr = fmt.Sprintf("[%s]:%s", p.RemoteHost, remotePort)
 	}
 
-	var listener net.Listener
+	listener, err := listen(localBindAddr, localPort)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := strconv.Atoi(localPort); err == nil {
-		// just numbers
-		addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%s", localBindAddr, localPort))
-		if err != nil {
-			return nil, err
+	fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", localPort, remoteAddr)
+
+	return &Server{
+		Addr:     remoteAddr,
+		Listener: listener,
+		Dial:     p.Dialer.DialContext,
+	}, nil
+}
+
+// ConnectMappings binds every mapping and proxies them over Wireguard until ctx
+// is cancelled. Hosts are resolved through the agent for every connection, and
+// the tunnel is reestablished when dialing fails. Connection counts and bytes
+// transferred are printed on exit and, if positive, every StatsInterval.
+func ConnectMappings(ctx context.Context, p *ConnectParams) (err error) {
+	var (
+		io     = iostreams.FromContext(ctx)
+		client = flyutil.ClientFromContext(ctx)
+		host   = p.RemoteHost
+	)
+
+	agentclient, err := agent.Establish(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if p.PromptInstance {
+		if host, err = selectInstance(ctx, p.OrganizationSlug, p.AppName, agentclient); err != nil {
+			return err
 		}
+	}
 
-		listener, err = net.ListenTCP("tcp", addr)
+	t := &tunnel{client: agentclient, slug: p.OrganizationSlug, network: p.Network}
+	servers := make([]mappingServer, 0, len(p.Mappings))
+	mappings := make([]Mapping, 0, len(p.Mappings))
+	defer func() {
 		if err != nil {
-			return nil, err
+			for _, srv := range servers {
+				srv.close()
+			}
 		}
-	} else {
-		// probably a unix path
-		addr, err := net.ResolveUnixAddr("unix", localPort)
-		if err != nil {
-			return nil, err
+	}()
+
+	waited := map[string]bool{}
+	for _, m := range p.Mappings {
+		m = m.WithDefaultHost(host)
+		if m.RemoteHost == "" {
+			return fmt.Errorf("mapping %s: missing remote host", m)
 		}
 
-		listener, err = net.ListenUnix("unix", addr)
+		var resolve func(ctx context.Context, host string) (string, error)
+		if !ip.IsV6(m.RemoteHost) {
+			resolve = t.resolve
+			if !waited[m.RemoteHost] {
+				if err = agentclient.WaitForDNS(ctx, p.Dialer, p.OrganizationSlug, m.RemoteHost, p.Network); err != nil {
+					return fmt.Errorf("%s: %w", m.RemoteHost, err)
+				}
+				waited[m.RemoteHost] = true
+			}
+		}
+
+		if m.UDP {
+			conn, err := net.ListenPacket("udp", net.JoinHostPort(p.BindAddr, m.LocalPort))
+			if err != nil {
+				return fmt.Errorf("mapping %s: %w", m, err)
+			}
+			servers = append(servers, &UDPServer{
+				Addr:        m.RemoteAddr(),
+				Conn:        conn,
+				Dial:        p.Dialer.DialContext,
+				Resolve:     resolve,
+				Reestablish: t.reestablish,
+				IdleTimeout: p.UDPIdleTimeout,
+			})
+			fmt.Fprintf(io.Out, "Proxying local UDP port %s to remote %s\n", m.LocalPort, m.RemoteAddr())
+		} else {
+			listener, err := listen(p.BindAddr, m.LocalPort)
+			if err != nil {
+				return fmt.Errorf("mapping %s: %w", m, err)
+			}
+			servers = append(servers, &Server{
+				LocalAddr:   listener.Addr().String(),
+				Addr:        m.RemoteAddr(),
+				Listener:    listener,
+				Dial:        p.Dialer.DialContext,
+				Resolve:     resolve,
+				Reestablish: t.reestablish,
+			})
+			fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", m.LocalPort, m.RemoteAddr())
+		}
+		mappings = append(mappings, m)
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, srv := range servers {
+		srv := srv
+		eg.Go(func() error {
+			return srv.ProxyServer(ctx)
+		})
+	}
+	if p.StatsInterval > 0 {
+		eg.Go(func() error {
+			ticker := time.NewTicker(p.StatsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+					renderStats(io.Out, mappings, servers)
+				}
+			}
+		})
+	}
+
+	err = eg.Wait()
+	renderStats(io.Out, mappings, servers)
+	return err
+}
+
+func renderStats(w stdio.Writer, mappings []Mapping, servers []mappingServer) {
+	rows := make([][]string, 0, len(servers))
+	for i, srv := range servers {
+		stats := srv.stats()
+		rows = append(rows, []string{
+			mappings[i].String(),
+			strconv.FormatInt(stats.Connections.Load(), 10),
+			strconv.FormatInt(stats.Active.Load(), 10),
+			strconv.FormatInt(stats.Failed.Load(), 10),
+			humanize.Bytes(uint64(stats.BytesSent.Load())),
+			humanize.Bytes(uint64(stats.BytesReceived.Load())),
+		})
+	}
+	render.Table(w, "", rows, "Mapping", "Connections", "Active", "Failed", "Sent", "Received")
+}
+
+// reestablishInterval is how long a reestablished tunnel is trusted before
+// another failed dial reestablishes it again
+const reestablishInterval = 5 * time.Second
+
+// tunnel resolves hosts and reestablishes the WireGuard tunnel of an
+// organization through the agent, on behalf of every mapping.
+type tunnel struct {
+	client  *agent.Client
+	slug    string
+	network string
+
+	mu            sync.Mutex
+	reestablished time.Time
+}
+
+func (t *tunnel) resolve(ctx context.Context, host string) (string, error) {
+	return t.client.Resolve(ctx, t.slug, host, t.network)
+}
+
+func (t *tunnel) reestablish(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Connections failing at the same time only need the tunnel reestablished once
+	if time.Since(t.reestablished) < reestablishInterval {
+		return nil
+	}
+	t.reestablished = time.Now()
+
+	if _, err := t.client.Reestablish(ctx, t.slug, t.network); err != nil {
+		return err
+	}
+	return t.client.WaitForTunnel(ctx, t.slug, t.network)
+}
+
+// listen binds to localPort on bindAddr, or to a unix socket if localPort isn't a number
+func listen(bindAddr, localPort string) (net.Listener, error) {
+	if _, err := strconv.Atoi(localPort); err == nil {
+		// just numbers
+		addr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(bindAddr, localPort))
 		if err != nil {
 			return nil, err
 		}
+		return net.ListenTCP("tcp", addr)
 	}
 
-	fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", localPort, remoteAddr)
-
-	return &Server{
-		Addr:     remoteAddr,
-		Listener: listener,
-		Dial:     p.Dialer.DialContext,
-	}, nil
+	// probably a unix path
+	addr, err := net.ResolveUnixAddr("unix", localPort)
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenUnix("unix", addr)
 }
 
 func selectInstance(ctx context.Context, org, app string, c *agent.Client) (instance string, err error) {
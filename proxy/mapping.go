@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Mapping forwards a local port, or unix socket path, to a port on a remote host
+type Mapping struct {
+	Name       string
+	LocalPort  string
+	RemoteHost string
+	RemotePort string
+	// UDP forwards datagrams rather than TCP connections
+	UDP bool
+}
+
+// ParseMapping parses mappings written as local[:remote] or local:host:remote,
+// with IPv6 hosts in brackets, e.g. 5432:[fdaa::3]:5432.
+func ParseMapping(spec string) (Mapping, error) {
+	var m Mapping
+
+	if start := strings.Index(spec, ":["); start >= 0 {
+		end := strings.Index(spec, "]:")
+		if end < start {
+			return m, fmt.Errorf("invalid port mapping %q", spec)
+		}
+		m = Mapping{LocalPort: spec[:start], RemoteHost: spec[start+2 : end], RemotePort: spec[end+2:]}
+		return m, m.validate()
+	}
+
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		m = Mapping{LocalPort: parts[0], RemotePort: parts[0]}
+	case 2:
+		m = Mapping{LocalPort: parts[0], RemotePort: parts[1]}
+	case 3:
+		m = Mapping{LocalPort: parts[0], RemoteHost: parts[1], RemotePort: parts[2]}
+	default:
+		return m, fmt.Errorf("invalid port mapping %q, expected local[:remote] or local:host:remote", spec)
+	}
+
+	return m, m.validate()
+}
+
+func (m Mapping) validate() error {
+	if m.LocalPort == "" {
+		return fmt.Errorf("mapping %s: missing local port", m)
+	}
+	if port, err := strconv.Atoi(m.RemotePort); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("mapping %s: invalid remote port %q", m, m.RemotePort)
+	}
+	if _, err := strconv.Atoi(m.LocalPort); err != nil && m.UDP {
+		return fmt.Errorf("mapping %s: UDP requires a local port number", m)
+	}
+	return nil
+}
+
+// WithDefaultHost returns m with host as its remote host unless it names one already
+func (m Mapping) WithDefaultHost(host string) Mapping {
+	if m.RemoteHost == "" {
+		m.RemoteHost = host
+	}
+	return m
+}
+
+// RemoteAddr returns the host and port the mapping forwards to
+func (m Mapping) RemoteAddr() string {
+	return fmt.Sprintf("[%s]:%s", m.RemoteHost, m.RemotePort)
+}
+
+func (m Mapping) String() string {
+	if m.Name != "" {
+		return m.Name
+	}
+
+	s := fmt.Sprintf("%s:%s", m.LocalPort, m.RemotePort)
+	if m.RemoteHost != "" {
+		s = fmt.Sprintf("%s:%s:%s", m.LocalPort, m.RemoteHost, m.RemotePort)
+	}
+	if m.UDP {
+		s += "/udp"
+	}
+	return s
+}
+
+// ParseUDPMapping is ParseMapping for mappings forwarding UDP
+func ParseUDPMapping(spec string) (Mapping, error) {
+	m, err := ParseMapping(spec)
+	if err != nil {
+		return m, err
+	}
+	m.UDP = true
+	return m, m.validate()
+}
+
+// mappingEntry is a mapping as written in a proxies file. Ports are
+// accepted both as numbers and strings.
+type mappingEntry struct {
+	Name     string `toml:"name" yaml:"name"`
+	Local    any    `toml:"local" yaml:"local"`
+	Remote   any    `toml:"remote" yaml:"remote"`
+	Host     string `toml:"host" yaml:"host"`
+	Protocol string `toml:"protocol" yaml:"protocol"`
+}
+
+// LoadMappings reads the proxies section of a TOML or YAML file, such as
+//
+//	[[proxies]]
+//	name = "db"
+//	local = 15432
+//	remote = 5432
+//	host = "my-db.flycast"
+//	protocol = "tcp" # or "udp"
+//
+// YAML is used for files with a .yaml or .yml extension.
+func LoadMappings(path string) ([]Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Proxies []mappingEntry `toml:"proxies" yaml:"proxies"`
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = toml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(file.Proxies) == 0 {
+		return nil, fmt.Errorf("%s has no proxies", path)
+	}
+
+	mappings := make([]Mapping, 0, len(file.Proxies))
+	for i, entry := range file.Proxies {
+		m := Mapping{
+			Name:       entry.Name,
+			LocalPort:  portString(entry.Local),
+			RemoteHost: entry.Host,
+			RemotePort: portString(entry.Remote),
+		}
+		if m.RemotePort == "" {
+			m.RemotePort = m.LocalPort
+		}
+		switch strings.ToLower(entry.Protocol) {
+		case "", "tcp":
+		case "udp":
+			m.UDP = true
+		default:
+			return nil, fmt.Errorf("%s: proxy #%d: unsupported protocol %q, expected tcp or udp", path, i+1, entry.Protocol)
+		}
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("%s: proxy #%d: %w", path, i+1, err)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+func portString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
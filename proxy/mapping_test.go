@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMapping(t *testing.T) {
+	cases := map[string]Mapping{
+		"5432":                   {LocalPort: "5432", RemotePort: "5432"},
+		"15432:5432":             {LocalPort: "15432", RemotePort: "5432"},
+		"6379:redis.flycast:80":  {LocalPort: "6379", RemoteHost: "redis.flycast", RemotePort: "80"},
+		"5432:[fdaa::3]:5433":    {LocalPort: "5432", RemoteHost: "fdaa::3", RemotePort: "5433"},
+		"/tmp/app.sock:8080":     {LocalPort: "/tmp/app.sock", RemotePort: "8080"},
+		"8080:db.internal:65535": {LocalPort: "8080", RemoteHost: "db.internal", RemotePort: "65535"},
+	}
+	for spec, expected := range cases {
+		m, err := ParseMapping(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, expected, m, spec)
+	}
+
+	for _, spec := range []string{"", "my-app.internal", "80:0", "80:70000", "1:2:3:4", "80:[fdaa::3:80"} {
+		_, err := ParseMapping(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseUDPMapping(t *testing.T) {
+	m, err := ParseUDPMapping("5353:dns.internal:53")
+	require.NoError(t, err)
+	assert.Equal(t, Mapping{LocalPort: "5353", RemoteHost: "dns.internal", RemotePort: "53", UDP: true}, m)
+	assert.Equal(t, "5353:dns.internal:53/udp", m.String())
+
+	_, err = ParseUDPMapping("/tmp/dns.sock:53")
+	assert.ErrorContains(t, err, "UDP requires a local port number")
+}
+
+func TestMappingWithDefaultHost(t *testing.T) {
+	m := Mapping{LocalPort: "80", RemotePort: "8080"}.WithDefaultHost("app.internal")
+	assert.Equal(t, "[app.internal]:8080", m.RemoteAddr())
+	assert.Equal(t, "80:app.internal:8080", m.String())
+
+	m = Mapping{Name: "db", LocalPort: "80", RemoteHost: "db.flycast", RemotePort: "5432"}.WithDefaultHost("app.internal")
+	assert.Equal(t, "[db.flycast]:5432", m.RemoteAddr())
+	assert.Equal(t, "db", m.String())
+}
+
+func TestLoadMappings(t *testing.T) {
+	dir := t.TempDir()
+	expected := []Mapping{
+		{Name: "db", LocalPort: "15432", RemoteHost: "my-db.flycast", RemotePort: "5432"},
+		{LocalPort: "8080", RemotePort: "8080"},
+		{LocalPort: "5353", RemotePort: "5353", UDP: true},
+	}
+
+	tomlPath := filepath.Join(dir, "proxies.toml")
+	require.NoError(t, os.WriteFile(tomlPath, []byte(`
+[[proxies]]
+name = "db"
+local = 15432
+remote = "5432"
+host = "my-db.flycast"
+
+[[proxies]]
+local = 8080
+
+[[proxies]]
+local = 5353
+protocol = "udp"
+`), 0o600))
+	mappings, err := LoadMappings(tomlPath)
+	require.NoError(t, err)
+	assert.Equal(t, expected, mappings)
+
+	yamlPath := filepath.Join(dir, "proxies.yml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+proxies:
+  - name: db
+    local: 15432
+    remote: 5432
+    host: my-db.flycast
+  - local: "8080"
+  - local: 5353
+    protocol: udp
+`), 0o600))
+	mappings, err = LoadMappings(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, expected, mappings)
+
+	sctpPath := filepath.Join(dir, "sctp.toml")
+	require.NoError(t, os.WriteFile(sctpPath, []byte("[[proxies]]\nlocal = 80\nprotocol = \"sctp\"\n"), 0o600))
+	_, err = LoadMappings(sctpPath)
+	assert.ErrorContains(t, err, "unsupported protocol")
+
+	invalidPath := filepath.Join(dir, "invalid.toml")
+	require.NoError(t, os.WriteFile(invalidPath, []byte("[[proxies]]\nremote = 80\n"), 0o600))
+	_, err = LoadMappings(invalidPath)
+	assert.ErrorContains(t, err, "proxy #1")
+
+	emptyPath := filepath.Join(dir, "empty.toml")
+	require.NoError(t, os.WriteFile(emptyPath, nil, 0o600))
+	_, err = LoadMappings(emptyPath)
+	assert.ErrorContains(t, err, "has no proxies")
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/superfly/flyctl/terminal"
@@ -16,6 +17,22 @@ type Server struct {
 	Addr      string
 	Listener  net.Listener
 	Dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Resolve, when set, looks up the host of Addr anew for every connection
+	Resolve func(ctx context.Context, host string) (string, error)
+	// Reestablish, when set, is called after a failed dial, which is then attempted once more
+	Reestablish func(ctx context.Context) error
+
+	Stats Stats
+}
+
+// Stats counts the connections, or UDP sessions, and bytes a server proxied
+type Stats struct {
+	Connections   atomic.Int64
+	Active        atomic.Int64
+	Failed        atomic.Int64
+	BytesSent     atomic.Int64
+	BytesReceived atomic.Int64
 }
 
 func (srv *Server) ProxyServer(ctx context.Context) error {
@@ -43,42 +60,91 @@ func (srv *Server) ProxyServer(ctx context.Context) error {
 					continue
 				}
 				terminal.Debug("Error accepting connection: ", err)
+				continue
 			}
 			terminal.Debug("accepted new connection from: ", source.RemoteAddr())
 
-			go func() {
-				defer source.Close() //skipcq: GO-S2307
+			go srv.handle(ctx, source)
+		}
+	}
+}
 
-				target, err := srv.Dial(ctx, "tcp", srv.Addr)
-				if err != nil {
-					terminal.Debug("failed to connect to target: ", err)
-					return
-				}
-				defer target.Close() //skipcq: GO-S2307
+func (srv *Server) handle(ctx context.Context, source net.Conn) {
+	defer source.Close() //skipcq: GO-S2307
 
-				wg := &sync.WaitGroup{}
+	srv.Stats.Connections.Add(1)
+	srv.Stats.Active.Add(1)
+	defer srv.Stats.Active.Add(-1)
 
-				wg.Add(2)
+	target, err := dialTarget(ctx, "tcp", srv.Addr, srv.Dial, srv.Resolve, srv.Reestablish)
+	if err != nil {
+		srv.Stats.Failed.Add(1)
+		terminal.Debug("failed to connect to target: ", err)
+		return
+	}
+	defer target.Close() //skipcq: GO-S2307
 
-				copyFunc := func(dst net.Conn, src net.Conn) {
-					defer wg.Done()
-					io.Copy(dst, src)
+	wg := &sync.WaitGroup{}
 
-					// close the write half if it exports a CloseWrite() method
-					if conn, ok := dst.(ClosableWrite); ok {
-						conn.CloseWrite()
-					}
-				}
+	wg.Add(2)
+
+	copyFunc := func(dst net.Conn, src net.Conn, counter *atomic.Int64) {
+		defer wg.Done()
+		n, _ := io.Copy(dst, src)
+		counter.Add(n)
+
+		// close the write half if it exports a CloseWrite() method
+		if conn, ok := dst.(ClosableWrite); ok {
+			conn.CloseWrite()
+		}
+	}
+
+	go copyFunc(target, source, &srv.Stats.BytesSent)
+	go copyFunc(source, target, &srv.Stats.BytesReceived)
 
-				go copyFunc(target, source)
-				go copyFunc(source, target)
+	wg.Wait()
+
+	terminal.Debug("connection closed")
+}
 
-				wg.Wait()
+func (srv *Server) stats() *Stats {
+	return &srv.Stats
+}
+
+func (srv *Server) close() error {
+	return srv.Listener.Close()
+}
+
+// dialTarget dials addr, resolving its host first if resolve is set. When
+// dialing fails and reestablish is set, it's called before dialing once more.
+func dialTarget(ctx context.Context, network, addr string,
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+	resolve func(ctx context.Context, host string) (string, error),
+	reestablish func(ctx context.Context) error,
+) (net.Conn, error) {
+	attempt := func() (net.Conn, error) {
+		target := addr
+		if resolve != nil {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			if host, err = resolve(ctx, host); err != nil {
+				return nil, err
+			}
+			target = net.JoinHostPort(host, port)
+		}
+		return dial(ctx, network, target)
+	}
 
-				terminal.Debug("connection closed")
-			}()
+	conn, err := attempt()
+	if err != nil && reestablish != nil && ctx.Err() == nil {
+		terminal.Debug("failed to connect to target, reestablishing tunnel: ", err)
+		if err = reestablish(ctx); err == nil {
+			conn, err = attempt()
 		}
 	}
+	return conn, err
 }
 
 type ClosableWrite interface {
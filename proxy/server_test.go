@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer accepts connections and writes back whatever it reads
+func echoServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestProxyServer(t *testing.T) {
+	echo := echoServer(t)
+	_, port, err := net.SplitHostPort(echo.Addr().String())
+	require.NoError(t, err)
+
+	listener, err := listen("127.0.0.1", "0")
+	require.NoError(t, err)
+
+	var (
+		dials        atomic.Int32
+		reestablishs atomic.Int32
+		resolved     atomic.Value
+	)
+	srv := &Server{
+		Addr:     net.JoinHostPort("echo.internal", port),
+		Listener: listener,
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			// The first dial fails, as a dropped tunnel would
+			if dials.Add(1) == 1 {
+				return nil, errors.New("tunnel down")
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		Resolve: func(ctx context.Context, host string) (string, error) {
+			resolved.Store(host)
+			return "127.0.0.1", nil
+		},
+		Reestablish: func(ctx context.Context) error {
+			reestablishs.Add(1)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.ProxyServer(ctx) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	assert.Equal(t, "echo.internal", resolved.Load())
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	conn.Close()
+
+	assert.Eventually(t, func() bool { return srv.Stats.Active.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, srv.Stats.Connections.Load())
+	assert.EqualValues(t, 0, srv.Stats.Failed.Load())
+	assert.EqualValues(t, 5, srv.Stats.BytesSent.Load())
+	assert.EqualValues(t, 5, srv.Stats.BytesReceived.Load())
+	assert.EqualValues(t, 2, dials.Load())
+	assert.EqualValues(t, 1, reestablishs.Load())
+
+	cancel()
+	require.NoError(t, <-done)
+}
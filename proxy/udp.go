@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/flyctl/terminal"
+)
+
+// DefaultUDPIdleTimeout is how long a UDP client session is kept without traffic
+const DefaultUDPIdleTimeout = time.Minute
+
+// maxDatagramSize fits any UDP payload
+const maxDatagramSize = 65535
+
+// UDPServer forwards datagrams received on Conn to Addr. Each client gets its
+// own session, with a separate connection to Addr so replies can be sent back
+// to the client they're meant for. Sessions are closed after IdleTimeout
+// without traffic in either direction.
+type UDPServer struct {
+	Addr        string
+	Conn        net.PacketConn
+	Dial        func(ctx context.Context, network, addr string) (net.Conn, error)
+	Resolve     func(ctx context.Context, host string) (string, error)
+	Reestablish func(ctx context.Context) error
+	IdleTimeout time.Duration
+
+	Stats Stats
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+}
+
+type udpSession struct {
+	client     net.Addr
+	packets    chan []byte
+	lastActive atomic.Int64
+	cancel     context.CancelFunc
+}
+
+func (s *udpSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+func (srv *UDPServer) ProxyServer(ctx context.Context) error {
+	defer srv.Conn.Close() //skipcq: GO-S2307
+
+	srv.mu.Lock()
+	srv.sessions = map[string]*udpSession{}
+	srv.mu.Unlock()
+	defer srv.closeSessions()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		select {
+
+		case <-ctx.Done():
+			return nil
+		default:
+			if err := srv.Conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+				return err
+			}
+
+			n, client, err := srv.Conn.ReadFrom(buf)
+			srv.expireSessions()
+			if err != nil {
+				if os.IsTimeout(err) {
+					continue
+				}
+				if errors.Is(err, net.ErrClosed) {
+					return nil
+				}
+				terminal.Debug("Error reading datagram: ", err)
+				continue
+			}
+
+			packet := make([]byte, n)
+			copy(packet, buf[:n])
+
+			session := srv.session(ctx, client)
+			select {
+			case session.packets <- packet:
+			default:
+				// The session can't keep up; drop the datagram as the network would
+				terminal.Debug("dropped datagram from: ", client)
+			}
+		}
+	}
+}
+
+// session returns the session of client, starting it if needed
+func (srv *UDPServer) session(ctx context.Context, client net.Addr) *udpSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if session, ok := srv.sessions[client.String()]; ok {
+		session.touch()
+		return session
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	session := &udpSession{
+		client:  client,
+		packets: make(chan []byte, 64),
+		cancel:  cancel,
+	}
+	session.touch()
+	srv.sessions[client.String()] = session
+	terminal.Debug("new UDP session from: ", client)
+
+	go srv.run(ctx, session)
+
+	return session
+}
+
+func (srv *UDPServer) run(ctx context.Context, session *udpSession) {
+	srv.Stats.Connections.Add(1)
+	srv.Stats.Active.Add(1)
+	defer srv.Stats.Active.Add(-1)
+
+	defer func() {
+		session.cancel()
+
+		srv.mu.Lock()
+		if srv.sessions[session.client.String()] == session {
+			delete(srv.sessions, session.client.String())
+		}
+		srv.mu.Unlock()
+
+		terminal.Debug("UDP session closed: ", session.client)
+	}()
+
+	target, err := dialTarget(ctx, "udp", srv.Addr, srv.Dial, srv.Resolve, srv.Reestablish)
+	if err != nil {
+		srv.Stats.Failed.Add(1)
+		terminal.Debug("failed to connect to target: ", err)
+		return
+	}
+	defer target.Close() //skipcq: GO-S2307
+
+	go func() {
+		defer session.cancel()
+
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, err := target.Read(buf)
+			if err != nil {
+				return
+			}
+			session.touch()
+			srv.Stats.BytesReceived.Add(int64(n))
+			if _, err := srv.Conn.WriteTo(buf[:n], session.client); err != nil {
+				terminal.Debug("failed to reply to client: ", err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet := <-session.packets:
+			if _, err := target.Write(packet); err != nil {
+				terminal.Debug("failed to forward datagram: ", err)
+				return
+			}
+			srv.Stats.BytesSent.Add(int64(len(packet)))
+		}
+	}
+}
+
+// expireSessions closes the sessions idle for longer than IdleTimeout
+func (srv *UDPServer) expireSessions() {
+	timeout := srv.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultUDPIdleTimeout
+	}
+	deadline := time.Now().Add(-timeout).UnixNano()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for key, session := range srv.sessions {
+		if session.lastActive.Load() < deadline {
+			session.cancel()
+			delete(srv.sessions, key)
+		}
+	}
+}
+
+func (srv *UDPServer) closeSessions() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, session := range srv.sessions {
+		session.cancel()
+	}
+}
+
+func (srv *UDPServer) stats() *Stats {
+	return &srv.Stats
+}
+
+func (srv *UDPServer) close() error {
+	return srv.Conn.Close()
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// udpEchoServer writes every datagram it receives back to its sender
+func udpEchoServer(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	return conn
+}
+
+func TestUDPServer(t *testing.T) {
+	echo := udpEchoServer(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &UDPServer{
+		Addr: echo.LocalAddr().String(),
+		Conn: conn,
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			assert.Equal(t, "udp", network)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		IdleTimeout: 200 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.ProxyServer(ctx) }()
+
+	exchange := func(client net.Conn, msg string) {
+		t.Helper()
+		_, err := client.Write([]byte(msg))
+		require.NoError(t, err)
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 64)
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(buf[:n]))
+	}
+
+	// Every client gets its own session, and its own replies
+	first, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer second.Close()
+
+	exchange(first, "hello")
+	exchange(second, "hi")
+	exchange(first, "again")
+
+	assert.EqualValues(t, 2, srv.Stats.Connections.Load())
+	assert.EqualValues(t, 12, srv.Stats.BytesSent.Load())
+	assert.Eventually(t, func() bool { return srv.Stats.BytesReceived.Load() == 12 }, time.Second, 10*time.Millisecond)
+
+	// Idle sessions are closed, and reopened on new traffic
+	assert.Eventually(t, func() bool { return srv.Stats.Active.Load() == 0 }, 5*time.Second, 50*time.Millisecond)
+	exchange(first, "back")
+	assert.EqualValues(t, 3, srv.Stats.Connections.Load())
+
+	cancel()
+	require.NoError(t, <-done)
+}
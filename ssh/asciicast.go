@@ -0,0 +1,229 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/azazeal/pause"
+)
+
+// AsciicastHeader is the first line of an asciicast v2 recording
+type AsciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes a terminal session as an asciicast v2 recording: a JSON
+// header line followed by a JSON array per event, holding the seconds since
+// the start, the event type ("o" for output, "i" for input, "r" for resize)
+// and its data. See https://docs.asciinema.org/manual/asciicast/v2/
+type Recorder struct {
+	Title string
+
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	err     error
+	partial map[string][]byte
+}
+
+func NewRecorder(w io.Writer, title string) *Recorder {
+	return &Recorder{Title: title, w: w, partial: map[string][]byte{}}
+}
+
+// Start writes the header. Events are timed from when it's called.
+func (r *Recorder) Start(width, height int, term string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.start = time.Now()
+	header := AsciicastHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     r.Title,
+	}
+	if term != "" {
+		header.Env = map[string]string{"TERM": term}
+	}
+	r.writeLine(header)
+	return r.err
+}
+
+// Output records data written to the terminal
+func (r *Recorder) Output(p []byte) {
+	r.event("o", p)
+}
+
+// Input records data typed into the terminal
+func (r *Recorder) Input(p []byte) {
+	r.event("i", p)
+}
+
+// Resize records the terminal changing size
+func (r *Recorder) Resize(width, height int) {
+	r.event("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+// Err returns the first error writing the recording, after which nothing
+// more is written.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) event(code string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.start.IsZero() {
+		return
+	}
+
+	// Event data is a JSON string, so a UTF-8 sequence split across writes
+	// is held back until it's complete rather than being mangled
+	data := append(r.partial[code], p...)
+	cut := incompleteRuneStart(data)
+	r.partial[code] = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return
+	}
+
+	elapsed := float64(time.Since(r.start).Microseconds()) / 1e6
+	r.writeLine([]any{elapsed, code, string(data[:cut])})
+}
+
+func (r *Recorder) writeLine(v any) {
+	if r.err != nil {
+		return
+	}
+
+	line, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = r.w.Write(append(line, '\n'))
+}
+
+// incompleteRuneStart returns where an incomplete UTF-8 sequence ending p
+// starts, or len(p) if p doesn't end with one.
+func incompleteRuneStart(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// recordingReader records everything read through it as input
+type recordingReader struct {
+	r        io.Reader
+	recorder *Recorder
+}
+
+func (rr recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if n > 0 {
+		rr.recorder.Input(p[:n])
+	}
+	return n, err
+}
+
+// recordingWriter records everything written through it as output
+type recordingWriter struct {
+	w        io.Writer
+	recorder *Recorder
+}
+
+func (rw recordingWriter) Write(p []byte) (int, error) {
+	n, err := rw.w.Write(p)
+	if n > 0 {
+		rw.recorder.Output(p[:n])
+	}
+	return n, err
+}
+
+// Replay writes the output of an asciicast v2 recording to w. Events are
+// spaced as they were originally, divided by speed, with pauses capped to
+// maxIdle when it's positive.
+func Replay(ctx context.Context, r io.Reader, w io.Writer, speed float64, maxIdle time.Duration) (AsciicastHeader, error) {
+	var header AsciicastHeader
+
+	br := bufio.NewReader(r)
+	line, err := br.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return header, err
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return header, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if header.Version != 2 {
+		return header, fmt.Errorf("unsupported asciicast version %d, expected 2", header.Version)
+	}
+
+	var previous float64
+	for lineNum := 2; ; lineNum++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var (
+				event   []json.RawMessage
+				elapsed float64
+				code    string
+				data    string
+			)
+			if err := json.Unmarshal(line, &event); err != nil || len(event) != 3 {
+				return header, fmt.Errorf("invalid asciicast event on line %d", lineNum)
+			}
+			if err := errors.Join(
+				json.Unmarshal(event[0], &elapsed),
+				json.Unmarshal(event[1], &code),
+				json.Unmarshal(event[2], &data),
+			); err != nil {
+				return header, fmt.Errorf("invalid asciicast event on line %d: %w", lineNum, err)
+			}
+
+			if code == "o" {
+				if speed > 0 && elapsed > previous {
+					delay := time.Duration((elapsed - previous) / speed * float64(time.Second))
+					if maxIdle > 0 && delay > maxIdle {
+						delay = maxIdle
+					}
+					pause.For(ctx, delay)
+				}
+				previous = elapsed
+
+				if ctx.Err() != nil {
+					return header, ctx.Err()
+				}
+				if _, err := io.WriteString(w, data); err != nil {
+					return header, err
+				}
+			}
+		}
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return header, nil
+		case err != nil:
+			return header, err
+		}
+	}
+}
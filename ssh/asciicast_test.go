@@ -0,0 +1,74 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf, "my-app")
+
+	// Nothing is recorded before the header
+	r.Output([]byte("early"))
+	require.NoError(t, r.Start(80, 24, "xterm"))
+
+	r.Input([]byte("ls\r"))
+	euro := []byte("€")
+	r.Output(append([]byte("price: "), euro[:2]...))
+	r.Output(append(euro[2:], '\n'))
+	r.Resize(120, 40)
+	require.NoError(t, r.Err())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5)
+
+	var header AsciicastHeader
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, 2, header.Version)
+	assert.Equal(t, 80, header.Width)
+	assert.Equal(t, 24, header.Height)
+	assert.Equal(t, "my-app", header.Title)
+	assert.Equal(t, map[string]string{"TERM": "xterm"}, header.Env)
+
+	expected := [][2]string{{"i", "ls\r"}, {"o", "price: "}, {"o", "€\n"}, {"r", "120x40"}}
+	for i, line := range lines[1:] {
+		var event []any
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		require.Len(t, event, 3)
+		assert.IsType(t, float64(0), event[0])
+		assert.Equal(t, expected[i][0], event[1])
+		assert.Equal(t, expected[i][1], event[2])
+	}
+}
+
+func TestReplay(t *testing.T) {
+	recording := `{"version": 2, "width": 80, "height": 24}
+[0.1, "o", "hello "]
+[0.2, "i", "typed"]
+[0.3, "r", "100x50"]
+[5.0, "o", "world\r\n"]
+`
+
+	var out bytes.Buffer
+	start := time.Now()
+	header, err := Replay(context.Background(), strings.NewReader(recording), &out, 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 80, header.Width)
+	assert.Equal(t, "hello world\r\n", out.String())
+	// The 4.9s pause is cut down to the idle limit
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	_, err = Replay(context.Background(), strings.NewReader(`{"version": 1}`), &out, 0, 0)
+	assert.ErrorContains(t, err, "unsupported asciicast version 1")
+
+	_, err = Replay(context.Background(), strings.NewReader("{\"version\": 2}\n[0.1, \"o\"]\n"), &out, 0, 0)
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 
@@ -119,3 +120,51 @@ func (c *Client) Shell(ctx context.Context, sessIO *SessionIO, cmd string) error
 
 	return sessIO.attach(ctx, sess, cmd)
 }
+
+// Run runs cmd without a terminal, writing its output to stdout and stderr
+// until it exits, and returns its exit status. Errors are only returned when
+// the command couldn't be run or its exit status is unknown.
+func (c *Client) Run(ctx context.Context, cmd string, stdout, stderr io.Writer) (int, error) {
+	return c.Pipe(ctx, cmd, nil, stdout, stderr)
+}
+
+// Pipe is Run with stdin fed to cmd, which sees the end of its input once
+// stdin is drained. No terminal is involved, so binary data passes through
+// untouched.
+func (c *Client) Pipe(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if c.Client == nil {
+		if err := c.Connect(ctx); err != nil {
+			return -1, err
+		}
+	}
+
+	sess, err := c.Client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer sess.Close()
+
+	sess.Stdin = stdin
+	sess.Stdout = stdout
+	sess.Stderr = stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Run(cmd)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	case err := <-done:
+		var exitErr *ssh.ExitError
+		switch {
+		case err == nil:
+			return 0, nil
+		case errors.As(err, &exitErr):
+			return exitErr.ExitStatus(), nil
+		default:
+			return -1, err
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/superfly/flyctl/terminal"
+)
+
+// Forward is an OpenSSH style port forward. Local forwards (-L) listen on this
+// side and connect to Host:Port from the remote host, remote forwards (-R)
+// listen on the remote host and connect to Host:Port from this side.
+type Forward struct {
+	Remote     bool
+	BindAddr   string
+	ListenPort string
+	Host       string
+	Port       string
+}
+
+// ParseForward parses a forward written as [bind_address:]port:host:hostport,
+// with IPv6 addresses in brackets. The bind address defaults to localhost.
+func ParseForward(spec string, remote bool) (Forward, error) {
+	f := Forward{Remote: remote, BindAddr: "localhost"}
+
+	parts := splitForward(spec)
+	switch len(parts) {
+	case 3:
+		f.ListenPort, f.Host, f.Port = parts[0], parts[1], parts[2]
+	case 4:
+		f.BindAddr, f.ListenPort, f.Host, f.Port = parts[0], parts[1], parts[2], parts[3]
+	default:
+		return f, fmt.Errorf("invalid forward %q, expected [bind_address:]port:host:hostport", spec)
+	}
+
+	if port, err := strconv.Atoi(f.ListenPort); err != nil || port < 0 || port > 65535 {
+		return f, fmt.Errorf("invalid forward %q: bad listen port %q", spec, f.ListenPort)
+	}
+	if port, err := strconv.Atoi(f.Port); err != nil || port < 1 || port > 65535 {
+		return f, fmt.Errorf("invalid forward %q: bad port %q", spec, f.Port)
+	}
+	if f.Host == "" {
+		return f, fmt.Errorf("invalid forward %q: missing host", spec)
+	}
+
+	return f, nil
+}
+
+// splitForward splits spec on the colons outside of brackets
+func splitForward(spec string) []string {
+	var (
+		parts     []string
+		part      strings.Builder
+		inBracket bool
+	)
+	for _, r := range spec {
+		switch {
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case r == ':' && !inBracket:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	return append(parts, part.String())
+}
+
+// ListenAddr returns the address the forward listens on
+func (f Forward) ListenAddr() string {
+	return net.JoinHostPort(f.BindAddr, f.ListenPort)
+}
+
+// TargetAddr returns the address the forward connects to
+func (f Forward) TargetAddr() string {
+	return net.JoinHostPort(f.Host, f.Port)
+}
+
+func (f Forward) String() string {
+	if f.Remote {
+		return fmt.Sprintf("remote %s to local %s", f.ListenAddr(), f.TargetAddr())
+	}
+	return fmt.Sprintf("local %s to remote %s", f.ListenAddr(), f.TargetAddr())
+}
+
+// Forward binds the listening side of f and forwards its connections in the
+// background until ctx is done. It returns once listening, with the address
+// bound, which tells the port picked when the forward's port is 0.
+func (c *Client) Forward(ctx context.Context, f Forward) (net.Addr, error) {
+	if c.Client == nil {
+		if err := c.Connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		listener net.Listener
+		dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+		err      error
+	)
+	if f.Remote {
+		listener, err = c.Client.Listen("tcp", f.ListenAddr())
+		dial = (&net.Dialer{}).DialContext
+	} else {
+		listener, err = net.Listen("tcp", f.ListenAddr())
+		dial = c.Client.DialContext
+	}
+	if err != nil {
+		return nil, fmt.Errorf("forward %s: %w", f, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		for {
+			source, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					terminal.Debugf("forward %s: accept: %v\n", f, err)
+				}
+				return
+			}
+
+			go func() {
+				defer source.Close()
+
+				target, err := dial(ctx, "tcp", f.TargetAddr())
+				if err != nil {
+					terminal.Debugf("forward %s: %v\n", f, err)
+					return
+				}
+				defer target.Close()
+
+				pipe(source, target)
+			}()
+		}
+	}()
+
+	return listener.Addr(), nil
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies between a and b until both directions are done
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	copyFunc := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+
+		if conn, ok := dst.(closeWriter); ok {
+			conn.CloseWrite()
+		}
+	}
+
+	go copyFunc(a, b)
+	go copyFunc(b, a)
+
+	wg.Wait()
+}
@@ -0,0 +1,221 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseForward(t *testing.T) {
+	cases := map[string]Forward{
+		"8080:localhost:80":          {BindAddr: "localhost", ListenPort: "8080", Host: "localhost", Port: "80"},
+		"0.0.0.0:6060:10.0.0.1:6060": {BindAddr: "0.0.0.0", ListenPort: "6060", Host: "10.0.0.1", Port: "6060"},
+		"[::1]:9000:[fdaa::3]:9001":  {BindAddr: "::1", ListenPort: "9000", Host: "fdaa::3", Port: "9001"},
+	}
+	for spec, expected := range cases {
+		f, err := ParseForward(spec, false)
+		require.NoError(t, err, spec)
+		assert.Equal(t, expected, f, spec)
+	}
+
+	f, err := ParseForward("9229:localhost:9229", true)
+	require.NoError(t, err)
+	assert.True(t, f.Remote)
+	assert.Equal(t, "remote localhost:9229 to local localhost:9229", f.String())
+
+	for _, spec := range []string{"8080", "8080:80", "x:localhost:80", "8080:localhost:0", "8080::80", "a:b:c:d:e"} {
+		_, err := ParseForward(spec, false)
+		assert.Error(t, err, spec)
+	}
+}
+
+// echoListener accepts connections and writes back whatever it reads
+func echoListener(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+// testServer runs an SSH server supporting local and remote forwarding and
+// returns a client connected to it.
+func testServer(t *testing.T) *Client {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		nConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range reqs {
+				if req.Type != "tcpip-forward" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct {
+					Addr string
+					Port uint32
+				}
+				ssh.Unmarshal(req.Payload, &payload)
+				fwd, err := net.Listen("tcp", net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port))))
+				if err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				t.Cleanup(func() { fwd.Close() })
+				port := uint32(fwd.Addr().(*net.TCPAddr).Port)
+				req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+				go func() {
+					for {
+						src, err := fwd.Accept()
+						if err != nil {
+							return
+						}
+						ch, chReqs, err := conn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+							Addr       string
+							Port       uint32
+							OriginAddr string
+							OriginPort uint32
+						}{payload.Addr, port, "127.0.0.1", 1234}))
+						if err != nil {
+							src.Close()
+							continue
+						}
+						go ssh.DiscardRequests(chReqs)
+						go func() {
+							defer src.Close()
+							defer ch.Close()
+							go io.Copy(ch, src)
+							io.Copy(src, ch)
+						}()
+					}
+				}()
+			}
+		}()
+
+		for newChannel := range chans {
+			if newChannel.ChannelType() != "direct-tcpip" {
+				newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+			var payload struct {
+				Host       string
+				Port       uint32
+				OriginAddr string
+				OriginPort uint32
+			}
+			ssh.Unmarshal(newChannel.ExtraData(), &payload)
+			dst, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+			if err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, chReqs, err := newChannel.Accept()
+			if err != nil {
+				dst.Close()
+				continue
+			}
+			go ssh.DiscardRequests(chReqs)
+			go func() {
+				defer dst.Close()
+				defer ch.Close()
+				go func() {
+					io.Copy(dst, ch)
+					dst.(*net.TCPConn).CloseWrite()
+				}()
+				io.Copy(ch, dst)
+			}()
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+		User:            "root",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return &Client{Client: client}
+}
+
+func assertEcho(t *testing.T, addr net.Addr) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestForward(t *testing.T) {
+	echo := echoListener(t)
+	_, echoPort, err := net.SplitHostPort(echo.Addr().String())
+	require.NoError(t, err)
+
+	client := testServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	local, err := client.Forward(ctx, Forward{BindAddr: "127.0.0.1", ListenPort: "0", Host: "127.0.0.1", Port: echoPort})
+	require.NoError(t, err)
+	assertEcho(t, local)
+
+	remote, err := client.Forward(ctx, Forward{Remote: true, BindAddr: "127.0.0.1", ListenPort: "0", Host: "127.0.0.1", Port: echoPort})
+	require.NoError(t, err)
+	assertEcho(t, remote)
+
+	// Forwards stop listening once the context is done
+	cancel()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", local.String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -34,6 +34,9 @@ type SessionIO struct {
 
 	AllocPTY bool
 	TermEnv  string
+
+	// Recorder, when set, records the session
+	Recorder *Recorder
 }
 
 func getFd(reader io.Reader) (fd int, ok bool) {
@@ -48,9 +51,9 @@ func getFd(reader io.Reader) (fd int, ok bool) {
 
 func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) error {
 
-	if s.AllocPTY {
-		width, height := DefaultWidth, DefaultHeight
+	width, height := DefaultWidth, DefaultHeight
 
+	if s.AllocPTY {
 		if fd, ok := getFd(s.Stdin); ok {
 			state, err := term.MakeRaw(fd)
 			if err != nil {
@@ -68,6 +71,26 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 		}
 	}
 
+	var (
+		sessStdin            = s.Stdin
+		sessStdout io.Writer = s.Stdout
+		sessStderr io.Writer = s.Stderr
+	)
+	if s.Recorder != nil {
+		if err := s.Recorder.Start(width, height, s.TermEnv); err != nil {
+			return err
+		}
+		if sessStdin != nil {
+			sessStdin = recordingReader{r: sessStdin, recorder: s.Recorder}
+		}
+		if s.Stdout != nil {
+			sessStdout = recordingWriter{w: s.Stdout, recorder: s.Recorder}
+		}
+		if s.Stderr != nil {
+			sessStderr = recordingWriter{w: s.Stderr, recorder: s.Recorder}
+		}
+	}
+
 	var closeStdin sync.Once
 	stdin, err := sess.StdinPipe()
 	if err != nil {
@@ -91,16 +114,16 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 		defer closeStdin.Do(func() {
 			stdin.Close()
 		})
-		if s.Stdin != nil {
-			io.Copy(stdin, s.Stdin)
+		if sessStdin != nil {
+			io.Copy(stdin, sessStdin)
 		}
 	}()
 	if s.Stdout != nil {
-		go io.Copy(s.Stdout, stdout)
+		go io.Copy(sessStdout, stdout)
 	}
 
 	if s.Stderr != nil {
-		go io.Copy(s.Stderr, stderr)
+		go io.Copy(sessStderr, stderr)
 	}
 
 	cmdC := make(chan error, 1)
@@ -123,3 +146,11 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 		return errors.New("session forcibly closed; the remote process may still be running")
 	}
 }
+
+// windowChange tells the remote side the terminal changed size
+func (s *SessionIO) windowChange(sess *ssh.Session, width, height int) error {
+	if s.Recorder != nil {
+		s.Recorder.Resize(width, height)
+	}
+	return sess.WindowChange(height, width)
+}
@@ -26,7 +26,7 @@ func (s *SessionIO) getAndWatchSize(ctx context.Context, sess *ssh.Session) (int
 	}
 
 	go func() {
-		if err := watchWindowSize(ctx, fd, sess); err != nil {
+		if err := s.watchWindowSize(ctx, fd, sess); err != nil {
 			terminal.Debugf("Error watching window size: %s\n", err)
 		}
 	}()
@@ -34,7 +34,7 @@ func (s *SessionIO) getAndWatchSize(ctx context.Context, sess *ssh.Session) (int
 	return width, height, nil
 }
 
-func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session) error {
+func (s *SessionIO) watchWindowSize(ctx context.Context, fd int, sess *ssh.Session) error {
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGWINCH)
 
@@ -50,7 +50,7 @@ func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session) error {
 			return err
 		}
 
-		if err := sess.WindowChange(height, width); err != nil {
+		if err := s.windowChange(sess, width, height); err != nil {
 			return err
 		}
 	}
@@ -23,7 +23,7 @@ func (s *SessionIO) getAndWatchSize(ctx context.Context, sess *ssh.Session) (int
 	}
 
 	go func() {
-		if err := watchWindowSize(ctx, fd, sess, width, height); err != nil {
+		if err := s.watchWindowSize(ctx, fd, sess, width, height); err != nil {
 			terminal.Debugf("Error watching window size: %s\n", err)
 		}
 	}()
@@ -31,7 +31,7 @@ func (s *SessionIO) getAndWatchSize(ctx context.Context, sess *ssh.Session) (int
 	return width, height, nil
 }
 
-func watchWindowSize(ctx context.Context, fd windows.Handle, sess *ssh.Session, width int, height int) error {
+func (s *SessionIO) watchWindowSize(ctx context.Context, fd windows.Handle, sess *ssh.Session, width int, height int) error {
 
 	// NOTE(Ali): Windows doesn't support SIGWINCH. The closest it has is WINDOW_BUFFER_SIZE_EVENT,
 	// which you only seem to be able to receive if *all* of your console input is read with ReadConsoleInput.
@@ -61,7 +61,7 @@ func watchWindowSize(ctx context.Context, fd windows.Handle, sess *ssh.Session,
 		width = newWidth
 		height = newHeight
 
-		if err := sess.WindowChange(height, width); err != nil {
+		if err := s.windowChange(sess, width, height); err != nil {
 			return err
 		}
 	}
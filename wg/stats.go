@@ -0,0 +1,75 @@
+package wg
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TunnelStats is the state of the WireGuard peer at the other end of a tunnel
+type TunnelStats struct {
+	Endpoint      string
+	LastHandshake time.Time
+	RxBytes       int64
+	TxBytes       int64
+}
+
+var errTunnelClosed = errors.New("tunnel is closed")
+
+// Stats reads the peer state from the WireGuard device
+func (t *Tunnel) Stats() (TunnelStats, error) {
+	if t.dev == nil {
+		return TunnelStats{}, errTunnelClosed
+	}
+
+	ipc, err := t.dev.IpcGet()
+	if err != nil {
+		return TunnelStats{}, err
+	}
+
+	return parseStats(ipc), nil
+}
+
+// parseStats reads the peer entries of a WireGuard UAPI get operation, one
+// key=value pair per line. Traffic is summed should there be several peers.
+func parseStats(ipc string) TunnelStats {
+	var (
+		stats         TunnelStats
+		handshakeSec  int64
+		handshakeNsec int64
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(ipc))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "endpoint":
+			stats.Endpoint = value
+		case "last_handshake_time_sec":
+			handshakeSec = atoi64(value)
+		case "last_handshake_time_nsec":
+			handshakeNsec = atoi64(value)
+		case "rx_bytes":
+			stats.RxBytes += atoi64(value)
+		case "tx_bytes":
+			stats.TxBytes += atoi64(value)
+		}
+	}
+
+	if handshakeSec > 0 {
+		stats.LastHandshake = time.Unix(handshakeSec, handshakeNsec)
+	}
+
+	return stats
+}
+
+func atoi64(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
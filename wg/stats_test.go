@@ -0,0 +1,32 @@
+package wg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStats(t *testing.T) {
+	stats := parseStats(`private_key=abcd
+listen_port=0
+public_key=ef01
+endpoint=[2a09:8280:1::a]:51820
+last_handshake_time_sec=1700000000
+last_handshake_time_nsec=500
+rx_bytes=1024
+tx_bytes=2048
+persistent_keepalive_interval=15
+allowed_ip=fdaa::/16
+`)
+
+	assert.Equal(t, TunnelStats{
+		Endpoint:      "[2a09:8280:1::a]:51820",
+		LastHandshake: time.Unix(1700000000, 500),
+		RxBytes:       1024,
+		TxBytes:       2048,
+	}, stats)
+
+	// No handshake yet
+	assert.True(t, parseStats("last_handshake_time_sec=0\nlast_handshake_time_nsec=0\n").LastHandshake.IsZero())
+}
@@ -138,7 +138,7 @@ func (t *Tunnel) LookupTXT(ctx context.Context, name string) ([]string, error) {
 	var m dns.Msg
 	_ = m.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
 
-	r, err := t.queryDNS(ctx, &m)
+	r, err := t.QueryDNS(ctx, &m)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +175,7 @@ func (t *Tunnel) LookupAAAA(ctx context.Context, name string) ([]net.IP, error)
 	var m dns.Msg
 	_ = m.SetQuestion(dns.Fqdn(name), dns.TypeAAAA)
 
-	r, err := t.queryDNS(ctx, &m)
+	r, err := t.QueryDNS(ctx, &m)
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +190,8 @@ func (t *Tunnel) LookupAAAA(ctx context.Context, name string) ([]net.IP, error)
 	return results, nil
 }
 
-func (t *Tunnel) queryDNS(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+// QueryDNS sends msg to the network's DNS server through the tunnel
+func (t *Tunnel) QueryDNS(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
 	client := dns.Client{
 		Net: "tcp",
 		Dialer: &net.Dialer{